@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Propagator receives every change of the broker, in order, as a command that replays it with Apply:
+//
+//	QRESTORE queue id visible-at-ms deliveries reserved body
+//	QREMOVE queue id
+//	QCONFIG queue visibility-timeout-ms max-deliveries dead-letter
+//	QDELETE queue
+//
+// Propagators are called with the broker lock held: they must not block nor call the broker.
+type Propagator func(args []string)
+
+// AddPropagator registers p to receive every subsequent change.
+func (b *Broker) AddPropagator(p Propagator) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.propagators = append(b.propagators, p)
+}
+
+// propagate sends a change to the propagators. Caller must hold mu.
+func (b *Broker) propagate(args ...string) {
+	for _, p := range b.propagators {
+		p(args)
+	}
+}
+
+// propagateMessage propagates the current state of msg. Caller must hold mu.
+func (b *Broker) propagateMessage(name string, msg Message) {
+	b.propagate(messageCommand(name, msg)...)
+}
+
+func messageCommand(name string, msg Message) []string {
+	reserved := "0"
+	if msg.Reserved {
+		reserved = "1"
+	}
+	return []string{"QRESTORE", name, msg.ID, strconv.FormatInt(msg.VisibleAt.UnixMilli(), 10),
+		strconv.Itoa(msg.Deliveries), reserved, msg.Body}
+}
+
+// Snapshot returns the commands recreating the broker. When barrier is not nil, it is called while the
+// broker is locked: changes propagated after barrier returns are exactly the changes missing from the snapshot.
+func (b *Broker) Snapshot(barrier func()) [][]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names := make([]string, 0, len(b.queues))
+	for name := range b.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var commands [][]string
+	for _, name := range names {
+		q := b.queues[name]
+		if o := q.options; o != nil {
+			commands = append(commands, []string{"QCONFIG", name, strconv.FormatInt(o.VisibilityTimeout.Milliseconds(), 10),
+				strconv.Itoa(o.MaxDeliveries), o.DeadLetter})
+		}
+		items := append(messageHeap(nil), q.messages...)
+		sort.Slice(items, items.Less)
+		for _, it := range items {
+			commands = append(commands, messageCommand(name, it.msg))
+		}
+	}
+	if barrier != nil {
+		barrier()
+	}
+	return commands
+}
+
+// Apply replays a command produced by a Propagator.
+func (b *Broker) Apply(args []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	switch name := strings.ToUpper(args[0]); {
+	case name == "QRESTORE" && len(args) == 7:
+		ms, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid visibility time %q", args[3])
+		}
+		deliveries, err := strconv.Atoi(args[4])
+		if err != nil || deliveries < 0 {
+			return fmt.Errorf("invalid delivery count %q", args[4])
+		}
+		if _, err := strconv.ParseUint(args[2], 10, 64); err != nil {
+			return fmt.Errorf("invalid message ID %q", args[2])
+		}
+		b.store(args[1], Message{ID: args[2], Body: args[6], Deliveries: deliveries,
+			VisibleAt: time.UnixMilli(ms), Reserved: args[5] == "1"})
+	case name == "QREMOVE" && len(args) == 3:
+		b.unstore(args[1], args[2])
+	case name == "QCONFIG" && len(args) == 5:
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || ms < 0 {
+			return fmt.Errorf("invalid visibility timeout %q", args[2])
+		}
+		maxDeliveries, err := strconv.Atoi(args[3])
+		if err != nil || maxDeliveries < 0 {
+			return fmt.Errorf("invalid max deliveries %q", args[3])
+		}
+		b.configure(args[1], Options{VisibilityTimeout: time.Duration(ms) * time.Millisecond, MaxDeliveries: maxDeliveries, DeadLetter: args[4]})
+	case name == "QDELETE" && len(args) == 2:
+		delete(b.queues, args[1])
+	default:
+		return fmt.Errorf("unknown command %q with %d arguments", args[0], len(args)-1)
+	}
+
+	b.propagate(args...)
+	return nil
+}
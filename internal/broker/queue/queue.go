@@ -1,2 +1,415 @@
+// Package queue implements named work queues. Messages are enqueued, possibly with a delay, then
+// reserved by consumers: a reserved message stays invisible to other consumers for a visibility
+// timeout, and is delivered again once it expires unless the consumer acknowledges it. A message
+// delivered too many times is moved to a dead-letter queue.
 package queue
 
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultVisibilityTimeout is the visibility timeout of queues created without one.
+	DefaultVisibilityTimeout = 30 * time.Second
+	// deadLetterSuffix names the dead-letter queue of a queue created without one.
+	deadLetterSuffix = ":dead"
+)
+
+var (
+	// ErrNotFound is returned for a message that is not in the queue.
+	ErrNotFound = errors.New("no such message")
+	// ErrNotReserved is returned when acknowledging a message that is not reserved.
+	ErrNotReserved = errors.New("message is not reserved")
+	// ErrStaleReceipt is returned when acknowledging a message with the receipt of a reservation that
+	// expired, the message being visible or delivered again.
+	ErrStaleReceipt = errors.New("reservation expired")
+	// ErrInvalidOptions is returned by Configure for negative timeouts or delivery counts.
+	ErrInvalidOptions = errors.New("invalid queue options")
+)
+
+// Options configure a queue.
+type Options struct {
+	// VisibilityTimeout is how long a reserved message stays invisible to other consumers before it is
+	// delivered again, unless it is acknowledged.
+	VisibilityTimeout time.Duration
+	// MaxDeliveries is the number of deliveries after which a message is moved to the dead-letter queue
+	// instead of being delivered again. Zero means no limit.
+	MaxDeliveries int
+	// DeadLetter is the name of the dead-letter queue, by default the name of the queue followed by ":dead".
+	DeadLetter string
+}
+
+// Message is a message of a queue.
+type Message struct {
+	ID   string
+	Body string
+	// Deliveries is the number of times the message was reserved.
+	Deliveries int
+	// VisibleAt is when the message can be reserved: the end of its delay, or the end of its
+	// visibility timeout when it is reserved.
+	VisibleAt time.Time
+	// Reserved is set while a consumer holds the message, until its visibility timeout expires.
+	Reserved bool
+}
+
+// Receipt identifies the delivery of a reserved message, for its consumer to Ack or Nack it. The
+// receipt is stale once the visibility timeout of the delivery expired.
+func (m Message) Receipt() string {
+	return m.ID + "-" + strconv.Itoa(m.Deliveries)
+}
+
+// Stats counts the messages of a queue by state.
+type Stats struct {
+	Ready    int
+	Delayed  int
+	Reserved int
+}
+
+// Broker holds named queues, created on first use.
+type Broker struct {
+	mu       sync.Mutex
+	queues   map[string]*queue
+	defaults Options
+	// lastID is the last message ID given, IDs being increasing integers
+	lastID      uint64
+	propagators []Propagator
+}
+
+// queue holds the messages of a queue, ordered by the time they become visible, then by ID.
+type queue struct {
+	// options is nil for queues using the defaults of the broker
+	options  *Options
+	messages messageHeap
+	byID     map[string]*item
+}
+
+type item struct {
+	msg Message
+	// seq is the numeric value of the ID, which orders messages visible at the same time
+	seq   uint64
+	index int
+}
+
+// NewBroker returns a Broker whose queues use defaults unless configured otherwise.
+func NewBroker(defaults Options) *Broker {
+	if defaults.VisibilityTimeout <= 0 {
+		defaults.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+	return &Broker{queues: make(map[string]*queue), defaults: defaults}
+}
+
+// Enqueue adds a message to the named queue, to be delivered once delay elapsed, and returns its ID.
+func (b *Broker) Enqueue(name, body string, delay time.Duration) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	msg := Message{ID: strconv.FormatUint(b.lastID, 10), Body: body, VisibleAt: time.Now().Add(max(delay, 0))}
+	b.put(name, msg)
+	return msg.ID
+}
+
+// Reserve returns the next visible message of the named queue, which stays invisible for timeout, or the
+// visibility timeout of the queue when timeout is zero. It returns false when no message is visible.
+// Messages that reached the maximum number of deliveries are moved to the dead-letter queue on the way.
+func (b *Broker) Reserve(name string, timeout time.Duration) (Message, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q := b.queues[name]
+	if q == nil {
+		return Message{}, false
+	}
+	options := b.options(name)
+	if timeout <= 0 {
+		timeout = options.VisibilityTimeout
+	}
+
+	now := time.Now()
+	for q.messages.Len() > 0 {
+		it := q.messages[0]
+		if it.msg.VisibleAt.After(now) {
+			break
+		}
+		if options.MaxDeliveries > 0 && it.msg.Deliveries >= options.MaxDeliveries {
+			b.deadLetter(name, it.msg, options)
+			continue
+		}
+		it.msg.Deliveries++
+		it.msg.Reserved = true
+		it.msg.VisibleAt = now.Add(timeout)
+		heap.Fix(&q.messages, it.index)
+		b.propagateMessage(name, it.msg)
+		return it.msg, true
+	}
+	return Message{}, false
+}
+
+// Ack removes a reserved message once its consumer processed it, given the receipt of its delivery.
+func (b *Broker) Ack(name, receipt string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	it, err := b.reserved(name, receipt)
+	if err != nil {
+		return err
+	}
+	b.remove(name, it.msg.ID)
+	return nil
+}
+
+// Nack gives a reserved message back to the named queue, given the receipt of its delivery, to be
+// delivered again once delay elapsed, or moves it to the dead-letter queue when it reached the maximum
+// number of deliveries.
+func (b *Broker) Nack(name, receipt string, delay time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	it, err := b.reserved(name, receipt)
+	if err != nil {
+		return err
+	}
+	options := b.options(name)
+	if options.MaxDeliveries > 0 && it.msg.Deliveries >= options.MaxDeliveries {
+		b.deadLetter(name, it.msg, options)
+		return nil
+	}
+	msg := it.msg
+	msg.Reserved = false
+	msg.VisibleAt = time.Now().Add(max(delay, 0))
+	b.put(name, msg)
+	return nil
+}
+
+// Configure sets the options of the named queue. Zero values select the defaults of the broker.
+func (b *Broker) Configure(name string, options Options) error {
+	if options.VisibilityTimeout < 0 || options.MaxDeliveries < 0 {
+		return ErrInvalidOptions
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.configure(name, options)
+	b.propagate("QCONFIG", name, strconv.FormatInt(options.VisibilityTimeout.Milliseconds(), 10),
+		strconv.Itoa(options.MaxDeliveries), options.DeadLetter)
+	return nil
+}
+
+// Options returns the options in effect for the named queue.
+func (b *Broker) Options(name string) Options {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.options(name)
+}
+
+// Stats counts the messages of the named queue by state.
+func (b *Broker) Stats(name string) Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var stats Stats
+	q := b.queues[name]
+	if q == nil {
+		return stats
+	}
+	now := time.Now()
+	for _, it := range q.messages {
+		switch {
+		case !it.msg.VisibleAt.After(now):
+			stats.Ready++
+		case it.msg.Reserved:
+			stats.Reserved++
+		default:
+			stats.Delayed++
+		}
+	}
+	return stats
+}
+
+// Delete removes the named queue along with its messages and options. It returns false when there was no such queue.
+func (b *Broker) Delete(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.queues[name]; !ok {
+		return false
+	}
+	delete(b.queues, name)
+	b.propagate("QDELETE", name)
+	return true
+}
+
+// Queues returns the names of the queues holding messages or options, sorted.
+func (b *Broker) Queues() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names := make([]string, 0, len(b.queues))
+	for name := range b.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// options returns the options in effect for the named queue. Caller must hold mu.
+func (b *Broker) options(name string) Options {
+	options := b.defaults
+	if q := b.queues[name]; q != nil && q.options != nil {
+		if q.options.VisibilityTimeout > 0 {
+			options.VisibilityTimeout = q.options.VisibilityTimeout
+		}
+		if q.options.MaxDeliveries > 0 {
+			options.MaxDeliveries = q.options.MaxDeliveries
+		}
+		if q.options.DeadLetter != "" {
+			options.DeadLetter = q.options.DeadLetter
+		}
+	}
+	if options.DeadLetter == "" {
+		options.DeadLetter = name + deadLetterSuffix
+	}
+	return options
+}
+
+// reserved returns the message of the named queue delivered with receipt, whose reservation must not
+// have expired. Caller must hold mu.
+func (b *Broker) reserved(name, receipt string) (*item, error) {
+	id, deliveries, ok := parseReceipt(receipt)
+	q := b.queues[name]
+	if !ok || q == nil || q.byID[id] == nil {
+		return nil, ErrNotFound
+	}
+	it := q.byID[id]
+	if !it.msg.Reserved {
+		return nil, ErrNotReserved
+	}
+	// Once expired, the message may be delivered to another consumer at any time
+	if it.msg.Deliveries != deliveries || !it.msg.VisibleAt.After(time.Now()) {
+		return nil, ErrStaleReceipt
+	}
+	return it, nil
+}
+
+// parseReceipt returns the ID and delivery count of receipt, false when it is malformed.
+func parseReceipt(receipt string) (string, int, bool) {
+	i := strings.LastIndexByte(receipt, '-')
+	if i < 0 {
+		return "", 0, false
+	}
+	deliveries, err := strconv.Atoi(receipt[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return receipt[:i], deliveries, true
+}
+
+// queue returns the named queue, creating it when needed. Caller must hold mu.
+func (b *Broker) queue(name string) *queue {
+	q := b.queues[name]
+	if q == nil {
+		q = &queue{byID: make(map[string]*item)}
+		b.queues[name] = q
+	}
+	return q
+}
+
+// put adds msg to the named queue, or replaces the message with the same ID. Caller must hold mu.
+func (b *Broker) put(name string, msg Message) {
+	b.store(name, msg)
+	b.propagateMessage(name, msg)
+}
+
+// store is put without propagation. Caller must hold mu.
+func (b *Broker) store(name string, msg Message) {
+	q := b.queue(name)
+	if it := q.byID[msg.ID]; it != nil {
+		it.msg = msg
+		heap.Fix(&q.messages, it.index)
+		return
+	}
+	seq, _ := strconv.ParseUint(msg.ID, 10, 64)
+	b.lastID = max(b.lastID, seq)
+	it := &item{msg: msg, seq: seq}
+	heap.Push(&q.messages, it)
+	q.byID[msg.ID] = it
+}
+
+// remove deletes the message id from the named queue, and the queue once it is empty and not configured.
+// Caller must hold mu.
+func (b *Broker) remove(name, id string) {
+	b.unstore(name, id)
+	b.propagate("QREMOVE", name, id)
+}
+
+// unstore is remove without propagation. Caller must hold mu.
+func (b *Broker) unstore(name, id string) {
+	q := b.queues[name]
+	if q == nil || q.byID[id] == nil {
+		return
+	}
+	heap.Remove(&q.messages, q.byID[id].index)
+	delete(q.byID, id)
+	if len(q.byID) == 0 && q.options == nil {
+		delete(b.queues, name)
+	}
+}
+
+// configure sets the options of the named queue without propagation. Caller must hold mu.
+func (b *Broker) configure(name string, options Options) {
+	q := b.queue(name)
+	if options == (Options{}) {
+		q.options = nil
+		if len(q.byID) == 0 {
+			delete(b.queues, name)
+		}
+		return
+	}
+	q.options = &options
+}
+
+// deadLetter moves msg from the named queue to its dead-letter queue, where it can be delivered
+// MaxDeliveries times again. Caller must hold mu.
+func (b *Broker) deadLetter(name string, msg Message, options Options) {
+	b.remove(name, msg.ID)
+	msg.Deliveries, msg.Reserved, msg.VisibleAt = 0, false, time.Now()
+	b.put(options.DeadLetter, msg)
+}
+
+// messageHeap orders messages by the time they become visible, then by ID. It implements heap.Interface.
+type messageHeap []*item
+
+func (h messageHeap) Len() int { return len(h) }
+
+func (h messageHeap) Less(i, j int) bool {
+	if !h[i].msg.VisibleAt.Equal(h[j].msg.VisibleAt) {
+		return h[i].msg.VisibleAt.Before(h[j].msg.VisibleAt)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h messageHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *messageHeap) Push(x any) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *messageHeap) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return it
+}
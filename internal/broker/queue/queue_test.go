@@ -0,0 +1,187 @@
+package queue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+)
+
+func TestBroker_ReserveAck(t *testing.T) {
+	b := queue.NewBroker(queue.Options{})
+	first := b.Enqueue("jobs", "a", 0)
+	second := b.Enqueue("jobs", "b", 0)
+
+	msg, ok := b.Reserve("jobs", 0)
+	if !ok || msg.ID != first || msg.Body != "a" || msg.Deliveries != 1 {
+		t.Fatalf("Expected the first message on its first delivery, got %+v, %v", msg, ok)
+	}
+	if msg, _ := b.Reserve("jobs", 0); msg.ID != second {
+		t.Errorf("Expected the reserved message to be skipped, got %+v", msg)
+	}
+	if _, ok := b.Reserve("jobs", 0); ok {
+		t.Error("Expected no visible message left")
+	}
+
+	if err := b.Ack("jobs", msg.Receipt()); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := b.Ack("jobs", msg.Receipt()); err != queue.ErrNotFound {
+		t.Errorf("Expected ErrNotFound for an acknowledged message, got %v", err)
+	}
+	if stats := b.Stats("jobs"); stats.Reserved != 1 || stats.Ready != 0 {
+		t.Errorf("Expected 1 reserved message, got %+v", stats)
+	}
+}
+
+func TestBroker_VisibilityTimeout(t *testing.T) {
+	b := queue.NewBroker(queue.Options{})
+	id := b.Enqueue("jobs", "a", 0)
+
+	expired, _ := b.Reserve("jobs", 20*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Ack("jobs", expired.Receipt()); err != queue.ErrStaleReceipt {
+		t.Errorf("Expected ErrStaleReceipt once the reservation expired, got %v", err)
+	}
+
+	msg, ok := b.Reserve("jobs", 0)
+	if !ok || msg.ID != id || msg.Deliveries != 2 {
+		t.Fatalf("Expected the message to be delivered again once its reservation expired, got %+v, %v", msg, ok)
+	}
+	// The consumer of the earlier delivery can no longer acknowledge the message
+	if err := b.Ack("jobs", expired.Receipt()); err != queue.ErrStaleReceipt {
+		t.Errorf("Expected ErrStaleReceipt for an earlier delivery, got %v", err)
+	}
+	if err := b.Nack("jobs", expired.Receipt(), 0); err != queue.ErrStaleReceipt {
+		t.Errorf("Expected ErrStaleReceipt for an earlier delivery, got %v", err)
+	}
+	if err := b.Ack("jobs", msg.Receipt()); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestBroker_DelayedDelivery(t *testing.T) {
+	b := queue.NewBroker(queue.Options{})
+	b.Enqueue("jobs", "later", 30*time.Millisecond)
+
+	if _, ok := b.Reserve("jobs", 0); ok {
+		t.Error("Expected a delayed message to be invisible")
+	}
+	if stats := b.Stats("jobs"); stats.Delayed != 1 {
+		t.Errorf("Expected 1 delayed message, got %+v", stats)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if msg, ok := b.Reserve("jobs", 0); !ok || msg.Body != "later" {
+		t.Errorf("Expected the message once its delay elapsed, got %+v, %v", msg, ok)
+	}
+}
+
+func TestBroker_NackAndDeadLetter(t *testing.T) {
+	b := queue.NewBroker(queue.Options{MaxDeliveries: 2})
+	id := b.Enqueue("jobs", "poison", 0)
+
+	if err := b.Nack("jobs", id+"-0", 0); err != queue.ErrNotReserved {
+		t.Errorf("Expected ErrNotReserved for a message that is not reserved, got %v", err)
+	}
+
+	msg, _ := b.Reserve("jobs", 0)
+	if err := b.Nack("jobs", msg.Receipt(), 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	msg, ok := b.Reserve("jobs", 0)
+	if !ok || msg.Deliveries != 2 {
+		t.Fatalf("Expected the requeued message on its second delivery, got %+v, %v", msg, ok)
+	}
+	b.Nack("jobs", msg.Receipt(), 0)
+
+	if _, ok := b.Reserve("jobs", 0); ok {
+		t.Error("Expected a message delivered MaxDeliveries times not to be delivered again")
+	}
+	msg, ok = b.Reserve("jobs:dead", 0)
+	if !ok || msg.ID != id || msg.Body != "poison" {
+		t.Errorf("Expected the message in the dead-letter queue, got %+v, %v", msg, ok)
+	}
+}
+
+func TestBroker_Configure(t *testing.T) {
+	b := queue.NewBroker(queue.Options{})
+	if err := b.Configure("jobs", queue.Options{MaxDeliveries: 1, DeadLetter: "failed"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := b.Configure("jobs", queue.Options{MaxDeliveries: -1}); err != queue.ErrInvalidOptions {
+		t.Errorf("Expected ErrInvalidOptions, got %v", err)
+	}
+
+	options := b.Options("jobs")
+	if options.VisibilityTimeout != queue.DefaultVisibilityTimeout || options.MaxDeliveries != 1 || options.DeadLetter != "failed" {
+		t.Errorf("Expected the configured options over the defaults, got %+v", options)
+	}
+
+	id := b.Enqueue("jobs", "a", 0)
+	b.Reserve("jobs", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := b.Reserve("jobs", 0); ok {
+		t.Error("Expected the message to be dead-lettered on its second delivery")
+	}
+	if msg, ok := b.Reserve("failed", 0); !ok || msg.ID != id {
+		t.Errorf("Expected the message in the configured dead-letter queue, got %+v, %v", msg, ok)
+	}
+}
+
+func TestBroker_ApplyReplaysChanges(t *testing.T) {
+	b := queue.NewBroker(queue.Options{})
+	replica := queue.NewBroker(queue.Options{})
+	b.AddPropagator(func(args []string) {
+		if err := replica.Apply(args); err != nil {
+			t.Errorf("Expected no error applying %q, got %v", args, err)
+		}
+	})
+
+	b.Configure("jobs", queue.Options{MaxDeliveries: 3})
+	b.Enqueue("jobs", "a", 0)
+	reserved := b.Enqueue("jobs", "b", 0)
+	b.Enqueue("jobs", "c", time.Hour)
+	acked, _ := b.Reserve("jobs", 0)
+	b.Ack("jobs", acked.Receipt())
+	msg, _ := b.Reserve("jobs", 0)
+
+	if stats := replica.Stats("jobs"); stats != (queue.Stats{Delayed: 1, Reserved: 1}) {
+		t.Errorf("Expected 1 delayed and 1 reserved message, got %+v", stats)
+	}
+	if err := replica.Ack("jobs", msg.Receipt()); err != nil {
+		t.Errorf("Expected the reservation to be replayed, got %v", err)
+	}
+	if options := replica.Options("jobs"); options.MaxDeliveries != 3 {
+		t.Errorf("Expected the options to be replayed, got %+v", options)
+	}
+
+	// IDs keep increasing after a replay
+	if id := replica.Enqueue("jobs", "d", 0); id <= reserved && len(id) <= len(reserved) {
+		t.Errorf("Expected a new ID after %s, got %s", reserved, id)
+	}
+}
+
+func TestBroker_Snapshot(t *testing.T) {
+	b := queue.NewBroker(queue.Options{})
+	b.Configure("jobs", queue.Options{DeadLetter: "failed"})
+	first := b.Enqueue("jobs", "a", 0)
+	b.Enqueue("jobs", "b", 0)
+	b.Enqueue("other", "c", 0)
+
+	restored := queue.NewBroker(queue.Options{})
+	for _, args := range b.Snapshot(nil) {
+		if err := restored.Apply(args); err != nil {
+			t.Fatalf("Expected no error applying %q, got %v", args, err)
+		}
+	}
+
+	if names := restored.Queues(); len(names) != 2 || names[0] != "jobs" || names[1] != "other" {
+		t.Errorf("Expected the queues jobs and other, got %v", names)
+	}
+	if msg, _ := restored.Reserve("jobs", 0); msg.ID != first {
+		t.Errorf("Expected the order of the messages to be kept, got %+v", msg)
+	}
+	if options := restored.Options("jobs"); options.DeadLetter != "failed" {
+		t.Errorf("Expected the options to be restored, got %+v", options)
+	}
+}
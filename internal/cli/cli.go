@@ -8,10 +8,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
 	"github.com/AbdessamadEnabih/Vertex/internal/cli/commands"
-	"github.com/AbdessamadEnabih/Vertex/pkg/persistence"
 	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
 	logger "github.com/AbdessamadEnabih/Vertex/pkg/logger"
+	"github.com/AbdessamadEnabih/Vertex/pkg/persistence"
 	"github.com/c-bata/go-prompt"
 	"github.com/spf13/cobra"
 )
@@ -26,19 +27,84 @@ var rootCmd = &cobra.Command{
 // key-value pairs in memory.
 var GlobalDataStore *datastore.DataStore
 
+// GlobalBroker holds the work queues of the application, and queueLog persists their changes.
+var (
+	GlobalBroker *queue.Broker
+	queueLog     *persistence.AOF
+)
+
+// appendOnly logs the writes of the global datastore when append_only is enabled, since the
+// append-only file rather than the snapshot is loaded then.
+var appendOnly *persistence.AOF
+
 // refreshInterval is the interval at which the global datastore is refreshed from persistence.
 const refreshInterval = 60 * time.Second
 
 // init initializes the CLI by loading the global datastore and adding the commands to the root command.
 func init() {
-	GlobalDataStore, _ = persistence.Load()
+	var err error
+	GlobalDataStore, err = persistence.Load()
+	if err != nil {
+		// Starting with an empty datastore would overwrite the persisted data on exit
+		fmt.Println("Error while loading datastore:", err)
+		os.Exit(1)
+	}
+	if err := GlobalDataStore.ApplyConfig(); err != nil {
+		// Running without the configured limits could exhaust the memory
+		fmt.Println("Invalid store configuration:", err)
+		os.Exit(1)
+	}
+	if appendOnly, err = persistence.StartAppendOnly(GlobalDataStore); err != nil {
+		fmt.Println("Error while opening append only file:", err)
+		os.Exit(1)
+	}
+	if GlobalBroker, err = persistence.LoadQueues(); err != nil {
+		fmt.Println("Error while loading queues:", err)
+		os.Exit(1)
+	}
+	if queueLog, err = persistence.StartQueueLog(GlobalBroker); err != nil {
+		fmt.Println("Error while opening queue log:", err)
+		os.Exit(1)
+	}
 	rootCmd.AddCommand(
 		commands.NewGetAllCmd(GlobalDataStore),
 		commands.NewGetCmd(GlobalDataStore),
 		commands.NewSetCmd(GlobalDataStore),
 		commands.NewUpdateCmd(GlobalDataStore),
+		commands.NewSetNXCmd(GlobalDataStore),
+		commands.NewGetSetCmd(GlobalDataStore),
+		commands.NewGetDelCmd(GlobalDataStore),
+		commands.NewMGetCmd(GlobalDataStore),
+		commands.NewMSetCmd(GlobalDataStore),
+		commands.NewMSetNXCmd(GlobalDataStore),
+		commands.NewGetVerCmd(GlobalDataStore),
+		commands.NewCASCmd(GlobalDataStore),
+		commands.NewIncrCmd(GlobalDataStore),
+		commands.NewDecrCmd(GlobalDataStore),
+		commands.NewIncrByCmd(GlobalDataStore),
+		commands.NewDecrByCmd(GlobalDataStore),
+		commands.NewIncrByFloatCmd(GlobalDataStore),
 		commands.NewDeleteCmd(GlobalDataStore),
 		commands.NewFlushCmd(GlobalDataStore),
+		commands.NewExpireCmd(GlobalDataStore),
+		commands.NewPExpireCmd(GlobalDataStore),
+		commands.NewTTLCmd(GlobalDataStore),
+		commands.NewPTTLCmd(GlobalDataStore),
+		commands.NewPersistCmd(GlobalDataStore),
+		commands.NewHSetCmd(GlobalDataStore),
+		commands.NewHGetCmd(GlobalDataStore),
+		commands.NewHMGetCmd(GlobalDataStore),
+		commands.NewHGetAllCmd(GlobalDataStore),
+		commands.NewHDelCmd(GlobalDataStore),
+		commands.NewHIncrByCmd(GlobalDataStore),
+		commands.NewHExistsCmd(GlobalDataStore),
+		commands.NewHLenCmd(GlobalDataStore),
+		commands.NewHScanCmd(GlobalDataStore),
+		commands.NewQPushCmd(GlobalBroker),
+		commands.NewQReserveCmd(GlobalBroker),
+		commands.NewQAckCmd(GlobalBroker),
+		commands.NewQNackCmd(GlobalBroker),
+		commands.NewQInfoCmd(GlobalBroker),
 	)
 }
 
@@ -76,7 +142,7 @@ func executor(input string) {
 
 	if input == "exit" {
 		fmt.Println("\nExiting Vertex...")
-		persistence.Save(GlobalDataStore)
+		persist()
 		os.Exit(0)
 	}
 
@@ -96,6 +162,10 @@ func Execute(GlobalDataStore *datastore.DataStore) {
 	// Start a goroutine to periodically refresh the global datastore.
 	go refreshDataStore()
 
+	// Actively delete expired keys while the prompt is running.
+	stopExpiration := GlobalDataStore.StartExpirationCycle()
+	defer stopExpiration()
+
 	// Start the prompt
 	p := prompt.New(
 		executor,
@@ -112,6 +182,17 @@ func Execute(GlobalDataStore *datastore.DataStore) {
 	p.Run()
 }
 
+// persist saves the datastore and flushes the append-only file and the queue log before exiting.
+func persist() {
+	persistence.Save(GlobalDataStore)
+	if appendOnly != nil {
+		appendOnly.Close()
+	}
+	if queueLog != nil {
+		queueLog.Close()
+	}
+}
+
 // The `refreshDataStore` function periodically loads and updates the global datastore from persistence.
 func refreshDataStore() {
 	ticker := time.NewTicker(refreshInterval)
@@ -122,6 +203,9 @@ func refreshDataStore() {
 		if err != nil {
 			logger.Log("Error while loading datastore: "+err.Error(), "ERROR")
 		} else {
+			if err := datastore.ApplyConfig(); err != nil {
+				logger.Log("Error while applying store configuration: "+err.Error(), "ERROR")
+			}
 			GlobalDataStore = datastore
 		}
 	}
@@ -135,7 +219,7 @@ func main() {
 
 	go func() {
 		<-c
-		persistence.Save(GlobalDataStore)
+		persist()
 		os.Exit(1)
 	}()
 
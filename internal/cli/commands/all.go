@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
 	"github.com/spf13/cobra"
@@ -9,12 +10,39 @@ import (
 
 func NewGetAllCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
 	return &cobra.Command{
-		Use: 	 "all",
-		Short:   "Get all keys",
-		Example: `all`,
+		Use:       "all",
+		Short:     "Get all keys, a page at a time",
+		Example:   `all [cursor] [count]`,
+		ValidArgs: []string{"cursor", "count"},
+		Args:      cobra.MaximumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
-			values := globaleDataStore.GetAll()
-			fmt.Println("All keys:", values)
+			var cursor uint64
+			var err error
+			if len(args) >= 1 {
+				if cursor, err = strconv.ParseUint(args[0], 10, 64); err != nil {
+					fmt.Printf("Invalid cursor %s\n", args[0])
+					return
+				}
+			}
+			count := 10
+			if len(args) == 2 {
+				if count, err = strconv.Atoi(args[1]); err != nil || count < 1 {
+					fmt.Printf("Invalid count %s, expected a positive integer\n", args[1])
+					return
+				}
+			}
+			next, keys := globaleDataStore.Scan(cursor, count)
+			for _, key := range keys {
+				// Values other than strings, such as lists, are only shown by type
+				if value, err := globaleDataStore.Get(key); err == nil {
+					fmt.Printf("%s: %v\n", key, value)
+				} else if valueType := globaleDataStore.Type(key); valueType != "none" {
+					fmt.Printf("%s: (%s)\n", key, valueType)
+				}
+			}
+			if next != 0 {
+				fmt.Println("Next cursor:", next)
+			}
 		},
 	}
 }
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewCASCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "cas",
+		Short:     "Set a key-value pair only if the key is still at the version returned by getver",
+		Example:   `cas key expected-version value [EX seconds|PX milliseconds]`,
+		ValidArgs: []string{"key", "expected-version", "value"},
+		Args:      cobra.MatchAll(cobra.RangeArgs(3, 5), validateCASOptions),
+		Run: func(cmd *cobra.Command, args []string) {
+			version, _ := strconv.ParseUint(args[1], 10, 64)
+			var ttl time.Duration
+			if len(args) == 5 {
+				ttl, _ = parseTTLOption(args[3], args[4])
+			}
+			version, err := globaleDataStore.CompareAndSwap(args[0], version, args[2], ttl)
+			if err != nil {
+				fmt.Printf("Unable to set the key %v: %v\n", args[0], err)
+				return
+			}
+			fmt.Println("Version:", version)
+		},
+	}
+}
+
+// validateCASOptions checks the expected version and the optional EX/PX arguments of the cas command.
+func validateCASOptions(cmd *cobra.Command, args []string) error {
+	if _, err := strconv.ParseUint(args[1], 10, 64); err != nil {
+		return fmt.Errorf("invalid version %s, expected a version returned by getver or 0", args[1])
+	}
+	return validateSetOptions(cmd, args[1:])
+}
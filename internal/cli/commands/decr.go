@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewDecrCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "decr",
+		Short:     "Decrement the integer held by a key by one",
+		Example:   `decr key`,
+		ValidArgs: []string{"key"},
+		Args:      cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			value, err := globaleDataStore.IncrBy(args[0], -1)
+			if err != nil {
+				fmt.Printf("Unable to decrement %v: %v\n", args[0], err)
+				return
+			}
+			fmt.Println("Value:", value)
+		},
+	}
+}
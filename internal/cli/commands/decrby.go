@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewDecrByCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "decrby",
+		Short:     "Decrement the integer held by a key",
+		Example:   `decrby key decrement`,
+		ValidArgs: []string{"key", "decrement"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			decrement, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil || decrement == math.MinInt64 {
+				fmt.Printf("Invalid decrement %s, expected an integer\n", args[1])
+				return
+			}
+			value, err := globaleDataStore.IncrBy(args[0], -decrement)
+			if err != nil {
+				fmt.Printf("Unable to decrement %v: %v\n", args[0], err)
+				return
+			}
+			fmt.Println("Value:", value)
+		},
+	}
+}
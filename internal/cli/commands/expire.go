@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewExpireCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "expire",
+		Short:     "Set a key's time to live in seconds",
+		Example:   `expire key seconds`,
+		ValidArgs: []string{"key", "seconds"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			runExpire(globaleDataStore, args, time.Second)
+		},
+	}
+}
+
+// runExpire applies the time to live given in args[1], expressed in unit, to the key in args[0].
+func runExpire(globaleDataStore *datastore.DataStore, args []string, unit time.Duration) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		fmt.Printf("Invalid time to live %v: value is not an integer\n", args[1])
+		return
+	}
+	if err := globaleDataStore.Expire(args[0], time.Duration(n)*unit); err != nil {
+		fmt.Printf("Unable to set the expire of key %v: %v\n", args[0], err)
+	}
+}
@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewGetDelCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "getdel",
+		Short:     "Get a key-value pair and delete it",
+		Example:   `getdel key`,
+		ValidArgs: []string{"key"},
+		Args:      cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			value, err := globaleDataStore.GetDel(args[0])
+			if err != nil {
+				fmt.Printf("Unable to get the key %v: %v\n", args[0], err)
+			} else {
+				fmt.Println("Value:", value)
+			}
+		},
+	}
+}
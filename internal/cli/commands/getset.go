@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewGetSetCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "getset",
+		Short:     "Set a key-value pair and get the value it replaced",
+		Example:   `getset key value`,
+		ValidArgs: []string{"key", "value"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			old, _, err := globaleDataStore.SetWithOptions(args[0], args[1], datastore.SetOptions{Get: true})
+			switch {
+			case err != nil:
+				fmt.Printf("Unable to set the key %v: %v\n", args[0], err)
+			case old == nil:
+				fmt.Println("No previous value")
+			default:
+				fmt.Println("Previous value:", old)
+			}
+		},
+	}
+}
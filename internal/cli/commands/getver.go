@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewGetVerCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "getver",
+		Short:     "Get a key-value pair along with its version, for cas",
+		Example:   `getver key`,
+		ValidArgs: []string{"key"},
+		Args:      cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			value, version, err := globaleDataStore.GetVersion(args[0])
+			if err != nil {
+				fmt.Printf("Unable to get the key %v: %v\n", args[0], err)
+			} else {
+				fmt.Println("Value:", value)
+				fmt.Println("Version:", version)
+			}
+		},
+	}
+}
@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewHDelCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "hdel",
+		Short:     "Delete fields of a hash",
+		Example:   `hdel key field [field ...]`,
+		ValidArgs: []string{"key", "field"},
+		Args:      cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			removed, err := globaleDataStore.HDel(args[0], args[1:]...)
+			if err != nil {
+				fmt.Printf("Failed to delete the fields of %v: %v\n", args[0], err)
+				return
+			}
+			fmt.Println("Fields removed:", removed)
+		},
+	}
+}
@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewHExistsCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "hexists",
+		Short:     "Check whether a field of a hash exists",
+		Example:   `hexists key field`,
+		ValidArgs: []string{"key", "field"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			exists, err := globaleDataStore.HExists(args[0], args[1])
+			if err != nil {
+				fmt.Printf("Unable to check the field %v of %v: %v\n", args[1], args[0], err)
+				return
+			}
+			fmt.Println("Exists:", exists)
+		},
+	}
+}
@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewHGetCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "hget",
+		Short:     "Get a field of a hash",
+		Example:   `hget key field`,
+		ValidArgs: []string{"key", "field"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			value, ok, err := globaleDataStore.HGet(args[0], args[1])
+			switch {
+			case err != nil:
+				fmt.Printf("Unable to get the field %v of %v: %v\n", args[1], args[0], err)
+			case !ok:
+				fmt.Printf("Field %v of %v not found\n", args[1], args[0])
+			default:
+				fmt.Println("Value:", value)
+			}
+		},
+	}
+}
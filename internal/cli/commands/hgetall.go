@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewHGetAllCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "hgetall",
+		Short:     "Get all the fields of a hash",
+		Example:   `hgetall key`,
+		ValidArgs: []string{"key"},
+		Args:      cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			fields, err := globaleDataStore.HGetAll(args[0])
+			if err != nil {
+				fmt.Printf("Unable to get the fields of %v: %v\n", args[0], err)
+				return
+			}
+			names := make([]string, 0, len(fields))
+			for field := range fields {
+				names = append(names, field)
+			}
+			sort.Strings(names)
+			for _, field := range names {
+				fmt.Printf("%s: %s\n", field, fields[field])
+			}
+		},
+	}
+}
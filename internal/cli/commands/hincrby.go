@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewHIncrByCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "hincrby",
+		Short:     "Increment the integer held by a field of a hash",
+		Example:   `hincrby key field increment`,
+		ValidArgs: []string{"key", "field", "increment"},
+		Args:      cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			increment, err := strconv.ParseInt(args[2], 10, 64)
+			if err != nil {
+				fmt.Printf("Invalid increment %s, expected an integer\n", args[2])
+				return
+			}
+			value, err := globaleDataStore.HIncrBy(args[0], args[1], increment)
+			if err != nil {
+				fmt.Printf("Unable to increment the field %v of %v: %v\n", args[1], args[0], err)
+				return
+			}
+			fmt.Println("Value:", value)
+		},
+	}
+}
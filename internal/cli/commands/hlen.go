@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewHLenCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "hlen",
+		Short:     "Get the number of fields of a hash",
+		Example:   `hlen key`,
+		ValidArgs: []string{"key"},
+		Args:      cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			n, err := globaleDataStore.HLen(args[0])
+			if err != nil {
+				fmt.Printf("Unable to count the fields of %v: %v\n", args[0], err)
+				return
+			}
+			fmt.Println("Fields:", n)
+		},
+	}
+}
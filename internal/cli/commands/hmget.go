@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewHMGetCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "hmget",
+		Short:     "Get several fields of a hash",
+		Example:   `hmget key field [field ...]`,
+		ValidArgs: []string{"key", "field"},
+		Args:      cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			values, err := globaleDataStore.HMGet(args[0], args[1:]...)
+			if err != nil {
+				fmt.Printf("Unable to get the fields of %v: %v\n", args[0], err)
+				return
+			}
+			for i, value := range values {
+				if value == nil {
+					fmt.Printf("%s: (nil)\n", args[i+1])
+				} else {
+					fmt.Printf("%s: %v\n", args[i+1], value)
+				}
+			}
+		},
+	}
+}
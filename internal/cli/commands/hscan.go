@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewHScanCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "hscan",
+		Short:     "Iterate over the fields of a hash",
+		Example:   `hscan key cursor [count]`,
+		ValidArgs: []string{"key", "cursor", "count"},
+		Args:      cobra.RangeArgs(2, 3),
+		Run: func(cmd *cobra.Command, args []string) {
+			cursor, err := strconv.ParseUint(args[1], 10, 64)
+			if err != nil {
+				fmt.Printf("Invalid cursor %s\n", args[1])
+				return
+			}
+			count := 10
+			if len(args) == 3 {
+				if count, err = strconv.Atoi(args[2]); err != nil || count < 1 {
+					fmt.Printf("Invalid count %s, expected a positive integer\n", args[2])
+					return
+				}
+			}
+			next, fieldValues, err := globaleDataStore.HScan(args[0], cursor, count)
+			if err != nil {
+				fmt.Printf("Unable to scan the fields of %v: %v\n", args[0], err)
+				return
+			}
+			for i := 0; i < len(fieldValues); i += 2 {
+				fmt.Printf("%s: %s\n", fieldValues[i], fieldValues[i+1])
+			}
+			fmt.Println("Next cursor:", next)
+		},
+	}
+}
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewHSetCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "hset",
+		Short:     "Set fields of a hash",
+		Example:   `hset key field value [field value ...]`,
+		ValidArgs: []string{"key", "field", "value"},
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 3 || len(args)%2 == 0 {
+				return fmt.Errorf("expected a key followed by field-value pairs")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			added, err := globaleDataStore.HSet(args[0], args[1:]...)
+			if err != nil {
+				fmt.Printf("Unable to set the fields of %v: %v\n", args[0], err)
+				return
+			}
+			fmt.Println("Fields added:", added)
+		},
+	}
+}
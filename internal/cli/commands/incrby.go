@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewIncrByCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "incrby",
+		Short:     "Increment the integer held by a key",
+		Example:   `incrby key increment`,
+		ValidArgs: []string{"key", "increment"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			increment, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				fmt.Printf("Invalid increment %s, expected an integer\n", args[1])
+				return
+			}
+			value, err := globaleDataStore.IncrBy(args[0], increment)
+			if err != nil {
+				fmt.Printf("Unable to increment %v: %v\n", args[0], err)
+				return
+			}
+			fmt.Println("Value:", value)
+		},
+	}
+}
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewIncrByFloatCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "incrbyfloat",
+		Short:     "Increment the number held by a key by a floating point increment",
+		Example:   `incrbyfloat key increment`,
+		ValidArgs: []string{"key", "increment"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			increment, err := strconv.ParseFloat(args[1], 64)
+			if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+				fmt.Printf("Invalid increment %s, expected a number\n", args[1])
+				return
+			}
+			value, err := globaleDataStore.IncrByFloat(args[0], increment)
+			if err != nil {
+				fmt.Printf("Unable to increment %v: %v\n", args[0], err)
+				return
+			}
+			fmt.Println("Value:", strconv.FormatFloat(value, 'f', -1, 64))
+		},
+	}
+}
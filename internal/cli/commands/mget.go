@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewMGetCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "mget",
+		Short:     "Get the values of several keys",
+		Example:   `mget key [key ...]`,
+		ValidArgs: []string{"key"},
+		Args:      cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			for i, value := range globaleDataStore.MGet(args...) {
+				if value == nil {
+					fmt.Printf("%s: (nil)\n", args[i])
+				} else {
+					fmt.Printf("%s: %v\n", args[i], value)
+				}
+			}
+		},
+	}
+}
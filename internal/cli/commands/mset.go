@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewMSetCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "mset",
+		Short:     "Set several key-value pairs at once",
+		Example:   `mset key value [key value ...]`,
+		ValidArgs: []string{"key", "value"},
+		Args:      validatePairArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := globaleDataStore.MSet(keyValuePairs(args)...); err != nil {
+				fmt.Printf("Unable to set the keys: %v\n", err)
+			}
+		},
+	}
+}
+
+// validatePairArgs checks that the arguments are key value pairs.
+func validatePairArgs(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return fmt.Errorf("expected key value pairs, got %d arguments", len(args))
+	}
+	return nil
+}
+
+// keyValuePairs returns the key value pairs of args.
+func keyValuePairs(args []string) []datastore.KeyValue {
+	pairs := make([]datastore.KeyValue, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		pairs = append(pairs, datastore.KeyValue{Key: args[i], Value: args[i+1]})
+	}
+	return pairs
+}
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewMSetNXCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "msetnx",
+		Short:     "Set several key-value pairs unless one of the keys exists",
+		Example:   `msetnx key value [key value ...]`,
+		ValidArgs: []string{"key", "value"},
+		Args:      validatePairArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			written, err := globaleDataStore.MSetNX(keyValuePairs(args)...)
+			switch {
+			case err != nil:
+				fmt.Printf("Unable to set the keys: %v\n", err)
+			case !written:
+				fmt.Println("One of the keys already exists, none was set")
+			}
+		},
+	}
+}
@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewPersistCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "persist",
+		Short:     "Remove the expire of a key",
+		Example:   `persist key`,
+		ValidArgs: []string{"key"},
+		Args:      cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			removed, err := globaleDataStore.Persist(args[0])
+			if err != nil {
+				fmt.Printf("Failed to persist key %s : %v\n", args[0], err)
+			} else if !removed {
+				fmt.Printf("Key %s has no expire\n", args[0])
+			}
+		},
+	}
+}
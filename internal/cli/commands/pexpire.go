@@ -0,0 +1,21 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewPExpireCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "pexpire",
+		Short:     "Set a key's time to live in milliseconds",
+		Example:   `pexpire key milliseconds`,
+		ValidArgs: []string{"key", "milliseconds"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			runExpire(globaleDataStore, args, time.Millisecond)
+		},
+	}
+}
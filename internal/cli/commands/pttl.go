@@ -0,0 +1,21 @@
+package commands
+
+import (
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewPTTLCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "pttl",
+		Short:     "Get the time to live of a key in milliseconds",
+		Example:   `pttl key`,
+		ValidArgs: []string{"key"},
+		Args:      cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runTTL(globaleDataStore, args[0], time.Millisecond)
+		},
+	}
+}
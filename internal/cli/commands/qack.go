@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+	"github.com/spf13/cobra"
+)
+
+func NewQAckCmd(globalBroker *queue.Broker) *cobra.Command {
+	return &cobra.Command{
+		Use:       "qack",
+		Short:     "Acknowledge a reserved message, removing it from its queue",
+		Example:   `qack queue receipt`,
+		ValidArgs: []string{"queue", "receipt"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := globalBroker.Ack(args[0], args[1]); err != nil {
+				fmt.Printf("Unable to acknowledge receipt %s: %v\n", args[1], err)
+			}
+		},
+	}
+}
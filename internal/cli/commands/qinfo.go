@@ -0,0 +1,24 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+	"github.com/spf13/cobra"
+)
+
+func NewQInfoCmd(globalBroker *queue.Broker) *cobra.Command {
+	return &cobra.Command{
+		Use:       "qinfo",
+		Short:     "Describe the messages and options of a queue",
+		Example:   `qinfo queue`,
+		ValidArgs: []string{"queue"},
+		Args:      cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			stats, options := globalBroker.Stats(args[0]), globalBroker.Options(args[0])
+			fmt.Printf("Ready: %d\nDelayed: %d\nReserved: %d\n", stats.Ready, stats.Delayed, stats.Reserved)
+			fmt.Printf("Visibility timeout: %v\nMax deliveries: %d\nDead-letter queue: %s\n",
+				options.VisibilityTimeout, options.MaxDeliveries, options.DeadLetter)
+		},
+	}
+}
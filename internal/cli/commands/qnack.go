@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+	"github.com/spf13/cobra"
+)
+
+func NewQNackCmd(globalBroker *queue.Broker) *cobra.Command {
+	return &cobra.Command{
+		Use:       "qnack",
+		Short:     "Give a reserved message back to its queue, optionally delayed",
+		Example:   `qnack queue receipt [delay-milliseconds]`,
+		ValidArgs: []string{"queue", "receipt", "delay"},
+		Args:      cobra.RangeArgs(2, 3),
+		Run: func(cmd *cobra.Command, args []string) {
+			var delay time.Duration
+			if len(args) == 3 {
+				var err error
+				if delay, err = parseMilliseconds(args[2]); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+			if err := globalBroker.Nack(args[0], args[1], delay); err != nil {
+				fmt.Printf("Unable to requeue receipt %s: %v\n", args[1], err)
+			}
+		},
+	}
+}
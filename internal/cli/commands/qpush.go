@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+	"github.com/spf13/cobra"
+)
+
+func NewQPushCmd(globalBroker *queue.Broker) *cobra.Command {
+	return &cobra.Command{
+		Use:       "qpush",
+		Short:     "Add a message to a queue, optionally delayed",
+		Example:   `qpush queue message [delay-milliseconds]`,
+		ValidArgs: []string{"queue", "message", "delay"},
+		Args:      cobra.RangeArgs(2, 3),
+		Run: func(cmd *cobra.Command, args []string) {
+			var delay time.Duration
+			if len(args) == 3 {
+				var err error
+				if delay, err = parseMilliseconds(args[2]); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+			fmt.Println("ID:", globalBroker.Enqueue(args[0], args[1], delay))
+		},
+	}
+}
+
+// parseMilliseconds converts an amount of milliseconds into a duration.
+func parseMilliseconds(amount string) (time.Duration, error) {
+	n, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid duration %s, expected milliseconds", amount)
+	}
+	return time.Duration(n) * time.Millisecond, nil
+}
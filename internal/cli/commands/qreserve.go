@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+	"github.com/spf13/cobra"
+)
+
+func NewQReserveCmd(globalBroker *queue.Broker) *cobra.Command {
+	return &cobra.Command{
+		Use:       "qreserve",
+		Short:     "Reserve the next message of a queue",
+		Example:   `qreserve queue [timeout-milliseconds]`,
+		ValidArgs: []string{"queue", "timeout"},
+		Args:      cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var timeout time.Duration
+			if len(args) == 2 {
+				var err error
+				if timeout, err = parseMilliseconds(args[1]); err != nil {
+					fmt.Println(err)
+					return
+				}
+			}
+			msg, ok := globalBroker.Reserve(args[0], timeout)
+			if !ok {
+				fmt.Printf("Queue %s has no visible message\n", args[0])
+				return
+			}
+			fmt.Printf("ID: %s\nBody: %s\nDeliveries: %d\nReceipt: %s\n", msg.ID, msg.Body, msg.Deliveries, msg.Receipt())
+		},
+	}
+}
@@ -2,6 +2,9 @@ package commands
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
 	"github.com/spf13/cobra"
@@ -11,16 +14,53 @@ func NewSetCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
 	return &cobra.Command{
 		Use:       "set",
 		Short:     "Set a key-value pair",
-		Example:   `set key value`,
+		Example:   `set key value [EX seconds|PX milliseconds]`,
 		ValidArgs: []string{"key", "value"},
-		Args:      cobra.ExactArgs(2),
+		Args:      cobra.MatchAll(cobra.RangeArgs(2, 4), validateSetOptions),
 		Run: func(cmd *cobra.Command, args []string) {
 			key := args[0]
 			value := args[1]
-			err := globaleDataStore.Set(key, value)
+			var err error
+			if len(args) == 4 {
+				ttl, _ := parseTTLOption(args[2], args[3])
+				err = globaleDataStore.SetWithTTL(key, value, ttl)
+			} else {
+				err = globaleDataStore.Set(key, value)
+			}
 			if err != nil {
 				fmt.Printf("Unable to set the key %v: %v\n", args[0], err)
 			}
 		},
 	}
 }
+
+// validateSetOptions checks the optional EX/PX arguments of the set command.
+func validateSetOptions(cmd *cobra.Command, args []string) error {
+	switch len(args) {
+	case 2:
+		return nil
+	case 4:
+		_, err := parseTTLOption(args[2], args[3])
+		return err
+	default:
+		return fmt.Errorf("expected EX seconds or PX milliseconds after the value")
+	}
+}
+
+// parseTTLOption converts an EX or PX option and its amount into a duration.
+func parseTTLOption(option string, amount string) (time.Duration, error) {
+	var unit time.Duration
+	switch strings.ToUpper(option) {
+	case "EX":
+		unit = time.Second
+	case "PX":
+		unit = time.Millisecond
+	default:
+		return 0, fmt.Errorf("unknown option %s, expected EX or PX", option)
+	}
+	n, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid expire time %s", amount)
+	}
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewSetNXCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "setnx",
+		Short:     "Set a key-value pair unless the key exists",
+		Example:   `setnx key value`,
+		ValidArgs: []string{"key", "value"},
+		Args:      cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			_, written, err := globaleDataStore.SetWithOptions(args[0], args[1], datastore.SetOptions{NX: true})
+			switch {
+			case err != nil:
+				fmt.Printf("Unable to set the key %v: %v\n", args[0], err)
+			case !written:
+				fmt.Printf("The key %v already exists\n", args[0])
+			}
+		},
+	}
+}
@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+func NewTTLCmd(globaleDataStore *datastore.DataStore) *cobra.Command {
+	return &cobra.Command{
+		Use:       "ttl",
+		Short:     "Get the time to live of a key in seconds",
+		Example:   `ttl key`,
+		ValidArgs: []string{"key"},
+		Args:      cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runTTL(globaleDataStore, args[0], time.Second)
+		},
+	}
+}
+
+// runTTL prints the time to live of key expressed in unit.
+func runTTL(globaleDataStore *datastore.DataStore, key string, unit time.Duration) {
+	ttl, err := globaleDataStore.TTL(key)
+	switch {
+	case err != nil:
+		fmt.Printf("Unable to get the time to live of key %v: %v\n", key, err)
+	case ttl == datastore.NoTTL:
+		fmt.Println("TTL: none")
+	default:
+		fmt.Println("TTL:", int64((ttl+unit/2)/unit))
+	}
+}
@@ -0,0 +1,165 @@
+package datastore
+
+import (
+	"strconv"
+	"time"
+)
+
+// ErrVersionMismatch is returned by CompareAndSwap when key is not at the expected version.
+var ErrVersionMismatch = &DataStoreError{Message: "Version mismatch"}
+
+// SetOptions are the conditions and expiry of SetWithOptions, like the options of SET.
+type SetOptions struct {
+	// NX only writes keys that do not exist, XX keys that exist
+	NX, XX bool
+	// TTL is the time to live of the key, which has no deadline when it is zero
+	TTL time.Duration
+	// KeepTTL keeps the deadline of the key when TTL is zero, rather than removing it
+	KeepTTL bool
+	// Get fails with ErrWrongType, instead of replacing it, when the key holds a value that cannot be
+	// returned, like SET with GET
+	Get bool
+}
+
+// SetWithOptions stores value under key whether the key exists or not, unless NX or XX say otherwise,
+// and returns the value replaced, or nil when there was none or it is not a plain value such as a list.
+// written reports whether value was stored.
+func (s *DataStore) SetWithOptions(key string, value interface{}, opts SetOptions) (old interface{}, written bool, err error) {
+	if err := validateKey(key); err != nil {
+		return nil, false, err
+	}
+	if value == nil {
+		return nil, false, ErrNilValue
+	}
+	if opts.TTL < 0 {
+		return nil, false, ErrInvalidTTL
+	}
+	s.lock()
+	defer s.unlock()
+
+	s.expireIfNeeded(key)
+	old, exists := s.Data[key]
+	if _, ok := old.(cloner); ok {
+		if opts.Get {
+			return nil, false, ErrWrongType
+		}
+		old = nil
+	}
+	if (opts.NX && exists) || (opts.XX && !exists) {
+		return old, false, nil
+	}
+	if err := s.overwrite(key, value, exists, opts.TTL, opts.KeepTTL); err != nil {
+		return nil, false, err
+	}
+	return old, true, nil
+}
+
+// GetDel removes key and returns the value it held.
+func (s *DataStore) GetDel(key string) (interface{}, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	s.lock()
+	defer s.unlock()
+
+	s.expireIfNeeded(key)
+	value, ok := s.Data[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if _, ok := value.(cloner); ok {
+		return nil, ErrWrongType
+	}
+	s.remove(key)
+	return value, nil
+}
+
+// GetVersion returns the value held by key along with its version, which changes on every write of
+// the key and is never zero. Versions are only meaningful to the datastore that returned them: they
+// are not propagated, nor kept by snapshots.
+func (s *DataStore) GetVersion(key string) (interface{}, uint64, error) {
+	s.rlock()
+	defer s.runlock()
+	if err := validateKey(key); err != nil {
+		return nil, 0, err
+	}
+	value, ok := s.Data[key]
+	if !ok || s.isExpired(key, time.Now()) {
+		return nil, 0, ErrKeyNotFound
+	}
+	if _, ok := value.(cloner); ok {
+		return nil, 0, ErrWrongType
+	}
+	s.touch(key)
+	return value, s.version(key), nil
+}
+
+// CompareAndSwap stores value under key only when the key is at version, as returned by GetVersion, or
+// does not exist when version is zero, and returns the new version. The key expires once ttl has elapsed,
+// or never when ttl is zero. It returns ErrVersionMismatch when the key was written since.
+func (s *DataStore) CompareAndSwap(key string, version uint64, value interface{}, ttl time.Duration) (uint64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	if value == nil {
+		return 0, ErrNilValue
+	}
+	if ttl < 0 {
+		return 0, ErrInvalidTTL
+	}
+	s.lock()
+	defer s.unlock()
+
+	s.expireIfNeeded(key)
+	current, exists := s.Data[key]
+	if _, ok := current.(cloner); ok {
+		return 0, ErrWrongType
+	}
+	if (version == 0 && exists) || (version != 0 && (!exists || s.version(key) != version)) {
+		return 0, ErrVersionMismatch
+	}
+	if err := s.overwrite(key, value, exists, ttl, false); err != nil {
+		return 0, err
+	}
+	return s.version(key), nil
+}
+
+// version returns the version of key, zero when it does not exist. Caller must hold mu.
+func (s *DataStore) version(key string) uint64 {
+	if m, ok := s.meta[key]; ok {
+		return m.version
+	}
+	return 0
+}
+
+// overwrite stores value under key, which exists or not, and propagates the write. The key expires once
+// ttl has elapsed, keeps its deadline with keepTTL, or has none. Caller must hold mu for writing and
+// have expired key if needed.
+func (s *DataStore) overwrite(key string, value interface{}, exists bool, ttl time.Duration, keepTTL bool) error {
+	if err := s.makeRoom(estimateSize(key, value)-s.storedSize(key), !exists, key); err != nil {
+		return err
+	}
+	s.replace(key, value, exists, ttl, keepTTL)
+	return nil
+}
+
+// replace is overwrite once room was made for value. Caller must hold mu for writing.
+func (s *DataStore) replace(key string, value interface{}, exists bool, ttl time.Duration, keepTTL bool) {
+	s.store(key, value)
+	if exists && keepTTL && ttl == 0 {
+		s.propagate(valueCommand("UPDATE", key, value)...)
+		return
+	}
+
+	// SET is replayed without deadline, which PEXPIREAT then sets
+	s.clearDeadline(key)
+	s.propagate(valueCommand("SET", key, value)...)
+	var deadline time.Time
+	if ttl > 0 {
+		deadline = time.Now().Add(ttl)
+	}
+	if deadline = s.capDeadline(deadline); !deadline.IsZero() {
+		s.setDeadline(key, deadline)
+		s.propagate("PEXPIREAT", key, strconv.FormatInt(deadline.UnixMilli(), 10))
+	}
+}
@@ -0,0 +1,129 @@
+package datastore_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_SetWithOptions(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if _, written, err := s.SetWithOptions("key", "a", datastore.SetOptions{XX: true}); err != nil || written {
+		t.Fatalf("Expected XX not to write a missing key, got %v, %v", written, err)
+	}
+	if _, written, _ := s.SetWithOptions("key", "a", datastore.SetOptions{NX: true}); !written {
+		t.Fatal("Expected NX to write a missing key")
+	}
+	if old, written, _ := s.SetWithOptions("key", "b", datastore.SetOptions{NX: true}); written || old != "a" {
+		t.Errorf("Expected NX not to write an existing key and return its value, got %v, %v", written, old)
+	}
+	if old, written, _ := s.SetWithOptions("key", "b", datastore.SetOptions{}); !written || old != "a" {
+		t.Errorf("Expected an upsert returning the old value, got %v, %v", written, old)
+	}
+
+	s.SetWithOptions("key", "c", datastore.SetOptions{TTL: time.Hour})
+	s.SetWithOptions("key", "d", datastore.SetOptions{KeepTTL: true})
+	if ttl, _ := s.TTL("key"); ttl <= 0 {
+		t.Errorf("Expected KeepTTL to keep the deadline, got %v", ttl)
+	}
+	s.SetWithOptions("key", "e", datastore.SetOptions{})
+	if ttl, _ := s.TTL("key"); ttl != datastore.NoTTL {
+		t.Errorf("Expected a plain set to remove the deadline, got %v", ttl)
+	}
+
+	s.RPush("list", "a")
+	if _, _, err := s.SetWithOptions("list", "x", datastore.SetOptions{Get: true}); err != datastore.ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if old, written, _ := s.SetWithOptions("list", "x", datastore.SetOptions{}); !written || old != nil {
+		t.Errorf("Expected a list to be replaced, got %v, %v", written, old)
+	}
+}
+
+func TestDataStore_GetDel(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("key", "value")
+
+	if value, err := s.GetDel("key"); err != nil || value != "value" {
+		t.Fatalf("Expected the value, got %v, %v", value, err)
+	}
+	if _, err := s.Get("key"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected the key to be deleted, got %v", err)
+	}
+	if _, err := s.GetDel("key"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestDataStore_CompareAndSwap(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if _, version, err := s.GetVersion("lease"); err != datastore.ErrKeyNotFound || version != 0 {
+		t.Fatalf("Expected version 0 for a missing key, got %d, %v", version, err)
+	}
+	v1, err := s.CompareAndSwap("lease", 0, "owner-1", time.Hour)
+	if err != nil || v1 == 0 {
+		t.Fatalf("Expected version 0 to create the key, got %d, %v", v1, err)
+	}
+	if _, err := s.CompareAndSwap("lease", 0, "owner-2", 0); err != datastore.ErrVersionMismatch {
+		t.Errorf("Expected version 0 to fail on an existing key, got %v", err)
+	}
+	if value, version, _ := s.GetVersion("lease"); value != "owner-1" || version != v1 {
+		t.Errorf("Expected owner-1 at version %d, got %v at %d", v1, value, version)
+	}
+
+	v2, err := s.CompareAndSwap("lease", v1, "owner-2", 0)
+	if err != nil || v2 == v1 {
+		t.Fatalf("Expected a new version, got %d, %v", v2, err)
+	}
+	if ttl, _ := s.TTL("lease"); ttl != datastore.NoTTL {
+		t.Errorf("Expected a zero ttl to remove the deadline, got %v", ttl)
+	}
+	if _, err := s.CompareAndSwap("lease", v1, "owner-3", 0); err != datastore.ErrVersionMismatch {
+		t.Errorf("Expected a stale version to fail, got %v", err)
+	}
+
+	// A key deleted and created again does not get a version back
+	s.Delete("lease")
+	s.Set("lease", "owner-2")
+	if _, err := s.CompareAndSwap("lease", v2, "owner-3", 0); err != datastore.ErrVersionMismatch {
+		t.Errorf("Expected the version of a deleted key to fail, got %v", err)
+	}
+}
+
+func TestDataStore_CompareAndSwapConcurrent(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("counter", "0")
+
+	const workers, increments = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for done := 0; done < increments; {
+				value, version, err := s.GetVersion("counter")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n, _ := strconv.Atoi(value.(string))
+				if _, err := s.CompareAndSwap("counter", version, strconv.Itoa(n+1), 0); err == nil {
+					done++
+				} else if err != datastore.ErrVersionMismatch {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, _ := s.Get("counter"); value != strconv.Itoa(workers*increments) {
+		t.Errorf("Expected %d, got %v", workers*increments, value)
+	}
+}
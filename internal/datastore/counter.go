@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"math"
+	"strconv"
+)
+
+// Declared counter errors
+var (
+	ErrValueNotInteger = &DataStoreError{Message: "value is not an integer or out of range"}
+	ErrValueNotFloat   = &DataStoreError{Message: "value is not a valid float"}
+	ErrNotFinite       = &DataStoreError{Message: "increment would produce NaN or Infinity"}
+)
+
+// IncrBy atomically adds increment to the integer held by key, which is set to zero first when missing,
+// and returns the new value. The value is stored as a decimal string and keeps its time to live.
+func (s *DataStore) IncrBy(key string, increment int64) (int64, error) {
+	var result int64
+	err := s.increment(key, func(current string, exists bool) (string, error) {
+		var n int64
+		if exists {
+			var err error
+			if n, err = strconv.ParseInt(current, 10, 64); err != nil {
+				return "", ErrValueNotInteger
+			}
+		}
+		if (increment > 0 && n > math.MaxInt64-increment) || (increment < 0 && n < math.MinInt64-increment) {
+			return "", ErrOverflow
+		}
+		result = n + increment
+		return strconv.FormatInt(result, 10), nil
+	})
+	return result, err
+}
+
+// IncrByFloat atomically adds increment to the number held by key, which is set to zero first when missing,
+// and returns the new value. The value is stored as a decimal string and keeps its time to live.
+func (s *DataStore) IncrByFloat(key string, increment float64) (float64, error) {
+	var result float64
+	err := s.increment(key, func(current string, exists bool) (string, error) {
+		var f float64
+		if exists {
+			var err error
+			if f, err = strconv.ParseFloat(current, 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return "", ErrValueNotFloat
+			}
+		}
+		result = f + increment
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return "", ErrNotFinite
+		}
+		return strconv.FormatFloat(result, 'f', -1, 64), nil
+	})
+	return result, err
+}
+
+// increment replaces the value held by key with the result of next, under a single lock so that
+// concurrent increments are never lost. The new value is propagated rather than the increment, so
+// that replaying it twice is harmless.
+func (s *DataStore) increment(key string, next func(current string, exists bool) (string, error)) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	s.lock()
+	defer s.unlock()
+
+	s.expireIfNeeded(key)
+	current, exists := s.Data[key]
+	if _, ok := current.(cloner); ok {
+		return ErrWrongType
+	}
+	value, err := next(FormatValue(current), exists)
+	if err != nil {
+		return err
+	}
+	if err := s.makeRoom(estimateSize(key, value)-s.storedSize(key), !exists, key); err != nil {
+		return err
+	}
+	s.store(key, value)
+	if exists {
+		s.propagate("UPDATE", key, value)
+	} else {
+		s.propagate("SET", key, value)
+		s.capNewKey(key)
+	}
+	return nil
+}
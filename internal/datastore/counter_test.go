@@ -0,0 +1,122 @@
+package datastore_test
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_IncrBy(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if value, err := s.IncrBy("counter", 5); err != nil || value != 5 {
+		t.Fatalf("Expected a missing key to start at zero, got %d, %v", value, err)
+	}
+	if value, _ := s.IncrBy("counter", -7); value != -2 {
+		t.Errorf("Expected -2, got %d", value)
+	}
+	if value, _ := s.Get("counter"); value != "-2" {
+		t.Errorf("Expected the value to be stored as a string, got %v", value)
+	}
+
+	s.Set("number", 41)
+	if value, err := s.IncrBy("number", 1); err != nil || value != 42 {
+		t.Errorf("Expected integer values to be incremented, got %d, %v", value, err)
+	}
+	s.Set("text", "abc")
+	if _, err := s.IncrBy("text", 1); err != datastore.ErrValueNotInteger {
+		t.Errorf("Expected ErrValueNotInteger, got %v", err)
+	}
+	s.Set("max", strconv.FormatInt(math.MaxInt64, 10))
+	if _, err := s.IncrBy("max", 1); err != datastore.ErrOverflow {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+	if value, _ := s.Get("max"); value != strconv.FormatInt(math.MaxInt64, 10) {
+		t.Errorf("Expected an overflow to leave the value unchanged, got %v", value)
+	}
+	s.RPush("list", "a")
+	if _, err := s.IncrBy("list", 1); err != datastore.ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestDataStore_IncrByFloat(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if value, err := s.IncrByFloat("f", 10.5); err != nil || value != 10.5 {
+		t.Fatalf("Expected 10.5, got %v, %v", value, err)
+	}
+	s.IncrByFloat("f", 0.1)
+	if value, _ := s.Get("f"); value != "10.6" {
+		t.Errorf("Expected 10.6, got %v", value)
+	}
+	s.Set("int", "3")
+	if value, _ := s.IncrByFloat("int", -0.5); value != 2.5 {
+		t.Errorf("Expected integers to be incremented as floats, got %v", value)
+	}
+	s.Set("text", "abc")
+	if _, err := s.IncrByFloat("text", 1); err != datastore.ErrValueNotFloat {
+		t.Errorf("Expected ErrValueNotFloat, got %v", err)
+	}
+	if _, err := s.IncrByFloat("f", math.MaxFloat64); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := s.IncrByFloat("f", math.MaxFloat64); err != datastore.ErrNotFinite {
+		t.Errorf("Expected ErrNotFinite, got %v", err)
+	}
+}
+
+func TestDataStore_IncrByIsAtomic(t *testing.T) {
+	s := datastore.NewDataStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.IncrBy("counter", 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := s.Get("counter"); value != "2000" {
+		t.Errorf("Expected no increment to be lost, got %v", value)
+	}
+}
+
+func TestDataStore_IncrByKeepsTTL(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.SetWithTTL("counter", "1", time.Minute)
+	s.IncrBy("counter", 1)
+	if ttl, _ := s.TTL("counter"); ttl <= 0 {
+		t.Errorf("Expected the counter to keep its time to live, got %v", ttl)
+	}
+}
+
+func TestDataStore_ApplyReplaysIncrements(t *testing.T) {
+	source := datastore.NewDataStore()
+	replica := datastore.NewDataStore()
+	source.AddPropagator(func(args []string) {
+		if err := replica.Apply(args); err != nil {
+			t.Errorf("Expected no error applying %v, got %v", args, err)
+		}
+	})
+
+	source.SetWithTTL("counter", "1", time.Minute)
+	source.IncrBy("counter", 2)
+	source.IncrBy("new", 3)
+	source.IncrByFloat("float", 1.5)
+
+	for key, expected := range map[string]string{"counter": "3", "new": "3", "float": "1.5"} {
+		if value, _ := replica.Get(key); value != expected {
+			t.Errorf("Expected %s to be %s, got %v", key, expected, value)
+		}
+	}
+	if ttl, _ := replica.TTL("counter"); ttl <= 0 {
+		t.Errorf("Expected the replicated counter to keep its time to live, got %v", ttl)
+	}
+}
@@ -1,21 +1,49 @@
 package datastore
 
 import (
+	"encoding/json"
 	"regexp"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
 )
 
-const defaultTTL = time.Minute * 60
 const maxAllowedEntries = 100000
 
+// DataStore is a handle to a keyspace. Transactions get a handle of their own, see Txn.
 type DataStore struct {
-	Data   map[string]interface{}
-	cache  *cache.Cache
-	ttlMap map[string]time.Time
-	mu     sync.RWMutex
+	*keyspace
+	// txn is set on the handle of a running transaction, which holds mu
+	txn *txnState
+}
+
+// keyspace is the state shared by the handles of a datastore.
+type keyspace struct {
+	Data map[string]interface{}
+	// index orders the keys for Scan
+	index      scanIndex
+	cache      *cache.Cache
+	ttlMap     map[string]time.Time
+	meta       map[string]*keyMeta
+	limits     Limits
+	usedMemory int64
+	// propagators receive every write, see AddPropagator
+	propagators []Propagator
+	// dirty counts the writes since the last successful save, see Dirty
+	dirty int64
+	// snapshots are the running snapshot iterators, see IterateSnapshot
+	snapshots []*snapshotState
+	// waiters are woken up by the next write to their keys, see WaitForKeys
+	waiters map[string][]*keyWaiter
+	waitMu  sync.Mutex
+	// lastVersion is the version of the value written last, see GetVersion
+	lastVersion uint64
+	// versions count the writes to the watched keys, watchers the watches of each key, see Watch
+	versions map[string]uint64
+	watchers map[string]int
+	mu       sync.RWMutex
 }
 type DataStoreError struct {
 	Cause   error
@@ -30,15 +58,23 @@ var (
 	ErrKeyNotFound          = &DataStoreError{Message: "Key not found"}
 	ErrDuplicateKey         = &DataStoreError{Message: "Key already exists"}
 	ErrSpecialCharactersKey = &DataStoreError{Message: "Key with special characters is not allowed"}
+	ErrInvalidTTL           = &DataStoreError{Message: "Invalid expire time"}
+	ErrWrongType            = &DataStoreError{Message: "Operation against a key holding the wrong kind of value"}
 )
 
 func (e *DataStoreError) Error() string { return e.Message }
+
+// NewDataStore returns an empty datastore without limits, which never evicts keys until SetLimits bounds it.
 func NewDataStore() *DataStore {
-	return &DataStore{
+	return &DataStore{keyspace: &keyspace{
 		Data:   make(map[string]interface{}),
 		cache:  cache.New(5*time.Minute, 30*time.Minute),
 		ttlMap: make(map[string]time.Time),
-	}
+		meta:   make(map[string]*keyMeta),
+		limits: Limits{Policy: NoEviction},
+		// Versions start from the clock so that they are not reused after a restart
+		lastVersion: uint64(time.Now().UnixNano()),
+	}}
 }
 func validateKey(key string) error {
 	re := regexp.MustCompile(`^[a-zA-Z0-9[\x80-\xFF]\s-_]+$`)
@@ -59,8 +95,24 @@ func validateKey(key string) error {
 	return nil
 }
 func (s *DataStore) Set(key string, value interface{}) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.lock()
+	defer s.unlock()
+	return s.set(key, value, time.Time{})
+}
+
+// SetWithTTL stores a new key-value pair that expires once ttl has elapsed.
+func (s *DataStore) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	s.lock()
+	defer s.unlock()
+	return s.set(key, value, time.Now().Add(ttl))
+}
+
+// set stores a new key-value pair, with an optional deadline. The zero deadline means no expiry.
+// Caller must hold mu for writing.
+func (s *DataStore) set(key string, value interface{}, deadline time.Time) error {
 	if err := validateKey(key); err != nil {
 		return err
 	}
@@ -68,75 +120,168 @@ func (s *DataStore) Set(key string, value interface{}) error {
 	if value == nil {
 		return ErrNilValue
 	}
+	s.expireIfNeeded(key)
 	if _, exists := s.Data[key]; exists {
 		return ErrDuplicateKey
 	}
 
+	// Make room for the new key, evicting other keys according to the policy
+	if err := s.makeRoom(estimateSize(key, value), true, key); err != nil {
+		return err
+	}
+
+	s.store(key, value)
+	s.propagate(valueCommand("SET", key, value)...)
+	if deadline = s.capDeadline(deadline); !deadline.IsZero() {
+		s.setDeadline(key, deadline)
+		s.propagate("PEXPIREAT", key, strconv.FormatInt(deadline.UnixMilli(), 10))
+	}
+	return nil
+}
+
+// store writes value under key and keeps the memory accounting up to date. Caller must hold mu for writing.
+func (s *DataStore) store(key string, value interface{}) {
 	if s.Data == nil {
-        s.Data = make(map[string]interface{})
-    }
-	if s.ttlMap == nil {
-		s.ttlMap = make(map[string]time.Time)
+		s.Data = make(map[string]interface{})
+	}
+	if s.meta == nil {
+		s.meta = make(map[string]*keyMeta)
+	}
+
+	s.preserve(key)
+	size := estimateSize(key, value)
+	if m, ok := s.meta[key]; ok {
+		s.usedMemory += size - m.size
+		m.size = size
+		m.touch(time.Now().UnixNano())
+	} else {
+		s.meta[key] = newKeyMeta(size, time.Now().UnixNano())
+		s.usedMemory += size
+	}
+	s.lastVersion++
+	s.meta[key].version = s.lastVersion
+	if _, exists := s.Data[key]; !exists {
+		s.index.add(key)
 	}
-	
 	s.Data[key] = value
-	s.ttlMap[key] = time.Now().Add(defaultTTL)
-	// Check for out-of-memory error
-	if len(s.Data) > maxAllowedEntries {
-		delete(s.Data, key)
-		return ErrOutOfMemory
+	s.wake(key)
+}
+
+// storedSize returns the accounted size of key. Caller must hold mu.
+func (s *DataStore) storedSize(key string) int64 {
+	if m, ok := s.meta[key]; ok {
+		return m.size
 	}
-	return nil
+	return 0
+}
+
+// remove deletes key along with its deadline and bookkeeping, and propagates the deletion.
+// Caller must hold mu for writing.
+func (s *DataStore) remove(key string) {
+	s.unstore(key)
+	s.propagate("DEL", key)
 }
+
+// unstore is remove without propagation, for writes whose propagated command removes key on its own,
+// such as popping the last element of a list. Caller must hold mu for writing.
+func (s *DataStore) unstore(key string) {
+	s.preserve(key)
+	if m, ok := s.meta[key]; ok {
+		s.usedMemory -= m.size
+		delete(s.meta, key)
+	}
+	if _, exists := s.Data[key]; exists {
+		s.index.remove(key)
+	}
+	delete(s.Data, key)
+	delete(s.ttlMap, key)
+}
+
 func (s *DataStore) Get(key string) (interface{}, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.rlock()
+	defer s.runlock()
 	if err := validateKey(key); err != nil {
 		return nil, err
 	}
 	value, ok := s.Data[key]
-	if !ok {
+	if !ok || s.isExpired(key, time.Now()) {
 		return nil, ErrKeyNotFound
 	}
+	if _, ok := value.(cloner); ok {
+		// Values modified in place, such as streams, are only accessed through their own methods
+		return nil, ErrWrongType
+	}
+	s.touch(key)
 	return value, nil
 }
+
+// GetAll returns a copy of every key-value pair that has not expired yet.
 func (s *DataStore) GetAll() map[string]interface{} {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.Data
+	s.rlock()
+	defer s.runlock()
+	now := time.Now()
+	values := make(map[string]interface{}, len(s.Data))
+	for key, value := range s.Data {
+		if s.isExpired(key, now) {
+			continue
+		}
+		if c, ok := value.(cloner); ok {
+			value = c.Clone()
+		}
+		values[key] = value
+	}
+	return values
 }
 func (s *DataStore) Delete(key string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.lock()
+	defer s.unlock()
 	if err := validateKey(key); err != nil {
 		return err
 	}
+	s.expireIfNeeded(key)
 	if _, ok := s.Data[key]; !ok {
 		return ErrKeyNotFound
 	}
-	delete(s.Data, key)
-
-	if s.ttlMap != nil {
-		delete(s.ttlMap, key)
-	}
+	s.remove(key)
 	return nil
 }
 func (s *DataStore) Update(key string, value interface{}) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.lock()
+	defer s.unlock()
 	if err := validateKey(key); err != nil {
 		return err
 	}
+	s.expireIfNeeded(key)
 	if _, ok := s.Data[key]; !ok {
 		return ErrKeyNotFound
 	}
-	s.Data[key] = value
+	if err := s.makeRoom(estimateSize(key, value)-s.storedSize(key), false, key); err != nil {
+		return err
+	}
+	s.store(key, value)
+	s.propagate(valueCommand("UPDATE", key, value)...)
 	return nil
 }
 func (s *DataStore) FlushAll() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.lock()
+	defer s.unlock()
+	s.flush()
+	s.propagate("FLUSHALL")
+	return nil
+}
+
+// flush deletes every key. Caller must hold mu for writing.
+func (s *DataStore) flush() {
+	if s.txn != nil || len(s.watchers) > 0 {
+		for key := range s.Data {
+			s.writing(key)
+		}
+	}
+	s.freeze()
 	s.Data = make(map[string]interface{})
+	s.index = scanIndex{}
+	s.meta = make(map[string]*keyMeta)
+	s.usedMemory = 0
 
 	if s.cache != nil {
 		s.cache.Flush()
@@ -145,6 +290,69 @@ func (s *DataStore) FlushAll() error {
 	if s.ttlMap != nil {
 		s.ttlMap = make(map[string]time.Time)
 	}
+}
+
+// dataStoreJSON is the JSON representation of a DataStore. Deadlines are stored as Unix milliseconds.
+type dataStoreJSON struct {
+	Data    map[string]interface{}
+	Expires map[string]int64 `json:",omitempty"`
+}
+
+// MarshalJSON encodes the live keys of the datastore along with their deadlines.
+func (s *DataStore) MarshalJSON() ([]byte, error) {
+	s.rlock()
+	defer s.runlock()
+	now := time.Now()
+	encoded := dataStoreJSON{Data: make(map[string]interface{}, len(s.Data))}
+	for key, value := range s.Data {
+		if s.isExpired(key, now) {
+			continue
+		}
+		encoded.Data[key] = value
+		if deadline, ok := s.ttlMap[key]; ok {
+			if encoded.Expires == nil {
+				encoded.Expires = make(map[string]int64)
+			}
+			encoded.Expires[key] = deadline.UnixMilli()
+		}
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON restores a datastore encoded by MarshalJSON, dropping keys whose deadline has passed.
+func (s *DataStore) UnmarshalJSON(data []byte) error {
+	var decoded dataStoreJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
 
+	if s.keyspace == nil {
+		// A zero DataStore, such as one allocated by json.Unmarshal
+		s.keyspace = NewDataStore().keyspace
+	}
+	s.lock()
+	defer s.unlock()
+	s.Data = make(map[string]interface{}, len(decoded.Data))
+	s.index = scanIndex{}
+	s.meta = make(map[string]*keyMeta, len(decoded.Data))
+	s.ttlMap = make(map[string]time.Time, len(decoded.Expires))
+	s.usedMemory = 0
+	if s.cache == nil {
+		s.cache = cache.New(5*time.Minute, 30*time.Minute)
+	}
+	now := time.Now()
+	for key, value := range decoded.Data {
+		deadline := time.Time{}
+		if ms, ok := decoded.Expires[key]; ok {
+			deadline = time.UnixMilli(ms)
+			if !now.Before(deadline) {
+				continue
+			}
+		}
+		s.store(key, value)
+		if !deadline.IsZero() {
+			s.ttlMap[key] = deadline
+		}
+	}
 	return nil
 }
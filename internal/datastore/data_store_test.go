@@ -215,6 +215,8 @@ func TestDataStore_Unicode(t *testing.T) {
 
 func TestDataStore_OutOfMemory(t *testing.T) {
 	s := datastore.NewDataStore()
+	// NewDataStore is unbounded, the server applies the default limits
+	s.SetLimits(datastore.DefaultLimits())
 
 	// Attempt to store extremely large amounts of data
 	for i := 0; i < 10000; i++ {
@@ -0,0 +1,332 @@
+package datastore
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionPolicy selects the keys removed when the datastore reaches its memory or entry limits.
+type EvictionPolicy string
+
+const (
+	// NoEviction rejects writes with ErrOutOfMemory once a limit is reached.
+	NoEviction EvictionPolicy = "noeviction"
+	// AllKeysLRU evicts the least recently used keys.
+	AllKeysLRU EvictionPolicy = "allkeys-lru"
+	// AllKeysLFU evicts the least frequently used keys.
+	AllKeysLFU EvictionPolicy = "allkeys-lfu"
+	// AllKeysRandom evicts random keys.
+	AllKeysRandom EvictionPolicy = "allkeys-random"
+	// VolatileLRU evicts the least recently used keys among the keys with an expire.
+	VolatileLRU EvictionPolicy = "volatile-lru"
+	// VolatileLFU evicts the least frequently used keys among the keys with an expire.
+	VolatileLFU EvictionPolicy = "volatile-lfu"
+	// VolatileRandom evicts random keys among the keys with an expire.
+	VolatileRandom EvictionPolicy = "volatile-random"
+	// VolatileTTL evicts the keys with the nearest deadline.
+	VolatileTTL EvictionPolicy = "volatile-ttl"
+)
+
+const (
+	// evictionSamples is the number of keys sampled to pick an eviction candidate, like Redis' maxmemory-samples.
+	evictionSamples = 5
+	// entryOverhead approximates the bookkeeping memory of a single key: map bucket, metadata and headers.
+	entryOverhead = 64
+	// lfuInitVal is the frequency counter of new keys, so they are not evicted before they get a chance to be read.
+	lfuInitVal = 5
+	// lfuLogFactor controls how fast the logarithmic frequency counter saturates.
+	lfuLogFactor = 10
+	// lfuDecayTime is the idle period after which the frequency counter is decremented by one.
+	lfuDecayTime = time.Minute
+)
+
+// Limits bound the size of a datastore.
+type Limits struct {
+	// MaxMemory is the estimated memory, in bytes, the keys and values may use. Zero means unlimited.
+	MaxMemory int64
+	// MaxEntries is the maximum number of keys. Zero means unlimited.
+	MaxEntries int
+	// MaxKeyAge is the time to live given to keys written without one, and the upper bound of any time to live.
+	// Zero means keys never expire unless asked to.
+	MaxKeyAge time.Duration
+	// Policy selects the keys evicted when a limit is reached.
+	Policy EvictionPolicy
+}
+
+// DefaultLimits returns the limits the server applies for the settings missing from the store
+// configuration. A datastore created with NewDataStore is not bounded until its limits are set.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxMemory:  100 * 1024 * 1024,
+		MaxEntries: maxAllowedEntries,
+		Policy:     AllKeysLRU,
+	}
+}
+
+// ParseEvictionPolicy returns the policy named name. "random" is accepted as an alias of allkeys-random.
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	policy := EvictionPolicy(name)
+	switch policy {
+	case NoEviction, AllKeysLRU, AllKeysLFU, AllKeysRandom, VolatileLRU, VolatileLFU, VolatileRandom, VolatileTTL:
+		return policy, nil
+	case "random":
+		return AllKeysRandom, nil
+	default:
+		return "", fmt.Errorf("unknown eviction policy %q", name)
+	}
+}
+
+// volatile reports whether the policy only evicts keys with an expire.
+func (p EvictionPolicy) volatile() bool {
+	return p == VolatileLRU || p == VolatileLFU || p == VolatileRandom || p == VolatileTTL
+}
+
+// keyMeta holds the eviction bookkeeping of a key. The access fields are atomics so that readers
+// holding only the read lock can update them.
+type keyMeta struct {
+	size       int64
+	lastAccess atomic.Int64
+	freq       atomic.Uint32
+	// version identifies the value of the key, see GetVersion
+	version uint64
+}
+
+func newKeyMeta(size int64, now int64) *keyMeta {
+	m := &keyMeta{size: size}
+	m.lastAccess.Store(now)
+	m.freq.Store(lfuInitVal)
+	return m
+}
+
+// frequency returns the LFU counter of the key, decayed by one for every lfuDecayTime it stayed idle.
+func (m *keyMeta) frequency(now int64) uint32 {
+	freq := m.freq.Load()
+	periods := (now - m.lastAccess.Load()) / int64(lfuDecayTime)
+	if periods >= int64(freq) {
+		return 0
+	}
+	return freq - uint32(periods)
+}
+
+// touch records an access to the key. The frequency counter grows logarithmically, like in Redis,
+// so that 8 bits are enough to tell hot keys from cold ones.
+func (m *keyMeta) touch(now int64) {
+	freq := m.frequency(now)
+	if freq < 255 {
+		base := float64(freq) - lfuInitVal
+		if base < 0 {
+			base = 0
+		}
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			freq++
+		}
+	}
+	m.freq.Store(freq)
+	m.lastAccess.Store(now)
+}
+
+// touch records an access to key, if it is known. Caller must hold mu.
+func (s *DataStore) touch(key string) {
+	if m, ok := s.meta[key]; ok {
+		m.touch(time.Now().UnixNano())
+	}
+}
+
+// SetLimits replaces the limits of the datastore and evicts keys until the datastore fits in them.
+func (s *DataStore) SetLimits(limits Limits) error {
+	if limits.Policy == "" {
+		limits.Policy = NoEviction
+	}
+	if _, err := ParseEvictionPolicy(string(limits.Policy)); err != nil {
+		return err
+	}
+
+	s.lock()
+	defer s.unlock()
+	s.limits = limits
+	return s.makeRoom(0, false, "")
+}
+
+// Limits returns the limits of the datastore.
+func (s *DataStore) Limits() Limits {
+	s.rlock()
+	defer s.runlock()
+	return s.limits
+}
+
+// UsedMemory returns the estimated memory, in bytes, used by the keys and values of the datastore.
+func (s *DataStore) UsedMemory() int64 {
+	s.rlock()
+	defer s.runlock()
+	return s.usedMemory
+}
+
+// overLimits reports whether adding size bytes and newKeys keys exceeds the limits.
+// Caller must hold mu.
+func (s *DataStore) overLimits(size int64, newKeys int) bool {
+	if s.limits.MaxMemory > 0 && s.usedMemory+size > s.limits.MaxMemory {
+		return true
+	}
+	return s.limits.MaxEntries > 0 && len(s.Data)+newKeys > s.limits.MaxEntries
+}
+
+// makeRoom evicts keys, other than exclude, until size more bytes and a new key when newKey is set
+// fit within the limits. It returns ErrOutOfMemory when the policy cannot free enough room.
+// Caller must hold mu for writing.
+func (s *DataStore) makeRoom(size int64, newKey bool, exclude string) error {
+	newKeys := 0
+	if newKey {
+		newKeys = 1
+	}
+	return s.makeRoomFor(size, newKeys, func(key string) bool { return key == exclude })
+}
+
+// makeRoomFor is makeRoom for writes of several keys: it evicts keys for which excluded returns false
+// until size more bytes and newKeys keys fit within the limits. Caller must hold mu for writing.
+func (s *DataStore) makeRoomFor(size int64, newKeys int, excluded func(key string) bool) error {
+	if s.limits.MaxMemory > 0 && size > s.limits.MaxMemory {
+		return ErrOutOfMemory
+	}
+	if s.limits.MaxEntries > 0 && newKeys > s.limits.MaxEntries {
+		return ErrOutOfMemory
+	}
+	for s.overLimits(size, newKeys) {
+		if !s.evictOne(excluded) {
+			return ErrOutOfMemory
+		}
+	}
+	return nil
+}
+
+// evictOne removes a single key chosen by the eviction policy among a random sample of the keys for which
+// excluded returns false, and reports whether a key was removed. Caller must hold mu for writing.
+func (s *DataStore) evictOne(excluded func(key string) bool) bool {
+	if s.limits.Policy == NoEviction || s.limits.Policy == "" {
+		return false
+	}
+
+	now := time.Now()
+	nowNano := now.UnixNano()
+	candidate, found := "", false
+	var best int64
+
+	consider := func(key string) bool {
+		// Expired keys are free to reclaim, whatever the policy says
+		if s.isExpired(key, now) {
+			candidate, found = key, true
+			return true
+		}
+
+		var score int64
+		m, tracked := s.meta[key]
+		switch s.limits.Policy {
+		case AllKeysLRU, VolatileLRU:
+			score = math.MaxInt64
+			if tracked {
+				score = nowNano - m.lastAccess.Load()
+			}
+		case AllKeysLFU, VolatileLFU:
+			score = 255
+			if tracked {
+				score -= int64(m.frequency(nowNano))
+			}
+		case VolatileTTL:
+			score = -s.ttlMap[key].UnixNano()
+		}
+		if !found || score > best {
+			candidate, best, found = key, score, true
+		}
+		// Random policies take the first key of the randomized map iteration
+		return s.limits.Policy == AllKeysRandom || s.limits.Policy == VolatileRandom
+	}
+
+	// Map iteration order is randomized, which gives us a cheap random sample.
+	sampled := 0
+	if s.limits.Policy.volatile() {
+		for key := range s.ttlMap {
+			if excluded(key) {
+				continue
+			}
+			if sampled == evictionSamples || consider(key) {
+				break
+			}
+			sampled++
+		}
+	} else {
+		for key := range s.Data {
+			if excluded(key) {
+				continue
+			}
+			if sampled == evictionSamples || consider(key) {
+				break
+			}
+			sampled++
+		}
+	}
+
+	if !found {
+		return false
+	}
+	s.remove(candidate)
+	return true
+}
+
+// sizer is implemented by values that know their own memory usage.
+type sizer interface {
+	MemoryUsage() int64
+}
+
+// estimateSize approximates the memory used by a key and its value.
+func estimateSize(key string, value interface{}) int64 {
+	return entryOverhead + int64(len(key)) + valueSize(reflect.ValueOf(value))
+}
+
+// valueSize approximates the memory used by a value, following pointers, slices and maps.
+func valueSize(v reflect.Value) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	if v.CanInterface() {
+		if s, ok := v.Interface().(sizer); ok {
+			return s.MemoryUsage()
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return int64(v.Len())
+		}
+		size := int64(0)
+		for i := 0; i < v.Len(); i++ {
+			size += valueSize(v.Index(i))
+		}
+		return size
+	case reflect.Map:
+		size := int64(0)
+		iter := v.MapRange()
+		for iter.Next() {
+			size += valueSize(iter.Key()) + valueSize(iter.Value())
+		}
+		return size
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return valueSize(v.Elem())
+	case reflect.Struct:
+		size := int64(0)
+		for i := 0; i < v.NumField(); i++ {
+			size += valueSize(v.Field(i))
+		}
+		return size
+	default:
+		return int64(v.Type().Size())
+	}
+}
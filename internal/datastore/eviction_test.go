@@ -0,0 +1,168 @@
+package datastore_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func newLimitedDataStore(t *testing.T, limits datastore.Limits) *datastore.DataStore {
+	t.Helper()
+	s := datastore.NewDataStore()
+	if err := s.SetLimits(limits); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return s
+}
+
+func TestDataStore_NoEviction(t *testing.T) {
+	s := newLimitedDataStore(t, datastore.Limits{MaxEntries: 2, Policy: datastore.NoEviction})
+
+	s.Set("key1", "value")
+	s.Set("key2", "value")
+	if err := s.Set("key3", "value"); err != datastore.ErrOutOfMemory {
+		t.Errorf("Expected 'Out of memory' once the entry limit is reached, got %v", err)
+	}
+}
+
+func TestDataStore_AllKeysLRU(t *testing.T) {
+	s := newLimitedDataStore(t, datastore.Limits{MaxEntries: 3, Policy: datastore.AllKeysLRU})
+
+	s.Set("old", "value")
+	time.Sleep(time.Millisecond)
+	s.Set("key1", "value")
+	s.Set("key2", "value")
+	// Reading refreshes the recency of key1 and key2, not of "old"
+	s.Get("key1")
+	s.Get("key2")
+
+	if err := s.Set("key3", "value"); err != nil {
+		t.Fatalf("Expected eviction to make room, got %v", err)
+	}
+	if _, err := s.Get("old"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected the least recently used key to be evicted, got %v", err)
+	}
+	if len(s.GetAll()) != 3 {
+		t.Errorf("Expected 3 keys, got %d", len(s.GetAll()))
+	}
+}
+
+func TestDataStore_AllKeysLFU(t *testing.T) {
+	s := newLimitedDataStore(t, datastore.Limits{MaxEntries: 2, Policy: datastore.AllKeysLFU})
+
+	s.Set("hot", "value")
+	s.Set("cold", "value")
+	for i := 0; i < 1000; i++ {
+		s.Get("hot")
+	}
+
+	s.Set("new", "value")
+	if _, err := s.Get("hot"); err != nil {
+		t.Errorf("Expected the frequently used key to stay, got %v", err)
+	}
+	if _, err := s.Get("cold"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected the least frequently used key to be evicted, got %v", err)
+	}
+}
+
+func TestDataStore_VolatileTTL(t *testing.T) {
+	s := newLimitedDataStore(t, datastore.Limits{MaxEntries: 3, Policy: datastore.VolatileTTL})
+
+	s.Set("persistent", "value")
+	s.SetWithTTL("soon", "value", time.Minute)
+	s.SetWithTTL("later", "value", time.Hour)
+
+	if err := s.Set("new", "value"); err != nil {
+		t.Fatalf("Expected eviction to make room, got %v", err)
+	}
+	if _, err := s.Get("soon"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected the key with the nearest deadline to be evicted, got %v", err)
+	}
+}
+
+func TestDataStore_VolatileWithoutCandidates(t *testing.T) {
+	s := newLimitedDataStore(t, datastore.Limits{MaxEntries: 1, Policy: datastore.VolatileLRU})
+
+	s.Set("persistent", "value")
+	if err := s.Set("new", "value"); err != datastore.ErrOutOfMemory {
+		t.Errorf("Expected 'Out of memory' without volatile keys to evict, got %v", err)
+	}
+}
+
+func TestDataStore_MaxMemory(t *testing.T) {
+	s := newLimitedDataStore(t, datastore.Limits{MaxMemory: 64 * 1024, Policy: datastore.AllKeysRandom})
+
+	value := strings.Repeat("x", 1024)
+	for i := 0; i < 1000; i++ {
+		if err := s.Set(fmt.Sprintf("key%d", i), value); err != nil {
+			t.Fatalf("Expected eviction to make room, got %v", err)
+		}
+		if used := s.UsedMemory(); used > 64*1024 {
+			t.Fatalf("Expected used memory to stay under the limit, got %d", used)
+		}
+	}
+
+	// A single value larger than the limit can never fit
+	if err := s.Set("huge", strings.Repeat("x", 128*1024)); err != datastore.ErrOutOfMemory {
+		t.Errorf("Expected 'Out of memory' for a value larger than the limit, got %v", err)
+	}
+}
+
+func TestDataStore_UsedMemory(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	s.Set("key", strings.Repeat("x", 1000))
+	grown := s.UsedMemory()
+	if grown < 1000 {
+		t.Errorf("Expected used memory to account for the value, got %d", grown)
+	}
+
+	s.Update("key", "x")
+	if s.UsedMemory() >= grown {
+		t.Errorf("Expected used memory to shrink after Update, got %d", s.UsedMemory())
+	}
+
+	s.Delete("key")
+	if s.UsedMemory() != 0 {
+		t.Errorf("Expected no used memory after Delete, got %d", s.UsedMemory())
+	}
+}
+
+func TestDataStore_MaxKeyAge(t *testing.T) {
+	s := newLimitedDataStore(t, datastore.Limits{MaxKeyAge: time.Hour, Policy: datastore.NoEviction})
+
+	s.Set("key", "value")
+	if ttl, _ := s.TTL("key"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected keys to get the maximum age as TTL, got %v", ttl)
+	}
+
+	s.Expire("key", 24*time.Hour)
+	if ttl, _ := s.TTL("key"); ttl > time.Hour {
+		t.Errorf("Expected the TTL to be capped by the maximum age, got %v", ttl)
+	}
+
+	// Keys created by other commands than SET get the maximum age too
+	s.IncrBy("counter", 1)
+	s.LPush("list", "a")
+	s.HSet("hash", "field", "value")
+	s.SAdd("set", "member")
+	s.ZAdd("zset", datastore.ZAddFlags{}, datastore.ZMember{Member: "member", Score: 1})
+	s.XAdd("stream", datastore.XAddArgs{AutoID: true, Fields: []string{"field", "value"}})
+	for _, key := range []string{"counter", "list", "hash", "set", "zset", "stream"} {
+		if ttl, _ := s.TTL(key); ttl <= 0 || ttl > time.Hour {
+			t.Errorf("Expected %s to get the maximum age as TTL, got %v", key, ttl)
+		}
+	}
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	if policy, err := datastore.ParseEvictionPolicy("random"); err != nil || policy != datastore.AllKeysRandom {
+		t.Errorf("Expected random to be an alias of allkeys-random, got %v, %v", policy, err)
+	}
+	if _, err := datastore.ParseEvictionPolicy("unknown"); err == nil {
+		t.Errorf("Expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,188 @@
+package datastore
+
+import (
+	"strconv"
+	"time"
+)
+
+// NoTTL is returned by TTL for keys that exist but have no associated expire.
+const NoTTL time.Duration = -1
+
+const (
+	// activeExpireInterval is how often the background cycle samples keys with a deadline.
+	activeExpireInterval = 100 * time.Millisecond
+	// activeExpireSampleSize is the number of keys with a deadline checked per round.
+	activeExpireSampleSize = 20
+	// activeExpireMaxDuration bounds the time a single cycle may hold the write lock.
+	activeExpireMaxDuration = 25 * time.Millisecond
+)
+
+// isExpired reports whether key has a deadline that is not after now. Caller must hold mu.
+func (s *DataStore) isExpired(key string, now time.Time) bool {
+	deadline, ok := s.ttlMap[key]
+	return ok && !now.Before(deadline)
+}
+
+// expireIfNeeded removes key when its deadline has passed and reports whether it did.
+// Caller must hold mu for writing.
+func (s *DataStore) expireIfNeeded(key string) bool {
+	if !s.isExpired(key, time.Now()) {
+		return false
+	}
+	s.remove(key)
+	return true
+}
+
+// setDeadline records the deadline of key. Caller must hold mu for writing.
+func (s *DataStore) setDeadline(key string, deadline time.Time) {
+	s.preserve(key)
+	if s.ttlMap == nil {
+		s.ttlMap = make(map[string]time.Time)
+	}
+	s.ttlMap[key] = deadline
+}
+
+// clearDeadline removes the deadline of key. Caller must hold mu for writing.
+func (s *DataStore) clearDeadline(key string) {
+	if _, ok := s.ttlMap[key]; ok {
+		s.preserve(key)
+		delete(s.ttlMap, key)
+	}
+}
+
+// capDeadline bounds deadline by the MaxKeyAge limit. A zero deadline, meaning no expiry,
+// becomes the maximum age when one is configured. Caller must hold mu.
+func (s *DataStore) capDeadline(deadline time.Time) time.Time {
+	if s.limits.MaxKeyAge <= 0 {
+		return deadline
+	}
+	maxDeadline := time.Now().Add(s.limits.MaxKeyAge)
+	if deadline.IsZero() || deadline.After(maxDeadline) {
+		return maxDeadline
+	}
+	return deadline
+}
+
+// capNewKey gives key, just created without deadline by a command other than SET, the MaxKeyAge limit
+// when one is configured, and propagates it. Caller must hold mu for writing.
+func (s *DataStore) capNewKey(key string) {
+	if deadline := s.capDeadline(time.Time{}); !deadline.IsZero() {
+		s.setDeadline(key, deadline)
+		s.propagate("PEXPIREAT", key, strconv.FormatInt(deadline.UnixMilli(), 10))
+	}
+}
+
+// Expire sets a timeout on key, after which the key is deleted. A non-positive ttl deletes the key right away.
+func (s *DataStore) Expire(key string, ttl time.Duration) error {
+	return s.ExpireAt(key, time.Now().Add(ttl))
+}
+
+// ExpireAt sets the absolute deadline of key. A deadline in the past deletes the key right away.
+func (s *DataStore) ExpireAt(key string, deadline time.Time) error {
+	s.lock()
+	defer s.unlock()
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	s.expireIfNeeded(key)
+	if _, ok := s.Data[key]; !ok {
+		return ErrKeyNotFound
+	}
+	if !deadline.After(time.Now()) {
+		s.remove(key)
+		return nil
+	}
+	deadline = s.capDeadline(deadline)
+	s.setDeadline(key, deadline)
+	s.propagate("PEXPIREAT", key, strconv.FormatInt(deadline.UnixMilli(), 10))
+	return nil
+}
+
+// TTL returns the remaining time to live of key, or NoTTL when the key has no deadline.
+func (s *DataStore) TTL(key string) (time.Duration, error) {
+	s.rlock()
+	defer s.runlock()
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if _, ok := s.Data[key]; !ok || s.isExpired(key, now) {
+		return 0, ErrKeyNotFound
+	}
+	deadline, ok := s.ttlMap[key]
+	if !ok {
+		return NoTTL, nil
+	}
+	return deadline.Sub(now), nil
+}
+
+// Persist removes the deadline of key and reports whether the key had one.
+func (s *DataStore) Persist(key string) (bool, error) {
+	s.lock()
+	defer s.unlock()
+	if err := validateKey(key); err != nil {
+		return false, err
+	}
+	s.expireIfNeeded(key)
+	if _, ok := s.Data[key]; !ok {
+		return false, ErrKeyNotFound
+	}
+	if _, ok := s.ttlMap[key]; !ok {
+		return false, nil
+	}
+	s.clearDeadline(key)
+	s.propagate("PERSIST", key)
+	return true, nil
+}
+
+// StartExpirationCycle starts a background goroutine that actively deletes expired keys,
+// so keys that are never accessed again do not linger in memory. It returns a function that stops the cycle.
+func (s *DataStore) StartExpirationCycle() (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(activeExpireInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.activeExpireCycle()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// activeExpireCycle samples keys with a deadline and deletes the expired ones. Like Redis, it keeps
+// sampling while more than a quarter of the sample was expired, within a bounded time budget.
+// It returns the number of deleted keys.
+func (s *DataStore) activeExpireCycle() int {
+	s.lock()
+	defer s.unlock()
+
+	start := time.Now()
+	deleted := 0
+	for {
+		sampled, expired := 0, 0
+		now := time.Now()
+		// Map iteration order is randomized, which gives us a cheap random sample.
+		for key, deadline := range s.ttlMap {
+			if sampled == activeExpireSampleSize {
+				break
+			}
+			sampled++
+			if !now.Before(deadline) {
+				s.remove(key)
+				expired++
+			}
+		}
+		deleted += expired
+
+		if expired*4 <= sampled || time.Since(start) > activeExpireMaxDuration {
+			return deleted
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package datastore_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_SetWithTTL(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if err := s.SetWithTTL("key", "value", 20*time.Millisecond); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got, _ := s.Get("key"); got != "value" {
+		t.Errorf("Expected value before the deadline, got %v", got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, err := s.Get("key"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected 'Key not found' after the deadline, got %v", err)
+	}
+	if len(s.GetAll()) != 0 {
+		t.Errorf("Expected GetAll to skip expired keys, got %v", s.GetAll())
+	}
+
+	// An expired key can be set again
+	if err := s.Set("key", "new value"); err != nil {
+		t.Errorf("Expected Set to replace an expired key, got %v", err)
+	}
+}
+
+func TestDataStore_SetWithTTL_Invalid(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if err := s.SetWithTTL("key", "value", 0); err != datastore.ErrInvalidTTL {
+		t.Errorf("Expected 'Invalid expire time', got %v", err)
+	}
+}
+
+func TestDataStore_ExpireAndTTL(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("key", "value")
+
+	if ttl, _ := s.TTL("key"); ttl != datastore.NoTTL {
+		t.Errorf("Expected NoTTL for a key without expire, got %v", ttl)
+	}
+	if _, err := s.TTL("missing"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected 'Key not found' for a missing key, got %v", err)
+	}
+	if err := s.Expire("missing", time.Second); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected 'Key not found' when expiring a missing key, got %v", err)
+	}
+
+	if err := s.Expire("key", time.Minute); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ttl, _ := s.TTL("key"); ttl <= 59*time.Second || ttl > time.Minute {
+		t.Errorf("Expected a TTL close to one minute, got %v", ttl)
+	}
+
+	// A non-positive TTL deletes the key
+	s.Expire("key", 0)
+	if _, err := s.Get("key"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected the key to be deleted, got %v", err)
+	}
+}
+
+func TestDataStore_Persist(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.SetWithTTL("key", "value", time.Minute)
+
+	if removed, err := s.Persist("key"); !removed || err != nil {
+		t.Errorf("Expected Persist to remove the expire, got %v, %v", removed, err)
+	}
+	if ttl, _ := s.TTL("key"); ttl != datastore.NoTTL {
+		t.Errorf("Expected NoTTL after Persist, got %v", ttl)
+	}
+	if removed, _ := s.Persist("key"); removed {
+		t.Errorf("Expected Persist to report false for a key without expire")
+	}
+}
+
+func TestDataStore_ExpirationCycle(t *testing.T) {
+	s := datastore.NewDataStore()
+	for _, key := range []string{"key1", "key2", "key3"} {
+		s.SetWithTTL(key, "value", 10*time.Millisecond)
+	}
+	s.Set("key4", "value")
+
+	stop := s.StartExpirationCycle()
+	defer stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if s.StoredKeys() == 1 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("Expected the expiration cycle to delete expired keys")
+}
+
+func TestDataStore_JSONKeepsDeadlines(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.SetWithTTL("volatile", "value", time.Minute)
+	s.Set("persistent", "value")
+
+	encoded, err := s.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var restored datastore.DataStore
+	if err := restored.UnmarshalJSON(encoded); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ttl, _ := restored.TTL("volatile"); ttl <= 59*time.Second {
+		t.Errorf("Expected the deadline to survive encoding, got %v", ttl)
+	}
+	if ttl, _ := restored.TTL("persistent"); ttl != datastore.NoTTL {
+		t.Errorf("Expected NoTTL for the persistent key, got %v", ttl)
+	}
+}
@@ -0,0 +1,8 @@
+package datastore
+
+// StoredKeys returns the number of keys held in memory, including expired keys not reclaimed yet.
+func (s *DataStore) StoredKeys() int {
+	s.rlock()
+	defer s.runlock()
+	return len(s.Data)
+}
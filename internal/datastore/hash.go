@@ -0,0 +1,447 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Declared hash errors
+var (
+	ErrHashValueNotInteger = &DataStoreError{Message: "hash value is not an integer"}
+	ErrOverflow            = &DataStoreError{Message: "increment or decrement would overflow"}
+)
+
+const (
+	// hashFieldOverhead approximates the bookkeeping memory of a field of a hash.
+	hashFieldOverhead = 32
+	// hashCommandBatch is the number of fields set by each command recreating a hash.
+	hashCommandBatch = 64
+)
+
+// Hash maps fields to string values under a single key. Hashes are modified in place through the
+// H methods of the datastore, and must not be modified once stored. Empty hashes are never stored:
+// deleting the last field removes the key.
+type Hash struct {
+	fields map[string]string
+	size   int64
+	// index orders the fields for HScan
+	index scanIndex
+}
+
+// NewHash returns a hash holding fieldValues, a list of field-value pairs.
+func NewHash(fieldValues ...string) *Hash {
+	h := &Hash{fields: make(map[string]string, len(fieldValues)/2)}
+	for i := 0; i+1 < len(fieldValues); i += 2 {
+		h.set(fieldValues[i], fieldValues[i+1])
+	}
+	return h
+}
+
+// Len returns the number of fields of the hash.
+func (h *Hash) Len() int { return len(h.fields) }
+
+// Fields returns a copy of the fields of the hash and their values.
+func (h *Hash) Fields() map[string]string {
+	fields := make(map[string]string, len(h.fields))
+	for field, value := range h.fields {
+		fields[field] = value
+	}
+	return fields
+}
+
+// Clone returns a copy of the hash that shares no mutable state with it.
+func (h *Hash) Clone() interface{} {
+	c := &Hash{fields: h.Fields(), size: h.size}
+	for field := range c.fields {
+		c.index.add(field)
+	}
+	return c
+}
+
+// MemoryUsage approximates the memory used by the hash.
+func (h *Hash) MemoryUsage() int64 { return h.size }
+
+// set sets field to value and reports whether the field is new.
+func (h *Hash) set(field, value string) bool {
+	old, exists := h.fields[field]
+	if exists {
+		h.size += int64(len(value) - len(old))
+	} else {
+		h.size += hashFieldSize(field, value)
+		h.index.add(field)
+	}
+	h.fields[field] = value
+	return !exists
+}
+
+// del removes field and reports whether it existed.
+func (h *Hash) del(field string) bool {
+	value, exists := h.fields[field]
+	if exists {
+		h.size -= hashFieldSize(field, value)
+		delete(h.fields, field)
+		h.index.remove(field)
+	}
+	return exists
+}
+
+// sortedFields returns the fields of the hash, sorted.
+func (h *Hash) sortedFields() []string {
+	fields := make([]string, 0, len(h.fields))
+	for field := range h.fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// hashFieldSize approximates the memory used by a field and its value.
+func hashFieldSize(field, value string) int64 {
+	return int64(len(field)+len(value)) + hashFieldOverhead
+}
+
+// hashCommands returns the commands that recreate h under key with Apply.
+func hashCommands(key string, h *Hash) [][]string {
+	fields := h.sortedFields()
+	var commands [][]string
+	for i := 0; i < len(fields); i += hashCommandBatch {
+		name := "HSET"
+		if i == 0 {
+			name = "HCREATE"
+		}
+		args := []string{name, key}
+		for _, field := range fields[i:min(i+hashCommandBatch, len(fields))] {
+			args = append(args, field, h.fields[field])
+		}
+		commands = append(commands, args)
+	}
+	return commands
+}
+
+// lookupHash returns the hash stored under key, nil when there is none. Caller must hold mu.
+func (s *DataStore) lookupHash(key string) (*Hash, error) {
+	value, ok := s.Data[key]
+	if !ok || s.isExpired(key, time.Now()) {
+		return nil, nil
+	}
+	h, ok := value.(*Hash)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return h, nil
+}
+
+// writeHash returns the hash stored under key, nil when there is none, before it is modified.
+// The hash must be stored again once modified. Caller must hold mu for writing.
+func (s *DataStore) writeHash(key string) (*Hash, error) {
+	s.expireIfNeeded(key)
+	h, err := s.lookupHash(key)
+	if h != nil {
+		s.preserve(key)
+	}
+	return h, err
+}
+
+// HSet sets fields of the hash stored under key, creating the hash when needed. fieldValues is a list
+// of field-value pairs. It returns the number of fields that did not exist.
+func (s *DataStore) HSet(key string, fieldValues ...string) (int, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	if len(fieldValues) == 0 || len(fieldValues)%2 != 0 {
+		return 0, fmt.Errorf("fields must be field-value pairs")
+	}
+	s.lock()
+	defer s.unlock()
+
+	h, err := s.lookupHash(key)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for i := 0; i < len(fieldValues); i += 2 {
+		size += hashFieldSize(fieldValues[i], fieldValues[i+1])
+	}
+	if h == nil {
+		size += entryOverhead + int64(len(key))
+	}
+	if err := s.makeRoom(size, h == nil, key); err != nil {
+		return 0, err
+	}
+
+	added := s.setHash(key, fieldValues)
+	s.propagate(append([]string{"HSET", key}, fieldValues...)...)
+	if h == nil {
+		s.capNewKey(key)
+	}
+	return added, nil
+}
+
+// setHash sets fields of the hash stored under key, creating it when needed, and returns the number of
+// new fields. Caller must hold mu for writing and have checked that key holds no other kind of value.
+func (s *DataStore) setHash(key string, fieldValues []string) int {
+	h, _ := s.writeHash(key)
+	if h == nil {
+		h = NewHash()
+	}
+	added := 0
+	for i := 0; i+1 < len(fieldValues); i += 2 {
+		if h.set(fieldValues[i], fieldValues[i+1]) {
+			added++
+		}
+	}
+	s.store(key, h)
+	return added
+}
+
+// HGet returns the value of field in the hash stored under key, false when there is no such field.
+func (s *DataStore) HGet(key, field string) (string, bool, error) {
+	s.rlock()
+	defer s.runlock()
+	h, err := s.lookupHash(key)
+	if h == nil {
+		return "", false, err
+	}
+	s.touch(key)
+	value, ok := h.fields[field]
+	return value, ok, nil
+}
+
+// HMGet returns the values of fields in the hash stored under key, nil for the missing ones.
+func (s *DataStore) HMGet(key string, fields ...string) ([]interface{}, error) {
+	s.rlock()
+	defer s.runlock()
+	h, err := s.lookupHash(key)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(fields))
+	if h == nil {
+		return values, nil
+	}
+	s.touch(key)
+	for i, field := range fields {
+		if value, ok := h.fields[field]; ok {
+			values[i] = value
+		}
+	}
+	return values, nil
+}
+
+// HGetAll returns a copy of the fields of the hash stored under key and their values, nil when there
+// is no such hash.
+func (s *DataStore) HGetAll(key string) (map[string]string, error) {
+	s.rlock()
+	defer s.runlock()
+	h, err := s.lookupHash(key)
+	if h == nil {
+		return nil, err
+	}
+	s.touch(key)
+	return h.Fields(), nil
+}
+
+// HDel removes fields from the hash stored under key and returns the number of fields removed.
+// The key is removed along with its last field.
+func (s *DataStore) HDel(key string, fields ...string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	h, err := s.writeHash(key)
+	if h == nil {
+		return 0, err
+	}
+	var removed []string
+	for _, field := range fields {
+		if h.del(field) {
+			removed = append(removed, field)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	s.storeHash(key, h)
+	s.propagate(append([]string{"HDEL", key}, removed...)...)
+	return len(removed), nil
+}
+
+// storeHash stores h under key once modified, removing key when h is empty. Caller must hold mu for writing.
+func (s *DataStore) storeHash(key string, h *Hash) {
+	if h.Len() == 0 {
+		s.unstore(key)
+	} else {
+		s.store(key, h)
+	}
+}
+
+// HIncrBy adds increment to the integer held by field in the hash stored under key, creating the hash
+// and the field, set to zero, when needed. It returns the new value.
+func (s *DataStore) HIncrBy(key, field string, increment int64) (int64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	s.lock()
+	defer s.unlock()
+
+	h, err := s.lookupHash(key)
+	if err != nil {
+		return 0, err
+	}
+	var current int64
+	old, exists := "", false
+	if h != nil {
+		old, exists = h.fields[field]
+	}
+	if exists {
+		if current, err = strconv.ParseInt(old, 10, 64); err != nil {
+			return 0, ErrHashValueNotInteger
+		}
+	}
+	if (increment > 0 && current > math.MaxInt64-increment) || (increment < 0 && current < math.MinInt64-increment) {
+		return 0, ErrOverflow
+	}
+	value := strconv.FormatInt(current+increment, 10)
+	size := hashFieldSize(field, value)
+	if exists {
+		size = int64(len(value) - len(old))
+	}
+	if h == nil {
+		size += entryOverhead + int64(len(key))
+	}
+	if err := s.makeRoom(size, h == nil, key); err != nil {
+		return 0, err
+	}
+
+	// The new value is propagated rather than the increment, so that replaying it twice is harmless
+	s.setHash(key, []string{field, value})
+	s.propagate("HSET", key, field, value)
+	if h == nil {
+		s.capNewKey(key)
+	}
+	return current + increment, nil
+}
+
+// HExists reports whether field exists in the hash stored under key.
+func (s *DataStore) HExists(key, field string) (bool, error) {
+	s.rlock()
+	defer s.runlock()
+	h, err := s.lookupHash(key)
+	if h == nil {
+		return false, err
+	}
+	_, ok := h.fields[field]
+	return ok, nil
+}
+
+// HLen returns the number of fields of the hash stored under key, zero when there is no such hash.
+func (s *DataStore) HLen(key string) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	h, err := s.lookupHash(key)
+	if h == nil {
+		return 0, err
+	}
+	return h.Len(), nil
+}
+
+// HScan returns about count fields of the hash stored under key, starting at cursor, as field-value
+// pairs, along with the cursor to continue from: zero once every field was returned. A scan started
+// with cursor zero returns every field present during the whole scan at least once.
+func (s *DataStore) HScan(key string, cursor uint64, count int) (uint64, []string, error) {
+	s.rlock()
+	defer s.runlock()
+	h, err := s.lookupHash(key)
+	if h == nil {
+		return 0, nil, err
+	}
+	next, batch := h.index.scan(cursor, count, nil)
+	fieldValues := make([]string, 0, 2*len(batch))
+	for _, field := range batch {
+		fieldValues = append(fieldValues, field, h.fields[field])
+	}
+	return next, fieldValues, nil
+}
+
+// isHashCommand reports whether name is a hash command propagated by the datastore.
+func isHashCommand(name string) bool {
+	return name == "HCREATE" || name == "HSET" || name == "HDEL"
+}
+
+// applyHash replays a hash command produced by a Propagator:
+//
+//	HCREATE key field value [field value ...]
+//	HSET key field value [field value ...]
+//	HDEL key field [field ...]
+//
+// HCREATE replaces any value stored under key, like SET. Caller must hold mu for writing.
+func (s *DataStore) applyHash(name string, args []string) error {
+	if len(args) < 3 || (name != "HDEL" && len(args)%2 != 0) {
+		return fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	key := args[1]
+	if name == "HCREATE" {
+		h := NewHash(args[2:]...)
+		s.makeRoom(estimateSize(key, h)-s.storedSize(key), s.Data[key] == nil, key)
+		s.store(key, h)
+		s.clearDeadline(key)
+		return nil
+	}
+
+	s.expireIfNeeded(key)
+	h, err := s.lookupHash(key)
+	if err != nil {
+		return err
+	}
+	if name == "HSET" {
+		var size int64
+		for i := 2; i < len(args); i += 2 {
+			size += hashFieldSize(args[i], args[i+1])
+		}
+		s.makeRoom(size, h == nil, key)
+		s.setHash(key, args[2:])
+	} else if h != nil {
+		s.preserve(key)
+		for _, field := range args[2:] {
+			h.del(field)
+		}
+		s.storeHash(key, h)
+	}
+	return nil
+}
+
+// errCorruptHash is returned by UnmarshalBinary for data that MarshalBinary did not produce.
+var errCorruptHash = errors.New("corrupt hash encoding")
+
+// MarshalBinary encodes the fields of the hash and their values, sorted by field.
+func (h *Hash) MarshalBinary() ([]byte, error) {
+	b := binary.AppendUvarint(nil, uint64(len(h.fields)))
+	for _, field := range h.sortedFields() {
+		for _, s := range []string{field, h.fields[field]} {
+			b = binary.AppendUvarint(b, uint64(len(s)))
+			b = append(b, s...)
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a hash encoded by MarshalBinary.
+func (h *Hash) UnmarshalBinary(data []byte) error {
+	d := streamDecoder{data: data}
+	n := d.length()
+	decoded := NewHash()
+	for i := 0; i < n && d.err == nil; i++ {
+		if !decoded.set(d.string(), d.string()) {
+			return errCorruptHash
+		}
+	}
+	if d.err != nil || d.pos != len(data) || n == 0 {
+		return errCorruptHash
+	}
+	*h = *decoded
+	return nil
+}
@@ -0,0 +1,163 @@
+package datastore_test
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_HashFields(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if added, err := s.HSet("h", "a", "1", "b", "2"); err != nil || added != 2 {
+		t.Fatalf("Expected 2 fields added, got %d, %v", added, err)
+	}
+	if added, _ := s.HSet("h", "b", "3", "c", "4"); added != 1 {
+		t.Errorf("Expected only the new field to be counted, got %d", added)
+	}
+	if value, ok, _ := s.HGet("h", "b"); !ok || value != "3" {
+		t.Errorf("Expected the updated value, got %q, %v", value, ok)
+	}
+	if values, _ := s.HMGet("h", "a", "missing"); !reflect.DeepEqual(values, []interface{}{"1", nil}) {
+		t.Errorf("Expected nil for the missing field, got %v", values)
+	}
+	if fields, _ := s.HGetAll("h"); !reflect.DeepEqual(fields, map[string]string{"a": "1", "b": "3", "c": "4"}) {
+		t.Errorf("Expected every field, got %v", fields)
+	}
+	if exists, _ := s.HExists("h", "c"); !exists {
+		t.Error("Expected the field to exist")
+	}
+
+	if removed, _ := s.HDel("h", "a", "missing"); removed != 1 {
+		t.Errorf("Expected 1 field removed, got %d", removed)
+	}
+	if n, _ := s.HLen("h"); n != 2 {
+		t.Errorf("Expected 2 fields left, got %d", n)
+	}
+	s.HDel("h", "b", "c")
+	if _, err := s.Get("h"); err != datastore.ErrKeyNotFound {
+		t.Error("Expected deleting the last field to remove the key")
+	}
+
+	s.Set("string", "value")
+	if _, err := s.HSet("string", "a", "1"); err != datastore.ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	s.HSet("hash", "a", "1")
+	if _, err := s.LLen("hash"); err != datastore.ErrWrongType {
+		t.Errorf("Expected LLEN of a hash to fail with ErrWrongType, got %v", err)
+	}
+}
+
+func TestDataStore_HIncrBy(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if value, err := s.HIncrBy("h", "n", 5); err != nil || value != 5 {
+		t.Fatalf("Expected a missing field to start at zero, got %d, %v", value, err)
+	}
+	if value, _ := s.HIncrBy("h", "n", -7); value != -2 {
+		t.Errorf("Expected -2, got %d", value)
+	}
+	s.HSet("h", "text", "abc", "max", strconv.FormatInt(math.MaxInt64, 10))
+	if _, err := s.HIncrBy("h", "text", 1); err != datastore.ErrHashValueNotInteger {
+		t.Errorf("Expected ErrHashValueNotInteger, got %v", err)
+	}
+	if _, err := s.HIncrBy("h", "max", 1); err != datastore.ErrOverflow {
+		t.Errorf("Expected ErrOverflow, got %v", err)
+	}
+}
+
+func TestDataStore_HScan(t *testing.T) {
+	s := datastore.NewDataStore()
+	for i := 0; i < 100; i++ {
+		s.HSet("h", "field"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+
+	seen := make(map[string]bool)
+	var cursor uint64
+	for calls := 0; ; calls++ {
+		if calls > 100 {
+			t.Fatal("Expected the scan to complete")
+		}
+		next, fieldValues, err := s.HScan("h", cursor, 7)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(fieldValues) > 2*7 {
+			t.Errorf("Expected a page of at most 7 fields, got %d", len(fieldValues)/2)
+		}
+		for i := 0; i < len(fieldValues); i += 2 {
+			seen[fieldValues[i]] = true
+		}
+		// Fields removed or added during the scan do not affect the other ones
+		if calls == 3 {
+			s.HDel("h", "field0", "field1")
+			s.HSet("h", "new", "value")
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	for i := 2; i < 100; i++ {
+		if field := "field" + strconv.Itoa(i); !seen[field] {
+			t.Errorf("Expected the scan to return %s", field)
+		}
+	}
+}
+
+func TestDataStore_ApplyReplaysHashes(t *testing.T) {
+	source := datastore.NewDataStore()
+	replica := datastore.NewDataStore()
+	source.AddPropagator(func(args []string) {
+		if err := replica.Apply(args); err != nil {
+			t.Errorf("Expected no error applying %v, got %v", args, err)
+		}
+	})
+
+	for i := 0; i < 100; i++ {
+		source.HSet("h", "f"+strconv.Itoa(i), "v")
+	}
+	source.HIncrBy("h", "counter", 3)
+	source.HDel("h", "f0", "f1")
+	source.HSet("gone", "a", "1")
+	source.HDel("gone", "a")
+
+	expected, _ := source.HGetAll("h")
+	if fields, _ := replica.HGetAll("h"); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+	if _, err := replica.Get("gone"); err != datastore.ErrKeyNotFound {
+		t.Error("Expected the emptied hash to be removed")
+	}
+
+	// The commands of an entry recreate the hash on an empty datastore
+	restored := datastore.NewDataStore()
+	for _, entry := range source.Snapshot(nil) {
+		for _, args := range datastore.EntryCommands(entry) {
+			if err := restored.Apply(args); err != nil {
+				t.Fatalf("Expected no error applying %v, got %v", args, err)
+			}
+		}
+	}
+	if fields, _ := restored.HGetAll("h"); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+}
+
+func TestHash_MarshalBinary(t *testing.T) {
+	hash := datastore.NewHash("a", "1", "b", "")
+	data, _ := hash.MarshalBinary()
+	decoded := new(datastore.Hash)
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fields := decoded.Fields(); !reflect.DeepEqual(fields, map[string]string{"a": "1", "b": ""}) {
+		t.Errorf("Expected the same fields, got %v", fields)
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("Expected an error for truncated data")
+	}
+}
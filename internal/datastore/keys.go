@@ -0,0 +1,92 @@
+package datastore
+
+import (
+	"sort"
+	"time"
+)
+
+// Scan returns about count keys, starting at cursor, along with the cursor of the next call, zero once
+// every key was returned. A scan started with cursor zero returns every key present from its start to its
+// end exactly once, whatever keys are written meanwhile; keys added or removed during the scan may be
+// returned or not. Values are not read, so a scan does not count as an access for eviction.
+func (s *DataStore) Scan(cursor uint64, count int) (uint64, []string) {
+	s.rlock()
+	defer s.runlock()
+	now := time.Now()
+	return s.index.scan(cursor, count, func(key string) bool { return !s.isExpired(key, now) })
+}
+
+// Keys returns every key that has not expired yet, sorted. Prefer Scan for large datastores, which
+// reads them a few at a time.
+func (s *DataStore) Keys() []string {
+	s.rlock()
+	defer s.runlock()
+	keys := s.liveKeys(time.Now())
+	sort.Strings(keys)
+	return keys
+}
+
+// liveKeys returns the keys whose deadline is after now. Caller must hold mu.
+func (s *DataStore) liveKeys(now time.Time) []string {
+	keys := make([]string, 0, len(s.Data))
+	for key := range s.Data {
+		if !s.isExpired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// DBSize returns the number of keys that have not expired yet.
+func (s *DataStore) DBSize() int {
+	s.rlock()
+	defer s.runlock()
+	now := time.Now()
+	n := len(s.Data)
+	for key := range s.ttlMap {
+		if s.isExpired(key, now) {
+			n--
+		}
+	}
+	return n
+}
+
+// Exists returns how many of keys exist, whatever the type of their value, counting a key as many
+// times as it is given.
+func (s *DataStore) Exists(keys ...string) int {
+	s.rlock()
+	defer s.runlock()
+	now := time.Now()
+	n := 0
+	for _, key := range keys {
+		if _, ok := s.Data[key]; ok && !s.isExpired(key, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// Type returns the type of the value held by key, as named by TYPE: string, list, hash, set, zset or
+// stream, and none when the key does not exist.
+func (s *DataStore) Type(key string) string {
+	s.rlock()
+	defer s.runlock()
+	value, ok := s.Data[key]
+	if !ok || s.isExpired(key, time.Now()) {
+		return "none"
+	}
+	switch value.(type) {
+	case *List:
+		return "list"
+	case *Hash:
+		return "hash"
+	case *Set:
+		return "set"
+	case *SortedSet:
+		return "zset"
+	case *Stream:
+		return "stream"
+	default:
+		return "string"
+	}
+}
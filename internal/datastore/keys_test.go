@@ -0,0 +1,74 @@
+package datastore_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_Scan(t *testing.T) {
+	s := datastore.NewDataStore()
+	for i := 0; i < 100; i++ {
+		s.Set(fmt.Sprintf("key:%d", i), i)
+	}
+
+	// Keys present during the whole scan are returned once, whatever is written meanwhile
+	seen := make(map[string]int)
+	cursor, calls := uint64(0), 0
+	for {
+		next, keys := s.Scan(cursor, 7)
+		if len(keys) > 7 {
+			t.Errorf("Expected a page of at most 7 keys, got %d", len(keys))
+		}
+		for _, key := range keys {
+			seen[key]++
+		}
+		s.Set(fmt.Sprintf("added:%d", calls), calls)
+		s.Delete(fmt.Sprintf("key:%d", 50+calls))
+		calls++
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		if i >= 50 && i < 50+calls {
+			continue
+		}
+		if seen[key] != 1 {
+			t.Errorf("Expected %s to be returned once, got %d", key, seen[key])
+		}
+	}
+	for key, n := range seen {
+		if n > 1 {
+			t.Errorf("Expected %s to be returned once, got %d", key, n)
+		}
+	}
+}
+
+func TestDataStore_KeysAndDBSize(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("b", "1")
+	s.Set("a", "1")
+	s.RPush("list", "x")
+	s.SetWithTTL("expired", "1", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if keys := s.Keys(); !reflect.DeepEqual(keys, []string{"a", "b", "list"}) {
+		t.Errorf("Expected the live keys sorted, got %v", keys)
+	}
+	if n := s.DBSize(); n != 3 {
+		t.Errorf("Expected 3 keys, got %d", n)
+	}
+	if n := s.Exists("a", "list", "a", "expired", "missing"); n != 3 {
+		t.Errorf("Expected 3, got %d", n)
+	}
+	for key, expected := range map[string]string{"a": "string", "list": "list", "expired": "none", "missing": "none"} {
+		if valueType := s.Type(key); valueType != expected {
+			t.Errorf("Expected the type of %s to be %s, got %s", key, expected, valueType)
+		}
+	}
+}
@@ -0,0 +1,621 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Declared list errors
+var (
+	ErrIndexOutOfRange = &DataStoreError{Message: "index out of range"}
+)
+
+const (
+	// listElementOverhead approximates the bookkeeping memory of a list element.
+	listElementOverhead = 16
+	// listCommandBatch is the number of elements pushed by each command recreating a list.
+	listCommandBatch = 64
+)
+
+// ListSide is an end of a list.
+type ListSide int
+
+const (
+	ListLeft ListSide = iota
+	ListRight
+)
+
+// ParseListSide parses LEFT or RIGHT, in any case.
+func ParseListSide(s string) (ListSide, bool) {
+	switch strings.ToUpper(s) {
+	case "LEFT":
+		return ListLeft, true
+	case "RIGHT":
+		return ListRight, true
+	}
+	return ListLeft, false
+}
+
+func (side ListSide) String() string {
+	if side == ListRight {
+		return "RIGHT"
+	}
+	return "LEFT"
+}
+
+// List is a sequence of strings that grows and shrinks at both ends. Lists are modified in place
+// through the L methods of the datastore, and must not be modified once stored. Empty lists are
+// never stored: popping the last element removes the key.
+type List struct {
+	// values is a ring buffer holding the elements from head on
+	values []string
+	head   int
+	n      int
+	size   int64
+}
+
+// NewList returns a list holding values.
+func NewList(values ...string) *List {
+	l := &List{}
+	for _, value := range values {
+		l.push(ListRight, value)
+	}
+	return l
+}
+
+// Len returns the number of elements of the list.
+func (l *List) Len() int { return l.n }
+
+// Values returns a copy of the elements of the list.
+func (l *List) Values() []string {
+	values := make([]string, l.n)
+	for i := range values {
+		values[i] = l.at(i)
+	}
+	return values
+}
+
+// Clone returns a copy of the list that shares no mutable state with it.
+func (l *List) Clone() interface{} {
+	return &List{values: l.Values(), n: l.n, size: l.size}
+}
+
+// MemoryUsage approximates the memory used by the list.
+func (l *List) MemoryUsage() int64 { return l.size }
+
+// at returns the element at index i, which must be in range.
+func (l *List) at(i int) string {
+	return l.values[(l.head+i)%len(l.values)]
+}
+
+// set replaces the element at index i, which must be in range.
+func (l *List) set(i int, value string) {
+	j := (l.head + i) % len(l.values)
+	l.size += int64(len(value) - len(l.values[j]))
+	l.values[j] = value
+}
+
+// push adds value at side of the list.
+func (l *List) push(side ListSide, value string) {
+	if l.n == len(l.values) {
+		grown := make([]string, max(2*l.n, 4))
+		for i := 0; i < l.n; i++ {
+			grown[i] = l.at(i)
+		}
+		l.values, l.head = grown, 0
+	}
+	if side == ListLeft {
+		l.head = (l.head - 1 + len(l.values)) % len(l.values)
+		l.values[l.head] = value
+	} else {
+		l.values[(l.head+l.n)%len(l.values)] = value
+	}
+	l.n++
+	l.size += int64(len(value)) + listElementOverhead
+}
+
+// pop removes the element at side of the list, which must not be empty, and returns it.
+func (l *List) pop(side ListSide) string {
+	j := l.head
+	if side == ListRight {
+		j = (l.head + l.n - 1) % len(l.values)
+	} else {
+		l.head = (l.head + 1) % len(l.values)
+	}
+	value := l.values[j]
+	l.values[j] = ""
+	l.n--
+	l.size -= int64(len(value)) + listElementOverhead
+	return value
+}
+
+// index returns the position index refers to, negative indexes counting from the end, and whether it is in range.
+func (l *List) index(index int) (int, bool) {
+	if index < 0 {
+		index += l.n
+	}
+	return index, index >= 0 && index < l.n
+}
+
+// span returns the positions between start and stop inclusive, negative indexes counting from the end,
+// clamped to the list. It returns false when the span is empty.
+func (l *List) span(start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += l.n
+	}
+	if stop < 0 {
+		stop += l.n
+	}
+	start, stop = max(start, 0), min(stop, l.n-1)
+	return start, stop, start <= stop
+}
+
+// trim keeps the elements between positions start and stop inclusive, which must be in range.
+func (l *List) trim(start, stop int) {
+	for l.n > stop+1 {
+		l.pop(ListRight)
+	}
+	for range start {
+		l.pop(ListLeft)
+	}
+}
+
+// listValuesSize approximates the memory values use once pushed on a list.
+func listValuesSize(values []string) int64 {
+	size := int64(len(values)) * listElementOverhead
+	for _, value := range values {
+		size += int64(len(value))
+	}
+	return size
+}
+
+// listCommands returns the commands that recreate l under key with Apply.
+func listCommands(key string, l *List) [][]string {
+	values := l.Values()
+	var commands [][]string
+	for i := 0; i < len(values); i += listCommandBatch {
+		name := "RPUSH"
+		if i == 0 {
+			name = "LCREATE"
+		}
+		batch := values[i:min(i+listCommandBatch, len(values))]
+		commands = append(commands, append([]string{name, key}, batch...))
+	}
+	return commands
+}
+
+// lookupList returns the list stored under key, nil when there is none. Caller must hold mu.
+func (s *DataStore) lookupList(key string) (*List, error) {
+	value, ok := s.Data[key]
+	if !ok || s.isExpired(key, time.Now()) {
+		return nil, nil
+	}
+	l, ok := value.(*List)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return l, nil
+}
+
+// writeList returns the list stored under key, nil when there is none, before it is modified.
+// The list must be stored again with storeList once modified. Caller must hold mu for writing.
+func (s *DataStore) writeList(key string) (*List, error) {
+	s.expireIfNeeded(key)
+	l, err := s.lookupList(key)
+	if l != nil {
+		s.preserve(key)
+	}
+	return l, err
+}
+
+// storeList stores l under key once modified, removing key when l is empty. Caller must hold mu for writing.
+func (s *DataStore) storeList(key string, l *List) {
+	if l.Len() == 0 {
+		s.unstore(key)
+	} else {
+		s.store(key, l)
+	}
+}
+
+// LPush inserts values at the head of the list stored under key, creating the list when needed, one
+// after the other: the last value ends up first. It returns the length of the list.
+func (s *DataStore) LPush(key string, values ...string) (int, error) {
+	return s.push(key, ListLeft, values)
+}
+
+// RPush appends values to the list stored under key, creating the list when needed, and returns its length.
+func (s *DataStore) RPush(key string, values ...string) (int, error) {
+	return s.push(key, ListRight, values)
+}
+
+func (s *DataStore) push(key string, side ListSide, values []string) (int, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, fmt.Errorf("no values to push")
+	}
+	s.lock()
+	defer s.unlock()
+
+	l, err := s.lookupList(key)
+	if err != nil {
+		return 0, err
+	}
+	size := listValuesSize(values)
+	if l == nil {
+		size += entryOverhead + int64(len(key))
+	}
+	if err := s.makeRoom(size, l == nil, key); err != nil {
+		return 0, err
+	}
+
+	n := s.pushList(key, side, values)
+	s.propagate(append([]string{pushCommand(side), key}, values...)...)
+	if l == nil {
+		s.capNewKey(key)
+	}
+	return n, nil
+}
+
+// pushList pushes values at side of the list stored under key, creating it when needed, and returns
+// its length. Caller must hold mu for writing and have checked that key holds no other kind of value.
+func (s *DataStore) pushList(key string, side ListSide, values []string) int {
+	l, _ := s.writeList(key)
+	if l == nil {
+		l = &List{}
+	}
+	for _, value := range values {
+		l.push(side, value)
+	}
+	s.store(key, l)
+	return l.Len()
+}
+
+func pushCommand(side ListSide) string {
+	if side == ListLeft {
+		return "LPUSH"
+	}
+	return "RPUSH"
+}
+
+func popCommand(side ListSide) string {
+	if side == ListLeft {
+		return "LPOP"
+	}
+	return "RPOP"
+}
+
+// LPop removes and returns up to count elements from the head of the list stored under key.
+// It returns nil when there is no such list.
+func (s *DataStore) LPop(key string, count int) ([]string, error) {
+	return s.pop(key, ListLeft, count)
+}
+
+// RPop removes and returns up to count elements from the tail of the list stored under key, last one first.
+// It returns nil when there is no such list.
+func (s *DataStore) RPop(key string, count int) ([]string, error) {
+	return s.pop(key, ListRight, count)
+}
+
+func (s *DataStore) pop(key string, side ListSide, count int) ([]string, error) {
+	if count < 0 {
+		return nil, fmt.Errorf("count must be positive")
+	}
+	s.lock()
+	defer s.unlock()
+
+	l, err := s.writeList(key)
+	if l == nil {
+		return nil, err
+	}
+	values := s.popList(key, l, side, count)
+	if len(values) > 0 {
+		s.propagate(popCommand(side), key, strconv.Itoa(len(values)))
+	}
+	return values, nil
+}
+
+// popList pops up to count elements at side of l, stored under key. Caller must hold mu for writing.
+func (s *DataStore) popList(key string, l *List, side ListSide, count int) []string {
+	values := make([]string, 0, min(count, l.Len()))
+	for l.Len() > 0 && len(values) < count {
+		values = append(values, l.pop(side))
+	}
+	s.storeList(key, l)
+	return values
+}
+
+// LLen returns the length of the list stored under key, zero when there is no such list.
+func (s *DataStore) LLen(key string) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	l, err := s.lookupList(key)
+	if l == nil {
+		return 0, err
+	}
+	return l.Len(), nil
+}
+
+// LRange returns the elements of the list stored under key between start and stop inclusive. Negative
+// indexes count from the end of the list, -1 being the last element. Out of range indexes are clamped.
+func (s *DataStore) LRange(key string, start, stop int) ([]string, error) {
+	s.rlock()
+	defer s.runlock()
+	l, err := s.lookupList(key)
+	if l == nil {
+		return nil, err
+	}
+	s.touch(key)
+
+	from, to, ok := l.span(start, stop)
+	if !ok {
+		return []string{}, nil
+	}
+	values := make([]string, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		values = append(values, l.at(i))
+	}
+	return values, nil
+}
+
+// LIndex returns the element at index of the list stored under key, negative indexes counting from
+// the end. It returns false when there is no such element.
+func (s *DataStore) LIndex(key string, index int) (string, bool, error) {
+	s.rlock()
+	defer s.runlock()
+	l, err := s.lookupList(key)
+	if l == nil {
+		return "", false, err
+	}
+	s.touch(key)
+	i, ok := l.index(index)
+	if !ok {
+		return "", false, nil
+	}
+	return l.at(i), true, nil
+}
+
+// LSet replaces the element at index of the list stored under key, negative indexes counting from the end.
+func (s *DataStore) LSet(key string, index int, value string) error {
+	s.lock()
+	defer s.unlock()
+
+	l, err := s.lookupList(key)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return ErrKeyNotFound
+	}
+	i, ok := l.index(index)
+	if !ok {
+		return ErrIndexOutOfRange
+	}
+	if err := s.makeRoom(int64(len(value)-len(l.at(i))), false, key); err != nil {
+		return err
+	}
+
+	s.preserve(key)
+	l.set(i, value)
+	s.store(key, l)
+	s.propagate("LSET", key, strconv.Itoa(i), value)
+	return nil
+}
+
+// LTrim keeps the elements of the list stored under key between start and stop inclusive, indexes being
+// interpreted like LRange. The key is removed when no element remains.
+func (s *DataStore) LTrim(key string, start, stop int) error {
+	s.lock()
+	defer s.unlock()
+
+	l, err := s.writeList(key)
+	if l == nil {
+		return err
+	}
+	from, to, ok := l.span(start, stop)
+	if ok && from == 0 && to == l.Len()-1 {
+		return nil
+	}
+	if !ok {
+		// An empty range is propagated as such, whatever the length of the list
+		from, to = 1, 0
+	}
+	s.trimList(key, l, from, to)
+	s.propagate("LTRIM", key, strconv.Itoa(from), strconv.Itoa(to))
+	return nil
+}
+
+// trimList keeps the elements of l, stored under key, between positions start and stop inclusive,
+// removing them all when the span is empty or out of range. Caller must hold mu for writing.
+func (s *DataStore) trimList(key string, l *List, start, stop int) {
+	if start < 0 || start > stop || stop >= l.Len() {
+		l.trim(l.Len(), l.Len()-1)
+	} else {
+		l.trim(start, stop)
+	}
+	s.storeList(key, l)
+}
+
+// LMove pops an element at side from of the list stored under src and pushes it at side to of the list
+// stored under dst, creating it when needed. src and dst may be the same list, in which case it is rotated.
+// It returns the element moved, false when src holds no list.
+func (s *DataStore) LMove(src, dst string, from, to ListSide) (string, bool, error) {
+	if err := validateKey(dst); err != nil {
+		return "", false, err
+	}
+	s.lock()
+	defer s.unlock()
+
+	l, err := s.lookupList(src)
+	if l == nil {
+		return "", false, err
+	}
+	target, err := s.lookupList(dst)
+	if err != nil {
+		return "", false, err
+	}
+	if target == nil && src != dst {
+		if err := s.makeRoom(entryOverhead+int64(len(dst)), true, dst); err != nil {
+			return "", false, err
+		}
+		// Making room may have evicted src
+		if l, _ = s.lookupList(src); l == nil {
+			return "", false, nil
+		}
+	}
+
+	value := s.moveList(src, dst, from, to)
+	s.propagate("LMOVE", src, dst, from.String(), to.String())
+	if target == nil && src != dst {
+		s.capNewKey(dst)
+	}
+	return value, true, nil
+}
+
+// moveList moves an element between the lists stored under src, which must not be empty, and dst.
+// Caller must hold mu for writing and have checked that both keys hold lists or nothing.
+func (s *DataStore) moveList(src, dst string, from, to ListSide) string {
+	l, _ := s.writeList(src)
+	value := s.popList(src, l, from, 1)[0]
+	s.pushList(dst, to, []string{value})
+	return value
+}
+
+// isListCommand reports whether name is a list command propagated by the datastore.
+func isListCommand(name string) bool {
+	switch name {
+	case "LCREATE", "LPUSH", "RPUSH", "LPOP", "RPOP", "LSET", "LTRIM", "LMOVE":
+		return true
+	}
+	return false
+}
+
+// applyList replays a list command produced by a Propagator:
+//
+//	LCREATE key value [value ...]
+//	LPUSH key value [value ...]
+//	RPUSH key value [value ...]
+//	LPOP key count
+//	RPOP key count
+//	LSET key index value
+//	LTRIM key start stop
+//	LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+//
+// LCREATE replaces any value stored under key, like SET. Caller must hold mu for writing.
+func (s *DataStore) applyList(name string, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	key := args[1]
+	if name == "LCREATE" {
+		l := NewList(args[2:]...)
+		s.makeRoom(estimateSize(key, l)-s.storedSize(key), s.Data[key] == nil, key)
+		s.store(key, l)
+		s.clearDeadline(key)
+		return nil
+	}
+
+	s.expireIfNeeded(key)
+	l, err := s.lookupList(key)
+	if err != nil {
+		return err
+	}
+	switch {
+	case name == "LPUSH" || name == "RPUSH":
+		side := ListLeft
+		if name == "RPUSH" {
+			side = ListRight
+		}
+		s.makeRoom(listValuesSize(args[2:]), l == nil, key)
+		s.pushList(key, side, args[2:])
+	case (name == "LPOP" || name == "RPOP") && len(args) == 3:
+		count, err := strconv.Atoi(args[2])
+		if err != nil || count < 0 {
+			return fmt.Errorf("invalid count %q", args[2])
+		}
+		side := ListLeft
+		if name == "RPOP" {
+			side = ListRight
+		}
+		if l != nil {
+			s.preserve(key)
+			s.popList(key, l, side, count)
+		}
+	case name == "LSET" && len(args) == 4:
+		index, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid index %q", args[2])
+		}
+		if l == nil {
+			return ErrKeyNotFound
+		}
+		i, ok := l.index(index)
+		if !ok {
+			return ErrIndexOutOfRange
+		}
+		s.preserve(key)
+		l.set(i, args[3])
+		s.store(key, l)
+	case name == "LTRIM" && len(args) == 4:
+		start, err1 := strconv.Atoi(args[2])
+		stop, err2 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("invalid range %q %q", args[2], args[3])
+		}
+		if l != nil {
+			s.preserve(key)
+			s.trimList(key, l, start, stop)
+		}
+	case name == "LMOVE" && len(args) == 5:
+		from, ok1 := ParseListSide(args[3])
+		to, ok2 := ParseListSide(args[4])
+		if !ok1 || !ok2 {
+			return fmt.Errorf("invalid sides %q %q", args[3], args[4])
+		}
+		if _, err := s.lookupList(args[2]); err != nil {
+			return err
+		}
+		if l != nil {
+			s.makeRoom(entryOverhead+int64(len(args[2])), s.Data[args[2]] == nil, args[2])
+			if l, _ = s.lookupList(key); l != nil {
+				s.moveList(key, args[2], from, to)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown command %q with %d arguments", name, len(args)-1)
+	}
+	return nil
+}
+
+// errCorruptList is returned by UnmarshalBinary for data that MarshalBinary did not produce.
+var errCorruptList = errors.New("corrupt list encoding")
+
+// MarshalBinary encodes the elements of the list.
+func (l *List) MarshalBinary() ([]byte, error) {
+	b := binary.AppendUvarint(nil, uint64(l.n))
+	for i := 0; i < l.n; i++ {
+		value := l.at(i)
+		b = binary.AppendUvarint(b, uint64(len(value)))
+		b = append(b, value...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a list encoded by MarshalBinary.
+func (l *List) UnmarshalBinary(data []byte) error {
+	d := streamDecoder{data: data}
+	values := make([]string, d.length())
+	for i := range values {
+		values[i] = d.string()
+	}
+	if d.err != nil || d.pos != len(data) || len(values) == 0 {
+		return errCorruptList
+	}
+	*l = *NewList(values...)
+	return nil
+}
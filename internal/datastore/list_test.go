@@ -0,0 +1,171 @@
+package datastore_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_ListPushPop(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if n, err := s.RPush("l", "b", "c"); err != nil || n != 2 {
+		t.Fatalf("Expected a list of 2 elements, got %d, %v", n, err)
+	}
+	if n, _ := s.LPush("l", "a", "z"); n != 4 {
+		t.Errorf("Expected a list of 4 elements, got %d", n)
+	}
+	if values, _ := s.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"z", "a", "b", "c"}) {
+		t.Errorf("Expected LPUSH to insert its values one after the other, got %v", values)
+	}
+	if values, _ := s.LPop("l", 1); !reflect.DeepEqual(values, []string{"z"}) {
+		t.Errorf("Expected to pop the head, got %v", values)
+	}
+	if values, _ := s.RPop("l", 2); !reflect.DeepEqual(values, []string{"c", "b"}) {
+		t.Errorf("Expected to pop the tail last element first, got %v", values)
+	}
+
+	// Popping the last element removes the key
+	if values, _ := s.RPop("l", 5); !reflect.DeepEqual(values, []string{"a"}) {
+		t.Errorf("Expected the remaining element, got %v", values)
+	}
+	if values, err := s.LPop("l", 1); values != nil || err != nil {
+		t.Errorf("Expected nil for a missing list, got %v, %v", values, err)
+	}
+	if _, err := s.Get("l"); err != datastore.ErrKeyNotFound {
+		t.Error("Expected the empty list to be removed")
+	}
+
+	s.Set("string", "value")
+	if _, err := s.LPush("string", "a"); err != datastore.ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	s.RPush("list", "a")
+	if _, err := s.Get("list"); err != datastore.ErrWrongType {
+		t.Errorf("Expected GET of a list to fail with ErrWrongType, got %v", err)
+	}
+	if _, err := s.XLen("list"); err != datastore.ErrWrongType {
+		t.Errorf("Expected XLEN of a list to fail with ErrWrongType, got %v", err)
+	}
+}
+
+func TestDataStore_ListIndexes(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.RPush("l", "a", "b", "c", "d", "e")
+
+	if values, _ := s.LRange("l", -3, 100); !reflect.DeepEqual(values, []string{"c", "d", "e"}) {
+		t.Errorf("Expected negative and out of range indexes to be clamped, got %v", values)
+	}
+	if values, _ := s.LRange("l", 3, 1); len(values) != 0 {
+		t.Errorf("Expected an empty range, got %v", values)
+	}
+	if value, ok, _ := s.LIndex("l", -1); !ok || value != "e" {
+		t.Errorf("Expected the last element, got %q, %v", value, ok)
+	}
+	if _, ok, _ := s.LIndex("l", 5); ok {
+		t.Error("Expected no element out of range")
+	}
+
+	if err := s.LSet("l", 1, "B"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := s.LSet("l", 9, "x"); err != datastore.ErrIndexOutOfRange {
+		t.Errorf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+	if err := s.LSet("missing", 0, "x"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	s.LTrim("l", 1, -2)
+	if values, _ := s.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"B", "c", "d"}) {
+		t.Errorf("Expected the trimmed list, got %v", values)
+	}
+	s.LTrim("l", 5, 10)
+	if _, err := s.Get("l"); err != datastore.ErrKeyNotFound {
+		t.Error("Expected trimming every element to remove the key")
+	}
+}
+
+func TestDataStore_LMove(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.RPush("src", "a", "b", "c")
+
+	if value, ok, err := s.LMove("src", "dst", datastore.ListRight, datastore.ListLeft); err != nil || !ok || value != "c" {
+		t.Fatalf("Expected to move c, got %q, %v, %v", value, ok, err)
+	}
+	if value, _, _ := s.LMove("src", "src", datastore.ListLeft, datastore.ListRight); value != "a" {
+		t.Errorf("Expected to rotate a, got %q", value)
+	}
+	if values, _ := s.LRange("src", 0, -1); !reflect.DeepEqual(values, []string{"b", "a"}) {
+		t.Errorf("Expected the rotated list, got %v", values)
+	}
+	if _, ok, err := s.LMove("missing", "dst", datastore.ListLeft, datastore.ListLeft); ok || err != nil {
+		t.Errorf("Expected nothing to move, got %v, %v", ok, err)
+	}
+
+	s.Set("string", "value")
+	if _, _, err := s.LMove("src", "string", datastore.ListLeft, datastore.ListLeft); err != datastore.ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if n, _ := s.LLen("src"); n != 2 {
+		t.Errorf("Expected a failed move to leave the source untouched, got %d elements", n)
+	}
+}
+
+func TestDataStore_ApplyReplaysLists(t *testing.T) {
+	source := datastore.NewDataStore()
+	replica := datastore.NewDataStore()
+	source.AddPropagator(func(args []string) {
+		if err := replica.Apply(args); err != nil {
+			t.Errorf("Expected no error applying %v, got %v", args, err)
+		}
+	})
+
+	for i := 0; i < 100; i++ {
+		source.RPush("l", "v")
+	}
+	source.LPush("l", "first")
+	source.LSet("l", -1, "last")
+	source.LTrim("l", 0, 80)
+	source.RPop("l", 3)
+	source.LMove("l", "other", datastore.ListLeft, datastore.ListRight)
+	source.LPop("other", 1)
+
+	expected, _ := source.LRange("l", 0, -1)
+	if values, _ := replica.LRange("l", 0, -1); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+	if _, err := replica.Get("other"); err != datastore.ErrKeyNotFound {
+		t.Error("Expected the emptied list to be removed")
+	}
+
+	// The commands of an entry recreate the list on an empty datastore
+	restored := datastore.NewDataStore()
+	restored.Set("l", "overwritten")
+	for _, entry := range source.Snapshot(nil) {
+		for _, args := range datastore.EntryCommands(entry) {
+			if err := restored.Apply(args); err != nil {
+				t.Fatalf("Expected no error applying %v, got %v", args, err)
+			}
+		}
+	}
+	if values, _ := restored.LRange("l", 0, -1); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
+
+func TestList_MarshalBinary(t *testing.T) {
+	list := datastore.NewList("a", "", "ccc")
+	data, _ := list.MarshalBinary()
+	decoded := new(datastore.List)
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if values := decoded.Values(); !reflect.DeepEqual(values, []string{"a", "", "ccc"}) {
+		t.Errorf("Expected the same elements, got %v", values)
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("Expected an error for truncated data")
+	}
+}
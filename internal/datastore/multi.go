@@ -0,0 +1,120 @@
+package datastore
+
+import "time"
+
+// KeyValue is a key along with the value MSet and MSetNX store under it.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// MGet returns the values held by keys, in order, nil standing for the keys that do not exist or do not
+// hold a plain value, such as lists. The datastore is locked once for all the keys.
+func (s *DataStore) MGet(keys ...string) []interface{} {
+	s.rlock()
+	defer s.runlock()
+	now := time.Now()
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value, ok := s.Data[key]
+		if !ok || s.isExpired(key, now) {
+			continue
+		}
+		if _, ok := value.(cloner); ok {
+			continue
+		}
+		s.touch(key)
+		values[i] = value
+	}
+	return values
+}
+
+// MSet stores the values of pairs under their keys, removing the deadlines of existing keys, the last
+// pair winning when a key is repeated. Either every pair is written or, when a key or value is invalid
+// or the datastore is out of memory, none is.
+func (s *DataStore) MSet(pairs ...KeyValue) error {
+	if err := validatePairs(pairs); err != nil {
+		return err
+	}
+	s.lock()
+	defer s.unlock()
+	return s.mset(pairs)
+}
+
+// MSetNX is MSet when none of the keys exist, and reports whether the pairs were written.
+func (s *DataStore) MSetNX(pairs ...KeyValue) (bool, error) {
+	if err := validatePairs(pairs); err != nil {
+		return false, err
+	}
+	s.lock()
+	defer s.unlock()
+	for _, pair := range pairs {
+		s.expireIfNeeded(pair.Key)
+		if _, exists := s.Data[pair.Key]; exists {
+			return false, nil
+		}
+	}
+	if err := s.mset(pairs); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Del removes keys, whatever the values they hold, and returns the number of keys removed.
+func (s *DataStore) Del(keys ...string) int {
+	s.lock()
+	defer s.unlock()
+	deleted := 0
+	for _, key := range keys {
+		s.expireIfNeeded(key)
+		if _, ok := s.Data[key]; ok {
+			s.remove(key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// validatePairs checks the keys and values of MSet.
+func validatePairs(pairs []KeyValue) error {
+	for _, pair := range pairs {
+		if err := validateKey(pair.Key); err != nil {
+			return err
+		}
+		if pair.Value == nil {
+			return ErrNilValue
+		}
+	}
+	return nil
+}
+
+// mset makes room for every pair at once, like a single write, then stores them. The keys of the pairs
+// are not evicted to make room. Caller must hold mu for writing.
+func (s *DataStore) mset(pairs []KeyValue) error {
+	final := make(map[string]interface{}, len(pairs))
+	for _, pair := range pairs {
+		final[pair.Key] = pair.Value
+	}
+	var size int64
+	newKeys := 0
+	for key, value := range final {
+		s.expireIfNeeded(key)
+		if _, exists := s.Data[key]; !exists {
+			newKeys++
+		}
+		size += estimateSize(key, value) - s.storedSize(key)
+	}
+	excluded := func(key string) bool {
+		_, ok := final[key]
+		return ok
+	}
+	if err := s.makeRoomFor(size, newKeys, excluded); err != nil {
+		return err
+	}
+
+	for _, pair := range pairs {
+		_, exists := s.Data[pair.Key]
+		s.replace(pair.Key, pair.Value, exists, 0, false)
+	}
+	return nil
+}
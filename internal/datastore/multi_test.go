@@ -0,0 +1,125 @@
+package datastore_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_MGet(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("a", "1")
+	s.Set("b", 2)
+	s.RPush("list", "x")
+	s.SetWithTTL("expired", "3", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	values := s.MGet("a", "missing", "b", "list", "expired", "")
+	if !reflect.DeepEqual(values, []interface{}{"1", nil, 2, nil, nil, nil}) {
+		t.Errorf("Expected the plain values of existing keys, got %v", values)
+	}
+}
+
+func TestDataStore_MSet(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.SetWithTTL("a", "old", time.Hour)
+	s.RPush("list", "x")
+
+	if err := s.MSet(datastore.KeyValue{Key: "a", Value: "1"}, datastore.KeyValue{Key: "list", Value: "2"},
+		datastore.KeyValue{Key: "c", Value: "3"}, datastore.KeyValue{Key: "c", Value: "4"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if values := s.MGet("a", "list", "c"); !reflect.DeepEqual(values, []interface{}{"1", "2", "4"}) {
+		t.Errorf("Expected the values to be replaced, the last one winning, got %v", values)
+	}
+	if ttl, _ := s.TTL("a"); ttl != datastore.NoTTL {
+		t.Errorf("Expected MSet to remove the deadline, got %v", ttl)
+	}
+
+	// An invalid pair writes nothing
+	if err := s.MSet(datastore.KeyValue{Key: "d", Value: "5"}, datastore.KeyValue{Key: "e", Value: nil}); err != datastore.ErrNilValue {
+		t.Errorf("Expected ErrNilValue, got %v", err)
+	}
+	if _, err := s.Get("d"); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected no pair to be written, got %v", err)
+	}
+}
+
+func TestDataStore_MSetOutOfMemory(t *testing.T) {
+	s := newLimitedDataStore(t, datastore.Limits{MaxEntries: 2, Policy: datastore.NoEviction})
+	s.Set("a", "1")
+
+	if err := s.MSet(datastore.KeyValue{Key: "a", Value: "2"}, datastore.KeyValue{Key: "b", Value: "2"}); err != nil {
+		t.Fatalf("Expected the pairs to fit, got %v", err)
+	}
+	if err := s.MSet(datastore.KeyValue{Key: "a", Value: "3"}, datastore.KeyValue{Key: "c", Value: "3"}); err != datastore.ErrOutOfMemory {
+		t.Fatalf("Expected ErrOutOfMemory, got %v", err)
+	}
+	if values := s.MGet("a", "c"); !reflect.DeepEqual(values, []interface{}{"2", nil}) {
+		t.Errorf("Expected no pair to be written, got %v", values)
+	}
+
+	// Every new key counts against the limit
+	empty := newLimitedDataStore(t, datastore.Limits{MaxEntries: 2, Policy: datastore.NoEviction})
+	pairs := []datastore.KeyValue{{Key: "a", Value: "1"}, {Key: "b", Value: "1"}, {Key: "c", Value: "1"}, {Key: "d", Value: "1"}}
+	if err := empty.MSet(pairs...); err != datastore.ErrOutOfMemory {
+		t.Fatalf("Expected ErrOutOfMemory, got %v", err)
+	}
+	if n := len(empty.GetAll()); n != 0 {
+		t.Errorf("Expected no pair to be written, got %d keys", n)
+	}
+}
+
+func TestDataStore_MSetEviction(t *testing.T) {
+	s := newLimitedDataStore(t, datastore.Limits{MaxEntries: 3, Policy: datastore.AllKeysLRU})
+	s.Set("a", "1")
+	s.Set("b", "1")
+	s.Set("c", "1")
+
+	// Two new keys need two evictions, and the keys written are not among them
+	pairs := []datastore.KeyValue{{Key: "a", Value: "2"}, {Key: "d", Value: "2"}, {Key: "e", Value: "2"}}
+	if err := s.MSet(pairs...); err != nil {
+		t.Fatalf("Expected the pairs to fit, got %v", err)
+	}
+	if values := s.MGet("a", "d", "e"); !reflect.DeepEqual(values, []interface{}{"2", "2", "2"}) {
+		t.Errorf("Expected every pair to be written, got %v", values)
+	}
+	if n := len(s.GetAll()); n != 3 {
+		t.Errorf("Expected 3 keys, got %d", n)
+	}
+}
+
+func TestDataStore_MSetNX(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if written, err := s.MSetNX(datastore.KeyValue{Key: "a", Value: "1"}, datastore.KeyValue{Key: "b", Value: "2"}); err != nil || !written {
+		t.Fatalf("Expected the pairs to be written, got %v, %v", written, err)
+	}
+	if written, err := s.MSetNX(datastore.KeyValue{Key: "b", Value: "3"}, datastore.KeyValue{Key: "c", Value: "3"}); err != nil || written {
+		t.Fatalf("Expected no pair to be written when a key exists, got %v, %v", written, err)
+	}
+	if values := s.MGet("a", "b", "c"); !reflect.DeepEqual(values, []interface{}{"1", "2", nil}) {
+		t.Errorf("Expected the keys to be unchanged, got %v", values)
+	}
+}
+
+func TestDataStore_Del(t *testing.T) {
+	s := datastore.NewDataStore()
+	var commands [][]string
+	s.AddPropagator(func(args []string) { commands = append(commands, args) })
+	s.Set("a", "1")
+	s.RPush("list", "x")
+	commands = nil
+
+	if deleted := s.Del("a", "missing", "list", "a"); deleted != 2 {
+		t.Errorf("Expected 2 keys to be deleted, got %d", deleted)
+	}
+	if !reflect.DeepEqual(commands, [][]string{{"DEL", "a"}, {"DEL", "list"}}) {
+		t.Errorf("Expected a DEL per deleted key, got %v", commands)
+	}
+	if s.Exists("a", "list") != 0 {
+		t.Error("Expected the keys to be deleted")
+	}
+}
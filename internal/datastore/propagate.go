@@ -0,0 +1,370 @@
+package datastore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Propagator receives every write applied to the datastore, in order, as a command that replays it
+// with Apply. Expired and evicted keys are propagated as DEL, and relative deadlines as absolute ones,
+// so that replaying the commands later leads to the same datastore. Writes to streams, lists,
+// hashes, sets and sorted sets are propagated as the commands listed by their apply methods, such
+// as applyStream. The writes of a transaction are propagated together once it commits, and not at
+// all when it is undone, see Txn.
+//
+// Propagators are called with the datastore lock held: they must not block nor call the datastore.
+type Propagator func(args []string)
+
+// Entry is a key of the datastore along with its value and deadline. A zero ExpireAt means no expiry.
+type Entry struct {
+	Key      string
+	Value    interface{}
+	ExpireAt time.Time
+}
+
+// AddPropagator registers p to receive every subsequent write.
+func (s *DataStore) AddPropagator(p Propagator) {
+	s.lock()
+	defer s.unlock()
+	s.propagators = append(s.propagators, p)
+}
+
+// propagate sends a write to the registered propagators and counts it as dirty. Caller must hold mu for writing.
+func (s *DataStore) propagate(args ...string) {
+	if s.txn != nil {
+		// Writes of a transaction are propagated together once it commits
+		s.txn.commands = append(s.txn.commands, args)
+		return
+	}
+	s.dirty++
+	for _, p := range s.propagators {
+		p(args)
+	}
+}
+
+// Dirty returns the number of writes since the datastore was last saved.
+func (s *DataStore) Dirty() int64 {
+	s.rlock()
+	defer s.runlock()
+	return s.dirty
+}
+
+// ClearDirty records that a save covered n writes, as returned by Dirty before the save started.
+// Writes that happened during the save stay dirty.
+func (s *DataStore) ClearDirty(n int64) {
+	s.lock()
+	defer s.unlock()
+	s.dirty = max(s.dirty-n, 0)
+}
+
+// Snapshot returns a point-in-time copy of the live keys. When barrier is not nil, it is called
+// while the datastore is locked, so that no write can slip between the copy and the call: writes
+// propagated after barrier returns are exactly the writes missing from the snapshot.
+// Writers wait for the whole copy, IterateSnapshot should be preferred for large datastores.
+func (s *DataStore) Snapshot(barrier func()) []Entry {
+	s.rlock()
+	defer s.runlock()
+
+	now := time.Now()
+	entries := make([]Entry, 0, len(s.Data))
+	for key, value := range s.Data {
+		if s.isExpired(key, now) {
+			continue
+		}
+		if c, ok := value.(cloner); ok {
+			value = c.Clone()
+		}
+		entries = append(entries, Entry{Key: key, Value: value, ExpireAt: s.ttlMap[key]})
+	}
+	if barrier != nil {
+		barrier()
+	}
+	return entries
+}
+
+// EntryCommands returns the commands that recreate entry with Apply.
+func EntryCommands(entry Entry) [][]string {
+	var commands [][]string
+	switch v := entry.Value.(type) {
+	case *Stream:
+		commands = streamCommands(entry.Key, v)
+	case *List:
+		commands = listCommands(entry.Key, v)
+	case *Hash:
+		commands = hashCommands(entry.Key, v)
+	case *Set:
+		commands = setCommands(entry.Key, v)
+	case *SortedSet:
+		commands = sortedSetCommands(entry.Key, v)
+	default:
+		commands = [][]string{valueCommand("SET", entry.Key, entry.Value)}
+	}
+	if !entry.ExpireAt.IsZero() {
+		commands = append(commands, []string{"PEXPIREAT", entry.Key, strconv.FormatInt(entry.ExpireAt.UnixMilli(), 10)})
+	}
+	return commands
+}
+
+// Apply replays a command produced by a Propagator. Unlike the regular methods, SET overwrites
+// existing keys and limits never reject a write, so that a log of writes that were accepted once
+// can always be replayed.
+func (s *DataStore) Apply(args []string) error {
+	s.lock()
+	defer s.unlock()
+	return s.apply(args)
+}
+
+// ApplyThen replays args like Apply, then calls then before the datastore is unlocked, whether args
+// could be applied or not: no snapshot can start between the write and then.
+func (s *DataStore) ApplyThen(args []string, then func()) error {
+	s.lock()
+	defer s.unlock()
+	err := s.apply(args)
+	then()
+	return err
+}
+
+// apply replays args as described by Apply. Caller must hold mu for writing.
+func (s *DataStore) apply(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+
+	switch name := strings.ToUpper(args[0]); {
+	case name == "SET" && (len(args) == 3 || len(args) == 4):
+		value, err := parseValue(args[2:])
+		if err != nil {
+			return err
+		}
+		// Make room when the datastore is full, but restore the key anyway
+		s.makeRoom(estimateSize(args[1], value)-s.storedSize(args[1]), s.Data[args[1]] == nil, args[1])
+		s.store(args[1], value)
+		s.clearDeadline(args[1])
+	case name == "UPDATE" && (len(args) == 3 || len(args) == 4):
+		value, err := parseValue(args[2:])
+		if err != nil {
+			return err
+		}
+		if _, ok := s.Data[args[1]]; ok {
+			s.store(args[1], value)
+		}
+	case name == "DEL" && len(args) >= 2:
+		for _, key := range args[1:] {
+			if _, ok := s.Data[key]; ok {
+				s.remove(key)
+			}
+		}
+		return nil
+	case name == "PEXPIREAT" && len(args) == 3:
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid deadline %q", args[2])
+		}
+		if _, ok := s.Data[args[1]]; !ok {
+			return nil
+		}
+		if deadline := time.UnixMilli(ms); deadline.After(time.Now()) {
+			s.setDeadline(args[1], deadline)
+		} else {
+			s.remove(args[1])
+			return nil
+		}
+	case name == "PERSIST" && len(args) == 2:
+		s.clearDeadline(args[1])
+	case name == "FLUSHALL" && len(args) == 1:
+		s.flush()
+	case isStreamCommand(name):
+		if err := s.applyStream(name, args); err != nil {
+			return err
+		}
+	case isListCommand(name):
+		if err := s.applyList(name, args); err != nil {
+			return err
+		}
+	case isHashCommand(name):
+		if err := s.applyHash(name, args); err != nil {
+			return err
+		}
+	case isSetCommand(name):
+		if err := s.applySet(name, args); err != nil {
+			return err
+		}
+	case isSortedSetCommand(name):
+		if err := s.applySortedSet(name, args); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown command %q with %d arguments", args[0], len(args)-1)
+	}
+
+	s.propagate(args...)
+	return nil
+}
+
+// Restore loads entries, such as the ones of a snapshot, overwriting existing keys. Entries whose
+// deadline has passed are skipped. Like Apply, limits make room for the entries but never reject them.
+func (s *DataStore) Restore(entries ...Entry) {
+	s.lock()
+	defer s.unlock()
+	s.restore(entries)
+}
+
+// Reset replaces the whole content of the datastore with entries, as a single write.
+func (s *DataStore) Reset(entries ...Entry) {
+	s.lock()
+	defer s.unlock()
+	s.flush()
+	s.propagate("FLUSHALL")
+	s.restore(entries)
+}
+
+// restore loads entries as described by Restore. Caller must hold mu for writing.
+func (s *DataStore) restore(entries []Entry) {
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.ExpireAt.IsZero() && !entry.ExpireAt.After(now) {
+			continue
+		}
+		_, exists := s.Data[entry.Key]
+		s.makeRoom(estimateSize(entry.Key, entry.Value)-s.storedSize(entry.Key), !exists, entry.Key)
+		s.store(entry.Key, entry.Value)
+		s.clearDeadline(entry.Key)
+		if !entry.ExpireAt.IsZero() {
+			s.setDeadline(entry.Key, entry.ExpireAt)
+		}
+		for _, args := range EntryCommands(entry) {
+			s.propagate(args...)
+		}
+	}
+}
+
+// valueCommand returns the SET or UPDATE command, given by name, that writes value under key. Values of
+// the types listed by valueType carry their type after the value, SET key value type, so that replaying
+// the command stores the same value rather than its string.
+func valueCommand(name, key string, value interface{}) []string {
+	if kind := valueType(value); kind != "" {
+		return []string{name, key, FormatValue(value), kind}
+	}
+	return []string{name, key, FormatValue(value)}
+}
+
+// valueType returns the name of the type value is propagated with, empty for strings and the values
+// propagated as their string.
+func valueType(value interface{}) string {
+	switch value.(type) {
+	case []byte:
+		return "bytes"
+	case bool:
+		return "bool"
+	case int:
+		return "int"
+	case int8:
+		return "int8"
+	case int16:
+		return "int16"
+	case int32:
+		return "int32"
+	case int64:
+		return "int64"
+	case uint:
+		return "uint"
+	case uint8:
+		return "uint8"
+	case uint16:
+		return "uint16"
+	case uint32:
+		return "uint32"
+	case uint64:
+		return "uint64"
+	case float32:
+		return "float32"
+	case float64:
+		return "float64"
+	default:
+		return ""
+	}
+}
+
+// parseValue returns the value propagated as args, the value optionally followed by its type.
+func parseValue(args []string) (interface{}, error) {
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	s, kind := args[0], args[1]
+	var value interface{}
+	var err error
+	switch kind {
+	case "bytes":
+		value = []byte(s)
+	case "bool":
+		value, err = strconv.ParseBool(s)
+	case "int":
+		var n int64
+		n, err = strconv.ParseInt(s, 10, strconv.IntSize)
+		value = int(n)
+	case "int8":
+		var n int64
+		n, err = strconv.ParseInt(s, 10, 8)
+		value = int8(n)
+	case "int16":
+		var n int64
+		n, err = strconv.ParseInt(s, 10, 16)
+		value = int16(n)
+	case "int32":
+		var n int64
+		n, err = strconv.ParseInt(s, 10, 32)
+		value = int32(n)
+	case "int64":
+		value, err = strconv.ParseInt(s, 10, 64)
+	case "uint":
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, strconv.IntSize)
+		value = uint(n)
+	case "uint8":
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, 8)
+		value = uint8(n)
+	case "uint16":
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, 16)
+		value = uint16(n)
+	case "uint32":
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, 32)
+		value = uint32(n)
+	case "uint64":
+		value, err = strconv.ParseUint(s, 10, 64)
+	case "float32":
+		var f float64
+		f, err = strconv.ParseFloat(s, 32)
+		value = float32(f)
+	case "float64":
+		value, err = strconv.ParseFloat(s, 64)
+	default:
+		return nil, fmt.Errorf("unknown value type %q", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %q", kind, s)
+	}
+	return value, nil
+}
+
+// FormatValue returns the string a value is propagated as.
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,116 @@
+package datastore_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_PropagatesWrites(t *testing.T) {
+	s := datastore.NewDataStore()
+	var commands [][]string
+	s.AddPropagator(func(args []string) { commands = append(commands, args) })
+
+	s.Set("a", "1")
+	s.Update("a", "2")
+	s.Persist("a")
+	s.Delete("a")
+	s.Delete("missing")
+	s.FlushAll()
+
+	expected := [][]string{{"SET", "a", "1"}, {"UPDATE", "a", "2"}, {"DEL", "a"}, {"FLUSHALL"}}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("Expected %v, got %v", expected, commands)
+	}
+}
+
+func TestDataStore_PropagatesAbsoluteDeadlines(t *testing.T) {
+	s := datastore.NewDataStore()
+	var commands [][]string
+	s.AddPropagator(func(args []string) { commands = append(commands, args) })
+
+	s.SetWithTTL("a", "1", 20*time.Millisecond)
+	if len(commands) != 2 || commands[1][0] != "PEXPIREAT" {
+		t.Fatalf("Expected SET followed by PEXPIREAT, got %v", commands)
+	}
+
+	// Expired keys are propagated as deletions
+	time.Sleep(30 * time.Millisecond)
+	s.Get("a")
+	s.Update("a", "2")
+	if last := commands[len(commands)-1]; !reflect.DeepEqual(last, []string{"DEL", "a"}) {
+		t.Errorf("Expected DEL a, got %v", last)
+	}
+}
+
+func TestDataStore_ApplyReplaysPropagatedWrites(t *testing.T) {
+	source := datastore.NewDataStore()
+	replica := datastore.NewDataStore()
+	source.AddPropagator(func(args []string) {
+		if err := replica.Apply(args); err != nil {
+			t.Errorf("Expected no error applying %v, got %v", args, err)
+		}
+	})
+
+	source.Set("a", "1")
+	source.Set("b", "2")
+	source.SetWithTTL("c", "3", time.Hour)
+	source.Update("b", "22")
+	source.Delete("a")
+
+	if !reflect.DeepEqual(source.GetAll(), replica.GetAll()) {
+		t.Errorf("Expected %v, got %v", source.GetAll(), replica.GetAll())
+	}
+	if ttl, _ := replica.TTL("c"); ttl <= 0 {
+		t.Errorf("Expected the deadline to be replayed, got %v", ttl)
+	}
+
+	if err := replica.Apply([]string{"UNKNOWN", "a"}); err == nil {
+		t.Errorf("Expected an error for unknown commands")
+	}
+}
+
+func TestDataStore_SnapshotBarrier(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("a", "1")
+	s.SetWithTTL("b", "2", time.Hour)
+
+	called := false
+	entries := s.Snapshot(func() { called = true })
+	if !called {
+		t.Errorf("Expected the barrier to be called")
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		commands := datastore.EntryCommands(entry)
+		if entry.Key == "b" && len(commands) != 2 {
+			t.Errorf("Expected SET and PEXPIREAT for a key with a deadline, got %v", commands)
+		}
+		if entry.Key == "a" && len(commands) != 1 {
+			t.Errorf("Expected a single SET for a key without deadline, got %v", commands)
+		}
+	}
+}
+
+func TestDataStore_Dirty(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("a", "1")
+	s.Update("a", "2")
+	s.Get("a")
+	s.Delete("missing")
+	if dirty := s.Dirty(); dirty != 2 {
+		t.Fatalf("Expected 2 dirty writes, got %d", dirty)
+	}
+
+	// Writes happening during a save stay dirty
+	saved := s.Dirty()
+	s.Set("b", "1")
+	s.ClearDirty(saved)
+	if dirty := s.Dirty(); dirty != 1 {
+		t.Errorf("Expected 1 dirty write, got %d", dirty)
+	}
+}
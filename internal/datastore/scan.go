@@ -0,0 +1,57 @@
+package datastore
+
+import "hash/fnv"
+
+// scanHash places a name on the cursor space of scans. It keeps 53 bits of the hash, which the scores
+// of a skiplist represent exactly.
+func scanHash(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64() >> 11
+}
+
+// scanIndex orders names by their scan hash, kept up to date as names are added and removed, so that a
+// scan finds its cursor in O(log n) and reads a page in O(count) rather than sorting every name.
+// The zero value is an empty index.
+type scanIndex struct {
+	list *skiplist
+}
+
+// add indexes name, which must not be indexed yet.
+func (x *scanIndex) add(name string) {
+	if x.list == nil {
+		x.list = newSkiplist()
+	}
+	x.list.insert(float64(scanHash(name)), name)
+}
+
+// remove forgets name.
+func (x *scanIndex) remove(name string) {
+	if x.list != nil {
+		x.list.delete(float64(scanHash(name)), name)
+	}
+}
+
+// scan visits about count names, starting at cursor, and returns those for which live, when set, is
+// true, along with the cursor of the next call, zero once every name was visited. Names are visited in
+// the order of their hash rather than their position, so that a scan returns every name present from
+// its start to its end, whatever names are added or removed meanwhile. Names sharing a hash are
+// returned together.
+func (x *scanIndex) scan(cursor uint64, count int, live func(string) bool) (uint64, []string) {
+	if x.list == nil {
+		return 0, nil
+	}
+	count = max(count, 1)
+	var batch []string
+	visited := 0
+	for n := x.list.firstAbove(ScoreBound{Score: float64(cursor)}); n != nil; n = n.levels[0].forward {
+		if visited >= count && n.score != n.backward.score {
+			return uint64(n.score), batch
+		}
+		visited++
+		if live == nil || live(n.member) {
+			batch = append(batch, n.member)
+		}
+	}
+	return 0, batch
+}
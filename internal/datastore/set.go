@@ -0,0 +1,400 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// setMemberOverhead approximates the bookkeeping memory of a member of a set.
+	setMemberOverhead = 16
+	// setCommandBatch is the number of members added by each command recreating a set.
+	setCommandBatch = 64
+)
+
+// Set is an unordered collection of unique strings. Sets are modified in place through the S methods
+// of the datastore, and must not be modified once stored. Empty sets are never stored: removing the
+// last member removes the key.
+type Set struct {
+	members map[string]struct{}
+	size    int64
+}
+
+// NewSet returns a set holding members.
+func NewSet(members ...string) *Set {
+	set := &Set{members: make(map[string]struct{}, len(members))}
+	for _, member := range members {
+		set.add(member)
+	}
+	return set
+}
+
+// Len returns the number of members of the set.
+func (set *Set) Len() int { return len(set.members) }
+
+// Members returns the members of the set, sorted.
+func (set *Set) Members() []string {
+	members := make([]string, 0, len(set.members))
+	for member := range set.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Clone returns a copy of the set that shares no mutable state with it.
+func (set *Set) Clone() interface{} {
+	clone := &Set{members: make(map[string]struct{}, len(set.members)), size: set.size}
+	for member := range set.members {
+		clone.members[member] = struct{}{}
+	}
+	return clone
+}
+
+// MemoryUsage approximates the memory used by the set.
+func (set *Set) MemoryUsage() int64 { return set.size }
+
+// add adds member and reports whether it is new.
+func (set *Set) add(member string) bool {
+	if _, exists := set.members[member]; exists {
+		return false
+	}
+	set.members[member] = struct{}{}
+	set.size += int64(len(member)) + setMemberOverhead
+	return true
+}
+
+// remove removes member and reports whether it existed.
+func (set *Set) remove(member string) bool {
+	if _, exists := set.members[member]; !exists {
+		return false
+	}
+	delete(set.members, member)
+	set.size -= int64(len(member)) + setMemberOverhead
+	return true
+}
+
+// setCommands returns the commands that recreate set under key with Apply.
+func setCommands(key string, set *Set) [][]string {
+	members := set.Members()
+	var commands [][]string
+	for i := 0; i < len(members); i += setCommandBatch {
+		name := "SADD"
+		if i == 0 {
+			name = "SCREATE"
+		}
+		commands = append(commands, append([]string{name, key}, members[i:min(i+setCommandBatch, len(members))]...))
+	}
+	return commands
+}
+
+// lookupSet returns the set stored under key, nil when there is none. Caller must hold mu.
+func (s *DataStore) lookupSet(key string) (*Set, error) {
+	value, ok := s.Data[key]
+	if !ok || s.isExpired(key, time.Now()) {
+		return nil, nil
+	}
+	set, ok := value.(*Set)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return set, nil
+}
+
+// writeSet returns the set stored under key, nil when there is none, before it is modified.
+// The set must be stored again once modified. Caller must hold mu for writing.
+func (s *DataStore) writeSet(key string) (*Set, error) {
+	s.expireIfNeeded(key)
+	set, err := s.lookupSet(key)
+	if set != nil {
+		s.preserve(key)
+	}
+	return set, err
+}
+
+// SAdd adds members to the set stored under key, creating the set when needed, and returns the
+// number of members that were not already in the set.
+func (s *DataStore) SAdd(key string, members ...string) (int, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("no members to add")
+	}
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.lookupSet(key)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, member := range members {
+		size += int64(len(member)) + setMemberOverhead
+	}
+	if set == nil {
+		size += entryOverhead + int64(len(key))
+	}
+	if err := s.makeRoom(size, set == nil, key); err != nil {
+		return 0, err
+	}
+
+	added := s.addSet(key, members)
+	if len(added) > 0 {
+		s.propagate(append([]string{"SADD", key}, added...)...)
+		if set == nil {
+			s.capNewKey(key)
+		}
+	}
+	return len(added), nil
+}
+
+// addSet adds members to the set stored under key, creating it when needed, and returns the members
+// added. Caller must hold mu for writing and have checked that key holds no other kind of value.
+func (s *DataStore) addSet(key string, members []string) []string {
+	set, _ := s.writeSet(key)
+	if set == nil {
+		set = NewSet()
+	}
+	var added []string
+	for _, member := range members {
+		if set.add(member) {
+			added = append(added, member)
+		}
+	}
+	if set.Len() > 0 {
+		s.store(key, set)
+	}
+	return added
+}
+
+// SRem removes members from the set stored under key and returns the number of members removed.
+// The key is removed along with its last member.
+func (s *DataStore) SRem(key string, members ...string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	set, err := s.writeSet(key)
+	if set == nil {
+		return 0, err
+	}
+	removed := s.removeSet(key, set, members)
+	if len(removed) > 0 {
+		s.propagate(append([]string{"SREM", key}, removed...)...)
+	}
+	return len(removed), nil
+}
+
+// removeSet removes members from set, stored under key, and returns the members removed.
+// Caller must hold mu for writing.
+func (s *DataStore) removeSet(key string, set *Set, members []string) []string {
+	var removed []string
+	for _, member := range members {
+		if set.remove(member) {
+			removed = append(removed, member)
+		}
+	}
+	if set.Len() == 0 {
+		s.unstore(key)
+	} else {
+		s.store(key, set)
+	}
+	return removed
+}
+
+// SMembers returns the members of the set stored under key, sorted.
+func (s *DataStore) SMembers(key string) ([]string, error) {
+	s.rlock()
+	defer s.runlock()
+	set, err := s.lookupSet(key)
+	if set == nil {
+		return nil, err
+	}
+	s.touch(key)
+	return set.Members(), nil
+}
+
+// SIsMember reports whether member is in the set stored under key.
+func (s *DataStore) SIsMember(key, member string) (bool, error) {
+	s.rlock()
+	defer s.runlock()
+	set, err := s.lookupSet(key)
+	if set == nil {
+		return false, err
+	}
+	_, ok := set.members[member]
+	return ok, nil
+}
+
+// SCard returns the number of members of the set stored under key, zero when there is no such set.
+func (s *DataStore) SCard(key string) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	set, err := s.lookupSet(key)
+	if set == nil {
+		return 0, err
+	}
+	return set.Len(), nil
+}
+
+// SInter returns the members present in every set stored under keys, sorted. Missing keys are empty sets.
+func (s *DataStore) SInter(keys ...string) ([]string, error) {
+	return s.combineSets(keys, func(sets []*Set) []string {
+		for _, set := range sets {
+			if set == nil {
+				return nil
+			}
+		}
+		var members []string
+	next:
+		for member := range sets[0].members {
+			for _, set := range sets[1:] {
+				if _, ok := set.members[member]; !ok {
+					continue next
+				}
+			}
+			members = append(members, member)
+		}
+		return members
+	})
+}
+
+// SUnion returns the members present in any set stored under keys, sorted.
+func (s *DataStore) SUnion(keys ...string) ([]string, error) {
+	return s.combineSets(keys, func(sets []*Set) []string {
+		union := make(map[string]struct{})
+		for _, set := range sets {
+			if set != nil {
+				for member := range set.members {
+					union[member] = struct{}{}
+				}
+			}
+		}
+		members := make([]string, 0, len(union))
+		for member := range union {
+			members = append(members, member)
+		}
+		return members
+	})
+}
+
+// SDiff returns the members of the set stored under the first key that are in none of the sets stored
+// under the other keys, sorted.
+func (s *DataStore) SDiff(keys ...string) ([]string, error) {
+	return s.combineSets(keys, func(sets []*Set) []string {
+		var members []string
+		if sets[0] == nil {
+			return nil
+		}
+	next:
+		for member := range sets[0].members {
+			for _, set := range sets[1:] {
+				if set != nil {
+					if _, ok := set.members[member]; ok {
+						continue next
+					}
+				}
+			}
+			members = append(members, member)
+		}
+		return members
+	})
+}
+
+// combineSets looks up the sets stored under keys, nil for missing keys, and returns the result of
+// combine, sorted.
+func (s *DataStore) combineSets(keys []string, combine func(sets []*Set) []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	s.rlock()
+	defer s.runlock()
+	sets := make([]*Set, len(keys))
+	for i, key := range keys {
+		set, err := s.lookupSet(key)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	members := combine(sets)
+	sort.Strings(members)
+	return members, nil
+}
+
+// isSetCommand reports whether name is a set command propagated by the datastore.
+func isSetCommand(name string) bool {
+	return name == "SCREATE" || name == "SADD" || name == "SREM"
+}
+
+// applySet replays a set command produced by a Propagator:
+//
+//	SCREATE key member [member ...]
+//	SADD key member [member ...]
+//	SREM key member [member ...]
+//
+// SCREATE replaces any value stored under key, like SET. Caller must hold mu for writing.
+func (s *DataStore) applySet(name string, args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	key := args[1]
+	if name == "SCREATE" {
+		set := NewSet(args[2:]...)
+		s.makeRoom(estimateSize(key, set)-s.storedSize(key), s.Data[key] == nil, key)
+		s.store(key, set)
+		s.clearDeadline(key)
+		return nil
+	}
+
+	s.expireIfNeeded(key)
+	set, err := s.lookupSet(key)
+	if err != nil {
+		return err
+	}
+	if name == "SADD" {
+		var size int64
+		for _, member := range args[2:] {
+			size += int64(len(member)) + setMemberOverhead
+		}
+		s.makeRoom(size, set == nil, key)
+		s.addSet(key, args[2:])
+	} else if set != nil {
+		s.preserve(key)
+		s.removeSet(key, set, args[2:])
+	}
+	return nil
+}
+
+// errCorruptSet is returned by UnmarshalBinary for data that MarshalBinary did not produce.
+var errCorruptSet = errors.New("corrupt set encoding")
+
+// MarshalBinary encodes the members of the set, sorted.
+func (set *Set) MarshalBinary() ([]byte, error) {
+	b := binary.AppendUvarint(nil, uint64(len(set.members)))
+	for _, member := range set.Members() {
+		b = binary.AppendUvarint(b, uint64(len(member)))
+		b = append(b, member...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a set encoded by MarshalBinary.
+func (set *Set) UnmarshalBinary(data []byte) error {
+	d := streamDecoder{data: data}
+	n := d.length()
+	decoded := NewSet()
+	for i := 0; i < n && d.err == nil; i++ {
+		if !decoded.add(d.string()) {
+			return errCorruptSet
+		}
+	}
+	if d.err != nil || d.pos != len(data) || n == 0 {
+		return errCorruptSet
+	}
+	*set = *decoded
+	return nil
+}
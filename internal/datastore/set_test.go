@@ -0,0 +1,124 @@
+package datastore_test
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_SetMembers(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if added, err := s.SAdd("s", "b", "a", "b"); err != nil || added != 2 {
+		t.Fatalf("Expected 2 members added, got %d, %v", added, err)
+	}
+	if added, _ := s.SAdd("s", "a", "c"); added != 1 {
+		t.Errorf("Expected only the new member to be counted, got %d", added)
+	}
+	if members, _ := s.SMembers("s"); !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+		t.Errorf("Expected the sorted members, got %v", members)
+	}
+	if ok, _ := s.SIsMember("s", "c"); !ok {
+		t.Error("Expected c to be a member")
+	}
+	if ok, _ := s.SIsMember("s", "d"); ok {
+		t.Error("Expected d not to be a member")
+	}
+
+	if removed, _ := s.SRem("s", "a", "missing"); removed != 1 {
+		t.Errorf("Expected 1 member removed, got %d", removed)
+	}
+	if n, _ := s.SCard("s"); n != 2 {
+		t.Errorf("Expected 2 members left, got %d", n)
+	}
+	s.SRem("s", "b", "c")
+	if _, err := s.Get("s"); err != datastore.ErrKeyNotFound {
+		t.Error("Expected removing the last member to remove the key")
+	}
+
+	s.Set("string", "value")
+	if _, err := s.SAdd("string", "a"); err != datastore.ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if _, err := s.SUnion("missing", "string"); err != datastore.ErrWrongType {
+		t.Errorf("Expected SUNION with a string to fail with ErrWrongType, got %v", err)
+	}
+}
+
+func TestDataStore_SetOperations(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.SAdd("s1", "a", "b", "c", "d")
+	s.SAdd("s2", "c", "d", "e")
+	s.SAdd("s3", "d", "f")
+
+	if members, _ := s.SInter("s1", "s2", "s3"); !reflect.DeepEqual(members, []string{"d"}) {
+		t.Errorf("Expected [d], got %v", members)
+	}
+	if members, _ := s.SInter("s1", "missing"); len(members) != 0 {
+		t.Errorf("Expected a missing key to empty the intersection, got %v", members)
+	}
+	if members, _ := s.SUnion("s2", "s3", "missing"); !reflect.DeepEqual(members, []string{"c", "d", "e", "f"}) {
+		t.Errorf("Expected [c d e f], got %v", members)
+	}
+	if members, _ := s.SDiff("s1", "s2", "missing"); !reflect.DeepEqual(members, []string{"a", "b"}) {
+		t.Errorf("Expected [a b], got %v", members)
+	}
+	if members, _ := s.SDiff("missing", "s1"); len(members) != 0 {
+		t.Errorf("Expected the difference of a missing key to be empty, got %v", members)
+	}
+}
+
+func TestDataStore_ApplyReplaysSets(t *testing.T) {
+	source := datastore.NewDataStore()
+	replica := datastore.NewDataStore()
+	source.AddPropagator(func(args []string) {
+		if err := replica.Apply(args); err != nil {
+			t.Errorf("Expected no error applying %v, got %v", args, err)
+		}
+	})
+
+	for i := 0; i < 100; i++ {
+		source.SAdd("s", "m"+strconv.Itoa(i))
+	}
+	source.SRem("s", "m0", "m1")
+	source.SAdd("gone", "a")
+	source.SRem("gone", "a")
+
+	expected, _ := source.SMembers("s")
+	if members, _ := replica.SMembers("s"); !reflect.DeepEqual(members, expected) {
+		t.Errorf("Expected %v, got %v", expected, members)
+	}
+	if _, err := replica.Get("gone"); err != datastore.ErrKeyNotFound {
+		t.Error("Expected the emptied set to be removed")
+	}
+
+	// The commands of an entry recreate the set on an empty datastore
+	restored := datastore.NewDataStore()
+	for _, entry := range source.Snapshot(nil) {
+		for _, args := range datastore.EntryCommands(entry) {
+			if err := restored.Apply(args); err != nil {
+				t.Fatalf("Expected no error applying %v, got %v", args, err)
+			}
+		}
+	}
+	if members, _ := restored.SMembers("s"); !reflect.DeepEqual(members, expected) {
+		t.Errorf("Expected %v, got %v", expected, members)
+	}
+}
+
+func TestSet_MarshalBinary(t *testing.T) {
+	set := datastore.NewSet("a", "b", "")
+	data, _ := set.MarshalBinary()
+	decoded := new(datastore.Set)
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if members := decoded.Members(); !reflect.DeepEqual(members, []string{"", "a", "b"}) {
+		t.Errorf("Expected the same members, got %v", members)
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("Expected an error for truncated data")
+	}
+}
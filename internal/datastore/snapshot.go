@@ -0,0 +1,138 @@
+package datastore
+
+import "time"
+
+// cloner is implemented by values that are modified in place rather than replaced, such as lists.
+// They are cloned before their first modification while a snapshot iterates the datastore.
+type cloner interface {
+	Clone() interface{}
+}
+
+// snapshotState is the copy-on-write state of a running SnapshotIterator.
+type snapshotState struct {
+	at   time.Time
+	keys []string
+	// preserved holds the entries, as they were when the snapshot started, of the keys written since.
+	preserved map[string]Entry
+	// data and ttl are the maps the datastore held when it was flushed during the snapshot.
+	data map[string]interface{}
+	ttl  map[string]time.Time
+}
+
+// SnapshotIterator walks a point-in-time view of the datastore. Writers are only blocked while it
+// starts, to copy the keys, and while each batch is read: a key written in the meantime keeps, for
+// the iterator, the value and deadline it had when the iterator started.
+type SnapshotIterator struct {
+	s     *DataStore
+	state *snapshotState
+	pos   int
+}
+
+// IterateSnapshot starts a SnapshotIterator, which must be closed once done. When barrier is not nil,
+// it is called while the datastore is locked: writes propagated after barrier returns are exactly the
+// writes missing from the snapshot.
+func (s *DataStore) IterateSnapshot(barrier func()) *SnapshotIterator {
+	s.lock()
+	defer s.unlock()
+
+	state := &snapshotState{
+		at:        time.Now(),
+		keys:      make([]string, 0, len(s.Data)),
+		preserved: make(map[string]Entry),
+	}
+	for key := range s.Data {
+		state.keys = append(state.keys, key)
+	}
+	s.snapshots = append(s.snapshots, state)
+	if barrier != nil {
+		barrier()
+	}
+	return &SnapshotIterator{s: s, state: state}
+}
+
+// Next fills batch with the next entries and returns their number, 0 once every key was returned.
+func (it *SnapshotIterator) Next(batch []Entry) int {
+	it.s.rlock()
+	defer it.s.runlock()
+
+	n := 0
+	for n < len(batch) && it.pos < len(it.state.keys) {
+		key := it.state.keys[it.pos]
+		it.pos++
+		if entry, ok := it.s.snapshotEntry(it.state, key); ok {
+			batch[n] = entry
+			n++
+		}
+	}
+	return n
+}
+
+// Close stops tracking the writes for the iterator.
+func (it *SnapshotIterator) Close() {
+	it.s.lock()
+	defer it.s.unlock()
+	for i, state := range it.s.snapshots {
+		if state == it.state {
+			it.s.snapshots = append(it.s.snapshots[:i], it.s.snapshots[i+1:]...)
+			break
+		}
+	}
+}
+
+// snapshotEntry returns key as it was when state started. Caller must hold mu.
+func (s *DataStore) snapshotEntry(state *snapshotState, key string) (Entry, bool) {
+	entry, ok := state.preserved[key]
+	if !ok {
+		data, ttl := s.Data, s.ttlMap
+		if state.data != nil {
+			data, ttl = state.data, state.ttl
+		}
+		var value interface{}
+		if value, ok = data[key]; !ok {
+			return Entry{}, false
+		}
+		if c, ok := value.(cloner); ok && state.data == nil {
+			// The value may be modified in place once the datastore is unlocked
+			value = c.Clone()
+		}
+		entry = Entry{Key: key, Value: value, ExpireAt: ttl[key]}
+	}
+	if !entry.ExpireAt.IsZero() && !state.at.Before(entry.ExpireAt) {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// preserve records the current entry of key for the running snapshots, before key is written.
+// Caller must hold mu for writing.
+func (s *DataStore) preserve(key string) {
+	s.writing(key)
+	for _, state := range s.snapshots {
+		if state.data != nil {
+			// The snapshot reads the maps held before the flush, which are not written anymore
+			continue
+		}
+		if _, ok := state.preserved[key]; ok {
+			continue
+		}
+		value, ok := s.Data[key]
+		if !ok {
+			// The key did not exist when the snapshot started either, the snapshot does not look it up
+			continue
+		}
+		if c, ok := value.(cloner); ok {
+			value = c.Clone()
+		}
+		state.preserved[key] = Entry{Key: key, Value: value, ExpireAt: s.ttlMap[key]}
+	}
+}
+
+// freeze hands the current maps over to the running snapshots, before they are replaced by a flush.
+// Caller must hold mu for writing.
+func (s *DataStore) freeze() {
+	for _, state := range s.snapshots {
+		if state.data == nil {
+			state.data, state.ttl = s.Data, s.ttlMap
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package datastore_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+// collect drains an iterator into a map of values, in batches of size.
+func collect(it *datastore.SnapshotIterator, size int) map[string]datastore.Entry {
+	entries := make(map[string]datastore.Entry)
+	batch := make([]datastore.Entry, size)
+	for n := it.Next(batch); n > 0; n = it.Next(batch) {
+		for _, entry := range batch[:n] {
+			entries[entry.Key] = entry
+		}
+	}
+	return entries
+}
+
+func TestSnapshotIterator_PointInTime(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("updated", "before")
+	s.Set("deleted", "before")
+	s.Set("persisted", "before")
+	s.Expire("persisted", time.Hour)
+	s.Set("expiring", "before")
+
+	it := s.IterateSnapshot(nil)
+	defer it.Close()
+
+	s.Update("updated", "after")
+	s.Delete("deleted")
+	s.Persist("persisted")
+	s.Expire("expiring", time.Minute)
+	s.Set("created", "after")
+
+	entries := collect(it, 2)
+	if len(entries) != 4 {
+		t.Fatalf("Expected the 4 keys present when the snapshot started, got %v", entries)
+	}
+	for key, entry := range entries {
+		if entry.Value != "before" {
+			t.Errorf("Expected %s to be before, got %v", key, entry.Value)
+		}
+	}
+	if entries["persisted"].ExpireAt.IsZero() {
+		t.Errorf("Expected persisted to keep its deadline")
+	}
+	if !entries["expiring"].ExpireAt.IsZero() {
+		t.Errorf("Expected expiring to have no deadline, got %v", entries["expiring"].ExpireAt)
+	}
+}
+
+func TestSnapshotIterator_Flush(t *testing.T) {
+	s := datastore.NewDataStore()
+	for i := 0; i < 10; i++ {
+		s.Set(fmt.Sprint(i), i)
+	}
+
+	it := s.IterateSnapshot(nil)
+	defer it.Close()
+
+	batch := make([]datastore.Entry, 3)
+	read := it.Next(batch)
+	s.FlushAll()
+	s.Set("0", "after")
+	read += len(collect(it, 3))
+
+	if read != 10 {
+		t.Errorf("Expected 10 entries, got %d", read)
+	}
+}
+
+func TestSnapshotIterator_SkipsExpiredKeys(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.SetWithTTL("expired", "value", time.Millisecond)
+	s.Set("live", "value")
+	time.Sleep(5 * time.Millisecond)
+
+	it := s.IterateSnapshot(nil)
+	defer it.Close()
+	if entries := collect(it, 10); len(entries) != 1 {
+		t.Errorf("Expected only the live key, got %v", entries)
+	}
+}
+
+func TestSnapshotIterator_ConcurrentWriters(t *testing.T) {
+	s := datastore.NewDataStore()
+	for i := 0; i < 1000; i++ {
+		s.Set(fmt.Sprint(i), 0)
+	}
+
+	it := s.IterateSnapshot(nil)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < 1000; i += 4 {
+				s.Update(fmt.Sprint(i), 1)
+			}
+		}(w)
+	}
+	entries := collect(it, 16)
+	wg.Wait()
+	it.Close()
+
+	if len(entries) != 1000 {
+		t.Fatalf("Expected 1000 entries, got %d", len(entries))
+	}
+	for key, entry := range entries {
+		if entry.Value != 0 {
+			t.Fatalf("Expected %s to be 0 in the snapshot, got %v", key, entry.Value)
+		}
+	}
+}
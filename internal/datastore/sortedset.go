@@ -0,0 +1,515 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Declared sorted set errors
+var (
+	ErrNotANumber = &DataStoreError{Message: "resulting score is not a number (NaN)"}
+)
+
+const (
+	// zsetMemberOverhead approximates the bookkeeping memory of a member of a sorted set.
+	zsetMemberOverhead = 64
+	// zsetCommandBatch is the number of members added by each command recreating a sorted set.
+	zsetCommandBatch = 64
+)
+
+// ZMember is a member of a sorted set along with its score.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ZAddFlags are the options of ZAdd. NX only adds new members and XX only updates existing ones.
+// GT and LT only update a member when its new score is greater or less than the current one.
+// CH counts the members updated along with the members added.
+type ZAddFlags struct {
+	NX, XX, GT, LT, CH bool
+}
+
+// SortedSet is a set of unique strings ordered by score, then lexicographically. Sorted sets are
+// modified in place through the Z methods of the datastore, and must not be modified once stored.
+// Empty sorted sets are never stored: removing the last member removes the key.
+type SortedSet struct {
+	scores map[string]float64
+	zsl    *skiplist
+	size   int64
+}
+
+// NewSortedSet returns a sorted set holding members. A member given twice keeps its last score.
+func NewSortedSet(members ...ZMember) *SortedSet {
+	z := &SortedSet{scores: make(map[string]float64, len(members)), zsl: newSkiplist()}
+	for _, m := range members {
+		z.set(m.Member, m.Score)
+	}
+	return z
+}
+
+// Len returns the number of members of the sorted set.
+func (z *SortedSet) Len() int { return len(z.scores) }
+
+// Members returns the members of the sorted set in order.
+func (z *SortedSet) Members() []ZMember {
+	members := make([]ZMember, 0, z.Len())
+	for x := z.zsl.header.levels[0].forward; x != nil; x = x.levels[0].forward {
+		members = append(members, ZMember{Member: x.member, Score: x.score})
+	}
+	return members
+}
+
+// Clone returns a copy of the sorted set that shares no mutable state with it.
+func (z *SortedSet) Clone() interface{} {
+	return NewSortedSet(z.Members()...)
+}
+
+// MemoryUsage approximates the memory used by the sorted set.
+func (z *SortedSet) MemoryUsage() int64 { return z.size }
+
+// set sets the score of member and reports whether the member is new.
+func (z *SortedSet) set(member string, score float64) bool {
+	old, exists := z.scores[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		z.zsl.delete(old, member)
+	} else {
+		z.size += int64(len(member)) + zsetMemberOverhead
+	}
+	z.scores[member] = score
+	z.zsl.insert(score, member)
+	return !exists
+}
+
+// remove removes member and reports whether it existed.
+func (z *SortedSet) remove(member string) bool {
+	score, exists := z.scores[member]
+	if !exists {
+		return false
+	}
+	z.zsl.delete(score, member)
+	delete(z.scores, member)
+	z.size -= int64(len(member)) + zsetMemberOverhead
+	return true
+}
+
+// formatScore returns the string a score is propagated as, which parses back to the same score.
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// sortedSetCommands returns the commands that recreate z under key with Apply.
+func sortedSetCommands(key string, z *SortedSet) [][]string {
+	var commands [][]string
+	var args []string
+	for i, m := range z.Members() {
+		if i%zsetCommandBatch == 0 {
+			if args != nil {
+				commands = append(commands, args)
+			}
+			name := "ZADD"
+			if i == 0 {
+				name = "ZCREATE"
+			}
+			args = []string{name, key}
+		}
+		args = append(args, formatScore(m.Score), m.Member)
+	}
+	if args != nil {
+		commands = append(commands, args)
+	}
+	return commands
+}
+
+// lookupSortedSet returns the sorted set stored under key, nil when there is none. Caller must hold mu.
+func (s *DataStore) lookupSortedSet(key string) (*SortedSet, error) {
+	value, ok := s.Data[key]
+	if !ok || s.isExpired(key, time.Now()) {
+		return nil, nil
+	}
+	z, ok := value.(*SortedSet)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return z, nil
+}
+
+// writeSortedSet returns the sorted set stored under key, nil when there is none, before it is modified.
+// The sorted set must be stored again once modified. Caller must hold mu for writing.
+func (s *DataStore) writeSortedSet(key string) (*SortedSet, error) {
+	s.expireIfNeeded(key)
+	z, err := s.lookupSortedSet(key)
+	if z != nil {
+		s.preserve(key)
+	}
+	return z, err
+}
+
+// ZAdd adds members to the sorted set stored under key, or updates their score, creating the sorted set
+// when needed. It returns the number of members added, plus the number of members updated with CH.
+func (s *DataStore) ZAdd(key string, flags ZAddFlags, members ...ZMember) (int, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("no members to add")
+	}
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, ErrNotANumber
+		}
+	}
+	s.lock()
+	defer s.unlock()
+
+	z, err := s.writeSortedSet(key)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, m := range members {
+		size += int64(len(m.Member)) + zsetMemberOverhead
+	}
+	if z == nil {
+		if flags.XX {
+			return 0, nil
+		}
+		size += entryOverhead + int64(len(key))
+	}
+	if err := s.makeRoom(size, z == nil, key); err != nil {
+		return 0, err
+	}
+	created := z == nil
+	if created {
+		z = NewSortedSet()
+	}
+
+	added, updated := 0, 0
+	args := []string{"ZADD", key}
+	for _, m := range members {
+		old, exists := z.scores[m.Member]
+		switch {
+		case exists && (flags.NX || old == m.Score || (flags.GT && m.Score <= old) || (flags.LT && m.Score >= old)):
+			continue
+		case !exists && flags.XX:
+			continue
+		}
+		if z.set(m.Member, m.Score) {
+			added++
+		} else {
+			updated++
+		}
+		args = append(args, formatScore(m.Score), m.Member)
+	}
+	if len(args) == 2 {
+		return 0, nil
+	}
+	s.store(key, z)
+	s.propagate(args...)
+	if created {
+		s.capNewKey(key)
+	}
+	if flags.CH {
+		return added + updated, nil
+	}
+	return added, nil
+}
+
+// ZIncrBy adds increment to the score of member in the sorted set stored under key, adding the member
+// with a score of zero when needed. It returns the new score.
+func (s *DataStore) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+	s.lock()
+	defer s.unlock()
+
+	z, err := s.writeSortedSet(key)
+	if err != nil {
+		return 0, err
+	}
+	var score float64
+	exists := false
+	if z != nil {
+		score, exists = z.scores[member]
+	}
+	score += increment
+	if math.IsNaN(score) {
+		return 0, ErrNotANumber
+	}
+	if !exists {
+		size := int64(len(member)) + zsetMemberOverhead
+		if z == nil {
+			size += entryOverhead + int64(len(key))
+		}
+		if err := s.makeRoom(size, z == nil, key); err != nil {
+			return 0, err
+		}
+	}
+	created := z == nil
+	if created {
+		z = NewSortedSet()
+	}
+
+	// The new score is propagated rather than the increment, so that replaying it twice is harmless
+	z.set(member, score)
+	s.store(key, z)
+	s.propagate("ZADD", key, formatScore(score), member)
+	if created {
+		s.capNewKey(key)
+	}
+	return score, nil
+}
+
+// ZRem removes members from the sorted set stored under key and returns the number of members removed.
+// The key is removed along with its last member.
+func (s *DataStore) ZRem(key string, members ...string) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	z, err := s.writeSortedSet(key)
+	if z == nil {
+		return 0, err
+	}
+	removed := s.removeSortedSet(key, z, members)
+	if len(removed) > 0 {
+		s.propagate(append([]string{"ZREM", key}, removed...)...)
+	}
+	return len(removed), nil
+}
+
+// removeSortedSet removes members from z, stored under key, and returns the members removed.
+// Caller must hold mu for writing.
+func (s *DataStore) removeSortedSet(key string, z *SortedSet, members []string) []string {
+	var removed []string
+	for _, member := range members {
+		if z.remove(member) {
+			removed = append(removed, member)
+		}
+	}
+	if z.Len() == 0 {
+		s.unstore(key)
+	} else {
+		s.store(key, z)
+	}
+	return removed
+}
+
+// ZScore returns the score of member in the sorted set stored under key, false when there is no such member.
+func (s *DataStore) ZScore(key, member string) (float64, bool, error) {
+	s.rlock()
+	defer s.runlock()
+	z, err := s.lookupSortedSet(key)
+	if z == nil {
+		return 0, false, err
+	}
+	score, ok := z.scores[member]
+	return score, ok, nil
+}
+
+// ZCard returns the number of members of the sorted set stored under key, zero when there is no such set.
+func (s *DataStore) ZCard(key string) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	z, err := s.lookupSortedSet(key)
+	if z == nil {
+		return 0, err
+	}
+	return z.Len(), nil
+}
+
+// ZRank returns the 0-based position of member in the sorted set stored under key, from the highest
+// score when reverse is set. It returns false when there is no such member.
+func (s *DataStore) ZRank(key, member string, reverse bool) (int, bool, error) {
+	s.rlock()
+	defer s.runlock()
+	z, err := s.lookupSortedSet(key)
+	if z == nil {
+		return 0, false, err
+	}
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, false, nil
+	}
+	rank := z.zsl.rank(score, member)
+	if reverse {
+		rank = z.Len() - 1 - rank
+	}
+	return rank, true, nil
+}
+
+// ZRange returns the members of the sorted set stored under key between the positions start and stop
+// inclusive, from the highest score when reverse is set. Negative positions count from the end, -1
+// being the last member, and out of range positions are clamped.
+func (s *DataStore) ZRange(key string, start, stop int, reverse bool) ([]ZMember, error) {
+	s.rlock()
+	defer s.runlock()
+	z, err := s.lookupSortedSet(key)
+	if z == nil {
+		return nil, err
+	}
+	s.touch(key)
+
+	n := z.Len()
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start, stop = max(start, 0), min(stop, n-1)
+	if start > stop {
+		return []ZMember{}, nil
+	}
+	members := make([]ZMember, 0, stop-start+1)
+	if reverse {
+		for x := z.zsl.byRank(n - 1 - start); len(members) < cap(members); x = x.backward {
+			members = append(members, ZMember{Member: x.member, Score: x.score})
+		}
+	} else {
+		for x := z.zsl.byRank(start); len(members) < cap(members); x = x.levels[0].forward {
+			members = append(members, ZMember{Member: x.member, Score: x.score})
+		}
+	}
+	return members, nil
+}
+
+// ZRangeByScore returns the members of the sorted set stored under key whose score is between min and
+// max, from the highest score when reverse is set. The first offset members in range are skipped, and
+// at most count members are returned, a negative count meaning all of them.
+func (s *DataStore) ZRangeByScore(key string, min, max ScoreBound, reverse bool, offset, count int) ([]ZMember, error) {
+	s.rlock()
+	defer s.runlock()
+	z, err := s.lookupSortedSet(key)
+	if z == nil {
+		return nil, err
+	}
+	s.touch(key)
+
+	members := []ZMember{}
+	var x *skiplistNode
+	if reverse {
+		x = z.zsl.lastBelow(max)
+	} else {
+		x = z.zsl.firstAbove(min)
+	}
+	for ; x != nil && count != 0; offset-- {
+		if (reverse && !min.above(x.score)) || (!reverse && !max.below(x.score)) {
+			break
+		}
+		if offset <= 0 {
+			members = append(members, ZMember{Member: x.member, Score: x.score})
+			count--
+		}
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.levels[0].forward
+		}
+	}
+	return members, nil
+}
+
+// isSortedSetCommand reports whether name is a sorted set command propagated by the datastore.
+func isSortedSetCommand(name string) bool {
+	return name == "ZCREATE" || name == "ZADD" || name == "ZREM"
+}
+
+// applySortedSet replays a sorted set command produced by a Propagator:
+//
+//	ZCREATE key score member [score member ...]
+//	ZADD key score member [score member ...]
+//	ZREM key member [member ...]
+//
+// ZCREATE replaces any value stored under key, like SET. Caller must hold mu for writing.
+func (s *DataStore) applySortedSet(name string, args []string) error {
+	if len(args) < 3 || (name != "ZREM" && len(args)%2 != 0) {
+		return fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	key := args[1]
+	if name == "ZREM" {
+		z, err := s.writeSortedSet(key)
+		if z != nil {
+			s.removeSortedSet(key, z, args[2:])
+		}
+		return err
+	}
+
+	members := make([]ZMember, 0, len(args)/2-1)
+	for i := 2; i < len(args); i += 2 {
+		score, err := strconv.ParseFloat(args[i], 64)
+		if err != nil || math.IsNaN(score) {
+			return fmt.Errorf("invalid score %q", args[i])
+		}
+		members = append(members, ZMember{Member: args[i+1], Score: score})
+	}
+	if name == "ZCREATE" {
+		z := NewSortedSet(members...)
+		s.makeRoom(estimateSize(key, z)-s.storedSize(key), s.Data[key] == nil, key)
+		s.store(key, z)
+		s.clearDeadline(key)
+		return nil
+	}
+
+	z, err := s.writeSortedSet(key)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, m := range members {
+		size += int64(len(m.Member)) + zsetMemberOverhead
+	}
+	s.makeRoom(size, z == nil, key)
+	if z == nil {
+		z = NewSortedSet()
+	}
+	for _, m := range members {
+		z.set(m.Member, m.Score)
+	}
+	s.store(key, z)
+	return nil
+}
+
+// errCorruptSortedSet is returned by UnmarshalBinary for data that MarshalBinary did not produce.
+var errCorruptSortedSet = errors.New("corrupt sorted set encoding")
+
+// MarshalBinary encodes the members of the sorted set in order, along with their scores.
+func (z *SortedSet) MarshalBinary() ([]byte, error) {
+	b := binary.AppendUvarint(nil, uint64(z.Len()))
+	for _, m := range z.Members() {
+		b = binary.AppendUvarint(b, uint64(len(m.Member)))
+		b = append(b, m.Member...)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(m.Score))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a sorted set encoded by MarshalBinary.
+func (z *SortedSet) UnmarshalBinary(data []byte) error {
+	d := streamDecoder{data: data}
+	n := d.length()
+	decoded := NewSortedSet()
+	for i := 0; i < n && d.err == nil; i++ {
+		member := d.string()
+		if d.err != nil || len(data)-d.pos < 8 {
+			return errCorruptSortedSet
+		}
+		score := math.Float64frombits(binary.LittleEndian.Uint64(data[d.pos:]))
+		d.pos += 8
+		if math.IsNaN(score) || !decoded.set(member, score) {
+			return errCorruptSortedSet
+		}
+	}
+	if d.err != nil || d.pos != len(data) || n == 0 {
+		return errCorruptSortedSet
+	}
+	*z = *decoded
+	return nil
+}
@@ -0,0 +1,187 @@
+package datastore_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_ZAdd(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	added, err := s.ZAdd("z", datastore.ZAddFlags{}, datastore.ZMember{Member: "a", Score: 1}, datastore.ZMember{Member: "b", Score: 2})
+	if err != nil || added != 2 {
+		t.Fatalf("Expected 2 members added, got %d, %v", added, err)
+	}
+	if added, _ := s.ZAdd("z", datastore.ZAddFlags{NX: true}, datastore.ZMember{Member: "a", Score: 5}); added != 0 {
+		t.Errorf("Expected NX not to update a, got %d", added)
+	}
+	if changed, _ := s.ZAdd("z", datastore.ZAddFlags{XX: true, CH: true}, datastore.ZMember{Member: "a", Score: 3}, datastore.ZMember{Member: "c", Score: 0}); changed != 1 {
+		t.Errorf("Expected XX to update a only, got %d", changed)
+	}
+	s.ZAdd("z", datastore.ZAddFlags{GT: true}, datastore.ZMember{Member: "a", Score: 2}, datastore.ZMember{Member: "b", Score: 4})
+	if members, _ := s.ZRange("z", 0, -1, false); !reflect.DeepEqual(members, []datastore.ZMember{{Member: "a", Score: 3}, {Member: "b", Score: 4}}) {
+		t.Errorf("Expected GT to only raise scores, got %v", members)
+	}
+	if score, ok, _ := s.ZScore("z", "a"); !ok || score != 3 {
+		t.Errorf("Expected a score of 3, got %v, %v", score, ok)
+	}
+	if _, ok, _ := s.ZScore("z", "c"); ok {
+		t.Error("Expected XX not to add c")
+	}
+	if _, err := s.ZAdd("z", datastore.ZAddFlags{}, datastore.ZMember{Member: "a", Score: math.NaN()}); err != datastore.ErrNotANumber {
+		t.Errorf("Expected ErrNotANumber, got %v", err)
+	}
+
+	if score, _ := s.ZIncrBy("z", 1.5, "a"); score != 4.5 {
+		t.Errorf("Expected 4.5, got %v", score)
+	}
+	if score, _ := s.ZIncrBy("z", -1, "new"); score != -1 {
+		t.Errorf("Expected a new member to start at zero, got %v", score)
+	}
+	s.ZAdd("z", datastore.ZAddFlags{}, datastore.ZMember{Member: "inf", Score: math.Inf(1)})
+	if _, err := s.ZIncrBy("z", math.Inf(-1), "inf"); err != datastore.ErrNotANumber {
+		t.Errorf("Expected ErrNotANumber, got %v", err)
+	}
+
+	if removed, _ := s.ZRem("z", "a", "missing"); removed != 1 {
+		t.Errorf("Expected 1 member removed, got %d", removed)
+	}
+	if n, _ := s.ZCard("z"); n != 3 {
+		t.Errorf("Expected 3 members left, got %d", n)
+	}
+	s.ZRem("z", "b", "new", "inf")
+	if _, err := s.Get("z"); err != datastore.ErrKeyNotFound {
+		t.Error("Expected removing the last member to remove the key")
+	}
+
+	s.Set("string", "value")
+	if _, err := s.ZAdd("string", datastore.ZAddFlags{}, datastore.ZMember{Member: "a"}); err != datastore.ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestDataStore_ZRangeMatchesSortedOrder(t *testing.T) {
+	s := datastore.NewDataStore()
+	scores := make(map[string]float64)
+	for i := 0; i < 2000; i++ {
+		member := "m" + strconv.Itoa(rand.IntN(500))
+		if rand.IntN(4) == 0 {
+			s.ZRem("z", member)
+			delete(scores, member)
+			continue
+		}
+		score := float64(rand.IntN(50))
+		s.ZAdd("z", datastore.ZAddFlags{}, datastore.ZMember{Member: member, Score: score})
+		scores[member] = score
+	}
+	expected := make([]datastore.ZMember, 0, len(scores))
+	for member, score := range scores {
+		expected = append(expected, datastore.ZMember{Member: member, Score: score})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		a, b := expected[i], expected[j]
+		return a.Score < b.Score || (a.Score == b.Score && a.Member < b.Member)
+	})
+
+	if members, _ := s.ZRange("z", 0, -1, false); !reflect.DeepEqual(members, expected) {
+		t.Fatalf("Expected the members ordered by score, then member")
+	}
+	for i, m := range expected {
+		if rank, ok, _ := s.ZRank("z", m.Member, false); !ok || rank != i {
+			t.Fatalf("Expected %s at rank %d, got %d", m.Member, i, rank)
+		}
+		if rank, _, _ := s.ZRank("z", m.Member, true); rank != len(expected)-1-i {
+			t.Fatalf("Expected %s at reverse rank %d, got %d", m.Member, len(expected)-1-i, rank)
+		}
+	}
+	if members, _ := s.ZRange("z", 10, 19, false); !reflect.DeepEqual(members, expected[10:20]) {
+		t.Errorf("Expected members 10 to 19, got %v", members)
+	}
+	if members, _ := s.ZRange("z", -3, -1, true); len(members) != 3 || members[0] != expected[2] || members[2] != expected[0] {
+		t.Errorf("Expected the 3 lowest members in reverse, got %v", members)
+	}
+
+	min, max := datastore.ScoreBound{Score: 10}, datastore.ScoreBound{Score: 20, Exclusive: true}
+	var inRange []datastore.ZMember
+	for _, m := range expected {
+		if m.Score >= 10 && m.Score < 20 {
+			inRange = append(inRange, m)
+		}
+	}
+	if members, _ := s.ZRangeByScore("z", min, max, false, 0, -1); !reflect.DeepEqual(members, inRange) {
+		t.Errorf("Expected the members scored in [10, 20), got %v", members)
+	}
+	if members, _ := s.ZRangeByScore("z", min, max, false, 2, 3); !reflect.DeepEqual(members, inRange[2:5]) {
+		t.Errorf("Expected the LIMIT 2 3 members, got %v", members)
+	}
+	reversed, _ := s.ZRangeByScore("z", min, max, true, 0, -1)
+	for i, m := range reversed {
+		if m != inRange[len(inRange)-1-i] {
+			t.Fatalf("Expected the members scored in [10, 20) in reverse, got %v", reversed)
+		}
+	}
+	if members, _ := s.ZRangeByScore("z", datastore.ScoreBound{Score: 100}, datastore.ScoreBound{Score: math.Inf(1)}, false, 0, -1); len(members) != 0 {
+		t.Errorf("Expected no member above 100, got %v", members)
+	}
+}
+
+func TestDataStore_ApplyReplaysSortedSets(t *testing.T) {
+	source := datastore.NewDataStore()
+	replica := datastore.NewDataStore()
+	source.AddPropagator(func(args []string) {
+		if err := replica.Apply(args); err != nil {
+			t.Errorf("Expected no error applying %v, got %v", args, err)
+		}
+	})
+
+	for i := 0; i < 100; i++ {
+		source.ZAdd("z", datastore.ZAddFlags{}, datastore.ZMember{Member: "m" + strconv.Itoa(i), Score: float64(i) / 3})
+	}
+	source.ZIncrBy("z", 0.1, "m5")
+	source.ZAdd("z", datastore.ZAddFlags{}, datastore.ZMember{Member: "inf", Score: math.Inf(-1)})
+	source.ZRem("z", "m0", "m1")
+	source.ZAdd("gone", datastore.ZAddFlags{}, datastore.ZMember{Member: "a"})
+	source.ZRem("gone", "a")
+
+	expected, _ := source.ZRange("z", 0, -1, false)
+	if members, _ := replica.ZRange("z", 0, -1, false); !reflect.DeepEqual(members, expected) {
+		t.Errorf("Expected %v, got %v", expected, members)
+	}
+	if _, err := replica.Get("gone"); err != datastore.ErrKeyNotFound {
+		t.Error("Expected the emptied sorted set to be removed")
+	}
+
+	// The commands of an entry recreate the sorted set on an empty datastore
+	restored := datastore.NewDataStore()
+	for _, entry := range source.Snapshot(nil) {
+		for _, args := range datastore.EntryCommands(entry) {
+			if err := restored.Apply(args); err != nil {
+				t.Fatalf("Expected no error applying %v, got %v", args, err)
+			}
+		}
+	}
+	if members, _ := restored.ZRange("z", 0, -1, false); !reflect.DeepEqual(members, expected) {
+		t.Errorf("Expected %v, got %v", expected, members)
+	}
+}
+
+func TestSortedSet_MarshalBinary(t *testing.T) {
+	members := []datastore.ZMember{{Member: "a", Score: math.Inf(-1)}, {Member: "b", Score: 0.1}, {Member: "c", Score: 0.1}}
+	data, _ := datastore.NewSortedSet(members...).MarshalBinary()
+	decoded := new(datastore.SortedSet)
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := decoded.Members(); !reflect.DeepEqual(got, members) {
+		t.Errorf("Expected the same members, got %v", got)
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("Expected an error for truncated data")
+	}
+}
@@ -0,0 +1,1056 @@
+package datastore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Declared stream errors
+var (
+	ErrStreamIDTooSmall = &DataStoreError{Message: "The ID specified in XADD is equal or smaller than the target stream top item"}
+	ErrStreamIDZero     = &DataStoreError{Message: "The ID specified in XADD must be greater than 0-0"}
+	ErrInvalidStreamID  = &DataStoreError{Message: "Invalid stream ID specified as stream command argument"}
+	ErrNoGroup          = &DataStoreError{Message: "No such key or consumer group"}
+	ErrGroupExists      = &DataStoreError{Message: "Consumer Group name already exists"}
+)
+
+// streamEntryOverhead approximates the bookkeeping memory of a stream entry or a pending entry.
+const streamEntryOverhead = 32
+
+// StreamID identifies an entry of a stream: the Unix time in milliseconds it was added at, and a sequence
+// number among the entries added during the same millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is greater than any other ID.
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// ParseStreamID parses an ID written as "<ms>-<seq>", or "<ms>" in which case the sequence number is defaultSeq.
+func ParseStreamID(s string, defaultSeq uint64) (StreamID, error) {
+	ms, seq, found := strings.Cut(s, "-")
+	var id StreamID
+	var err error
+	if id.Ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return id, ErrInvalidStreamID
+	}
+	id.Seq = defaultSeq
+	if found {
+		if id.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+			return id, ErrInvalidStreamID
+		}
+	}
+	return id, nil
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less reports whether id comes before other.
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// Next returns the smallest ID greater than id, or id itself when it is MaxStreamID.
+func (id StreamID) Next() StreamID {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}
+	}
+	return id
+}
+
+// StreamEntry is an entry of a stream. Fields holds field-value pairs.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// Stream is an append-only log of entries, read by consumer groups that track the entries delivered to
+// their consumers until they are acknowledged. Streams are modified in place through the X methods
+// of the datastore, and must not be modified once stored.
+type Stream struct {
+	// entries are sorted by ID
+	entries []StreamEntry
+	// lastID is the ID of the last entry ever added: new entries must have a greater ID, even once it was trimmed
+	lastID StreamID
+	groups map[string]*streamGroup
+	// size approximates the memory used by the entries and pending entries, see MemoryUsage
+	size int64
+}
+
+// streamGroup is a consumer group of a stream.
+type streamGroup struct {
+	// lastDelivered is the ID of the last entry delivered to the group
+	lastDelivered StreamID
+	// pending holds the entries delivered and not acknowledged yet
+	pending map[StreamID]*pendingEntry
+}
+
+type pendingEntry struct {
+	consumer   string
+	delivered  time.Time
+	deliveries int
+}
+
+// PendingEntry is an entry delivered to a consumer of a group and not acknowledged yet.
+type PendingEntry struct {
+	ID       StreamID
+	Consumer string
+	// Idle is the time elapsed since the entry was last delivered
+	Idle       time.Duration
+	Deliveries int
+}
+
+// PendingSummary describes the entries pending in a group, see XPending.
+type PendingSummary struct {
+	Count           int
+	Lowest, Highest StreamID
+	// Consumers counts the pending entries of each consumer holding some
+	Consumers map[string]int
+}
+
+// TrimStrategy selects how a stream is trimmed.
+type TrimStrategy int
+
+const (
+	// TrimNone leaves the stream as is.
+	TrimNone TrimStrategy = iota
+	// TrimMaxLen keeps the MaxLen most recent entries.
+	TrimMaxLen
+	// TrimMinID removes the entries whose ID is less than MinID.
+	TrimMinID
+)
+
+// StreamTrim describes how a stream is trimmed.
+type StreamTrim struct {
+	Strategy TrimStrategy
+	MaxLen   int
+	MinID    StreamID
+}
+
+// XAddArgs are the arguments of XAdd.
+type XAddArgs struct {
+	// ID is the ID of the new entry. With AutoSeq, only ID.Ms is given and the sequence number is generated;
+	// with AutoID, the whole ID is generated from the current time.
+	ID      StreamID
+	AutoID  bool
+	AutoSeq bool
+	Fields  []string
+	// NoMkStream fails with ErrKeyNotFound instead of creating a missing stream
+	NoMkStream bool
+	Trim       StreamTrim
+}
+
+// Len returns the number of entries of the stream.
+func (st *Stream) Len() int { return len(st.entries) }
+
+// LastID returns the ID of the last entry ever added to the stream.
+func (st *Stream) LastID() StreamID { return st.lastID }
+
+// Clone returns a copy of the stream that shares no mutable state with it.
+func (st *Stream) Clone() interface{} {
+	clone := &Stream{entries: append([]StreamEntry(nil), st.entries...), lastID: st.lastID, size: st.size}
+	if st.groups != nil {
+		clone.groups = make(map[string]*streamGroup, len(st.groups))
+		for name, g := range st.groups {
+			pending := make(map[StreamID]*pendingEntry, len(g.pending))
+			for id, p := range g.pending {
+				copied := *p
+				pending[id] = &copied
+			}
+			clone.groups[name] = &streamGroup{lastDelivered: g.lastDelivered, pending: pending}
+		}
+	}
+	return clone
+}
+
+// MemoryUsage approximates the memory used by the stream.
+func (st *Stream) MemoryUsage() int64 { return st.size }
+
+// entrySize approximates the memory used by an entry.
+func entrySize(fields []string) int64 {
+	size := int64(streamEntryOverhead)
+	for _, field := range fields {
+		size += int64(len(field))
+	}
+	return size
+}
+
+// search returns the index of the first entry whose ID is not less than id.
+func (st *Stream) search(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool { return !st.entries[i].ID.Less(id) })
+}
+
+// entry returns the entry id, if it was not trimmed.
+func (st *Stream) entry(id StreamID) (StreamEntry, bool) {
+	if i := st.search(id); i < len(st.entries) && st.entries[i].ID == id {
+		return st.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// nextID returns the ID of a new entry, as described by XAddArgs.
+func (st *Stream) nextID(args XAddArgs, now time.Time) (StreamID, error) {
+	id := args.ID
+	switch {
+	case args.AutoID:
+		id = StreamID{Ms: uint64(max(now.UnixMilli(), 0))}
+		if !st.lastID.Less(id) {
+			if st.lastID == MaxStreamID {
+				return id, ErrStreamIDTooSmall
+			}
+			id = st.lastID.Next()
+		}
+		return id, nil
+	case args.AutoSeq:
+		switch {
+		case id.Ms < st.lastID.Ms:
+			return id, ErrStreamIDTooSmall
+		case id.Ms == st.lastID.Ms:
+			if st.lastID.Seq == math.MaxUint64 {
+				return id, ErrStreamIDTooSmall
+			}
+			id.Seq = st.lastID.Seq + 1
+		default:
+			id.Seq = 0
+		}
+		return id, nil
+	}
+	if id == (StreamID{}) {
+		return id, ErrStreamIDZero
+	}
+	if !st.lastID.Less(id) {
+		return id, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// add appends an entry, whose ID must be greater than the ID of the last entry.
+func (st *Stream) add(id StreamID, fields []string) {
+	st.entries = append(st.entries, StreamEntry{ID: id, Fields: fields})
+	if st.lastID.Less(id) {
+		st.lastID = id
+	}
+	st.size += entrySize(fields)
+}
+
+// trimBefore removes the entries whose ID is less than id and returns their number. Pending entries
+// are kept: they are reported as deleted when read.
+func (st *Stream) trimBefore(id StreamID) int {
+	n := st.search(id)
+	for _, entry := range st.entries[:n] {
+		st.size -= entrySize(entry.Fields)
+	}
+	if n > len(st.entries)/2 {
+		// Release the trimmed entries, rather than keeping them reachable from the array
+		st.entries = append([]StreamEntry(nil), st.entries[n:]...)
+	} else {
+		clear(st.entries[:n])
+		st.entries = st.entries[n:]
+	}
+	return n
+}
+
+// trimID returns the ID trim removes the entries before, false when trim removes nothing.
+func (st *Stream) trimID(trim StreamTrim) (StreamID, bool) {
+	switch trim.Strategy {
+	case TrimMaxLen:
+		if len(st.entries) <= max(trim.MaxLen, 0) {
+			return StreamID{}, false
+		}
+		if trim.MaxLen <= 0 {
+			return st.lastID.Next(), true
+		}
+		return st.entries[len(st.entries)-trim.MaxLen].ID, true
+	case TrimMinID:
+		if len(st.entries) == 0 || !st.entries[0].ID.Less(trim.MinID) {
+			return StreamID{}, false
+		}
+		return trim.MinID, true
+	}
+	return StreamID{}, false
+}
+
+// group returns the named consumer group, or ErrNoGroup.
+func (st *Stream) group(name string) (*streamGroup, error) {
+	if st == nil || st.groups[name] == nil {
+		return nil, ErrNoGroup
+	}
+	return st.groups[name], nil
+}
+
+// claim records that the entry id was delivered to consumer.
+func (st *Stream) claim(g *streamGroup, id StreamID, consumer string, delivered time.Time, deliveries int) {
+	if p := g.pending[id]; p != nil {
+		st.size -= streamEntryOverhead + int64(len(p.consumer))
+	}
+	g.pending[id] = &pendingEntry{consumer: consumer, delivered: delivered, deliveries: deliveries}
+	st.size += streamEntryOverhead + int64(len(consumer))
+}
+
+// ack removes the entry id from the pending entries of g and reports whether it was pending.
+func (st *Stream) ack(g *streamGroup, id StreamID) bool {
+	p := g.pending[id]
+	if p == nil {
+		return false
+	}
+	delete(g.pending, id)
+	st.size -= streamEntryOverhead + int64(len(p.consumer))
+	return true
+}
+
+// sortedPending returns the IDs of the pending entries of g, sorted.
+func sortedPending(g *streamGroup) []StreamID {
+	ids := make([]StreamID, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	return ids
+}
+
+// streamCommands returns the commands that recreate st under key with Apply.
+func streamCommands(key string, st *Stream) [][]string {
+	commands := [][]string{{"XCREATE", key, st.lastID.String()}}
+	for _, entry := range st.entries {
+		commands = append(commands, append([]string{"XADD", key, entry.ID.String()}, entry.Fields...))
+	}
+	names := make([]string, 0, len(st.groups))
+	for name := range st.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g := st.groups[name]
+		commands = append(commands, []string{"XGROUP", "CREATE", key, name, g.lastDelivered.String()})
+		for _, id := range sortedPending(g) {
+			commands = append(commands, claimCommand(key, name, id, g.pending[id]))
+		}
+	}
+	return commands
+}
+
+func claimCommand(key, group string, id StreamID, p *pendingEntry) []string {
+	return []string{"XCLAIM", key, group, p.consumer, id.String(),
+		strconv.FormatInt(p.delivered.UnixMilli(), 10), strconv.Itoa(p.deliveries)}
+}
+
+// lookupStream returns the stream stored under key, nil when there is none. Caller must hold mu.
+func (s *DataStore) lookupStream(key string) (*Stream, error) {
+	value, ok := s.Data[key]
+	if !ok || s.isExpired(key, time.Now()) {
+		return nil, nil
+	}
+	st, ok := value.(*Stream)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return st, nil
+}
+
+// writeStream returns the stream stored under key, nil when there is none, before it is modified.
+// The stream must be stored again once modified. Caller must hold mu for writing.
+func (s *DataStore) writeStream(key string) (*Stream, error) {
+	s.expireIfNeeded(key)
+	st, err := s.lookupStream(key)
+	if st != nil {
+		s.preserve(key)
+	}
+	return st, err
+}
+
+// XAdd appends an entry to the stream stored under key, creating the stream when needed, then trims it.
+// It returns the ID of the new entry.
+func (s *DataStore) XAdd(key string, args XAddArgs) (StreamID, error) {
+	if err := validateKey(key); err != nil {
+		return StreamID{}, err
+	}
+	if len(args.Fields) == 0 || len(args.Fields)%2 != 0 {
+		return StreamID{}, fmt.Errorf("fields must be field-value pairs")
+	}
+	s.lock()
+	defer s.unlock()
+
+	st, err := s.writeStream(key)
+	if err != nil {
+		return StreamID{}, err
+	}
+	created := st == nil
+	if created {
+		if args.NoMkStream {
+			return StreamID{}, ErrKeyNotFound
+		}
+		st = &Stream{}
+	}
+	id, err := st.nextID(args, time.Now())
+	if err != nil {
+		return id, err
+	}
+	size := entrySize(args.Fields)
+	if created {
+		size += entryOverhead + int64(len(key))
+	}
+	if err := s.makeRoom(size, created, key); err != nil {
+		return id, err
+	}
+
+	st.add(id, args.Fields)
+	s.store(key, st)
+	s.propagate(append([]string{"XADD", key, id.String()}, args.Fields...)...)
+	if created {
+		s.capNewKey(key)
+	}
+	s.trimStream(key, st, args.Trim)
+	return id, nil
+}
+
+// XTrim trims the stream stored under key and returns the number of entries removed.
+func (s *DataStore) XTrim(key string, trim StreamTrim) (int, error) {
+	s.lock()
+	defer s.unlock()
+	st, err := s.writeStream(key)
+	if st == nil {
+		return 0, err
+	}
+	return s.trimStream(key, st, trim), nil
+}
+
+// trimStream trims st, stored under key, and propagates the trim as a MINID one. Caller must hold mu for writing.
+func (s *DataStore) trimStream(key string, st *Stream, trim StreamTrim) int {
+	id, ok := st.trimID(trim)
+	if !ok {
+		return 0
+	}
+	n := st.trimBefore(id)
+	s.store(key, st)
+	s.propagate("XTRIM", key, "MINID", id.String())
+	return n
+}
+
+// XLen returns the number of entries of the stream stored under key, 0 when there is none.
+func (s *DataStore) XLen(key string) (int, error) {
+	s.rlock()
+	defer s.runlock()
+	st, err := s.lookupStream(key)
+	if st == nil {
+		return 0, err
+	}
+	return st.Len(), nil
+}
+
+// XRange returns the entries of the stream stored under key whose ID is between start and end inclusive,
+// in reverse order when reverse is set. A count greater than zero limits the number of entries.
+func (s *DataStore) XRange(key string, start, end StreamID, count int, reverse bool) ([]StreamEntry, error) {
+	s.rlock()
+	defer s.runlock()
+	st, err := s.lookupStream(key)
+	if st == nil || end.Less(start) {
+		return nil, err
+	}
+	s.touch(key)
+
+	from, to := st.search(start), st.search(end.Next())
+	if end == MaxStreamID {
+		to = len(st.entries)
+	}
+	var entries []StreamEntry
+	for i := range to - from {
+		if count > 0 && len(entries) == count {
+			break
+		}
+		if reverse {
+			entries = append(entries, st.entries[to-1-i])
+		} else {
+			entries = append(entries, st.entries[from+i])
+		}
+	}
+	return entries, nil
+}
+
+// XRead returns the entries of the stream stored under key whose ID is greater than after.
+// A count greater than zero limits the number of entries.
+func (s *DataStore) XRead(key string, after StreamID, count int) ([]StreamEntry, error) {
+	if after == MaxStreamID {
+		return nil, nil
+	}
+	return s.XRange(key, after.Next(), MaxStreamID, count, false)
+}
+
+// XLastID returns the ID of the last entry added to the stream stored under key, the zero ID when there is none.
+func (s *DataStore) XLastID(key string) (StreamID, error) {
+	s.rlock()
+	defer s.runlock()
+	st, err := s.lookupStream(key)
+	if st == nil {
+		return StreamID{}, err
+	}
+	return st.lastID, nil
+}
+
+// XGroupCreate creates a consumer group of the stream stored under key, which is delivered the entries
+// added after id, or after the last entry of the stream when last is set. With mkStream, a missing stream
+// is created empty, otherwise it fails with ErrKeyNotFound.
+func (s *DataStore) XGroupCreate(key, group string, id StreamID, last bool, mkStream bool) error {
+	s.lock()
+	defer s.unlock()
+
+	st, err := s.writeStream(key)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		if !mkStream {
+			return ErrKeyNotFound
+		}
+		if err := validateKey(key); err != nil {
+			return err
+		}
+		if err := s.makeRoom(streamEntryOverhead, true, key); err != nil {
+			return err
+		}
+		st = &Stream{}
+		s.store(key, st)
+		s.propagate("XCREATE", key, st.lastID.String())
+		s.capNewKey(key)
+	}
+	if st.groups[group] != nil {
+		return ErrGroupExists
+	}
+	if last {
+		id = st.lastID
+	}
+	st.createGroup(group, id)
+	s.store(key, st)
+	s.propagate("XGROUP", "CREATE", key, group, id.String())
+	return nil
+}
+
+// createGroup adds a consumer group, delivered the entries added after id.
+func (st *Stream) createGroup(group string, id StreamID) {
+	if st.groups == nil {
+		st.groups = make(map[string]*streamGroup)
+	}
+	st.groups[group] = &streamGroup{lastDelivered: id, pending: make(map[StreamID]*pendingEntry)}
+	st.size += streamEntryOverhead + int64(len(group))
+}
+
+// XGroupDestroy removes a consumer group, along with its pending entries, and reports whether it existed.
+func (s *DataStore) XGroupDestroy(key, group string) (bool, error) {
+	s.lock()
+	defer s.unlock()
+
+	st, err := s.writeStream(key)
+	if st == nil {
+		return false, err
+	}
+	if !st.destroyGroup(group) {
+		return false, nil
+	}
+	s.store(key, st)
+	s.propagate("XGROUP", "DESTROY", key, group)
+	return true, nil
+}
+
+// destroyGroup removes a consumer group and reports whether it existed.
+func (st *Stream) destroyGroup(group string) bool {
+	g := st.groups[group]
+	if g == nil {
+		return false
+	}
+	for id := range g.pending {
+		st.ack(g, id)
+	}
+	delete(st.groups, group)
+	st.size -= streamEntryOverhead + int64(len(group))
+	return true
+}
+
+// XReadGroup delivers to consumer the entries of the stream stored under key that were not delivered to
+// the group yet. Unless noAck is set, they are pending until acknowledged with XAck. A count greater than
+// zero limits the number of entries.
+func (s *DataStore) XReadGroup(key, group, consumer string, count int, noAck bool) ([]StreamEntry, error) {
+	s.lock()
+	defer s.unlock()
+
+	st, err := s.writeStream(key)
+	if err != nil {
+		return nil, err
+	}
+	g, err := st.group(group)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []StreamEntry
+	now := time.Now()
+	for i := st.search(g.lastDelivered.Next()); i < len(st.entries) && (count <= 0 || len(entries) < count); i++ {
+		entry := st.entries[i]
+		if entry.ID == g.lastDelivered {
+			// Next does not go past MaxStreamID
+			break
+		}
+		entries = append(entries, entry)
+		if !noAck {
+			deliveries := 1
+			if p := g.pending[entry.ID]; p != nil {
+				deliveries = p.deliveries + 1
+			}
+			st.claim(g, entry.ID, consumer, now, deliveries)
+			s.propagate(claimCommand(key, group, entry.ID, g.pending[entry.ID])...)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	g.lastDelivered = entries[len(entries)-1].ID
+	s.store(key, st)
+	s.propagate("XGROUP", "SETID", key, group, g.lastDelivered.String())
+	return entries, nil
+}
+
+// XReadGroupHistory returns the entries pending for consumer whose ID is greater than after. Entries
+// trimmed since they were delivered have nil Fields. A count greater than zero limits the number of entries.
+func (s *DataStore) XReadGroupHistory(key, group, consumer string, after StreamID, count int) ([]StreamEntry, error) {
+	s.rlock()
+	defer s.runlock()
+
+	st, err := s.lookupStream(key)
+	if err != nil {
+		return nil, err
+	}
+	g, err := st.group(group)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []StreamEntry{}
+	for _, id := range sortedPending(g) {
+		if count > 0 && len(entries) == count {
+			break
+		}
+		if !after.Less(id) || g.pending[id].consumer != consumer {
+			continue
+		}
+		entry, _ := st.entry(id)
+		entry.ID = id
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// XAck acknowledges the entries ids of a group and returns the number of entries that were pending.
+func (s *DataStore) XAck(key, group string, ids []StreamID) (int, error) {
+	s.lock()
+	defer s.unlock()
+
+	st, err := s.writeStream(key)
+	if st == nil {
+		return 0, err
+	}
+	g := st.groups[group]
+	if g == nil {
+		return 0, nil
+	}
+	acked := []string{"XACK", key, group}
+	for _, id := range ids {
+		if st.ack(g, id) {
+			acked = append(acked, id.String())
+		}
+	}
+	if len(acked) == 3 {
+		return 0, nil
+	}
+	s.store(key, st)
+	s.propagate(acked...)
+	return len(acked) - 3, nil
+}
+
+// XPending summarizes the entries pending in a group.
+func (s *DataStore) XPending(key, group string) (PendingSummary, error) {
+	s.rlock()
+	defer s.runlock()
+
+	var summary PendingSummary
+	st, err := s.lookupStream(key)
+	if err != nil {
+		return summary, err
+	}
+	g, err := st.group(group)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.Count = len(g.pending)
+	summary.Consumers = make(map[string]int)
+	for _, p := range g.pending {
+		summary.Consumers[p.consumer]++
+	}
+	ids := sortedPending(g)
+	if len(ids) > 0 {
+		summary.Lowest, summary.Highest = ids[0], ids[len(ids)-1]
+	}
+	return summary, nil
+}
+
+// XPendingRange returns the entries pending in a group whose ID is between start and end inclusive, which
+// are idle for at least minIdle, and belong to consumer unless it is empty. At most count entries are returned.
+func (s *DataStore) XPendingRange(key, group string, start, end StreamID, count int, consumer string, minIdle time.Duration) ([]PendingEntry, error) {
+	s.rlock()
+	defer s.runlock()
+
+	st, err := s.lookupStream(key)
+	if err != nil {
+		return nil, err
+	}
+	g, err := st.group(group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := []PendingEntry{}
+	for _, id := range sortedPending(g) {
+		if len(entries) >= count {
+			break
+		}
+		p := g.pending[id]
+		idle := max(now.Sub(p.delivered), 0)
+		if id.Less(start) || end.Less(id) || (consumer != "" && p.consumer != consumer) || idle < minIdle {
+			continue
+		}
+		entries = append(entries, PendingEntry{ID: id, Consumer: p.consumer, Idle: idle, Deliveries: p.deliveries})
+	}
+	return entries, nil
+}
+
+// XClaim transfers to consumer the entries ids pending in a group which are idle for at least minIdle,
+// and returns them. Unless justID is set, their delivery count is incremented. Pending entries that were
+// trimmed are acknowledged instead.
+func (s *DataStore) XClaim(key, group, consumer string, minIdle time.Duration, ids []StreamID, justID bool) ([]StreamEntry, error) {
+	s.lock()
+	defer s.unlock()
+
+	st, err := s.writeStream(key)
+	if err != nil {
+		return nil, err
+	}
+	g, err := st.group(group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := []StreamEntry{}
+	for _, id := range ids {
+		p := g.pending[id]
+		if p == nil || now.Sub(p.delivered) < minIdle {
+			continue
+		}
+		entry, ok := st.entry(id)
+		if !ok {
+			st.ack(g, id)
+			s.propagate("XACK", key, group, id.String())
+			continue
+		}
+		deliveries := p.deliveries
+		if !justID {
+			deliveries++
+		}
+		st.claim(g, id, consumer, now, deliveries)
+		s.propagate(claimCommand(key, group, id, g.pending[id])...)
+		entries = append(entries, entry)
+	}
+	s.store(key, st)
+	return entries, nil
+}
+
+// isStreamCommand reports whether name is a stream command propagated by the datastore.
+func isStreamCommand(name string) bool {
+	switch name {
+	case "XCREATE", "XADD", "XTRIM", "XGROUP", "XCLAIM", "XACK":
+		return true
+	}
+	return false
+}
+
+// applyStream replays a stream command produced by a Propagator:
+//
+//	XCREATE key last-id
+//	XADD key id field value [field value ...]
+//	XTRIM key MINID id
+//	XGROUP CREATE key group last-delivered-id
+//	XGROUP DESTROY key group
+//	XGROUP SETID key group last-delivered-id
+//	XCLAIM key group consumer id delivery-time-ms deliveries
+//	XACK key group id [id ...]
+//
+// XCREATE replaces any value stored under key, like SET. Caller must hold mu for writing.
+func (s *DataStore) applyStream(name string, args []string) error {
+	if name == "XCREATE" {
+		if len(args) != 3 {
+			return fmt.Errorf("wrong number of arguments for %s", name)
+		}
+		id, err := ParseStreamID(args[2], 0)
+		if err != nil {
+			return err
+		}
+		st := &Stream{lastID: id}
+		s.makeRoom(estimateSize(args[1], st)-s.storedSize(args[1]), s.Data[args[1]] == nil, args[1])
+		s.store(args[1], st)
+		s.clearDeadline(args[1])
+		return nil
+	}
+
+	if name == "XGROUP" {
+		if len(args) < 4 {
+			return fmt.Errorf("wrong number of arguments for %s", name)
+		}
+		// Move the subcommand after the key, like the other commands
+		args = append([]string{strings.ToUpper(args[1]), args[2]}, args[3:]...)
+	}
+	if len(args) < 3 {
+		return fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	key := args[1]
+	s.expireIfNeeded(key)
+	st, err := s.lookupStream(key)
+	if err != nil {
+		return err
+	}
+	if st == nil && name != "XADD" {
+		return nil
+	}
+	if st != nil {
+		s.preserve(key)
+	}
+
+	ids := make([]StreamID, 0, len(args))
+	switch {
+	case name == "XADD" && len(args) >= 5 && len(args)%2 == 1:
+		id, err := ParseStreamID(args[2], 0)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			st = &Stream{}
+		} else if n := len(st.entries); n > 0 && !st.entries[n-1].ID.Less(id) {
+			return ErrStreamIDTooSmall
+		}
+		s.makeRoom(entrySize(args[3:]), s.Data[key] == nil, key)
+		st.add(id, args[3:])
+	case name == "XTRIM" && len(args) == 4 && strings.EqualFold(args[2], "MINID"):
+		id, err := ParseStreamID(args[3], 0)
+		if err != nil {
+			return err
+		}
+		st.trimBefore(id)
+	case name == "XACK" && len(args) >= 4:
+		for _, arg := range args[3:] {
+			id, err := ParseStreamID(arg, 0)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if g := st.groups[args[2]]; g != nil {
+			for _, id := range ids {
+				st.ack(g, id)
+			}
+		}
+	case name == "XCLAIM" && len(args) == 7:
+		id, err := ParseStreamID(args[4], 0)
+		if err != nil {
+			return err
+		}
+		ms, err := strconv.ParseInt(args[5], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid delivery time %q", args[5])
+		}
+		deliveries, err := strconv.Atoi(args[6])
+		if err != nil || deliveries < 0 {
+			return fmt.Errorf("invalid delivery count %q", args[6])
+		}
+		if g := st.groups[args[2]]; g != nil {
+			st.claim(g, id, args[3], time.UnixMilli(ms), deliveries)
+		}
+	case name == "XGROUP" && args[0] == "CREATE" && len(args) == 4:
+		id, err := ParseStreamID(args[3], 0)
+		if err != nil {
+			return err
+		}
+		if st.groups[args[2]] != nil {
+			st.destroyGroup(args[2])
+		}
+		st.createGroup(args[2], id)
+	case name == "XGROUP" && args[0] == "DESTROY" && len(args) == 3:
+		st.destroyGroup(args[2])
+	case name == "XGROUP" && args[0] == "SETID" && len(args) == 4:
+		id, err := ParseStreamID(args[3], 0)
+		if err != nil {
+			return err
+		}
+		if g := st.groups[args[2]]; g != nil {
+			g.lastDelivered = id
+		}
+	default:
+		return fmt.Errorf("unknown command %q with %d arguments", name, len(args)-1)
+	}
+	s.store(key, st)
+	return nil
+}
+
+// errCorruptStream is returned by UnmarshalBinary for data that MarshalBinary did not produce.
+var errCorruptStream = errors.New("corrupt stream encoding")
+
+// MarshalBinary encodes the stream, along with its consumer groups.
+func (st *Stream) MarshalBinary() ([]byte, error) {
+	var b []byte
+	appendID := func(id StreamID) {
+		b = binary.AppendUvarint(b, id.Ms)
+		b = binary.AppendUvarint(b, id.Seq)
+	}
+	appendString := func(s string) {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+
+	appendID(st.lastID)
+	b = binary.AppendUvarint(b, uint64(len(st.entries)))
+	for _, entry := range st.entries {
+		appendID(entry.ID)
+		b = binary.AppendUvarint(b, uint64(len(entry.Fields)))
+		for _, field := range entry.Fields {
+			appendString(field)
+		}
+	}
+	names := make([]string, 0, len(st.groups))
+	for name := range st.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b = binary.AppendUvarint(b, uint64(len(names)))
+	for _, name := range names {
+		g := st.groups[name]
+		appendString(name)
+		appendID(g.lastDelivered)
+		b = binary.AppendUvarint(b, uint64(len(g.pending)))
+		for _, id := range sortedPending(g) {
+			p := g.pending[id]
+			appendID(id)
+			appendString(p.consumer)
+			b = binary.AppendVarint(b, p.delivered.UnixMilli())
+			b = binary.AppendUvarint(b, uint64(p.deliveries))
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a stream encoded by MarshalBinary.
+func (st *Stream) UnmarshalBinary(data []byte) error {
+	d := streamDecoder{data: data}
+	decoded := Stream{lastID: d.id()}
+	entries := d.length()
+	for i := 0; i < entries && d.err == nil; i++ {
+		id := d.id()
+		fields := make([]string, d.length())
+		for j := range fields {
+			fields[j] = d.string()
+		}
+		if n := len(decoded.entries); (n > 0 && !decoded.entries[n-1].ID.Less(id)) || decoded.lastID.Less(id) ||
+			len(fields) == 0 || len(fields)%2 != 0 {
+			return errCorruptStream
+		}
+		decoded.add(id, fields)
+	}
+	groups := d.length()
+	for i := 0; i < groups && d.err == nil; i++ {
+		name := d.string()
+		if decoded.groups[name] != nil {
+			return errCorruptStream
+		}
+		decoded.createGroup(name, d.id())
+		g := decoded.groups[name]
+		pending := d.length()
+		for j := 0; j < pending && d.err == nil; j++ {
+			id, consumer := d.id(), d.string()
+			delivered, deliveries := d.varint(), d.uvarint()
+			if deliveries > math.MaxInt32 {
+				return errCorruptStream
+			}
+			decoded.claim(g, id, consumer, time.UnixMilli(delivered), int(deliveries))
+		}
+	}
+	if d.err != nil || d.pos != len(data) {
+		return errCorruptStream
+	}
+	*st = decoded
+	return nil
+}
+
+// streamDecoder reads the values encoded by MarshalBinary, recording the first error.
+type streamDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *streamDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.data[d.pos:])
+	if size <= 0 {
+		d.err = errCorruptStream
+		return 0
+	}
+	d.pos += size
+	return n
+}
+
+func (d *streamDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Varint(d.data[d.pos:])
+	if size <= 0 {
+		d.err = errCorruptStream
+		return 0
+	}
+	d.pos += size
+	return n
+}
+
+func (d *streamDecoder) id() StreamID {
+	return StreamID{Ms: d.uvarint(), Seq: d.uvarint()}
+}
+
+// length reads a number of elements, each taking at least one byte.
+func (d *streamDecoder) length() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)-d.pos) {
+		d.err = errCorruptStream
+		return 0
+	}
+	return int(n)
+}
+
+func (d *streamDecoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.data[d.pos : d.pos+n])
+	d.pos += n
+	return s
+}
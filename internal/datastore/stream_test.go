@@ -0,0 +1,224 @@
+package datastore_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func id(ms, seq uint64) datastore.StreamID { return datastore.StreamID{Ms: ms, Seq: seq} }
+
+func TestDataStore_XAddIDs(t *testing.T) {
+	s := datastore.NewDataStore()
+
+	if added, err := s.XAdd("s", datastore.XAddArgs{ID: id(5, 1), Fields: []string{"f", "v"}}); err != nil || added != id(5, 1) {
+		t.Fatalf("Expected 5-1, got %v, %v", added, err)
+	}
+	if _, err := s.XAdd("s", datastore.XAddArgs{ID: id(5, 1), Fields: []string{"f", "v"}}); err != datastore.ErrStreamIDTooSmall {
+		t.Errorf("Expected ErrStreamIDTooSmall, got %v", err)
+	}
+	if added, _ := s.XAdd("s", datastore.XAddArgs{ID: id(5, 0), AutoSeq: true, Fields: []string{"f", "v"}}); added != id(5, 2) {
+		t.Errorf("Expected the next sequence number, got %v", added)
+	}
+	if added, _ := s.XAdd("s", datastore.XAddArgs{AutoID: true, Fields: []string{"f", "v"}}); added.Ms < uint64(time.Now().Add(-time.Minute).UnixMilli()) {
+		t.Errorf("Expected a time-based ID, got %v", added)
+	}
+	if _, err := s.XAdd("empty", datastore.XAddArgs{Fields: []string{"f", "v"}}); err != datastore.ErrStreamIDZero {
+		t.Errorf("Expected ErrStreamIDZero, got %v", err)
+	}
+	if _, err := s.XAdd("missing", datastore.XAddArgs{AutoID: true, NoMkStream: true, Fields: []string{"f", "v"}}); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound with NoMkStream, got %v", err)
+	}
+
+	s.Set("string", "value")
+	if _, err := s.XAdd("string", datastore.XAddArgs{AutoID: true, Fields: []string{"f", "v"}}); err != datastore.ErrWrongType {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+	if _, err := s.Get("s"); err != datastore.ErrWrongType {
+		t.Errorf("Expected GET of a stream to fail with ErrWrongType, got %v", err)
+	}
+}
+
+func TestDataStore_XRangeAndTrim(t *testing.T) {
+	s := datastore.NewDataStore()
+	for i := uint64(1); i <= 5; i++ {
+		s.XAdd("s", datastore.XAddArgs{ID: id(i, 0), Fields: []string{"n", "v"}})
+	}
+
+	entries, _ := s.XRange("s", id(2, 0), id(4, 0), 0, false)
+	if len(entries) != 3 || entries[0].ID != id(2, 0) || entries[2].ID != id(4, 0) {
+		t.Errorf("Expected entries 2 to 4, got %v", entries)
+	}
+	entries, _ = s.XRange("s", datastore.StreamID{}, datastore.MaxStreamID, 2, true)
+	if len(entries) != 2 || entries[0].ID != id(5, 0) || entries[1].ID != id(4, 0) {
+		t.Errorf("Expected the 2 last entries in reverse, got %v", entries)
+	}
+	if entries, _ = s.XRead("s", id(4, 0), 0); len(entries) != 1 || entries[0].ID != id(5, 0) {
+		t.Errorf("Expected the entries after 4-0, got %v", entries)
+	}
+
+	s.XAdd("s", datastore.XAddArgs{ID: id(6, 0), Fields: []string{"n", "v"}, Trim: datastore.StreamTrim{Strategy: datastore.TrimMaxLen, MaxLen: 4}})
+	if n, _ := s.XLen("s"); n != 4 {
+		t.Errorf("Expected MAXLEN to keep 4 entries, got %d", n)
+	}
+	if removed, _ := s.XTrim("s", datastore.StreamTrim{Strategy: datastore.TrimMinID, MinID: id(5, 0)}); removed != 2 {
+		t.Errorf("Expected MINID to remove 2 entries, got %d", removed)
+	}
+	if removed, _ := s.XTrim("s", datastore.StreamTrim{Strategy: datastore.TrimMaxLen, MaxLen: 0}); removed != 2 {
+		t.Errorf("Expected MAXLEN 0 to remove every entry, got %d", removed)
+	}
+
+	// IDs keep increasing once the stream is empty
+	if _, err := s.XAdd("s", datastore.XAddArgs{ID: id(6, 0), Fields: []string{"n", "v"}}); err != datastore.ErrStreamIDTooSmall {
+		t.Errorf("Expected ErrStreamIDTooSmall, got %v", err)
+	}
+}
+
+func TestDataStore_ConsumerGroups(t *testing.T) {
+	s := datastore.NewDataStore()
+	if err := s.XGroupCreate("s", "g", datastore.StreamID{}, false, false); err != datastore.ErrKeyNotFound {
+		t.Errorf("Expected ErrKeyNotFound without MKSTREAM, got %v", err)
+	}
+	if err := s.XGroupCreate("s", "g", datastore.StreamID{}, false, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := s.XGroupCreate("s", "g", datastore.StreamID{}, false, false); err != datastore.ErrGroupExists {
+		t.Errorf("Expected ErrGroupExists, got %v", err)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		s.XAdd("s", datastore.XAddArgs{ID: id(i, 0), Fields: []string{"n", "v"}})
+	}
+
+	entries, _ := s.XReadGroup("s", "g", "alice", 2, false)
+	if len(entries) != 2 || entries[0].ID != id(1, 0) {
+		t.Fatalf("Expected the 2 first entries, got %v", entries)
+	}
+	if entries, _ = s.XReadGroup("s", "g", "bob", 0, false); len(entries) != 1 || entries[0].ID != id(3, 0) {
+		t.Errorf("Expected bob to get the remaining entry, got %v", entries)
+	}
+	if entries, _ = s.XReadGroup("s", "g", "bob", 0, false); len(entries) != 0 {
+		t.Errorf("Expected no new entry, got %v", entries)
+	}
+	if _, err := s.XReadGroup("s", "missing", "bob", 0, false); err != datastore.ErrNoGroup {
+		t.Errorf("Expected ErrNoGroup, got %v", err)
+	}
+
+	summary, _ := s.XPending("s", "g")
+	if summary.Count != 3 || summary.Lowest != id(1, 0) || summary.Highest != id(3, 0) ||
+		!reflect.DeepEqual(summary.Consumers, map[string]int{"alice": 2, "bob": 1}) {
+		t.Errorf("Expected 3 pending entries, got %+v", summary)
+	}
+	if n, _ := s.XAck("s", "g", []datastore.StreamID{id(1, 0), id(1, 0), id(9, 0)}); n != 1 {
+		t.Errorf("Expected 1 entry acknowledged, got %d", n)
+	}
+	history, _ := s.XReadGroupHistory("s", "g", "alice", datastore.StreamID{}, 0)
+	if len(history) != 1 || history[0].ID != id(2, 0) {
+		t.Errorf("Expected alice's pending entry, got %v", history)
+	}
+
+	// alice's entry is claimed by bob once idle long enough
+	if claimed, _ := s.XClaim("s", "g", "bob", time.Hour, []datastore.StreamID{id(2, 0)}, false); len(claimed) != 0 {
+		t.Errorf("Expected no entry idle for an hour, got %v", claimed)
+	}
+	claimed, _ := s.XClaim("s", "g", "bob", 0, []datastore.StreamID{id(2, 0)}, false)
+	if len(claimed) != 1 {
+		t.Fatalf("Expected the entry to be claimed, got %v", claimed)
+	}
+	pending, _ := s.XPendingRange("s", "g", datastore.StreamID{}, datastore.MaxStreamID, 10, "bob", 0)
+	if len(pending) != 2 || pending[0].ID != id(2, 0) || pending[0].Deliveries != 2 {
+		t.Errorf("Expected bob to hold 2 entries, the claimed one delivered twice, got %+v", pending)
+	}
+
+	// Trimmed pending entries are reported as deleted
+	s.XTrim("s", datastore.StreamTrim{Strategy: datastore.TrimMaxLen, MaxLen: 0})
+	if history, _ = s.XReadGroupHistory("s", "g", "bob", datastore.StreamID{}, 0); len(history) != 2 || history[0].Fields != nil {
+		t.Errorf("Expected trimmed entries without fields, got %v", history)
+	}
+}
+
+func TestDataStore_ApplyReplaysStreams(t *testing.T) {
+	source := datastore.NewDataStore()
+	replica := datastore.NewDataStore()
+	source.AddPropagator(func(args []string) {
+		if err := replica.Apply(args); err != nil {
+			t.Errorf("Expected no error applying %v, got %v", args, err)
+		}
+	})
+
+	source.XGroupCreate("s", "g", datastore.StreamID{}, false, true)
+	for i := uint64(1); i <= 4; i++ {
+		source.XAdd("s", datastore.XAddArgs{AutoID: true, Fields: []string{"n", "v"}, Trim: datastore.StreamTrim{Strategy: datastore.TrimMaxLen, MaxLen: 3}})
+	}
+	read, _ := source.XReadGroup("s", "g", "alice", 2, false)
+	source.XAck("s", "g", []datastore.StreamID{read[0].ID})
+
+	expected, _ := source.XRange("s", datastore.StreamID{}, datastore.MaxStreamID, 0, false)
+	if entries, _ := replica.XRange("s", datastore.StreamID{}, datastore.MaxStreamID, 0, false); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v, got %v", expected, entries)
+	}
+	if pending, _ := replica.XPendingRange("s", "g", datastore.StreamID{}, datastore.MaxStreamID, 10, "", 0); len(pending) != 1 || pending[0].ID != read[1].ID {
+		t.Errorf("Expected the unacknowledged entry to be pending, got %+v", pending)
+	}
+	if entries, _ := replica.XReadGroup("s", "g", "bob", 0, false); len(entries) != 1 {
+		t.Errorf("Expected the last delivered ID to be replayed, got %v", entries)
+	}
+
+	// The commands of an entry recreate the stream on an empty datastore
+	restored := datastore.NewDataStore()
+	for _, entry := range source.Snapshot(nil) {
+		for _, args := range datastore.EntryCommands(entry) {
+			if err := restored.Apply(args); err != nil {
+				t.Fatalf("Expected no error applying %v, got %v", args, err)
+			}
+		}
+	}
+	source.XAdd("s", datastore.XAddArgs{AutoID: true, Fields: []string{"n", "v"}})
+	if entries, _ := restored.XRange("s", datastore.StreamID{}, datastore.MaxStreamID, 0, false); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected %v, got %v", expected, entries)
+	}
+}
+
+func TestStream_MarshalBinary(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.XAdd("s", datastore.XAddArgs{ID: id(1, 1), Fields: []string{"a", "1", "b", "2"}})
+	s.XAdd("s", datastore.XAddArgs{ID: id(2, 0), Fields: []string{"a", "3"}})
+	s.XGroupCreate("s", "g", datastore.StreamID{}, false, false)
+	s.XReadGroup("s", "g", "alice", 1, false)
+
+	stream := s.Snapshot(nil)[0].Value.(*datastore.Stream)
+	data, _ := stream.MarshalBinary()
+	decoded := new(datastore.Stream)
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if n := decoded.Len(); n != 2 || decoded.LastID() != id(2, 0) {
+		t.Errorf("Expected 2 entries up to 2-0, got %d up to %v", n, decoded.LastID())
+	}
+	if encoded, _ := decoded.MarshalBinary(); string(encoded) != string(data) {
+		t.Errorf("Expected the decoded stream to encode the same")
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("Expected an error for truncated data")
+	}
+}
+
+func TestDataStore_WaitForKeys(t *testing.T) {
+	s := datastore.NewDataStore()
+	written, cancel := s.WaitForKeys("a", "b")
+	defer cancel()
+
+	s.Set("c", "1")
+	select {
+	case <-written:
+		t.Fatal("Expected no wake up for another key")
+	default:
+	}
+	s.XAdd("b", datastore.XAddArgs{AutoID: true, Fields: []string{"f", "v"}})
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a write to b to wake up the waiter")
+	}
+}
@@ -0,0 +1,186 @@
+package datastore
+
+// ErrTxnAborted is returned by Txn when a watched key was written since it was watched.
+var ErrTxnAborted = &DataStoreError{Message: "Transaction aborted, a watched key was written"}
+
+// txnState is the state of the transaction running on a handle.
+type txnState struct {
+	// undo holds the entries, as they were when the transaction started, of the keys it wrote,
+	// nil when its writes are never undone
+	undo map[string]undoEntry
+	// commands are the writes of the transaction, propagated once it commits
+	commands [][]string
+}
+
+// undoEntry is a key written by a transaction, as it was when the transaction started.
+type undoEntry struct {
+	Entry
+	existed bool
+}
+
+// lock locks mu for writing, unless the handle is a transaction's, which already holds it.
+func (s *DataStore) lock() {
+	if s.txn == nil {
+		s.mu.Lock()
+	}
+}
+
+func (s *DataStore) unlock() {
+	if s.txn == nil {
+		s.mu.Unlock()
+	}
+}
+
+// rlock locks mu for reading, unless the handle is a transaction's, which already holds it.
+func (s *DataStore) rlock() {
+	if s.txn == nil {
+		s.mu.RLock()
+	}
+}
+
+func (s *DataStore) runlock() {
+	if s.txn == nil {
+		s.mu.RUnlock()
+	}
+}
+
+// writing records that key is about to be written, for its watchers and the running transaction.
+// Caller must hold mu for writing.
+func (s *DataStore) writing(key string) {
+	if _, ok := s.watchers[key]; ok {
+		s.versions[key]++
+	}
+	if s.txn == nil || s.txn.undo == nil {
+		return
+	}
+	if _, ok := s.txn.undo[key]; ok {
+		return
+	}
+	value, existed := s.Data[key]
+	if c, ok := value.(cloner); ok {
+		value = c.Clone()
+	}
+	s.txn.undo[key] = undoEntry{Entry: Entry{Key: key, Value: value, ExpireAt: s.ttlMap[key]}, existed: existed}
+}
+
+// Watch tracks writes to keys, so that a transaction only runs when none of them was written since
+// they were watched, like WATCH.
+type Watch struct {
+	s        *DataStore
+	versions map[string]uint64
+}
+
+// Watch starts watching keys. The watch must be released once done, by Txn or Release.
+func (s *DataStore) Watch(keys ...string) *Watch {
+	w := &Watch{s: s, versions: make(map[string]uint64)}
+	w.Add(keys...)
+	return w
+}
+
+// Add watches keys in addition to the keys already watched.
+func (w *Watch) Add(keys ...string) {
+	w.s.lock()
+	defer w.s.unlock()
+	if w.s.watchers == nil {
+		w.s.watchers = make(map[string]int)
+		w.s.versions = make(map[string]uint64)
+	}
+	for _, key := range keys {
+		if _, ok := w.versions[key]; ok {
+			continue
+		}
+		// A key whose deadline passed is expired now rather than counted as a write later
+		w.s.expireIfNeeded(key)
+		w.s.watchers[key]++
+		w.versions[key] = w.s.versions[key]
+	}
+}
+
+// Release stops watching the keys.
+func (w *Watch) Release() {
+	w.s.lock()
+	defer w.s.unlock()
+	w.release()
+}
+
+// release is Release for callers holding mu for writing.
+func (w *Watch) release() {
+	for key := range w.versions {
+		if w.s.watchers[key]--; w.s.watchers[key] == 0 {
+			delete(w.s.watchers, key)
+			delete(w.s.versions, key)
+		}
+	}
+	w.versions = nil
+}
+
+// written reports whether a watched key was written, expiring the watched keys whose deadline has
+// passed. Caller must hold mu for writing.
+func (w *Watch) written() bool {
+	for key, version := range w.versions {
+		w.s.expireIfNeeded(key)
+		if w.s.versions[key] != version {
+			return true
+		}
+	}
+	return false
+}
+
+// Txn runs fn with tx, a handle on the datastore, while every other caller waits: fn sees no write
+// but its own, and other callers see every write of fn at once. When fn returns an error, its writes
+// are undone and Txn returns the error. When w is not nil, fn only runs if none of the keys watched by
+// w was written since, otherwise Txn returns ErrTxnAborted, and w is released either way.
+//
+// fn must not use tx once it returns, start another transaction, nor call the datastore through
+// another handle, which would wait for the transaction to end.
+func (s *DataStore) Txn(w *Watch, fn func(tx *DataStore) error) error {
+	return s.run(w, make(map[string]undoEntry), fn)
+}
+
+// Exec is Txn for fn that never undo their writes, like EXEC: a failed write does not undo the
+// others. Values are not copied before their first write, as Txn does in case they must be restored.
+func (s *DataStore) Exec(w *Watch, fn func(tx *DataStore)) error {
+	return s.run(w, nil, func(tx *DataStore) error {
+		fn(tx)
+		return nil
+	})
+}
+
+// run implements Txn and Exec, journaling the writes of fn in undo unless it is nil.
+func (s *DataStore) run(w *Watch, undo map[string]undoEntry, fn func(tx *DataStore) error) error {
+	s.lock()
+	defer s.unlock()
+
+	if w != nil {
+		defer w.release()
+		if w.written() {
+			return ErrTxnAborted
+		}
+	}
+	tx := &DataStore{keyspace: s.keyspace, txn: &txnState{undo: undo}}
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	for _, args := range tx.txn.commands {
+		s.propagate(args...)
+	}
+	return nil
+}
+
+// rollback restores the keys written by the transaction of the handle.
+func (s *DataStore) rollback() {
+	for key, entry := range s.txn.undo {
+		if !entry.existed {
+			s.unstore(key)
+			continue
+		}
+		s.store(key, entry.Value)
+		if entry.ExpireAt.IsZero() {
+			s.clearDeadline(key)
+		} else {
+			s.setDeadline(key, entry.ExpireAt)
+		}
+	}
+	s.txn.commands = nil
+}
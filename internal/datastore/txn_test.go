@@ -0,0 +1,152 @@
+package datastore_test
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+func TestDataStore_TxnIsAtomic(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("counter", 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				s.Txn(nil, func(tx *datastore.DataStore) error {
+					value, _ := tx.Get("counter")
+					return tx.Update("counter", value.(int)+1)
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := s.Get("counter"); value != 1000 {
+		t.Errorf("Expected no update to be lost, got %v", value)
+	}
+}
+
+func TestDataStore_TxnRollsBackOnError(t *testing.T) {
+	s := datastore.NewDataStore()
+	var propagated [][]string
+	s.AddPropagator(func(args []string) { propagated = append(propagated, args) })
+	s.SetWithTTL("a", "1", time.Minute)
+	s.Set("b", "2")
+	s.RPush("list", "x")
+	propagated = nil
+
+	failure := errors.New("failure")
+	err := s.Txn(nil, func(tx *datastore.DataStore) error {
+		tx.Update("a", "changed")
+		tx.Persist("a")
+		tx.Delete("b")
+		tx.LPush("list", "y")
+		tx.Set("new", "value")
+		tx.FlushAll()
+		tx.Set("after", "flush")
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("Expected the error of fn, got %v", err)
+	}
+
+	if value, _ := s.Get("a"); value != "1" {
+		t.Errorf("Expected a to be restored, got %v", value)
+	}
+	if ttl, _ := s.TTL("a"); ttl <= 0 {
+		t.Errorf("Expected the deadline of a to be restored, got %v", ttl)
+	}
+	if value, _ := s.Get("b"); value != "2" {
+		t.Errorf("Expected b to be restored, got %v", value)
+	}
+	if values, _ := s.LRange("list", 0, -1); !reflect.DeepEqual(values, []string{"x"}) {
+		t.Errorf("Expected the list to be restored, got %v", values)
+	}
+	for _, key := range []string{"new", "after"} {
+		if _, err := s.Get(key); err != datastore.ErrKeyNotFound {
+			t.Errorf("Expected %s to be removed, got %v", key, err)
+		}
+	}
+	if len(propagated) != 0 {
+		t.Errorf("Expected nothing to be propagated, got %v", propagated)
+	}
+}
+
+func TestDataStore_TxnPropagatesOnCommit(t *testing.T) {
+	source := datastore.NewDataStore()
+	replica := datastore.NewDataStore()
+	source.AddPropagator(func(args []string) {
+		if err := replica.Apply(args); err != nil {
+			t.Errorf("Expected no error applying %v, got %v", args, err)
+		}
+	})
+
+	err := source.Txn(nil, func(tx *datastore.DataStore) error {
+		tx.Set("a", "1")
+		if _, err := replica.Get("a"); err != datastore.ErrKeyNotFound {
+			t.Error("Expected the writes to be propagated once the transaction commits")
+		}
+		tx.IncrBy("a", 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := replica.Get("a"); value != "2" {
+		t.Errorf("Expected the writes to be propagated, got %v", value)
+	}
+}
+
+func TestDataStore_Watch(t *testing.T) {
+	s := datastore.NewDataStore()
+	s.Set("a", "1")
+	run := func(w *datastore.Watch) error {
+		return s.Exec(w, func(tx *datastore.DataStore) {})
+	}
+
+	if err := run(s.Watch("a", "missing")); err != nil {
+		t.Errorf("Expected unwritten keys to let the transaction run, got %v", err)
+	}
+
+	w := s.Watch("a")
+	s.Update("a", "2")
+	if err := run(w); err != datastore.ErrTxnAborted {
+		t.Errorf("Expected an update to abort the transaction, got %v", err)
+	}
+
+	w = s.Watch("missing")
+	s.Set("missing", "now")
+	if err := run(w); err != datastore.ErrTxnAborted {
+		t.Errorf("Expected a new key to abort the transaction, got %v", err)
+	}
+
+	w = s.Watch("a")
+	s.FlushAll()
+	if err := run(w); err != datastore.ErrTxnAborted {
+		t.Errorf("Expected a flush to abort the transaction, got %v", err)
+	}
+
+	s.SetWithTTL("short", "1", 20*time.Millisecond)
+	w = s.Watch("short")
+	time.Sleep(30 * time.Millisecond)
+	if err := run(w); err != datastore.ErrTxnAborted {
+		t.Errorf("Expected an expired key to abort the transaction, got %v", err)
+	}
+
+	// Writes by a transaction abort the transactions watching the same keys
+	s.Set("b", "1")
+	first, second := s.Watch("b"), s.Watch("b")
+	if err := s.Exec(first, func(tx *datastore.DataStore) { tx.Update("b", "2") }); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := run(second); err != datastore.ErrTxnAborted {
+		t.Errorf("Expected the write of the first transaction to abort the second one, got %v", err)
+	}
+}
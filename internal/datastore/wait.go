@@ -0,0 +1,57 @@
+package datastore
+
+// keyWaiter is a caller of WaitForKeys.
+type keyWaiter struct {
+	keys    []string
+	written chan struct{}
+}
+
+// WaitForKeys returns a channel closed by the next write to one of keys, for commands that block until
+// a key is written, such as XREAD BLOCK. Callers get the channel before checking the keys, so that no
+// write can slip between the check and the wait, and call cancel once they stop waiting.
+func (s *DataStore) WaitForKeys(keys ...string) (written <-chan struct{}, cancel func()) {
+	w := &keyWaiter{keys: keys, written: make(chan struct{})}
+	s.waitMu.Lock()
+	defer s.waitMu.Unlock()
+	if s.waiters == nil {
+		s.waiters = make(map[string][]*keyWaiter)
+	}
+	for _, key := range keys {
+		s.waiters[key] = append(s.waiters[key], w)
+	}
+	return w.written, func() {
+		s.waitMu.Lock()
+		defer s.waitMu.Unlock()
+		s.dropWaiter(w)
+	}
+}
+
+// wake wakes up the callers of WaitForKeys waiting for key. Caller must hold mu for writing.
+func (s *DataStore) wake(key string) {
+	s.waitMu.Lock()
+	defer s.waitMu.Unlock()
+	waiters := s.waiters[key]
+	delete(s.waiters, key)
+	for _, w := range waiters {
+		s.dropWaiter(w)
+		close(w.written)
+	}
+}
+
+// dropWaiter stops tracking w. Caller must hold waitMu.
+func (s *DataStore) dropWaiter(w *keyWaiter) {
+	for _, key := range w.keys {
+		waiters := s.waiters[key]
+		for i, other := range waiters {
+			if other == w {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(s.waiters, key)
+		} else {
+			s.waiters[key] = waiters
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package network
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/config"
+)
+
+// Access control follows the design of Redis ACLs. Clients authenticate as a user with AUTH, and start
+// as the default user when it needs no password. A user may run the commands of the categories it is
+// granted, on the keys matching one of its patterns. Passwords are only kept as SHA-256 hashes.
+
+// ACL categories of the commands
+const (
+	categoryRead   = "read"
+	categoryWrite  = "write"
+	categoryAdmin  = "admin"
+	categoryPubSub = "pubsub"
+	// categoryConnection holds the commands every authenticated user may run, such as PING
+	categoryConnection = "connection"
+)
+
+// aclCategories are the categories that can be granted to users.
+var aclCategories = []string{categoryRead, categoryWrite, categoryAdmin, categoryPubSub}
+
+const defaultUser = "default"
+
+const (
+	errNoAuth    = "NOAUTH Authentication required."
+	errWrongPass = "WRONGPASS invalid username-password pair or user is disabled."
+	errNoKeyPerm = "NOPERM No permissions to access a key"
+)
+
+// aclUser holds the permissions of a user. Users are never modified once stored in the acl, but replaced,
+// so that they can be read without holding its lock.
+type aclUser struct {
+	name    string
+	enabled bool
+	// noPass is set for users accepting any password, passwords holds the SHA-256 hashes of the others
+	noPass     bool
+	passwords  map[string]struct{}
+	categories map[string]bool
+	keys       []string
+}
+
+func newACLUser(name string) *aclUser {
+	return &aclUser{name: name, passwords: make(map[string]struct{}), categories: make(map[string]bool)}
+}
+
+func (u *aclUser) clone() *aclUser {
+	c := *u
+	c.passwords = make(map[string]struct{}, len(u.passwords))
+	for hash := range u.passwords {
+		c.passwords[hash] = struct{}{}
+	}
+	c.categories = make(map[string]bool, len(u.categories))
+	for category, ok := range u.categories {
+		c.categories[category] = ok
+	}
+	c.keys = append([]string(nil), u.keys...)
+	return &c
+}
+
+// checkPassword reports whether password is one of the passwords of the user.
+func (u *aclUser) checkPassword(password string) bool {
+	if u.noPass {
+		return true
+	}
+	hash := hashPassword(password)
+	ok := false
+	for h := range u.passwords {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// allowsKey reports whether key matches one of the key patterns of the user.
+func (u *aclUser) allowsKey(key string) bool {
+	for _, pattern := range u.keys {
+		if pattern == "*" || globMatch(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsAllKeys reports whether the user may access every key.
+func (u *aclUser) allowsAllKeys() bool {
+	for _, pattern := range u.keys {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// setRule applies a rule of ACL SETUSER to the user:
+//
+//	on, off             enable or disable the user
+//	nopass, resetpass   accept any password, or none until one is added
+//	>password, <password, #hash, !hash
+//	                    add or remove a password, given in clear or as its SHA-256 hash
+//	~pattern, allkeys, resetkeys
+//	                    allow the keys matching pattern, every key, or none
+//	+@category, -@category, allcommands, nocommands
+//	                    allow or deny the commands of a category, or of every category
+//	reset               remove every password and permission, and disable the user
+func (u *aclUser) setRule(rule string) error {
+	switch lower := strings.ToLower(rule); {
+	case lower == "on":
+		u.enabled = true
+	case lower == "off":
+		u.enabled = false
+	case lower == "nopass":
+		u.noPass = true
+		u.passwords = make(map[string]struct{})
+	case lower == "resetpass":
+		u.noPass = false
+		u.passwords = make(map[string]struct{})
+	case strings.HasPrefix(rule, ">"):
+		u.passwords[hashPassword(rule[1:])] = struct{}{}
+		u.noPass = false
+	case strings.HasPrefix(rule, "<"):
+		delete(u.passwords, hashPassword(rule[1:]))
+	case strings.HasPrefix(rule, "#"):
+		hash := strings.ToLower(rule[1:])
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.passwords[hash] = struct{}{}
+		u.noPass = false
+	case strings.HasPrefix(rule, "!"):
+		delete(u.passwords, strings.ToLower(rule[1:]))
+	case strings.HasPrefix(rule, "~"):
+		u.keys = append(u.keys, rule[1:])
+	case lower == "allkeys":
+		u.keys = []string{"*"}
+	case lower == "resetkeys":
+		u.keys = nil
+	case lower == "allcommands" || lower == "+@all":
+		for _, category := range aclCategories {
+			u.categories[category] = true
+		}
+	case lower == "nocommands" || lower == "-@all":
+		u.categories = make(map[string]bool)
+	case strings.HasPrefix(lower, "+@") || strings.HasPrefix(lower, "-@"):
+		category := lower[2:]
+		if !isACLCategory(category) {
+			return errors.New("Unknown command or category name in ACL")
+		}
+		if lower[0] == '+' {
+			u.categories[category] = true
+		} else {
+			delete(u.categories, category)
+		}
+	case lower == "reset":
+		*u = *newACLUser(u.name)
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+// rules describes the user as ACL SETUSER rules, like ACL LIST.
+func (u *aclUser) rules() string {
+	rules := []string{"user", u.name}
+	if u.enabled {
+		rules = append(rules, "on")
+	} else {
+		rules = append(rules, "off")
+	}
+	if u.noPass {
+		rules = append(rules, "nopass")
+	}
+	hashes := make([]string, 0, len(u.passwords))
+	for hash := range u.passwords {
+		hashes = append(hashes, "#"+hash)
+	}
+	sort.Strings(hashes)
+	rules = append(rules, hashes...)
+	if u.allowsAllKeys() {
+		rules = append(rules, "~*")
+	} else {
+		for _, pattern := range u.keys {
+			rules = append(rules, "~"+pattern)
+		}
+	}
+	all := true
+	for _, category := range aclCategories {
+		all = all && u.categories[category]
+	}
+	if all {
+		rules = append(rules, "+@all")
+	} else {
+		rules = append(rules, "-@all")
+		for _, category := range aclCategories {
+			if u.categories[category] {
+				rules = append(rules, "+@"+category)
+			}
+		}
+	}
+	return strings.Join(rules, " ")
+}
+
+func isACLCategory(name string) bool {
+	for _, category := range aclCategories {
+		if category == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hashPassword returns the SHA-256 hash of password in hexadecimal, the form in which passwords are kept.
+func hashPassword(password string) string {
+	hash := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(hash[:])
+}
+
+// acl holds the users of the server.
+type acl struct {
+	mu    sync.RWMutex
+	users map[string]*aclUser
+}
+
+// newACL returns an acl with only the default user, which has every permission and no password.
+func newACL() *acl {
+	user := newACLUser(defaultUser)
+	for _, rule := range []string{"on", "nopass", "allkeys", "allcommands"} {
+		user.setRule(rule)
+	}
+	return &acl{users: map[string]*aclUser{defaultUser: user}}
+}
+
+// user returns the user named name, nil when there is none.
+func (a *acl) user(name string) *aclUser {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.users[name]
+}
+
+// authenticate returns the user named name when it is enabled and password is one of its passwords.
+func (a *acl) authenticate(name, password string) (*aclUser, bool) {
+	user := a.user(name)
+	if user == nil || !user.enabled || !user.checkPassword(password) {
+		return nil, false
+	}
+	return user, true
+}
+
+// initialUser returns the user new connections are authenticated as, empty when they must authenticate.
+func (a *acl) initialUser() string {
+	if user := a.user(defaultUser); user != nil && user.enabled && user.noPass {
+		return defaultUser
+	}
+	return ""
+}
+
+// setUser applies rules to the user named name, creating it disabled and without permission when it
+// does not exist. The user is left unchanged when a rule is invalid.
+func (a *acl) setUser(name string, rules []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	user := newACLUser(name)
+	if current, ok := a.users[name]; ok {
+		user = current.clone()
+	}
+	for _, rule := range rules {
+		if err := user.setRule(rule); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %v", rule, err)
+		}
+	}
+	a.users[name] = user
+	return nil
+}
+
+// list describes every user, sorted by name, like ACL LIST.
+func (a *acl) list() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	names := make([]string, 0, len(a.users))
+	for name := range a.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]string, len(names))
+	for i, name := range names {
+		list[i] = a.users[name].rules()
+	}
+	return list
+}
+
+// restricted reports whether a client may have less than every permission, which the legacy protocol
+// cannot enforce.
+func (a *acl) restricted() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	user := a.users[defaultUser]
+	if len(a.users) > 1 || user == nil || !user.enabled || !user.noPass || !user.allowsAllKeys() {
+		return true
+	}
+	for _, category := range aclCategories {
+		if !user.categories[category] {
+			return true
+		}
+	}
+	return false
+}
+
+// loadACL replaces the users with those of the acl section of the config file. Without users there,
+// the default user keeps every permission and needs no password. Otherwise the default user is disabled
+// unless it is configured too.
+func loadACL(users []config.ACLUser) (*acl, error) {
+	a := newACL()
+	if len(users) == 0 {
+		return a, nil
+	}
+	a.users = make(map[string]*aclUser, len(users)+1)
+	a.users[defaultUser] = newACLUser(defaultUser)
+	for _, user := range users {
+		if user.Name == "" {
+			return nil, errors.New("acl user without name")
+		}
+		rules := []string{"reset", "on"}
+		if user.NoPass {
+			rules = append(rules, "nopass")
+		}
+		for _, hash := range user.Passwords {
+			rules = append(rules, "#"+hash)
+		}
+		for _, pattern := range user.Keys {
+			rules = append(rules, "~"+pattern)
+		}
+		for _, category := range user.Categories {
+			if strings.EqualFold(category, "all") {
+				rules = append(rules, "allcommands")
+			} else {
+				rules = append(rules, "+@"+category)
+			}
+		}
+		if err := a.setUser(user.Name, rules); err != nil {
+			return nil, fmt.Errorf("acl user %s: %v", user.Name, err)
+		}
+	}
+	return a, nil
+}
+
+// checkPermissions returns the error reply for a command the client may not run, empty when it may.
+func (s *Server) checkPermissions(c *client, cmd *command, args [][]byte) string {
+	if cmd.noAuth {
+		return ""
+	}
+	// The user may have been disabled since the client authenticated
+	user := s.acl.user(c.user)
+	if user == nil || !user.enabled {
+		return errNoAuth
+	}
+	if cmd.category != categoryConnection && !user.categories[cmd.category] {
+		return fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", user.name, cmd.name)
+	}
+	if cmd.keys != nil && !user.allowsAllKeys() {
+		for _, key := range cmd.keys(args) {
+			if !user.allowsKey(string(key)) {
+				return errNoKeyPerm
+			}
+		}
+	}
+	return ""
+}
+
+// visibleKeys returns the keys the client may access, for the commands listing keys.
+func (s *Server) visibleKeys(c *client, keys []string) []string {
+	user := s.acl.user(c.user)
+	if user == nil || user.allowsAllKeys() {
+		return keys
+	}
+	visible := keys[:0:0]
+	for _, key := range keys {
+		if user.allowsKey(key) {
+			visible = append(visible, key)
+		}
+	}
+	return visible
+}
+
+// Key specifications of the commands, which return the keys among their arguments
+func firstKey(args [][]byte) [][]byte     { return args[1:2] }
+func allKeys(args [][]byte) [][]byte      { return args[1:] }
+func twoKeys(args [][]byte) [][]byte      { return args[1:3] }
+func blockingKeys(args [][]byte) [][]byte { return args[1 : len(args)-1] }
+
+// pairKeys returns the keys of commands taking key value [key value ...], such as MSET.
+func pairKeys(args [][]byte) [][]byte {
+	keys := make([][]byte, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// xgroupKeys returns the key of XGROUP subcommand key ...
+func xgroupKeys(args [][]byte) [][]byte {
+	if len(args) > 2 {
+		return args[2:3]
+	}
+	return nil
+}
+
+// streamsKeys returns the key specification of commands ending with STREAMS key [key ...] id [id ...],
+// looking for STREAMS from the argument at from on.
+func streamsKeys(from int) func(args [][]byte) [][]byte {
+	return func(args [][]byte) [][]byte {
+		for i := from; i < len(args); i++ {
+			if strings.EqualFold(string(args[i]), "streams") {
+				streams := args[i+1:]
+				return streams[:len(streams)/2]
+			}
+		}
+		return nil
+	}
+}
+
+// authCommand implements AUTH [username] password, which authenticates the connection as username, or
+// as the default user.
+func (s *Server) authCommand(c *client, args [][]byte) {
+	name, password := defaultUser, string(args[1])
+	switch len(args) {
+	case 2:
+	case 3:
+		name, password = string(args[1]), string(args[2])
+	default:
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	if !s.authenticate(c, name, password) {
+		c.writer.WriteError(errWrongPass)
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// authenticate authenticates the client as the user name and reports whether password was accepted.
+func (s *Server) authenticate(c *client, name, password string) bool {
+	user, ok := s.acl.authenticate(name, password)
+	if !ok {
+		return false
+	}
+	c.user = user.name
+	return true
+}
+
+// disconnectUser closes the connections authenticated as the user name, such as subscribers that run no
+// command to be refused, once it is disabled. The connection of c is closed once the reply is written.
+func (s *Server) disconnectUser(c *client, name string) {
+	for _, other := range s.clients.list() {
+		if other == c {
+			c.closing = c.closing || c.user == name
+		} else if other.snapshot().user == name {
+			other.kill()
+		}
+	}
+}
+
+// allowed reports whether the user of c may run the commands of category.
+func (s *Server) allowed(c *client, category string) bool {
+	user := s.acl.user(c.user)
+	return user != nil && user.enabled && user.categories[category]
+}
+
+// aclCommand implements ACL WHOAMI, available to every user, and ACL LIST and ACL SETUSER username
+// [rule ...], which need the admin category.
+func (s *Server) aclCommand(c *client, args [][]byte) {
+	subcommand := strings.ToLower(string(args[1]))
+	if subcommand == "whoami" && len(args) == 2 {
+		c.writer.WriteBulkString(c.user)
+		return
+	}
+	if !s.allowed(c, categoryAdmin) {
+		c.writer.WriteError(fmt.Sprintf("NOPERM User %s has no permissions to run the 'acl|%s' command", c.user, printable([]byte(subcommand))))
+		return
+	}
+	switch {
+	case subcommand == "list" && len(args) == 2:
+		c.writer.WriteStringArray(s.acl.list())
+	case subcommand == "setuser" && len(args) >= 3:
+		name := string(args[2])
+		if err := s.acl.setUser(name, stringArgs(args[3:])); err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+		if !s.acl.user(name).enabled {
+			s.disconnectUser(c, name)
+		}
+		c.writer.WriteOK()
+	case subcommand == "whoami" || subcommand == "list" || subcommand == "setuser":
+		c.writer.WriteError(fmt.Sprintf("ERR wrong number of arguments for 'acl|%s' command", subcommand))
+	default:
+		c.writer.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'", printable(args[1])))
+	}
+}
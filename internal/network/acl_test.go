@@ -0,0 +1,184 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/config"
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+// newACLServer returns a server with an admin user and a sessions user, restricted to reading and
+// writing session keys, whose passwords are their names.
+func newACLServer(t *testing.T) *Server {
+	t.Helper()
+	server := NewServer(datastore.NewDataStore())
+	users, err := loadACL([]config.ACLUser{
+		{Name: "admin", Passwords: []string{hashPassword("admin")}, Categories: []string{"all"}, Keys: []string{"*"}},
+		{Name: "sessions", Passwords: []string{hashPassword("sessions")}, Categories: []string{"read", "write"}, Keys: []string{"session:*"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected the users to load, got %v", err)
+	}
+	server.acl = users
+	return server
+}
+
+func TestServer_AuthAndPermissions(t *testing.T) {
+	server := newACLServer(t)
+	server.datastore.Set("session:1", "a")
+	server.datastore.Set("secret", "b")
+
+	replies := exchange(t, server,
+		"PING\r\n",
+		"AUTH nobody\r\n",
+		"AUTH sessions wrong\r\n",
+		"AUTH sessions sessions\r\n",
+		"ACL WHOAMI\r\n",
+		"GET session:1\r\n",
+		"GET secret\r\n",
+		"DEL session:1 secret\r\n",
+		"FLUSHALL\r\n",
+		"PUBLISH news hello\r\n",
+		"SCAN 0 COUNT 100\r\n",
+		"KEYS *\r\n",
+		"ACL LIST\r\n",
+		"MULTI\r\n",
+		"SET session:2 c\r\n",
+		"SET secret c\r\n",
+		"EXEC\r\n",
+	)
+	expected := []string{
+		"-NOAUTH Authentication required.\r\n",
+		"-WRONGPASS invalid username-password pair or user is disabled.\r\n",
+		"-WRONGPASS invalid username-password pair or user is disabled.\r\n",
+		"+OK\r\n",
+		"$8\r\nsessions\r\n",
+		"$1\r\na\r\n",
+		"-NOPERM No permissions to access a key\r\n",
+		"-NOPERM No permissions to access a key\r\n",
+		"-NOPERM User sessions has no permissions to run the 'flushall' command\r\n",
+		"-NOPERM User sessions has no permissions to run the 'publish' command\r\n",
+		"*2\r\n$1\r\n0\r\n*1\r\n$9\r\nsession:1\r\n",
+		"*1\r\n$9\r\nsession:1\r\n",
+		"-NOPERM User sessions has no permissions to run the 'acl|list' command\r\n",
+		"+OK\r\n",
+		"+QUEUED\r\n",
+		"-NOPERM No permissions to access a key\r\n",
+		"-EXECABORT Transaction discarded because of previous errors.\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+	if value, _ := server.datastore.Get("secret"); value != "b" {
+		t.Errorf("Expected the secret key to be left alone, got %v", value)
+	}
+}
+
+func TestServer_HelloAuth(t *testing.T) {
+	server := newACLServer(t)
+
+	replies := exchange(t, server,
+		"HELLO 3\r\n",
+		"HELLO 3 AUTH admin wrong\r\n",
+		"HELLO 2 AUTH admin admin\r\n",
+		"ACL WHOAMI\r\n",
+	)
+	if replies[0][:7] != "-NOAUTH" {
+		t.Errorf("Expected HELLO without AUTH to fail, got %q", replies[0])
+	}
+	if replies[1] != "-WRONGPASS invalid username-password pair or user is disabled.\r\n" {
+		t.Errorf("Expected a wrong password to fail, got %q", replies[1])
+	}
+	if replies[2][0] != '*' {
+		t.Errorf("Expected HELLO to reply once authenticated, got %q", replies[2])
+	}
+	if replies[3] != "$5\r\nadmin\r\n" {
+		t.Errorf("Expected admin, got %q", replies[3])
+	}
+}
+
+func TestServer_ACLSetUser(t *testing.T) {
+	server := newACLServer(t)
+
+	replies := exchange(t, server,
+		"AUTH admin admin\r\n",
+		"ACL SETUSER bob on >secret ~bob:* +@read\r\n",
+		"ACL SETUSER bob +@nothing\r\n",
+		"ACL SETUSER bob #abc\r\n",
+	)
+	expected := []string{
+		"+OK\r\n",
+		"+OK\r\n",
+		"-ERR Error in ACL SETUSER modifier '+@nothing': Unknown command or category name in ACL\r\n",
+		"-ERR Error in ACL SETUSER modifier '#abc': The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+	users := server.acl.list()
+	bob := "user bob on #" + hashPassword("secret") + " ~bob:* -@all +@read"
+	if len(users) != 4 || users[1] != bob || users[2] != "user default off -@all" {
+		t.Errorf("Expected bob to be %q, got %q", bob, users)
+	}
+
+	replies = exchange(t, server,
+		"AUTH bob secret\r\n",
+		"GET bob:1\r\n",
+		"SET bob:1 x\r\n",
+		"AUTH default anything\r\n",
+	)
+	expected = []string{
+		"+OK\r\n",
+		"$-1\r\n",
+		"-NOPERM User bob has no permissions to run the 'set' command\r\n",
+		"-WRONGPASS invalid username-password pair or user is disabled.\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_ACLDisabledUser(t *testing.T) {
+	server := newACLServer(t)
+
+	// Disabling a user closes its connections
+	sessions := newSubscriber(t, server)
+	sessions.send(t, "AUTH sessions sessions\r\n")
+	sessions.expect(t, "+OK\r\n")
+	replies := exchange(t, server, "AUTH admin admin\r\n", "ACL SETUSER sessions off\r\n")
+	if replies[1] != "+OK\r\n" {
+		t.Fatalf("Expected the user to be disabled, got %q", replies[1])
+	}
+	expectClosed(t, sessions)
+
+	// Connections authenticated as a disabled user are refused every command
+	server.acl.setUser("sessions", []string{"on"})
+	sessions = newSubscriber(t, server)
+	sessions.send(t, "AUTH sessions sessions\r\n")
+	sessions.expect(t, "+OK\r\n")
+	server.acl.setUser("sessions", []string{"off"})
+	sessions.send(t, "GET session:1\r\n")
+	sessions.expect(t, "-NOAUTH Authentication required.\r\n")
+}
+
+func TestLoadACL(t *testing.T) {
+	if users, err := loadACL(nil); err != nil || users.restricted() || users.initialUser() != defaultUser {
+		t.Errorf("Expected no users to leave every permission to the default user, got %v", err)
+	}
+	users, err := loadACL([]config.ACLUser{{Name: "default", NoPass: true, Categories: []string{"read"}, Keys: []string{"*"}}})
+	if err != nil || !users.restricted() || users.initialUser() != defaultUser {
+		t.Errorf("Expected a restricted default user without password, got %v", err)
+	}
+	if _, err := loadACL([]config.ACLUser{{Name: "bad", Categories: []string{"everything"}}}); err == nil {
+		t.Error("Expected an unknown category to be rejected")
+	}
+	if _, err := loadACL([]config.ACLUser{{Name: "bad", Passwords: []string{"plain"}}}); err == nil {
+		t.Error("Expected a password that is not a hash to be rejected")
+	}
+}
@@ -0,0 +1,117 @@
+package network
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// block calls try, then again after each write to one of keys, until try replies, which it reports by
+// returning true. It gives up once timeout elapsed, zero meaning never, c is killed or disconnects, or the
+// server stops, and returns false: the caller then replies that nothing happened.
+func (s *Server) block(c *client, keys []string, timeout time.Duration, try func() bool) bool {
+	if s.txn {
+		// Commands of a transaction run while the datastore is locked, they cannot wait for writes
+		return try()
+	}
+	written, cancel := s.datastore.WaitForKeys(keys...)
+	if try() {
+		cancel()
+		return true
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	gone, unwatch := c.watchDisconnect()
+	defer unwatch()
+	// The replies of the commands pipelined before this one are not held back while it waits
+	c.writer.Flush()
+
+	for {
+		select {
+		case <-written:
+		case <-expired:
+			cancel()
+			return false
+		case <-c.killed:
+			cancel()
+			return false
+		case <-gone:
+			cancel()
+			return false
+		case <-s.life.stopping:
+			cancel()
+			return false
+		}
+		// A client that left must not take what was written, it would be lost
+		select {
+		case <-gone:
+			cancel()
+			return false
+		default:
+		}
+
+		written, cancel = s.datastore.WaitForKeys(keys...)
+		if try() {
+			cancel()
+			return true
+		}
+	}
+}
+
+// watchDisconnect reads ahead from the connection of c while it waits in a blocking command, and closes
+// gone once the peer disconnected. The bytes read meanwhile stay buffered for the next commands, and
+// unwatch stops reading.
+func (c *client) watchDisconnect() (gone <-chan struct{}, unwatch func()) {
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	// The command was read entirely, the read timeout no longer applies
+	c.conn.SetReadDeadline(time.Time{})
+	go func() {
+		defer close(done)
+		r := c.reader.r
+		for n := r.Buffered() + 1; n <= r.Size(); n = r.Buffered() + 1 {
+			if _, err := r.Peek(n); err != nil {
+				if !isTimeout(err) {
+					close(closed)
+				}
+				return
+			}
+		}
+	}()
+	return closed, func() {
+		// Wake the read up, then let the next command set its own deadline
+		c.conn.SetReadDeadline(time.Now())
+		<-done
+		c.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// parseBlockTimeout parses the milliseconds argument of BLOCK options, zero meaning forever.
+func parseBlockTimeout(arg []byte) (time.Duration, error) {
+	ms, err := parseInteger(arg)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	if ms < 0 {
+		return 0, errNegativeTimeout
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// parseBlockSeconds parses the timeout argument of blocking list commands, in seconds with an optional
+// fractional part, zero meaning forever.
+func parseBlockSeconds(arg []byte) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || seconds > float64(1<<31) {
+		return 0, errTimeoutNotFloat
+	}
+	if seconds < 0 {
+		return 0, errNegativeTimeout
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,237 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+// client holds the state of a connection speaking the RESP protocol.
+type client struct {
+	id     int64
+	conn   net.Conn
+	reader *respReader
+	writer *respWriter
+	// name is set with HELLO ... SETNAME, user is the ACL user the client is authenticated as, empty
+	// until it authenticates
+	name string
+	user string
+	// closing is set by commands, such as QUIT, after which the connection must be closed.
+	closing bool
+	// replicaPort is set by REPLCONF listening-port, replica once the connection is a replica's, after PSYNC
+	replicaPort int
+	replica     *replicaConn
+	// channels and patterns are the subscriptions of the client, push the messages published to it,
+	// created by its first subscription
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	push     *pushQueue
+	// outMu is held while a command runs and its reply is written, so that published messages are
+	// only written between replies
+	outMu sync.Mutex
+	// multi is set between MULTI and EXEC or DISCARD, queued holds the commands to run on EXEC, and
+	// multiFailed is set once one of them was rejected, so that EXEC discards them
+	multi       bool
+	queued      [][][]byte
+	multiFailed bool
+	// watch tracks the keys watched with WATCH, nil when none is
+	watch *datastore.Watch
+	// addr and laddr are the remote and local addresses of the connection, opened at created
+	addr, laddr string
+	created     time.Time
+	// infoMu guards info, which the connection updates around each command for CLIENT LIST
+	infoMu sync.Mutex
+	info   clientInfo
+	// killed is closed by CLIENT KILL, waking the client up when it waits in a blocking command
+	killed   chan struct{}
+	killOnce sync.Once
+}
+
+func newClient(id int64, conn net.Conn) *client {
+	now := time.Now()
+	c := &client{
+		id:       id,
+		conn:     conn,
+		reader:   newRESPReader(conn),
+		writer:   newRESPWriter(conn),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		addr:     conn.RemoteAddr().String(),
+		laddr:    conn.LocalAddr().String(),
+		created:  now,
+		killed:   make(chan struct{}),
+	}
+	c.info = clientInfo{lastActive: now, multi: -1, kind: clientNormal}
+	return c
+}
+
+// subscribed reports whether the client is subscribed to a channel or a pattern.
+func (c *client) subscribed() bool {
+	return len(c.channels)+len(c.patterns) > 0
+}
+
+// flush writes the replies not written yet.
+func (c *client) flush() error {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+	return c.writer.Flush()
+}
+
+// failTransaction records that a command was rejected after MULTI, if any, so that EXEC fails.
+func (c *client) failTransaction() {
+	if c.multi {
+		c.multiFailed = true
+	}
+}
+
+// endTransaction closes the transaction started by MULTI and releases the watched keys.
+func (c *client) endTransaction() {
+	c.multi, c.queued, c.multiFailed = false, nil, false
+	c.unwatch()
+}
+
+// unwatch releases the keys watched with WATCH.
+func (c *client) unwatch() {
+	if c.watch != nil {
+		c.watch.Release()
+		c.watch = nil
+	}
+}
+
+// Types of clients, as filtered by CLIENT LIST TYPE
+const (
+	clientNormal  = "normal"
+	clientReplica = "replica"
+	clientPubSub  = "pubsub"
+)
+
+// clientInfo is the state of a client reported by CLIENT LIST, copied from the client around each of
+// its commands, so that other connections read it without racing with them.
+type clientInfo struct {
+	name        string
+	user        string
+	kind        string
+	lastCommand string
+	lastActive  time.Time
+	// qbuf is the size of the commands received and not run yet, obl that of the last reply
+	qbuf, obl int
+	sub, psub int
+	// multi is the number of commands queued after MULTI, -1 outside of a transaction
+	multi int
+	push  *pushQueue
+}
+
+// startCommand records that the client runs the command name.
+func (c *client) startCommand(name []byte) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	c.info.lastCommand = strings.ToLower(string(name))
+	c.info.lastActive = time.Now()
+	c.info.qbuf = c.reader.r.Buffered()
+}
+
+// endCommand records the state of the client once its command replied, before the reply is flushed.
+func (c *client) endCommand() {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	c.info.name, c.info.user = c.name, c.user
+	c.info.kind = clientNormal
+	if c.replica != nil {
+		c.info.kind = clientReplica
+	} else if c.subscribed() {
+		c.info.kind = clientPubSub
+	}
+	c.info.obl = c.writer.w.Buffered()
+	c.info.sub, c.info.psub = len(c.channels), len(c.patterns)
+	c.info.multi = -1
+	if c.multi {
+		c.info.multi = len(c.queued)
+	}
+	c.info.push = c.push
+}
+
+// snapshot returns the state of the client as of its last command.
+func (c *client) snapshot() clientInfo {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.info
+}
+
+// describe returns the line of the client in CLIENT LIST, at now.
+func (c *client) describe(now time.Time) string {
+	info := c.snapshot()
+	flags := "N"
+	switch info.kind {
+	case clientReplica:
+		flags = "S"
+	case clientPubSub:
+		flags = "P"
+	}
+	if info.multi >= 0 {
+		flags += "x"
+	}
+	omem := 0
+	if info.push != nil {
+		omem = info.push.pending()
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=0 sub=%d psub=%d multi=%d qbuf=%d obl=%d omem=%d cmd=%s user=%s",
+		c.id, c.addr, c.laddr, info.name, int64(now.Sub(c.created).Seconds()), int64(now.Sub(info.lastActive).Seconds()),
+		flags, info.sub, info.psub, info.multi, info.qbuf, info.obl, omem, info.lastCommand, info.user)
+}
+
+// kill closes the connection of the client, and wakes it up when it waits in a blocking command.
+func (c *client) kill() {
+	c.killOnce.Do(func() {
+		close(c.killed)
+		c.conn.Close()
+	})
+}
+
+// isKilled reports whether the client was killed, its connection possibly not closed yet.
+func (c *client) isKilled() bool {
+	select {
+	case <-c.killed:
+		return true
+	default:
+		return false
+	}
+}
+
+// clientRegistry holds the clients connected with the RESP protocol, for the CLIENT command.
+type clientRegistry struct {
+	mu      sync.Mutex
+	clients map[int64]*client
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{clients: make(map[int64]*client)}
+}
+
+func (r *clientRegistry) add(c *client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[c.id] = c
+}
+
+func (r *clientRegistry) remove(c *client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.clients, c.id)
+}
+
+// list returns the connected clients, in the order they connected.
+func (r *clientRegistry) list() []*client {
+	r.mu.Lock()
+	clients := make([]*client, 0, len(r.clients))
+	for _, c := range r.clients {
+		clients = append(clients, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients
+}
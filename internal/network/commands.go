@@ -0,0 +1,361 @@
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+	"github.com/AbdessamadEnabih/Vertex/pkg/persistence"
+)
+
+// command describes a command of the RESP protocol.
+type command struct {
+	name string
+	// arity is the number of arguments, including the command name. A negative arity is a minimum.
+	arity int
+	// write is set for commands that modify the datastore, which replicas reject
+	write bool
+	// pubsub is set for the commands a RESP2 connection may send while subscribed
+	pubsub bool
+	// immediate is set for the commands run at once after MULTI rather than queued, and noMulti for
+	// those that cannot run in a transaction
+	immediate bool
+	noMulti   bool
+	// category is the ACL category of the command, read or write by default, and keys returns the keys
+	// among its arguments, for the key patterns of users. noAuth is set for the commands clients may
+	// send before authenticating.
+	category string
+	keys     func(args [][]byte) [][]byte
+	noAuth   bool
+	handler  func(s *Server, c *client, args [][]byte)
+}
+
+var (
+	errNotInteger = errors.New("value is not an integer or out of range")
+	errNotFloat   = errors.New("value is not a valid float")
+	errSyntax     = errors.New("syntax error")
+
+	errNegativeTimeout   = errors.New("timeout is negative")
+	errTimeoutNotFloat   = errors.New("timeout is not a float or out of range")
+	errNotPositive       = errors.New("value is out of range, must be positive")
+	errInvalidCursor     = errors.New("invalid cursor")
+	errUnbalancedStreams = errors.New("unbalanced list of streams: for each stream key an ID must be specified")
+)
+
+// commandTable maps lower case command names to their description.
+var commandTable map[string]*command
+
+func init() {
+	commands := []*command{
+		// Connection
+		{name: "ping", arity: -1, pubsub: true, category: categoryConnection, handler: (*Server).pingCommand},
+		{name: "echo", arity: 2, category: categoryConnection, handler: (*Server).echoCommand},
+		{name: "hello", arity: -1, noMulti: true, category: categoryConnection, noAuth: true, handler: (*Server).helloCommand},
+		{name: "quit", arity: -1, pubsub: true, immediate: true, category: categoryConnection, noAuth: true, handler: (*Server).quitCommand},
+		{name: "select", arity: 2, category: categoryConnection, handler: (*Server).selectCommand},
+		{name: "command", arity: -1, category: categoryConnection, handler: (*Server).commandCommand},
+		{name: "auth", arity: -2, category: categoryConnection, noAuth: true, handler: (*Server).authCommand},
+		{name: "acl", arity: -2, category: categoryConnection, handler: (*Server).aclCommand},
+		{name: "client", arity: -2, category: categoryConnection, handler: (*Server).clientCommand},
+
+		// Strings
+		{name: "set", arity: -3, write: true, keys: firstKey, handler: (*Server).setCommand},
+		{name: "get", arity: 2, keys: firstKey, handler: (*Server).getCommand},
+		{name: "setnx", arity: 3, write: true, keys: firstKey, handler: (*Server).setnxCommand},
+		{name: "getset", arity: 3, write: true, keys: firstKey, handler: (*Server).getsetCommand},
+		{name: "getdel", arity: 2, write: true, keys: firstKey, handler: (*Server).getdelCommand},
+		{name: "mget", arity: -2, keys: allKeys, handler: (*Server).mgetCommand},
+		{name: "mset", arity: -3, write: true, keys: pairKeys, handler: (*Server).msetCommand},
+		{name: "msetnx", arity: -3, write: true, keys: pairKeys, handler: (*Server).msetCommand},
+		{name: "getver", arity: 2, keys: firstKey, handler: (*Server).getverCommand},
+		{name: "cas", arity: -4, write: true, keys: firstKey, handler: (*Server).casCommand},
+		{name: "update", arity: 3, write: true, keys: firstKey, handler: (*Server).updateCommand},
+		{name: "incr", arity: 2, write: true, keys: firstKey, handler: (*Server).incrCommand},
+		{name: "decr", arity: 2, write: true, keys: firstKey, handler: (*Server).incrCommand},
+		{name: "incrby", arity: 3, write: true, keys: firstKey, handler: (*Server).incrCommand},
+		{name: "decrby", arity: 3, write: true, keys: firstKey, handler: (*Server).incrCommand},
+		{name: "incrbyfloat", arity: 3, write: true, keys: firstKey, handler: (*Server).incrbyfloatCommand},
+
+		// Keyspace
+		{name: "del", arity: -2, write: true, keys: allKeys, handler: (*Server).delCommand},
+		{name: "exists", arity: -2, keys: allKeys, handler: (*Server).existsCommand},
+		{name: "expire", arity: 3, write: true, keys: firstKey, handler: (*Server).expireCommand},
+		{name: "pexpire", arity: 3, write: true, keys: firstKey, handler: (*Server).pexpireCommand},
+		{name: "ttl", arity: 2, keys: firstKey, handler: (*Server).ttlCommand},
+		{name: "pttl", arity: 2, keys: firstKey, handler: (*Server).pttlCommand},
+		{name: "persist", arity: 2, write: true, keys: firstKey, handler: (*Server).persistCommand},
+		{name: "type", arity: 2, keys: firstKey, handler: (*Server).typeCommand},
+		{name: "scan", arity: -2, handler: (*Server).scanCommand},
+		{name: "keys", arity: 2, handler: (*Server).keysCommand},
+		{name: "dbsize", arity: 1, handler: (*Server).dbsizeCommand},
+		{name: "all", arity: 1, handler: (*Server).allCommand},
+		{name: "flushall", arity: -1, write: true, category: categoryAdmin, handler: (*Server).flushallCommand},
+		{name: "flushdb", arity: -1, write: true, category: categoryAdmin, handler: (*Server).flushallCommand},
+
+		// Server
+		{name: "bgrewriteaof", arity: 1, noMulti: true, category: categoryAdmin, handler: (*Server).bgrewriteaofCommand},
+		{name: "save", arity: 1, noMulti: true, category: categoryAdmin, handler: (*Server).saveCommand},
+		{name: "bgsave", arity: -1, noMulti: true, category: categoryAdmin, handler: (*Server).bgsaveCommand},
+		{name: "lastsave", arity: 1, category: categoryAdmin, handler: (*Server).lastsaveCommand},
+		{name: "shutdown", arity: -1, noMulti: true, category: categoryAdmin, handler: (*Server).shutdownCommand},
+		{name: "info", arity: -1, category: categoryAdmin, handler: (*Server).infoCommand},
+
+		// Lists
+		{name: "lpush", arity: -3, write: true, keys: firstKey, handler: (*Server).pushCommand},
+		{name: "rpush", arity: -3, write: true, keys: firstKey, handler: (*Server).pushCommand},
+		{name: "lpop", arity: -2, write: true, keys: firstKey, handler: (*Server).popCommand},
+		{name: "rpop", arity: -2, write: true, keys: firstKey, handler: (*Server).popCommand},
+		{name: "llen", arity: 2, keys: firstKey, handler: (*Server).llenCommand},
+		{name: "lrange", arity: 4, keys: firstKey, handler: (*Server).lrangeCommand},
+		{name: "lindex", arity: 3, keys: firstKey, handler: (*Server).lindexCommand},
+		{name: "lset", arity: 4, write: true, keys: firstKey, handler: (*Server).lsetCommand},
+		{name: "ltrim", arity: 4, write: true, keys: firstKey, handler: (*Server).ltrimCommand},
+		{name: "lmove", arity: 5, write: true, keys: twoKeys, handler: (*Server).lmoveCommand},
+		{name: "blpop", arity: -3, write: true, keys: blockingKeys, handler: (*Server).bpopCommand},
+		{name: "brpop", arity: -3, write: true, keys: blockingKeys, handler: (*Server).bpopCommand},
+		{name: "blmove", arity: 6, write: true, keys: twoKeys, handler: (*Server).blmoveCommand},
+
+		// Hashes
+		{name: "hset", arity: -4, write: true, keys: firstKey, handler: (*Server).hsetCommand},
+		{name: "hget", arity: 3, keys: firstKey, handler: (*Server).hgetCommand},
+		{name: "hmget", arity: -3, keys: firstKey, handler: (*Server).hmgetCommand},
+		{name: "hgetall", arity: 2, keys: firstKey, handler: (*Server).hgetallCommand},
+		{name: "hdel", arity: -3, write: true, keys: firstKey, handler: (*Server).hdelCommand},
+		{name: "hincrby", arity: 4, write: true, keys: firstKey, handler: (*Server).hincrbyCommand},
+		{name: "hexists", arity: 3, keys: firstKey, handler: (*Server).hexistsCommand},
+		{name: "hlen", arity: 2, keys: firstKey, handler: (*Server).hlenCommand},
+		{name: "hscan", arity: -3, keys: firstKey, handler: (*Server).hscanCommand},
+
+		// Sets
+		{name: "sadd", arity: -3, write: true, keys: firstKey, handler: (*Server).saddCommand},
+		{name: "srem", arity: -3, write: true, keys: firstKey, handler: (*Server).sremCommand},
+		{name: "smembers", arity: 2, keys: firstKey, handler: (*Server).smembersCommand},
+		{name: "sismember", arity: 3, keys: firstKey, handler: (*Server).sismemberCommand},
+		{name: "scard", arity: 2, keys: firstKey, handler: (*Server).scardCommand},
+		{name: "sinter", arity: -2, keys: allKeys, handler: (*Server).setOperationCommand},
+		{name: "sunion", arity: -2, keys: allKeys, handler: (*Server).setOperationCommand},
+		{name: "sdiff", arity: -2, keys: allKeys, handler: (*Server).setOperationCommand},
+
+		// Sorted Sets
+		{name: "zadd", arity: -4, write: true, keys: firstKey, handler: (*Server).zaddCommand},
+		{name: "zincrby", arity: 4, write: true, keys: firstKey, handler: (*Server).zincrbyCommand},
+		{name: "zrem", arity: -3, write: true, keys: firstKey, handler: (*Server).zremCommand},
+		{name: "zscore", arity: 3, keys: firstKey, handler: (*Server).zscoreCommand},
+		{name: "zcard", arity: 2, keys: firstKey, handler: (*Server).zcardCommand},
+		{name: "zrank", arity: -3, keys: firstKey, handler: (*Server).zrankCommand},
+		{name: "zrevrank", arity: -3, keys: firstKey, handler: (*Server).zrankCommand},
+		{name: "zrange", arity: -4, keys: firstKey, handler: (*Server).zrangeCommand},
+		{name: "zrevrange", arity: -4, keys: firstKey, handler: (*Server).zrangeCommand},
+		{name: "zrangebyscore", arity: -4, keys: firstKey, handler: (*Server).zrangeCommand},
+		{name: "zrevrangebyscore", arity: -4, keys: firstKey, handler: (*Server).zrangeCommand},
+
+		// Queues
+		{name: "qpush", arity: -3, write: true, keys: firstKey, handler: (*Server).qpushCommand},
+		{name: "qreserve", arity: -2, write: true, keys: firstKey, handler: (*Server).qreserveCommand},
+		{name: "qack", arity: 3, write: true, keys: firstKey, handler: (*Server).qackCommand},
+		{name: "qnack", arity: -3, write: true, keys: firstKey, handler: (*Server).qnackCommand},
+		{name: "qconfig", arity: -2, write: true, keys: firstKey, handler: (*Server).qconfigCommand},
+		{name: "qinfo", arity: 2, keys: firstKey, handler: (*Server).qinfoCommand},
+		{name: "qlist", arity: 1, handler: (*Server).qlistCommand},
+		{name: "qdelete", arity: 2, write: true, keys: firstKey, handler: (*Server).qdeleteCommand},
+
+		// Streams
+		{name: "xadd", arity: -5, write: true, keys: firstKey, handler: (*Server).xaddCommand},
+		{name: "xtrim", arity: -4, write: true, keys: firstKey, handler: (*Server).xtrimCommand},
+		{name: "xlen", arity: 2, keys: firstKey, handler: (*Server).xlenCommand},
+		{name: "xrange", arity: -4, keys: firstKey, handler: (*Server).xrangeCommand},
+		{name: "xrevrange", arity: -4, keys: firstKey, handler: (*Server).xrangeCommand},
+		{name: "xread", arity: -4, keys: streamsKeys(1), handler: (*Server).xreadCommand},
+		{name: "xgroup", arity: -2, write: true, keys: xgroupKeys, handler: (*Server).xgroupCommand},
+		{name: "xreadgroup", arity: -7, write: true, keys: streamsKeys(4), handler: (*Server).xreadgroupCommand},
+		{name: "xack", arity: -4, write: true, keys: firstKey, handler: (*Server).xackCommand},
+		{name: "xpending", arity: -3, keys: firstKey, handler: (*Server).xpendingCommand},
+		{name: "xclaim", arity: -6, write: true, keys: firstKey, handler: (*Server).xclaimCommand},
+
+		// Transactions
+		{name: "multi", arity: 1, immediate: true, category: categoryConnection, handler: (*Server).multiCommand},
+		{name: "exec", arity: 1, immediate: true, category: categoryConnection, handler: (*Server).execCommand},
+		{name: "discard", arity: 1, immediate: true, category: categoryConnection, handler: (*Server).discardCommand},
+		{name: "watch", arity: -2, immediate: true, keys: allKeys, handler: (*Server).watchCommand},
+		{name: "unwatch", arity: 1, immediate: true, category: categoryConnection, handler: (*Server).unwatchCommand},
+
+		// Pub/Sub
+		{name: "subscribe", arity: -2, pubsub: true, noMulti: true, category: categoryPubSub, handler: (*Server).subscribeCommand},
+		{name: "psubscribe", arity: -2, pubsub: true, noMulti: true, category: categoryPubSub, handler: (*Server).subscribeCommand},
+		{name: "unsubscribe", arity: -1, pubsub: true, noMulti: true, category: categoryPubSub, handler: (*Server).unsubscribeCommand},
+		{name: "punsubscribe", arity: -1, pubsub: true, noMulti: true, category: categoryPubSub, handler: (*Server).unsubscribeCommand},
+		{name: "publish", arity: 3, category: categoryPubSub, handler: (*Server).publishCommand},
+
+		// Replication
+		{name: "replicaof", arity: 3, noMulti: true, category: categoryAdmin, handler: (*Server).replicaofCommand},
+		{name: "slaveof", arity: 3, noMulti: true, category: categoryAdmin, handler: (*Server).replicaofCommand},
+		{name: "psync", arity: 3, noMulti: true, category: categoryAdmin, handler: (*Server).psyncCommand},
+		{name: "replconf", arity: -1, noMulti: true, category: categoryAdmin, handler: (*Server).replconfCommand},
+	}
+
+	commandTable = make(map[string]*command, len(commands))
+	for _, cmd := range commands {
+		if cmd.category == "" && cmd.write {
+			cmd.category = categoryWrite
+		} else if cmd.category == "" {
+			cmd.category = categoryRead
+		}
+		commandTable[cmd.name] = cmd
+	}
+}
+
+// dispatch looks up the command named by args[0], checks its arity and runs it.
+func (s *Server) dispatch(c *client, args [][]byte) {
+	cmd, ok := commandTable[strings.ToLower(string(args[0]))]
+	if !ok {
+		c.failTransaction()
+		c.writer.WriteError(fmt.Sprintf("ERR unknown command '%s'", printable(args[0])))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.failTransaction()
+		c.writer.WriteError(wrongArgs(cmd.name))
+		return
+	}
+	if reply := s.checkPermissions(c, cmd, args); reply != "" {
+		c.failTransaction()
+		c.writer.WriteError(reply)
+		return
+	}
+	if !cmd.pubsub && c.writer.proto < 3 && c.subscribed() {
+		c.writer.WriteError(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", cmd.name))
+		return
+	}
+	if cmd.write && s.repl.isReplica() {
+		c.failTransaction()
+		c.writer.WriteError(errReadOnly)
+		return
+	}
+	if cmd.write {
+		if err := s.logFailure(); err != nil {
+			c.failTransaction()
+			c.writer.WriteError(logFailureReply(err))
+			return
+		}
+	}
+	if c.multi && !cmd.immediate {
+		if cmd.noMulti {
+			c.failTransaction()
+			c.writer.WriteError("ERR Command not allowed inside a transaction")
+			return
+		}
+		c.queued = append(c.queued, args)
+		c.writer.WriteSimpleString("QUEUED")
+		return
+	}
+	if cmd.write && s.logsEveryWrite() {
+		s.runLogged(c, cmd, args)
+		return
+	}
+	cmd.handler(s, c, args)
+}
+
+// logFailure returns the error of the last attempt to write the append-only file or the queue log, nil
+// when it succeeded or persistence is disabled.
+func (s *Server) logFailure() error {
+	for _, log := range []*persistence.AOF{s.aof, s.queueLog} {
+		if log == nil {
+			continue
+		}
+		if err := log.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logsEveryWrite reports whether writes are flushed to disk before they are acknowledged.
+func (s *Server) logsEveryWrite() bool {
+	return s.aof != nil && s.aof.Policy() == persistence.FsyncAlways
+}
+
+// runLogged runs the write command cmd when writes are flushed to disk before they are acknowledged:
+// its reply is held back, and replaced by an error when the write could not be logged.
+func (s *Server) runLogged(c *client, cmd *command, args [][]byte) {
+	// The replies of the commands pipelined before this one are not held back with its own
+	out := c.writer
+	out.Flush()
+	var reply bytes.Buffer
+	c.writer = newRESPWriter(&reply)
+	c.writer.proto = out.proto
+	cmd.handler(s, c, args)
+	c.writer.Flush()
+	c.writer = out
+
+	if err := s.logFailure(); err != nil {
+		c.writer.WriteError(logFailureReply(err))
+		return
+	}
+	c.writer.w.Write(reply.Bytes())
+}
+
+// logFailureReply is the error replied to the writes refused because the log could not be written.
+func logFailureReply(err error) string {
+	return "MISCONF Errors writing to the AOF file: " + err.Error()
+}
+
+// commandCommand implements COMMAND, COMMAND COUNT and COMMAND DOCS, which client libraries send on connect.
+func (s *Server) commandCommand(c *client, args [][]byte) {
+	if len(args) == 1 {
+		names := make([]string, 0, len(commandTable))
+		for name := range commandTable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.writer.WriteArrayHeader(len(names))
+		for _, name := range names {
+			c.writer.WriteArrayHeader(2)
+			c.writer.WriteBulkString(name)
+			c.writer.WriteInteger(int64(commandTable[name].arity))
+		}
+		return
+	}
+
+	switch strings.ToLower(string(args[1])) {
+	case "count":
+		c.writer.WriteInteger(int64(len(commandTable)))
+	case "docs":
+		c.writer.WriteMapHeader(0)
+	default:
+		c.writer.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'", printable(args[1])))
+	}
+}
+
+// writeDataStoreError replies with the error returned by the datastore.
+func writeDataStoreError(c *client, err error) {
+	switch err {
+	case datastore.ErrOutOfMemory:
+		c.writer.WriteError("OOM command not allowed when used memory > 'max_size'")
+	case datastore.ErrWrongType:
+		c.writer.WriteError("WRONGTYPE " + err.Error())
+	case datastore.ErrNoGroup:
+		c.writer.WriteError("NOGROUP " + err.Error())
+	case datastore.ErrGroupExists:
+		c.writer.WriteError("BUSYGROUP " + err.Error())
+	default:
+		c.writer.WriteError("ERR " + err.Error())
+	}
+}
+
+// parseInteger parses a command argument holding a 64 bit signed integer.
+func parseInteger(arg []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	return n, nil
+}
+
+// wrongArgs returns the error reply for a command called with the wrong number of arguments.
+func wrongArgs(name string) string {
+	return fmt.Sprintf("ERR wrong number of arguments for '%s' command", name)
+}
@@ -0,0 +1,269 @@
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverVersion is reported by HELLO.
+const serverVersion = "0.1.0"
+
+func (s *Server) pingCommand(c *client, args [][]byte) {
+	if c.writer.proto < 3 && c.subscribed() {
+		// Subscribed RESP2 connections only receive arrays
+		c.writer.WriteArrayHeader(2)
+		c.writer.WriteBulkString("pong")
+		if len(args) > 1 {
+			c.writer.WriteBulk(args[1])
+		} else {
+			c.writer.WriteBulkString("")
+		}
+		return
+	}
+	switch len(args) {
+	case 1:
+		c.writer.WriteSimpleString("PONG")
+	case 2:
+		c.writer.WriteBulk(args[1])
+	default:
+		c.writer.WriteError(wrongArgs("ping"))
+	}
+}
+
+func (s *Server) echoCommand(c *client, args [][]byte) {
+	c.writer.WriteBulk(args[1])
+}
+
+// helloCommand implements HELLO [protover [AUTH username password] [SETNAME clientname]],
+// which switches the connection to RESP2 or RESP3 and describes the server.
+func (s *Server) helloCommand(c *client, args [][]byte) {
+	proto := c.writer.proto
+	if len(args) > 1 {
+		version, err := parseInteger(args[1])
+		if err != nil {
+			c.writer.WriteError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if version != 2 && version != 3 {
+			c.writer.WriteError("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = int(version)
+	}
+
+	name := c.name
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "auth" && i+2 < len(args):
+			if !s.authenticate(c, string(args[i+1]), string(args[i+2])) {
+				c.writer.WriteError(errWrongPass)
+				return
+			}
+			i += 2
+		case option == "setname" && i+1 < len(args):
+			name = string(args[i+1])
+			i++
+		default:
+			c.writer.WriteError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", printable(args[i])))
+			return
+		}
+	}
+
+	if c.user == "" {
+		c.writer.WriteError(errNoAuth + " HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+	c.writer.proto = proto
+	c.name = name
+
+	c.writer.WriteMapHeader(7)
+	c.writer.WriteBulkString("server")
+	c.writer.WriteBulkString("vertex")
+	c.writer.WriteBulkString("version")
+	c.writer.WriteBulkString(serverVersion)
+	c.writer.WriteBulkString("proto")
+	c.writer.WriteInteger(int64(proto))
+	c.writer.WriteBulkString("id")
+	c.writer.WriteInteger(c.id)
+	c.writer.WriteBulkString("mode")
+	c.writer.WriteBulkString("standalone")
+	c.writer.WriteBulkString("role")
+	c.writer.WriteBulkString(s.role())
+	c.writer.WriteBulkString("modules")
+	c.writer.WriteArrayHeader(0)
+}
+
+func (s *Server) quitCommand(c *client, args [][]byte) {
+	c.writer.WriteOK()
+	c.closing = true
+}
+
+// selectCommand accepts SELECT 0 for compatibility with clients that always select a database.
+func (s *Server) selectCommand(c *client, args [][]byte) {
+	index, err := parseInteger(args[1])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	if index != 0 {
+		c.writer.WriteError("ERR DB index is out of range")
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// clientCommand implements CLIENT ID, CLIENT SETNAME name and CLIENT GETNAME, available to every user,
+// and CLIENT LIST and CLIENT KILL, which need the admin category.
+func (s *Server) clientCommand(c *client, args [][]byte) {
+	subcommand := strings.ToLower(string(args[1]))
+	if (subcommand == "list" || subcommand == "kill") && !s.allowed(c, categoryAdmin) {
+		c.writer.WriteError(fmt.Sprintf("NOPERM User %s has no permissions to run the 'client|%s' command", c.user, subcommand))
+		return
+	}
+	switch {
+	case subcommand == "id" && len(args) == 2:
+		c.writer.WriteInteger(c.id)
+	case subcommand == "getname" && len(args) == 2:
+		if c.name == "" {
+			c.writer.WriteNull()
+			return
+		}
+		c.writer.WriteBulkString(c.name)
+	case subcommand == "setname" && len(args) == 3:
+		for _, ch := range args[2] {
+			if ch <= ' ' || ch > '~' {
+				c.writer.WriteError("ERR Client names cannot contain spaces, newlines or special characters.")
+				return
+			}
+		}
+		c.name = string(args[2])
+		c.writer.WriteOK()
+	case subcommand == "list":
+		s.clientListCommand(c, args[2:])
+	case subcommand == "kill" && len(args) >= 3:
+		s.clientKillCommand(c, args[2:])
+	case subcommand == "id" || subcommand == "getname" || subcommand == "setname" || subcommand == "kill":
+		c.writer.WriteError(fmt.Sprintf("ERR wrong number of arguments for 'client|%s' command", subcommand))
+	default:
+		c.writer.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'", printable(args[1])))
+	}
+}
+
+// clientListCommand implements CLIENT LIST [TYPE normal|replica|pubsub] [ID id [id ...]], describing
+// the connected clients one per line.
+func (s *Server) clientListCommand(c *client, options [][]byte) {
+	var kind string
+	var ids map[int64]bool
+	for i := 0; i < len(options); i++ {
+		switch option := strings.ToLower(string(options[i])); {
+		case option == "type" && i+1 < len(options):
+			kind = strings.ToLower(string(options[i+1]))
+			if kind == "master" || kind == "slave" {
+				kind = clientReplica
+			}
+			if kind != clientNormal && kind != clientReplica && kind != clientPubSub {
+				c.writer.WriteError(fmt.Sprintf("ERR Unknown client type '%s'", printable(options[i+1])))
+				return
+			}
+			i++
+		case option == "id" && i+1 < len(options):
+			ids = make(map[int64]bool)
+			for i++; i < len(options); i++ {
+				id, err := parseInteger(options[i])
+				if err != nil || id <= 0 {
+					c.writer.WriteError("ERR Invalid client ID")
+					return
+				}
+				ids[id] = true
+			}
+		default:
+			c.writer.WriteError("ERR " + errSyntax.Error())
+			return
+		}
+	}
+
+	var list strings.Builder
+	now := time.Now()
+	for _, client := range s.clients.list() {
+		if (kind != "" && client.snapshot().kind != kind) || (ids != nil && !ids[client.id]) {
+			continue
+		}
+		list.WriteString(client.describe(now))
+		list.WriteByte('\n')
+	}
+	c.writer.WriteBulkString(list.String())
+}
+
+// clientKillCommand implements CLIENT KILL addr, replying OK, and CLIENT KILL [ID id] [ADDR addr]
+// [LADDR addr] [USER username] [SKIPME yes|no], replying with the number of clients killed. A client
+// killing itself is disconnected once the reply is written.
+func (s *Server) clientKillCommand(c *client, options [][]byte) {
+	matches := func(*client) bool { return true }
+	skipMe := true
+	if len(options) == 1 {
+		addr := string(options[0])
+		matches = func(other *client) bool { return other.addr == addr }
+		skipMe = false
+	} else {
+		if len(options)%2 != 0 {
+			c.writer.WriteError("ERR " + errSyntax.Error())
+			return
+		}
+		for i := 0; i < len(options); i += 2 {
+			value := string(options[i+1])
+			previous := matches
+			switch strings.ToLower(string(options[i])) {
+			case "id":
+				id, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || id <= 0 {
+					c.writer.WriteError("ERR client-id should be greater than 0")
+					return
+				}
+				matches = func(other *client) bool { return previous(other) && other.id == id }
+			case "addr":
+				matches = func(other *client) bool { return previous(other) && other.addr == value }
+			case "laddr":
+				matches = func(other *client) bool { return previous(other) && other.laddr == value }
+			case "user":
+				matches = func(other *client) bool { return previous(other) && other.snapshot().user == value }
+			case "skipme":
+				switch strings.ToLower(value) {
+				case "yes":
+					skipMe = true
+				case "no":
+					skipMe = false
+				default:
+					c.writer.WriteError("ERR " + errSyntax.Error())
+					return
+				}
+			default:
+				c.writer.WriteError("ERR " + errSyntax.Error())
+				return
+			}
+		}
+	}
+
+	killed := 0
+	for _, other := range s.clients.list() {
+		if !matches(other) || (skipMe && other == c) || other.isKilled() {
+			continue
+		}
+		killed++
+		if other == c {
+			c.closing = true
+		} else {
+			other.kill()
+		}
+	}
+	if len(options) == 1 {
+		if killed == 0 {
+			c.writer.WriteError("ERR No such client")
+			return
+		}
+		c.writer.WriteOK()
+		return
+	}
+	c.writer.WriteInteger(int64(killed))
+}
@@ -0,0 +1,123 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_ClientCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"CLIENT GETNAME\r\n",
+		"*3\r\n$6\r\nCLIENT\r\n$7\r\nSETNAME\r\n$8\r\nbad name\r\n",
+		"CLIENT SETNAME worker\r\n",
+		"CLIENT GETNAME\r\n",
+		"CLIENT LIST TYPE pubsub\r\n",
+		"CLIENT LIST TYPE unknown\r\n",
+		"CLIENT KILL 10.0.0.1:6380\r\n",
+		"CLIENT KILL ID 0\r\n",
+		"CLIENT NOPE\r\n",
+	)
+	expected := []string{
+		"$-1\r\n",
+		"-ERR Client names cannot contain spaces, newlines or special characters.\r\n",
+		"+OK\r\n",
+		"$6\r\nworker\r\n",
+		"$0\r\n\r\n",
+		"-ERR Unknown client type 'unknown'\r\n",
+		"-ERR No such client\r\n",
+		"-ERR client-id should be greater than 0\r\n",
+		"-ERR unknown subcommand 'NOPE'\r\n",
+	}
+	for i, reply := range replies {
+		if reply != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], reply)
+		}
+	}
+
+	sub := newSubscriber(t, server)
+	sub.send(t, "CLIENT SETNAME lister\r\n")
+	sub.expect(t, "+OK\r\n")
+	sub.send(t, "CLIENT ID\r\n")
+	id := readReply(t, sub.reader)
+	sub.send(t, "CLIENT LIST ID "+strings.Trim(id, ":\r\n")+"\r\n")
+	list := readReply(t, sub.reader)
+	for _, field := range []string{"id=" + strings.Trim(id, ":\r\n") + " ", " name=lister ", " flags=N ", " cmd=client ", " user=default"} {
+		if !strings.Contains(list, field) {
+			t.Errorf("Expected CLIENT LIST to report %q, got %q", field, list)
+		}
+	}
+}
+
+func TestServer_ClientKill(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	blocked := newSubscriber(t, server)
+	blocked.send(t, "CLIENT ID\r\n")
+	id := strings.Trim(readReply(t, blocked.reader), ":\r\n")
+	blocked.send(t, "BLPOP queue 0\r\n")
+	waitBusy(t, server)
+
+	admin := newSubscriber(t, server)
+	admin.send(t, "CLIENT KILL ID "+id+"\r\n")
+	admin.expect(t, ":1\r\n")
+	// The blocked command gives up, its connection closed without a reply
+	expectClosed(t, blocked)
+
+	admin.send(t, "CLIENT KILL USER default\r\n")
+	admin.expect(t, ":0\r\n")
+	admin.send(t, "CLIENT KILL USER default SKIPME no\r\n")
+	admin.expect(t, ":1\r\n")
+	expectClosed(t, admin)
+}
+
+func TestServer_MaxClients(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+	server.maxClients = 1
+
+	first := newSubscriber(t, server)
+	first.send(t, "PING\r\n")
+	first.expect(t, "+PONG\r\n")
+
+	second := newSubscriber(t, server)
+	second.expect(t, "-ERR max number of clients reached\r\n")
+	expectClosed(t, second)
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+	server.idleTimeout = 50 * time.Millisecond
+
+	idle := newSubscriber(t, server)
+	idle.send(t, "PING\r\n")
+	idle.expect(t, "+PONG\r\n")
+	expectClosed(t, idle)
+
+	// Subscribers wait for messages, they are not idle
+	sub := newSubscriber(t, server)
+	sub.send(t, "SUBSCRIBE news\r\n")
+	sub.expect(t, "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+	time.Sleep(150 * time.Millisecond)
+	sub.send(t, "PING\r\n")
+	sub.expect(t, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+}
+
+func TestServer_ReadTimeout(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+	server.readTimeout = 50 * time.Millisecond
+
+	slow := newSubscriber(t, server)
+	slow.send(t, "*2\r\n$4\r\nECHO\r\n")
+	expectClosed(t, slow)
+
+	// Without a pending command, the read timeout does not apply
+	waiting := newSubscriber(t, server)
+	time.Sleep(150 * time.Millisecond)
+	waiting.send(t, fmt.Sprintf("*2\r\n$4\r\nECHO\r\n$%d\r\n%s\r\n", 2, "hi"))
+	waiting.expect(t, "$2\r\nhi\r\n")
+}
@@ -0,0 +1,200 @@
+package network
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hsetCommand implements HSET key field value [field value ...], replying with the number of fields added.
+func (s *Server) hsetCommand(c *client, args [][]byte) {
+	if len(args)%2 != 0 {
+		c.writer.WriteError(wrongArgs("hset"))
+		return
+	}
+	fieldValues := make([]string, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		fieldValues = append(fieldValues, string(arg))
+	}
+	added, err := s.datastore.HSet(string(args[1]), fieldValues...)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(added))
+}
+
+// hgetCommand implements HGET key field, replying with the value of field or null.
+func (s *Server) hgetCommand(c *client, args [][]byte) {
+	value, ok, err := s.datastore.HGet(string(args[1]), string(args[2]))
+	switch {
+	case err != nil:
+		writeDataStoreError(c, err)
+	case !ok:
+		c.writer.WriteNull()
+	default:
+		c.writer.WriteBulkString(value)
+	}
+}
+
+// hmgetCommand implements HMGET key field [field ...], replying with the values of the fields, null for
+// the missing ones.
+func (s *Server) hmgetCommand(c *client, args [][]byte) {
+	fields := make([]string, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		fields = append(fields, string(arg))
+	}
+	values, err := s.datastore.HMGet(string(args[1]), fields...)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteValue(values)
+}
+
+// hgetallCommand implements HGETALL key, replying with the fields and their values sorted by field,
+// a map in RESP3 and a flat array in RESP2.
+func (s *Server) hgetallCommand(c *client, args [][]byte) {
+	fields, err := s.datastore.HGetAll(string(args[1]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	c.writer.WriteMapHeader(len(names))
+	for _, field := range names {
+		c.writer.WriteBulkString(field)
+		c.writer.WriteBulkString(fields[field])
+	}
+}
+
+// hdelCommand implements HDEL key field [field ...], replying with the number of fields removed.
+func (s *Server) hdelCommand(c *client, args [][]byte) {
+	fields := make([]string, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		fields = append(fields, string(arg))
+	}
+	removed, err := s.datastore.HDel(string(args[1]), fields...)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(removed))
+}
+
+// hincrbyCommand implements HINCRBY key field increment, replying with the new value of field.
+func (s *Server) hincrbyCommand(c *client, args [][]byte) {
+	increment, err := parseInteger(args[3])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	value, err := s.datastore.HIncrBy(string(args[1]), string(args[2]), increment)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(value)
+}
+
+// hexistsCommand implements HEXISTS key field, replying with 1 when field exists and 0 otherwise.
+func (s *Server) hexistsCommand(c *client, args [][]byte) {
+	exists, err := s.datastore.HExists(string(args[1]), string(args[2]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	if exists {
+		c.writer.WriteInteger(1)
+	} else {
+		c.writer.WriteInteger(0)
+	}
+}
+
+// hlenCommand implements HLEN key, replying with the number of fields of the hash.
+func (s *Server) hlenCommand(c *client, args [][]byte) {
+	n, err := s.datastore.HLen(string(args[1]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(n))
+}
+
+// scanOptions are the options of the SCAN family of commands.
+type scanOptions struct {
+	match     string
+	count     int
+	noValues  bool
+	valueType string
+}
+
+// parseScanOptions parses the [MATCH pattern] [COUNT count] options of the SCAN family of commands,
+// along with extra, the NOVALUES option of HSCAN or the TYPE type option of SCAN.
+func parseScanOptions(args [][]byte, extra string) (scanOptions, error) {
+	options := scanOptions{count: 10}
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "match" && i+1 < len(args):
+			options.match = string(args[i+1])
+			i++
+		case option == "count" && i+1 < len(args):
+			n, err := parseInteger(args[i+1])
+			if err != nil {
+				return options, errNotInteger
+			}
+			if n < 1 {
+				return options, errSyntax
+			}
+			options.count = int(n)
+			i++
+		case option == "novalues" && extra == option:
+			options.noValues = true
+		case option == "type" && extra == option && i+1 < len(args):
+			options.valueType = strings.ToLower(string(args[i+1]))
+			i++
+		default:
+			return options, errSyntax
+		}
+	}
+	return options, nil
+}
+
+// hscanCommand implements HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES], replying with the
+// cursor to continue from, zero once the scan is complete, and an array of fields and their values.
+// MATCH filters the fields once read, so a call may reply with fewer fields than COUNT, or none.
+func (s *Server) hscanCommand(c *client, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		c.writer.WriteError("ERR " + errInvalidCursor.Error())
+		return
+	}
+	options, err := parseScanOptions(args[3:], "novalues")
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	next, fieldValues, err := s.datastore.HScan(string(args[1]), cursor, options.count)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+
+	var reply []string
+	for i := 0; i < len(fieldValues); i += 2 {
+		if options.match != "" && !globMatch(options.match, fieldValues[i]) {
+			continue
+		}
+		reply = append(reply, fieldValues[i])
+		if !options.noValues {
+			reply = append(reply, fieldValues[i+1])
+		}
+	}
+	c.writer.WriteArrayHeader(2)
+	c.writer.WriteBulkString(strconv.FormatUint(next, 10))
+	c.writer.WriteStringArray(reply)
+}
@@ -0,0 +1,88 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_HashCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"HSET h b 2 a 1\r\n",
+		"HSET h a 3\r\n",
+		"HGET h a\r\n",
+		"HGET h missing\r\n",
+		"HMGET h a missing b\r\n",
+		"HGETALL h\r\n",
+		"HINCRBY h n 5\r\n",
+		"HINCRBY h a x\r\n",
+		"HSET h text abc\r\n",
+		"HINCRBY h text 1\r\n",
+		"HEXISTS h n\r\n",
+		"HDEL h n text missing\r\n",
+		"HLEN h\r\n",
+		"HSET h odd\r\n",
+		"HGETALL missing\r\n",
+		"SET str value\r\n",
+		"HGET str a\r\n",
+		"GET h\r\n",
+	)
+	expected := []string{
+		":2\r\n",
+		":0\r\n",
+		"$1\r\n3\r\n",
+		"$-1\r\n",
+		"*3\r\n$1\r\n3\r\n$-1\r\n$1\r\n2\r\n",
+		"*4\r\n$1\r\na\r\n$1\r\n3\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		":5\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		":1\r\n",
+		"-ERR hash value is not an integer\r\n",
+		":1\r\n",
+		":2\r\n",
+		":2\r\n",
+		"-ERR wrong number of arguments for 'hset' command\r\n",
+		"*0\r\n",
+		"+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_HScan(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"HSET h user:1 a user:2 b other c\r\n",
+		"HSCAN h 0 MATCH user:* COUNT 100 NOVALUES\r\n",
+		"HSCAN h 0 MATCH other\r\n",
+		"HSCAN h nope\r\n",
+		"HSCAN h 0 COUNT 0\r\n",
+		"HSCAN missing 0\r\n",
+	)
+	matched := map[string]bool{
+		"*2\r\n$1\r\n0\r\n*2\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n": true,
+		"*2\r\n$1\r\n0\r\n*2\r\n$6\r\nuser:2\r\n$6\r\nuser:1\r\n": true,
+	}
+	if !matched[replies[1]] {
+		t.Errorf("Expected the matching fields without values, got %q", replies[1])
+	}
+	expected := []string{
+		"*2\r\n$1\r\n0\r\n*2\r\n$5\r\nother\r\n$1\r\nc\r\n",
+		"-ERR invalid cursor\r\n",
+		"-ERR syntax error\r\n",
+		"*2\r\n$1\r\n0\r\n*0\r\n",
+	}
+	for i := range expected {
+		if replies[i+2] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i+2, expected[i], replies[i+2])
+		}
+	}
+}
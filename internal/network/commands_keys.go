@@ -0,0 +1,169 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+// delCommand implements DEL key [key ...] and replies with the number of deleted keys.
+func (s *Server) delCommand(c *client, args [][]byte) {
+	c.writer.WriteInteger(int64(s.datastore.Del(stringArgs(args[1:])...)))
+}
+
+// existsCommand implements EXISTS key [key ...] and replies with the number of existing keys.
+func (s *Server) existsCommand(c *client, args [][]byte) {
+	c.writer.WriteInteger(int64(s.datastore.Exists(stringArgs(args[1:])...)))
+}
+
+// typeCommand implements TYPE key, replying with the type of the value held by key, or none.
+func (s *Server) typeCommand(c *client, args [][]byte) {
+	c.writer.WriteSimpleString(s.datastore.Type(string(args[1])))
+}
+
+// scanCommand implements SCAN cursor [MATCH pattern] [COUNT count] [TYPE type], replying with the cursor
+// to continue from, zero once the scan is complete, and an array of keys. Every key present from the start
+// of the scan to its end is returned once. MATCH and TYPE filter the keys once read, so a call may reply
+// with fewer keys than COUNT, or none.
+func (s *Server) scanCommand(c *client, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.writer.WriteError("ERR " + errInvalidCursor.Error())
+		return
+	}
+	options, err := parseScanOptions(args[2:], "type")
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	next, keys := s.datastore.Scan(cursor, options.count)
+
+	reply := make([]string, 0, len(keys))
+	for _, key := range s.visibleKeys(c, keys) {
+		if options.match != "" && !globMatch(options.match, key) {
+			continue
+		}
+		if options.valueType != "" && s.datastore.Type(key) != options.valueType {
+			continue
+		}
+		reply = append(reply, key)
+	}
+	c.writer.WriteArrayHeader(2)
+	c.writer.WriteBulkString(strconv.FormatUint(next, 10))
+	c.writer.WriteStringArray(reply)
+}
+
+// keysCommand implements KEYS pattern, replying with every key matching pattern, sorted. It reads the
+// whole keyspace at once, so SCAN is preferable on large datastores.
+func (s *Server) keysCommand(c *client, args [][]byte) {
+	pattern := string(args[1])
+	var reply []string
+	for _, key := range s.visibleKeys(c, s.datastore.Keys()) {
+		if globMatch(pattern, key) {
+			reply = append(reply, key)
+		}
+	}
+	c.writer.WriteStringArray(reply)
+}
+
+// dbsizeCommand implements DBSIZE, replying with the number of keys.
+func (s *Server) dbsizeCommand(c *client, args [][]byte) {
+	c.writer.WriteInteger(int64(s.datastore.DBSize()))
+}
+
+func (s *Server) expireCommand(c *client, args [][]byte) {
+	s.genericExpire(c, args, time.Second)
+}
+
+func (s *Server) pexpireCommand(c *client, args [][]byte) {
+	s.genericExpire(c, args, time.Millisecond)
+}
+
+// genericExpire sets the time to live of a key, given in unit, and replies 1 if the key exists.
+func (s *Server) genericExpire(c *client, args [][]byte, unit time.Duration) {
+	n, err := parseInteger(args[2])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	ttl, err := expireDuration(n, unit, strings.ToLower(string(args[0])))
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	if err := s.datastore.Expire(string(args[1]), ttl); err != nil {
+		c.writer.WriteInteger(0)
+		return
+	}
+	c.writer.WriteInteger(1)
+}
+
+// expireDuration converts n amounts of unit to a duration, failing when it does not fit one rather than
+// wrapping around to a negative time to live that would delete the key.
+func expireDuration(n int64, unit time.Duration, command string) (time.Duration, error) {
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return 0, fmt.Errorf("invalid expire time in '%s' command", command)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func (s *Server) ttlCommand(c *client, args [][]byte) {
+	ttl, err := s.datastore.TTL(string(args[1]))
+	c.writer.WriteInteger(formatTTL(ttl, err, time.Second))
+}
+
+func (s *Server) pttlCommand(c *client, args [][]byte) {
+	ttl, err := s.datastore.TTL(string(args[1]))
+	c.writer.WriteInteger(formatTTL(ttl, err, time.Millisecond))
+}
+
+func (s *Server) persistCommand(c *client, args [][]byte) {
+	if removed, err := s.datastore.Persist(string(args[1])); err != nil || !removed {
+		c.writer.WriteInteger(0)
+		return
+	}
+	c.writer.WriteInteger(1)
+}
+
+// allCommand implements ALL, which replies with a map of every key the client may access and its value.
+func (s *Server) allCommand(c *client, args [][]byte) {
+	values := s.datastore.GetAll()
+	if user := s.acl.user(c.user); user != nil && !user.allowsAllKeys() {
+		for key := range values {
+			if !user.allowsKey(key) {
+				delete(values, key)
+			}
+		}
+	}
+	c.writer.WriteValue(values)
+}
+
+// flushallCommand implements FLUSHALL [ASYNC|SYNC]. Both modes flush synchronously.
+func (s *Server) flushallCommand(c *client, args [][]byte) {
+	if len(args) > 2 || (len(args) == 2 && !strings.EqualFold(string(args[1]), "async") && !strings.EqualFold(string(args[1]), "sync")) {
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	if err := s.datastore.FlushAll(); err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// formatTTL converts the result of DataStore.TTL to the Redis convention:
+// -2 when the key does not exist, -1 when it has no expire, the remaining time in unit otherwise.
+func formatTTL(ttl time.Duration, err error, unit time.Duration) int64 {
+	if err != nil {
+		return -2
+	}
+	if ttl == datastore.NoTTL {
+		return -1
+	}
+	// Round to the nearest unit, like Redis does
+	return int64((ttl + unit/2) / unit)
+}
@@ -0,0 +1,78 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_KeyspaceCommands(t *testing.T) {
+	store := datastore.NewDataStore()
+	server := NewServer(store)
+	store.Set("user:1", "a")
+	store.Set("user:2", "b")
+	store.Set("session:1", "c")
+	store.RPush("queue", "x")
+
+	replies := exchange(t, server,
+		"DBSIZE\r\n",
+		"KEYS user:*\r\n",
+		"KEYS *\r\n",
+		"EXISTS user:1 queue missing\r\n",
+		"TYPE queue\r\n",
+		"TYPE missing\r\n",
+		"SCAN 0 COUNT 100 MATCH user:*\r\n",
+		"SCAN 0 COUNT 100 TYPE list\r\n",
+		"SCAN x\r\n",
+		"SCAN 0 COUNT 0\r\n",
+		"SCAN 0 NOVALUES\r\n",
+	)
+	expected := []string{
+		":4\r\n",
+		"*2\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n",
+		"*4\r\n$5\r\nqueue\r\n$9\r\nsession:1\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n",
+		":2\r\n",
+		"+list\r\n",
+		"+none\r\n",
+		"",
+		"*2\r\n$1\r\n0\r\n*1\r\n$5\r\nqueue\r\n",
+		"-ERR invalid cursor\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR syntax error\r\n",
+	}
+	for i := range expected {
+		if expected[i] != "" && replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+	// The order of SCAN is not specified
+	if replies[6] != "*2\r\n$1\r\n0\r\n*2\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n" && replies[6] != "*2\r\n$1\r\n0\r\n*2\r\n$6\r\nuser:2\r\n$6\r\nuser:1\r\n" {
+		t.Errorf("Expected SCAN to reply with the user keys, got %q", replies[6])
+	}
+}
+
+func TestServer_ExpireOverflow(t *testing.T) {
+	store := datastore.NewDataStore()
+	server := NewServer(store)
+	store.Set("key", "a")
+
+	replies := exchange(t, server,
+		"EXPIRE key 10000000000\r\n",
+		"PEXPIRE key 9223372036854775807\r\n",
+		"SET other b EX 10000000000\r\n",
+		"EXPIRE key 100000\r\n",
+		"EXISTS key other\r\n",
+	)
+	expected := []string{
+		"-ERR invalid expire time in 'expire' command\r\n",
+		"-ERR invalid expire time in 'pexpire' command\r\n",
+		"-ERR invalid expire time in 'set' command\r\n",
+		":1\r\n",
+		":1\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package network
+
+import (
+	"strings"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+// pushCommand implements LPUSH and RPUSH key element [element ...], replying with the length of the list.
+func (s *Server) pushCommand(c *client, args [][]byte) {
+	values := make([]string, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		values = append(values, string(arg))
+	}
+	push := s.datastore.RPush
+	if strings.EqualFold(string(args[0]), "lpush") {
+		push = s.datastore.LPush
+	}
+	n, err := push(string(args[1]), values...)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(n))
+}
+
+// popCommand implements LPOP and RPOP key [count]. Without count it replies with the element popped,
+// or null when the list does not exist; with count it replies with an array of up to count elements.
+func (s *Server) popCommand(c *client, args [][]byte) {
+	if len(args) > 3 {
+		c.writer.WriteError(wrongArgs(strings.ToLower(string(args[0]))))
+		return
+	}
+	count := int64(1)
+	if len(args) == 3 {
+		var err error
+		if count, err = parseInteger(args[2]); err != nil || count < 0 {
+			c.writer.WriteError("ERR " + errNotPositive.Error())
+			return
+		}
+	}
+	pop := s.datastore.RPop
+	if strings.EqualFold(string(args[0]), "lpop") {
+		pop = s.datastore.LPop
+	}
+	values, err := pop(string(args[1]), int(count))
+	switch {
+	case err != nil:
+		writeDataStoreError(c, err)
+	case len(args) == 3 && values == nil:
+		c.writer.WriteNullArray()
+	case len(args) == 3:
+		c.writer.WriteStringArray(values)
+	case len(values) == 0:
+		c.writer.WriteNull()
+	default:
+		c.writer.WriteBulkString(values[0])
+	}
+}
+
+// llenCommand implements LLEN key, replying with the length of the list, zero when it does not exist.
+func (s *Server) llenCommand(c *client, args [][]byte) {
+	n, err := s.datastore.LLen(string(args[1]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(n))
+}
+
+// lrangeCommand implements LRANGE key start stop, replying with the elements between start and stop
+// inclusive, negative indexes counting from the end of the list.
+func (s *Server) lrangeCommand(c *client, args [][]byte) {
+	start, err1 := parseInteger(args[2])
+	stop, err2 := parseInteger(args[3])
+	if err1 != nil || err2 != nil {
+		c.writer.WriteError("ERR " + errNotInteger.Error())
+		return
+	}
+	values, err := s.datastore.LRange(string(args[1]), int(start), int(stop))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteStringArray(values)
+}
+
+// lindexCommand implements LINDEX key index, replying with the element at index, or null when out of range.
+func (s *Server) lindexCommand(c *client, args [][]byte) {
+	index, err := parseInteger(args[2])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	value, ok, err := s.datastore.LIndex(string(args[1]), int(index))
+	switch {
+	case err != nil:
+		writeDataStoreError(c, err)
+	case !ok:
+		c.writer.WriteNull()
+	default:
+		c.writer.WriteBulkString(value)
+	}
+}
+
+// lsetCommand implements LSET key index element.
+func (s *Server) lsetCommand(c *client, args [][]byte) {
+	index, err := parseInteger(args[2])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	if err := s.datastore.LSet(string(args[1]), int(index), string(args[3])); err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// ltrimCommand implements LTRIM key start stop, keeping the elements LRANGE would reply with.
+func (s *Server) ltrimCommand(c *client, args [][]byte) {
+	start, err1 := parseInteger(args[2])
+	stop, err2 := parseInteger(args[3])
+	if err1 != nil || err2 != nil {
+		c.writer.WriteError("ERR " + errNotInteger.Error())
+		return
+	}
+	if err := s.datastore.LTrim(string(args[1]), int(start), int(stop)); err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// parseListSides parses the LEFT|RIGHT LEFT|RIGHT arguments of LMOVE and BLMOVE.
+func parseListSides(args [][]byte) (from, to datastore.ListSide, err error) {
+	from, ok1 := datastore.ParseListSide(string(args[0]))
+	to, ok2 := datastore.ParseListSide(string(args[1]))
+	if !ok1 || !ok2 {
+		return from, to, errSyntax
+	}
+	return from, to, nil
+}
+
+// lmoveCommand implements LMOVE source destination LEFT|RIGHT LEFT|RIGHT, replying with the element
+// moved, or null when source does not exist.
+func (s *Server) lmoveCommand(c *client, args [][]byte) {
+	from, to, err := parseListSides(args[3:5])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	if !s.move(c, string(args[1]), string(args[2]), from, to) {
+		c.writer.WriteNull()
+	}
+}
+
+// move moves an element from src to dst and replies with it. It returns false, without replying,
+// when src does not exist.
+func (s *Server) move(c *client, src, dst string, from, to datastore.ListSide) bool {
+	value, ok, err := s.datastore.LMove(src, dst, from, to)
+	switch {
+	case err != nil:
+		writeDataStoreError(c, err)
+	case !ok:
+		return false
+	default:
+		c.writer.WriteBulkString(value)
+	}
+	return true
+}
+
+// bpopCommand implements BLPOP and BRPOP key [key ...] timeout. It pops an element from the first
+// non-empty list, replying with the key and the element, and waits for an element to be pushed to
+// one of the lists when they are all empty. It replies with null once timeout, in seconds, elapsed.
+func (s *Server) bpopCommand(c *client, args [][]byte) {
+	timeout, err := parseBlockSeconds(args[len(args)-1])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	keys := make([]string, 0, len(args)-2)
+	for _, arg := range args[1 : len(args)-1] {
+		keys = append(keys, string(arg))
+	}
+	pop := s.datastore.RPop
+	if strings.EqualFold(string(args[0]), "blpop") {
+		pop = s.datastore.LPop
+	}
+
+	try := func() bool {
+		for _, key := range keys {
+			values, err := pop(key, 1)
+			if err != nil {
+				writeDataStoreError(c, err)
+				return true
+			}
+			if len(values) > 0 {
+				c.writer.WriteStringArray([]string{key, values[0]})
+				return true
+			}
+		}
+		return false
+	}
+	if !s.block(c, keys, timeout, try) {
+		c.writer.WriteNullArray()
+	}
+}
+
+// blmoveCommand implements BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout, which waits for
+// source to exist before moving an element like LMOVE. It replies with null once timeout, in seconds, elapsed.
+func (s *Server) blmoveCommand(c *client, args [][]byte) {
+	from, to, err := parseListSides(args[3:5])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	timeout, err := parseBlockSeconds(args[5])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	src, dst := string(args[1]), string(args[2])
+
+	try := func() bool { return s.move(c, src, dst, from, to) }
+	if !s.block(c, []string{src}, timeout, try) {
+		c.writer.WriteNull()
+	}
+}
@@ -0,0 +1,142 @@
+package network
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_ListCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"RPUSH l b c d\r\n",
+		"LPUSH l a\r\n",
+		"LRANGE l 0 -1\r\n",
+		"LLEN l\r\n",
+		"LINDEX l -1\r\n",
+		"LINDEX l 10\r\n",
+		"LSET l 0 A\r\n",
+		"LSET l 10 x\r\n",
+		"LPOP l\r\n",
+		"RPOP l 2\r\n",
+		"LPOP missing\r\n",
+		"LPOP missing 2\r\n",
+		"LPOP l -1\r\n",
+		"RPUSH l e f\r\n",
+		"LTRIM l 1 -1\r\n",
+		"LMOVE l other LEFT RIGHT\r\n",
+		"LMOVE missing other LEFT RIGHT\r\n",
+		"LMOVE l other UP RIGHT\r\n",
+		"SET str value\r\n",
+		"LPUSH str a\r\n",
+		"GET l\r\n",
+	)
+	expected := []string{
+		":3\r\n",
+		":4\r\n",
+		"*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n",
+		":4\r\n",
+		"$1\r\nd\r\n",
+		"$-1\r\n",
+		"+OK\r\n",
+		"-ERR index out of range\r\n",
+		"$1\r\nA\r\n",
+		"*2\r\n$1\r\nd\r\n$1\r\nc\r\n",
+		"$-1\r\n",
+		"*-1\r\n",
+		"-ERR value is out of range, must be positive\r\n",
+		":3\r\n",
+		"+OK\r\n",
+		"$1\r\ne\r\n",
+		"$-1\r\n",
+		"-ERR syntax error\r\n",
+		"+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_BlockingPops(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"RPUSH b x\r\n",
+		"BLPOP a b 0\r\n",
+		"BRPOP a 0.02\r\n",
+		"BLMOVE a b LEFT LEFT 0.02\r\n",
+		"BLPOP a -1\r\n",
+		"BLPOP a soon\r\n",
+	)
+	expected := []string{
+		":1\r\n",
+		"*2\r\n$1\r\nb\r\n$1\r\nx\r\n",
+		"*-1\r\n",
+		"$-1\r\n",
+		"-ERR timeout is negative\r\n",
+		"-ERR timeout is not a float or out of range\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+
+	popped := make(chan string)
+	moved := make(chan string)
+	go func() { popped <- exchange(t, server, "BRPOP a b 0\r\n")[0] }()
+	go func() { moved <- exchange(t, server, "BLMOVE src dst RIGHT LEFT 0\r\n")[0] }()
+	time.Sleep(20 * time.Millisecond)
+	exchange(t, server, "LPUSH b y\r\n", "RPUSH src z\r\n")
+
+	for name, result := range map[string]struct {
+		reply    <-chan string
+		expected string
+	}{
+		"BRPOP":  {popped, "*2\r\n$1\r\nb\r\n$1\r\ny\r\n"},
+		"BLMOVE": {moved, "$1\r\nz\r\n"},
+	} {
+		select {
+		case reply := <-result.reply:
+			if reply != result.expected {
+				t.Errorf("Expected %s to reply %q, got %q", name, result.expected, reply)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the push to wake up the blocked %s", name)
+		}
+	}
+	if replies := exchange(t, server, "LRANGE dst 0 -1\r\n"); replies[0] != "*1\r\n$1\r\nz\r\n" {
+		t.Errorf("Expected BLMOVE to push the element, got %q", replies[0])
+	}
+}
+
+func TestServer_BlockingPopDisconnect(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	blocked := newSubscriber(t, server)
+	blocked.send(t, "BLPOP queue 0\r\n")
+	waitBusy(t, server)
+	blocked.conn.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		server.life.mu.Lock()
+		open := len(server.life.conns)
+		server.life.mu.Unlock()
+		if open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the blocked command to give up once its client disconnected")
+		}
+	}
+
+	// The element is not popped for the client that left
+	if replies := exchange(t, server, "RPUSH queue x\r\n", "LLEN queue\r\n"); replies[1] != ":1\r\n" {
+		t.Errorf("Expected the list to keep its element, got %q", replies[1])
+	}
+}
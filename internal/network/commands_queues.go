@@ -0,0 +1,157 @@
+package network
+
+import (
+	"strings"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+)
+
+// qpushCommand implements QPUSH queue message [DELAY milliseconds], replying with the ID of the message.
+func (s *Server) qpushCommand(c *client, args [][]byte) {
+	var delay time.Duration
+	if len(args) > 3 {
+		var ok bool
+		if delay, ok = parseDurationOption(c, args[3:], "delay"); !ok {
+			return
+		}
+	}
+	c.writer.WriteBulkString(s.broker.Enqueue(string(args[1]), string(args[2]), delay))
+}
+
+// qreserveCommand implements QRESERVE queue [TIMEOUT milliseconds], replying with the ID, body, number of
+// deliveries and receipt of the next visible message, or null when there is none. The message stays
+// invisible for the given timeout, or the visibility timeout of the queue.
+func (s *Server) qreserveCommand(c *client, args [][]byte) {
+	var timeout time.Duration
+	if len(args) > 2 {
+		var ok bool
+		if timeout, ok = parseDurationOption(c, args[2:], "timeout"); !ok {
+			return
+		}
+	}
+	msg, ok := s.broker.Reserve(string(args[1]), timeout)
+	if !ok {
+		c.writer.WriteNullArray()
+		return
+	}
+	c.writer.WriteArrayHeader(4)
+	c.writer.WriteBulkString(msg.ID)
+	c.writer.WriteBulkString(msg.Body)
+	c.writer.WriteInteger(int64(msg.Deliveries))
+	c.writer.WriteBulkString(msg.Receipt())
+}
+
+// qackCommand implements QACK queue receipt, replying 1 when the reserved message was removed, 0 otherwise,
+// such as when its reservation expired.
+func (s *Server) qackCommand(c *client, args [][]byte) {
+	if err := s.broker.Ack(string(args[1]), string(args[2])); err != nil {
+		c.writer.WriteInteger(0)
+		return
+	}
+	c.writer.WriteInteger(1)
+}
+
+// qnackCommand implements QNACK queue receipt [DELAY milliseconds], replying 1 when the reserved message was
+// given back to the queue, or moved to the dead-letter queue, and 0 otherwise.
+func (s *Server) qnackCommand(c *client, args [][]byte) {
+	var delay time.Duration
+	if len(args) > 3 {
+		var ok bool
+		if delay, ok = parseDurationOption(c, args[3:], "delay"); !ok {
+			return
+		}
+	}
+	if err := s.broker.Nack(string(args[1]), string(args[2]), delay); err != nil {
+		c.writer.WriteInteger(0)
+		return
+	}
+	c.writer.WriteInteger(1)
+}
+
+// qconfigCommand implements QCONFIG queue [VISIBILITY milliseconds] [MAXDELIVERIES count] [DEADLETTER queue].
+// Options not given are reset to the defaults of the server.
+func (s *Server) qconfigCommand(c *client, args [][]byte) {
+	var options queue.Options
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.writer.WriteError("ERR " + errSyntax.Error())
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "visibility":
+			ms, err := parseInteger(args[i+1])
+			if err != nil || ms <= 0 {
+				c.writer.WriteError("ERR invalid visibility timeout")
+				return
+			}
+			options.VisibilityTimeout = time.Duration(ms) * time.Millisecond
+		case "maxdeliveries":
+			n, err := parseInteger(args[i+1])
+			if err != nil || n < 0 {
+				c.writer.WriteError("ERR invalid max deliveries")
+				return
+			}
+			options.MaxDeliveries = int(n)
+		case "deadletter":
+			options.DeadLetter = string(args[i+1])
+		default:
+			c.writer.WriteError("ERR " + errSyntax.Error())
+			return
+		}
+	}
+	if err := s.broker.Configure(string(args[1]), options); err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// qinfoCommand implements QINFO queue, describing the messages and options of a queue.
+func (s *Server) qinfoCommand(c *client, args [][]byte) {
+	name := string(args[1])
+	stats, options := s.broker.Stats(name), s.broker.Options(name)
+
+	c.writer.WriteMapHeader(6)
+	c.writer.WriteBulkString("ready")
+	c.writer.WriteInteger(int64(stats.Ready))
+	c.writer.WriteBulkString("delayed")
+	c.writer.WriteInteger(int64(stats.Delayed))
+	c.writer.WriteBulkString("reserved")
+	c.writer.WriteInteger(int64(stats.Reserved))
+	c.writer.WriteBulkString("visibility-timeout")
+	c.writer.WriteInteger(options.VisibilityTimeout.Milliseconds())
+	c.writer.WriteBulkString("max-deliveries")
+	c.writer.WriteInteger(int64(options.MaxDeliveries))
+	c.writer.WriteBulkString("dead-letter")
+	c.writer.WriteBulkString(options.DeadLetter)
+}
+
+// qlistCommand implements QLIST, replying with the names of the queues.
+func (s *Server) qlistCommand(c *client, args [][]byte) {
+	c.writer.WriteStringArray(s.broker.Queues())
+}
+
+// qdeleteCommand implements QDELETE queue, removing a queue along with its messages and options.
+func (s *Server) qdeleteCommand(c *client, args [][]byte) {
+	if s.broker.Delete(string(args[1])) {
+		c.writer.WriteInteger(1)
+	} else {
+		c.writer.WriteInteger(0)
+	}
+}
+
+// parseDurationOption parses options, which must be a single "<name> <milliseconds>" pair,
+// and replies with an error when they are invalid.
+func parseDurationOption(c *client, options [][]byte, name string) (time.Duration, bool) {
+	if len(options) != 2 || !strings.EqualFold(string(options[0]), name) {
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return 0, false
+	}
+	ms, err := parseInteger(options[1])
+	if err != nil || ms < 0 {
+		c.writer.WriteError("ERR invalid " + name)
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
@@ -0,0 +1,76 @@
+package network
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_QueueCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"QPUSH jobs first\r\n",
+		"QPUSH jobs later DELAY 3600000\r\n",
+		"QRESERVE jobs\r\n",
+		"QRESERVE jobs\r\n",
+		"QNACK jobs 1-1\r\n",
+		"QRESERVE jobs TIMEOUT 60000\r\n",
+		"QACK jobs 1-1\r\n",
+		"QACK jobs 1-2\r\n",
+		"QACK jobs 1-2\r\n",
+		"QCONFIG jobs MAXDELIVERIES 2 DEADLETTER failed\r\n",
+		"QCONFIG jobs MAXDELIVERIES -1\r\n",
+		"QPUSH jobs x DELAY\r\n",
+		"QLIST\r\n",
+		"QDELETE jobs\r\n",
+		"QLIST\r\n",
+	)
+	expected := []string{
+		"$1\r\n1\r\n",
+		"$1\r\n2\r\n",
+		"*4\r\n$1\r\n1\r\n$5\r\nfirst\r\n:1\r\n$3\r\n1-1\r\n",
+		"*-1\r\n",
+		":1\r\n",
+		"*4\r\n$1\r\n1\r\n$5\r\nfirst\r\n:2\r\n$3\r\n1-2\r\n",
+		":0\r\n",
+		":1\r\n",
+		":0\r\n",
+		"+OK\r\n",
+		"-ERR invalid max deliveries\r\n",
+		"-ERR syntax error\r\n",
+		"*1\r\n$4\r\njobs\r\n",
+		":1\r\n",
+		"*0\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_QInfo(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"QPUSH jobs a\r\n",
+		"QPUSH jobs b\r\n",
+		"QPUSH jobs c DELAY 3600000\r\n",
+		"QRESERVE jobs\r\n",
+		"QINFO jobs\r\n",
+	)
+	info := replies[4]
+	for _, field := range []string{
+		"$5\r\nready\r\n:1\r\n",
+		"$7\r\ndelayed\r\n:1\r\n",
+		"$8\r\nreserved\r\n:1\r\n",
+		"$18\r\nvisibility-timeout\r\n:30000\r\n",
+		"$11\r\ndead-letter\r\n$9\r\njobs:dead\r\n",
+	} {
+		if !strings.Contains(info, field) {
+			t.Errorf("Expected QINFO to contain %q, got %q", field, info)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package network
+
+import (
+	"log"
+	"strings"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/persistence"
+)
+
+// bgrewriteaofCommand implements BGREWRITEAOF, compacting the append-only file in the background.
+func (s *Server) bgrewriteaofCommand(c *client, args [][]byte) {
+	if s.aof == nil {
+		c.writer.WriteError("ERR Append only file is disabled")
+		return
+	}
+	if s.aof.Rewriting() {
+		c.writer.WriteError("ERR " + persistence.ErrRewriteInProgress.Error())
+		return
+	}
+
+	go func() {
+		if err := s.aof.Rewrite(); err != nil {
+			log.Printf("Error rewriting append only file: %v\n", err)
+		}
+	}()
+	c.writer.WriteSimpleString("Background append only file rewriting started")
+}
+
+// saveCommand implements SAVE, writing a snapshot before replying.
+func (s *Server) saveCommand(c *client, args [][]byte) {
+	if s.snapshotter == nil {
+		c.writer.WriteError("ERR " + persistence.ErrPersistenceDisabled.Error())
+		return
+	}
+	if err := s.snapshotter.Save(); err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// bgsaveCommand implements BGSAVE [SCHEDULE]. SCHEDULE is accepted but a running save is still an error.
+func (s *Server) bgsaveCommand(c *client, args [][]byte) {
+	if len(args) > 2 || (len(args) == 2 && !strings.EqualFold(string(args[1]), "schedule")) {
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	if s.snapshotter == nil {
+		c.writer.WriteError("ERR " + persistence.ErrPersistenceDisabled.Error())
+		return
+	}
+	if err := s.snapshotter.BackgroundSave(); err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	c.writer.WriteSimpleString("Background saving started")
+}
+
+// lastsaveCommand implements LASTSAVE, the Unix time of the last successful save.
+func (s *Server) lastsaveCommand(c *client, args [][]byte) {
+	if s.snapshotter == nil {
+		c.writer.WriteError("ERR " + persistence.ErrPersistenceDisabled.Error())
+		return
+	}
+	c.writer.WriteInteger(s.snapshotter.LastSave().Unix())
+}
+
+// infoSections lists the sections of INFO, in the order they are written.
+var infoSections = []struct {
+	name     string
+	describe func(s *Server) string
+}{
+	{"stats", (*Server).statsInfo},
+	{"replication", (*Server).replicationInfo},
+}
+
+// infoCommand implements INFO [section ...], describing the server as "field:value" lines.
+func (s *Server) infoCommand(c *client, args [][]byte) {
+	all := len(args) == 1
+	wanted := make(map[string]bool, len(args)-1)
+	for _, arg := range args[1:] {
+		section := strings.ToLower(string(arg))
+		all = all || section == "all" || section == "default" || section == "everything"
+		wanted[section] = true
+	}
+
+	var info []string
+	for _, section := range infoSections {
+		if all || wanted[section.name] {
+			info = append(info, section.describe(s))
+		}
+	}
+	c.writer.WriteBulkString(strings.Join(info, "\r\n"))
+}
@@ -0,0 +1,40 @@
+package network
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/persistence"
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_RefusesUnloggedWrites(t *testing.T) {
+	// Every write to /dev/full fails
+	aof, err := persistence.OpenAOF("/dev/full", persistence.FsyncAlways)
+	if err != nil {
+		t.Skipf("Expected /dev/full to be available, got %v", err)
+	}
+	server := NewServer(datastore.NewDataStore())
+	aof.Attach(server.datastore)
+	defer aof.Close()
+	server.aof = aof
+
+	replies := exchange(t, server,
+		"PING\r\n",
+		"SET a 1\r\n",
+		"SET b 2\r\n",
+		"GET b\r\n",
+	)
+	if replies[0] != "+PONG\r\n" {
+		t.Errorf("Expected reads to be served, got %q", replies[0])
+	}
+	for _, reply := range replies[1:3] {
+		if !strings.HasPrefix(reply, "-MISCONF Errors writing to the AOF file: ") {
+			t.Errorf("Expected the write not to be acknowledged, got %q", reply)
+		}
+	}
+	// The second write is refused before it runs
+	if replies[3] != "$-1\r\n" {
+		t.Errorf("Expected the refused write not to run, got %q", replies[3])
+	}
+}
@@ -0,0 +1,92 @@
+package network
+
+import "strings"
+
+// saddCommand implements SADD key member [member ...], replying with the number of members added.
+func (s *Server) saddCommand(c *client, args [][]byte) {
+	added, err := s.datastore.SAdd(string(args[1]), stringArgs(args[2:])...)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(added))
+}
+
+// sremCommand implements SREM key member [member ...], replying with the number of members removed.
+func (s *Server) sremCommand(c *client, args [][]byte) {
+	removed, err := s.datastore.SRem(string(args[1]), stringArgs(args[2:])...)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(removed))
+}
+
+// smembersCommand implements SMEMBERS key, replying with the members of the set, sorted.
+func (s *Server) smembersCommand(c *client, args [][]byte) {
+	members, err := s.datastore.SMembers(string(args[1]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	writeSet(c, members)
+}
+
+// sismemberCommand implements SISMEMBER key member, replying with 1 when member is in the set and 0 otherwise.
+func (s *Server) sismemberCommand(c *client, args [][]byte) {
+	ok, err := s.datastore.SIsMember(string(args[1]), string(args[2]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	if ok {
+		c.writer.WriteInteger(1)
+	} else {
+		c.writer.WriteInteger(0)
+	}
+}
+
+// scardCommand implements SCARD key, replying with the number of members of the set.
+func (s *Server) scardCommand(c *client, args [][]byte) {
+	n, err := s.datastore.SCard(string(args[1]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(n))
+}
+
+// setOperationCommand implements SINTER, SUNION and SDIFF key [key ...], replying with the members of
+// the resulting set, sorted. Missing keys are empty sets.
+func (s *Server) setOperationCommand(c *client, args [][]byte) {
+	operation := s.datastore.SInter
+	switch strings.ToLower(string(args[0])) {
+	case "sunion":
+		operation = s.datastore.SUnion
+	case "sdiff":
+		operation = s.datastore.SDiff
+	}
+	members, err := operation(stringArgs(args[1:])...)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	writeSet(c, members)
+}
+
+// writeSet replies with members as a set, a plain array in RESP2.
+func writeSet(c *client, members []string) {
+	c.writer.WriteSetHeader(len(members))
+	for _, member := range members {
+		c.writer.WriteBulkString(member)
+	}
+}
+
+// stringArgs converts command arguments to strings.
+func stringArgs(args [][]byte) []string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = string(arg)
+	}
+	return values
+}
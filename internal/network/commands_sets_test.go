@@ -0,0 +1,52 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_SetCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"SADD s1 b a c a\r\n",
+		"SADD s2 c d\r\n",
+		"SMEMBERS s1\r\n",
+		"SISMEMBER s1 a\r\n",
+		"SISMEMBER s1 d\r\n",
+		"SINTER s1 s2\r\n",
+		"SUNION s1 s2 missing\r\n",
+		"SDIFF s1 s2\r\n",
+		"SREM s1 a b missing\r\n",
+		"SCARD s1\r\n",
+		"SMEMBERS missing\r\n",
+		"SET str value\r\n",
+		"SINTER s1 str\r\n",
+		"HELLO 3\r\n",
+		"SMEMBERS s2\r\n",
+	)
+	expected := []string{
+		":3\r\n",
+		":2\r\n",
+		"*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		":1\r\n",
+		":0\r\n",
+		"*1\r\n$1\r\nc\r\n",
+		"*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n",
+		"*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		":2\r\n",
+		":1\r\n",
+		"*0\r\n",
+		"+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+	if reply := replies[len(replies)-1]; reply != "~2\r\n$1\r\nc\r\n$1\r\nd\r\n" {
+		t.Errorf("Expected a RESP3 set, got %q", reply)
+	}
+}
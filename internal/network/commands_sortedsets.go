@@ -0,0 +1,272 @@
+package network
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+var errBoundNotFloat = errors.New("min or max is not a float")
+
+// parseScore parses a score, accepting -inf and +inf but not NaN.
+func parseScore(arg []byte) (float64, error) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errNotFloat
+	}
+	return score, nil
+}
+
+// parseScoreBound parses the minimum or maximum of a score range, exclusive when prefixed by "(".
+func parseScoreBound(arg []byte) (datastore.ScoreBound, error) {
+	var bound datastore.ScoreBound
+	if len(arg) > 0 && arg[0] == '(' {
+		bound.Exclusive = true
+		arg = arg[1:]
+	}
+	score, err := parseScore(arg)
+	if err != nil {
+		return bound, errBoundNotFloat
+	}
+	bound.Score = score
+	return bound, nil
+}
+
+// zaddCommand implements ZADD key [NX|XX] [GT|LT] [CH] score member [score member ...], replying with
+// the number of members added, or changed with CH.
+func (s *Server) zaddCommand(c *client, args [][]byte) {
+	var flags datastore.ZAddFlags
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			flags.NX = true
+		case "xx":
+			flags.XX = true
+		case "gt":
+			flags.GT = true
+		case "lt":
+			flags.LT = true
+		case "ch":
+			flags.CH = true
+		default:
+			break options
+		}
+	}
+	switch {
+	case flags.NX && flags.XX:
+		c.writer.WriteError("ERR XX and NX options at the same time are not compatible")
+		return
+	case (flags.GT && flags.LT) || (flags.NX && (flags.GT || flags.LT)):
+		c.writer.WriteError("ERR GT, LT, and/or NX options at the same time are not compatible")
+		return
+	case i == len(args) || (len(args)-i)%2 != 0:
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+
+	members := make([]datastore.ZMember, 0, (len(args)-i)/2)
+	for ; i < len(args); i += 2 {
+		score, err := parseScore(args[i])
+		if err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+		members = append(members, datastore.ZMember{Member: string(args[i+1]), Score: score})
+	}
+	n, err := s.datastore.ZAdd(string(args[1]), flags, members...)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(n))
+}
+
+// zincrbyCommand implements ZINCRBY key increment member, replying with the new score of member.
+func (s *Server) zincrbyCommand(c *client, args [][]byte) {
+	increment, err := parseScore(args[2])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	score, err := s.datastore.ZIncrBy(string(args[1]), increment, string(args[3]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteDouble(score)
+}
+
+// zremCommand implements ZREM key member [member ...], replying with the number of members removed.
+func (s *Server) zremCommand(c *client, args [][]byte) {
+	removed, err := s.datastore.ZRem(string(args[1]), stringArgs(args[2:])...)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(removed))
+}
+
+// zscoreCommand implements ZSCORE key member, replying with the score of member or null.
+func (s *Server) zscoreCommand(c *client, args [][]byte) {
+	score, ok, err := s.datastore.ZScore(string(args[1]), string(args[2]))
+	switch {
+	case err != nil:
+		writeDataStoreError(c, err)
+	case !ok:
+		c.writer.WriteNull()
+	default:
+		c.writer.WriteDouble(score)
+	}
+}
+
+// zcardCommand implements ZCARD key, replying with the number of members of the sorted set.
+func (s *Server) zcardCommand(c *client, args [][]byte) {
+	n, err := s.datastore.ZCard(string(args[1]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(n))
+}
+
+// zrankCommand implements ZRANK and ZREVRANK key member [WITHSCORE], replying with the 0-based position
+// of member, from the highest score for ZREVRANK, or null when there is no such member.
+func (s *Server) zrankCommand(c *client, args [][]byte) {
+	withScore := false
+	switch {
+	case len(args) == 4 && strings.EqualFold(string(args[3]), "withscore"):
+		withScore = true
+	case len(args) != 3:
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	key, member := string(args[1]), string(args[2])
+	rank, ok, err := s.datastore.ZRank(key, member, strings.EqualFold(string(args[0]), "zrevrank"))
+	switch {
+	case err != nil:
+		writeDataStoreError(c, err)
+	case !ok && withScore:
+		c.writer.WriteNullArray()
+	case !ok:
+		c.writer.WriteNull()
+	case withScore:
+		score, _, _ := s.datastore.ZScore(key, member)
+		c.writer.WriteArrayHeader(2)
+		c.writer.WriteInteger(int64(rank))
+		c.writer.WriteDouble(score)
+	default:
+		c.writer.WriteInteger(int64(rank))
+	}
+}
+
+// zrangeOptions are the options of the ZRANGE family of commands.
+type zrangeOptions struct {
+	byScore, reverse, withScores, limit bool
+	offset, count                       int
+}
+
+// parseZRangeOptions parses the [BYSCORE] [REV] [LIMIT offset count] [WITHSCORES] options of ZRANGE into
+// options. BYSCORE and REV are rejected when fixed, for the variants whose name already sets them.
+func parseZRangeOptions(args [][]byte, options zrangeOptions, fixed bool) (zrangeOptions, error) {
+	options.count = -1
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "byscore" && !fixed:
+			options.byScore = true
+		case option == "rev" && !fixed:
+			options.reverse = true
+		case option == "withscores":
+			options.withScores = true
+		case option == "limit" && i+2 < len(args):
+			offset, err1 := parseInteger(args[i+1])
+			count, err2 := parseInteger(args[i+2])
+			if err1 != nil || err2 != nil {
+				return options, errNotInteger
+			}
+			options.limit, options.offset, options.count = true, int(offset), int(count)
+			i += 2
+		default:
+			return options, errSyntax
+		}
+	}
+	if options.limit && !options.byScore {
+		return options, errors.New("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	return options, nil
+}
+
+// zrangeCommand implements ZRANGE key start stop [BYSCORE] [REV] [LIMIT offset count] [WITHSCORES], along
+// with ZREVRANGE, ZRANGEBYSCORE key min max and ZREVRANGEBYSCORE key max min. By default start and stop
+// are positions, negative ones counting from the end; with BYSCORE they are scores, exclusive when
+// prefixed by "(". With REV, the range is read from the highest score, and BYSCORE takes max before min.
+func (s *Server) zrangeCommand(c *client, args [][]byte) {
+	var options zrangeOptions
+	name := strings.ToLower(string(args[0]))
+	fixed := name != "zrange"
+	options.byScore = strings.HasSuffix(name, "byscore")
+	options.reverse = strings.HasPrefix(name, "zrev")
+	options, err := parseZRangeOptions(args[4:], options, fixed)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+
+	var members []datastore.ZMember
+	if options.byScore {
+		minArg, maxArg := args[2], args[3]
+		if options.reverse {
+			minArg, maxArg = maxArg, minArg
+		}
+		min, err1 := parseScoreBound(minArg)
+		max, err2 := parseScoreBound(maxArg)
+		if err1 != nil || err2 != nil {
+			c.writer.WriteError("ERR " + errBoundNotFloat.Error())
+			return
+		}
+		if options.offset < 0 {
+			c.writer.WriteArrayHeader(0)
+			return
+		}
+		members, err = s.datastore.ZRangeByScore(string(args[1]), min, max, options.reverse, options.offset, options.count)
+	} else {
+		start, err1 := parseInteger(args[2])
+		stop, err2 := parseInteger(args[3])
+		if err1 != nil || err2 != nil {
+			c.writer.WriteError("ERR " + errNotInteger.Error())
+			return
+		}
+		members, err = s.datastore.ZRange(string(args[1]), int(start), int(stop), options.reverse)
+	}
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	writeZMembers(c, members, options.withScores)
+}
+
+// writeZMembers replies with the members of a sorted set, along with their scores when withScores is set:
+// as [member, score] pairs in RESP3, and a flat array in RESP2.
+func writeZMembers(c *client, members []datastore.ZMember, withScores bool) {
+	switch {
+	case !withScores:
+		c.writer.WriteArrayHeader(len(members))
+	case c.writer.proto >= 3:
+		c.writer.WriteArrayHeader(len(members))
+	default:
+		c.writer.WriteArrayHeader(2 * len(members))
+	}
+	for _, m := range members {
+		if withScores && c.writer.proto >= 3 {
+			c.writer.WriteArrayHeader(2)
+		}
+		c.writer.WriteBulkString(m.Member)
+		if withScores {
+			c.writer.WriteDouble(m.Score)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_SortedSetCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"ZADD z 1 a 2 b 3 c\r\n",
+		"ZADD z NX XX 1 a\r\n",
+		"ZADD z GT LT 1 a\r\n",
+		"ZADD z 1 a 2\r\n",
+		"ZADD z nope a\r\n",
+		"ZADD z GT CH 0 a 5 b\r\n",
+		"ZINCRBY z 1.5 a\r\n",
+		"ZSCORE z a\r\n",
+		"ZSCORE z missing\r\n",
+		"ZRANK z c\r\n",
+		"ZREVRANK z c WITHSCORE\r\n",
+		"ZRANK z missing\r\n",
+		"ZRANGE z 0 -1\r\n",
+		"ZREVRANGE z 0 0 WITHSCORES\r\n",
+		"ZRANGE z (2.5 +inf BYSCORE WITHSCORES\r\n",
+		"ZRANGE z +inf -inf BYSCORE REV LIMIT 1 1\r\n",
+		"ZRANGEBYSCORE z -inf 3\r\n",
+		"ZREVRANGEBYSCORE z 5 (2.5\r\n",
+		"ZRANGE z 0 -1 LIMIT 0 1\r\n",
+		"ZRANGEBYSCORE z x 1\r\n",
+		"ZREM z a missing\r\n",
+		"ZCARD z\r\n",
+		"SET str value\r\n",
+		"ZCARD str\r\n",
+		"HELLO 3\r\n",
+		"ZRANGE z 0 0 WITHSCORES\r\n",
+	)
+	expected := []string{
+		":3\r\n",
+		"-ERR XX and NX options at the same time are not compatible\r\n",
+		"-ERR GT, LT, and/or NX options at the same time are not compatible\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR value is not a valid float\r\n",
+		":1\r\n",
+		"$3\r\n2.5\r\n",
+		"$3\r\n2.5\r\n",
+		"$-1\r\n",
+		":1\r\n",
+		"*2\r\n:1\r\n$1\r\n3\r\n",
+		"$-1\r\n",
+		"*3\r\n$1\r\na\r\n$1\r\nc\r\n$1\r\nb\r\n",
+		"*2\r\n$1\r\nb\r\n$1\r\n5\r\n",
+		"*4\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nb\r\n$1\r\n5\r\n",
+		"*1\r\n$1\r\nc\r\n",
+		"*2\r\n$1\r\na\r\n$1\r\nc\r\n",
+		"*2\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		"-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n",
+		"-ERR min or max is not a float\r\n",
+		":1\r\n",
+		":2\r\n",
+		"+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+	if reply := replies[len(replies)-1]; reply != "*1\r\n*2\r\n$1\r\nc\r\n,3\r\n" {
+		t.Errorf("Expected RESP3 member and score pairs, got %q", reply)
+	}
+}
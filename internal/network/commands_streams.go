@@ -0,0 +1,622 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+// xaddCommand implements XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...],
+// replying with the ID of the new entry, or null when the stream does not exist and NOMKSTREAM is given.
+func (s *Server) xaddCommand(c *client, args [][]byte) {
+	var xargs datastore.XAddArgs
+	i := 2
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nomkstream":
+			xargs.NoMkStream = true
+			continue
+		case "maxlen", "minid":
+			n, err := parseTrim(args[i:], &xargs.Trim)
+			if err != nil {
+				c.writer.WriteError("ERR " + err.Error())
+				return
+			}
+			i += n - 1
+			continue
+		}
+		break
+	}
+	if i >= len(args) || (len(args)-i-1) < 2 || (len(args)-i-1)%2 != 0 {
+		c.writer.WriteError(wrongArgs("xadd"))
+		return
+	}
+
+	id := string(args[i])
+	switch {
+	case id == "*":
+		xargs.AutoID = true
+	case strings.HasSuffix(id, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(id, "-*"), 10, 64)
+		if err != nil {
+			writeDataStoreError(c, datastore.ErrInvalidStreamID)
+			return
+		}
+		xargs.ID.Ms, xargs.AutoSeq = ms, true
+	default:
+		var err error
+		if xargs.ID, err = datastore.ParseStreamID(id, 0); err != nil {
+			writeDataStoreError(c, err)
+			return
+		}
+	}
+	for _, field := range args[i+1:] {
+		xargs.Fields = append(xargs.Fields, string(field))
+	}
+
+	added, err := s.datastore.XAdd(string(args[1]), xargs)
+	if err == datastore.ErrKeyNotFound {
+		c.writer.WriteNull()
+		return
+	}
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteBulkString(added.String())
+}
+
+// parseTrim parses the MAXLEN|MINID [=|~] threshold [LIMIT count] options at the start of args into trim,
+// and returns the number of arguments they take. Approximate trimming is exact, and LIMIT is ignored.
+func parseTrim(args [][]byte, trim *datastore.StreamTrim) (int, error) {
+	n := 1
+	if n < len(args) && (string(args[n]) == "=" || string(args[n]) == "~") {
+		n++
+	}
+	if n >= len(args) {
+		return 0, errSyntax
+	}
+	if strings.EqualFold(string(args[0]), "maxlen") {
+		maxLen, err := parseInteger(args[n])
+		if err != nil || maxLen < 0 {
+			return 0, errors.New("The MAXLEN argument must be >= 0.")
+		}
+		trim.Strategy, trim.MaxLen = datastore.TrimMaxLen, int(maxLen)
+	} else {
+		minID, err := datastore.ParseStreamID(string(args[n]), 0)
+		if err != nil {
+			return 0, err
+		}
+		trim.Strategy, trim.MinID = datastore.TrimMinID, minID
+	}
+	n++
+	if n+1 < len(args) && strings.EqualFold(string(args[n]), "limit") {
+		if _, err := parseInteger(args[n+1]); err != nil {
+			return 0, errNotInteger
+		}
+		n += 2
+	}
+	return n, nil
+}
+
+// xtrimCommand implements XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count], replying with the number
+// of entries removed.
+func (s *Server) xtrimCommand(c *client, args [][]byte) {
+	var trim datastore.StreamTrim
+	lower := strings.ToLower(string(args[2]))
+	if lower != "maxlen" && lower != "minid" {
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	n, err := parseTrim(args[2:], &trim)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	if 2+n != len(args) {
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	removed, err := s.datastore.XTrim(string(args[1]), trim)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(removed))
+}
+
+// xlenCommand implements XLEN key.
+func (s *Server) xlenCommand(c *client, args [][]byte) {
+	n, err := s.datastore.XLen(string(args[1]))
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(n))
+}
+
+// xrangeCommand implements XRANGE key start end [COUNT count] and XREVRANGE key end start [COUNT count].
+// Start and end are inclusive unless prefixed with "(", "-" and "+" being the smallest and greatest IDs.
+func (s *Server) xrangeCommand(c *client, args [][]byte) {
+	reverse := strings.EqualFold(string(args[0]), "xrevrange")
+	startArg, endArg := args[2], args[3]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, err := parseRangeID(startArg, false)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	end, err := parseRangeID(endArg, true)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+
+	count := 0
+	if len(args) > 4 {
+		if len(args) != 6 || !strings.EqualFold(string(args[4]), "count") {
+			c.writer.WriteError("ERR " + errSyntax.Error())
+			return
+		}
+		n, err := parseInteger(args[5])
+		if err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+		if n <= 0 {
+			c.writer.WriteArrayHeader(0)
+			return
+		}
+		count = int(n)
+	}
+
+	entries, err := s.datastore.XRange(string(args[1]), start, end, count, reverse)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	writeStreamEntries(c, entries)
+}
+
+// parseRangeID parses a boundary of XRANGE. A missing sequence number is the smallest one for a start
+// and the greatest one for an end.
+func parseRangeID(arg []byte, end bool) (datastore.StreamID, error) {
+	switch string(arg) {
+	case "-":
+		return datastore.StreamID{}, nil
+	case "+":
+		return datastore.MaxStreamID, nil
+	}
+	exclusive := len(arg) > 0 && arg[0] == '('
+	if exclusive {
+		arg = arg[1:]
+	}
+	defaultSeq := uint64(0)
+	if end {
+		defaultSeq = datastore.MaxStreamID.Seq
+	}
+	id, err := datastore.ParseStreamID(string(arg), defaultSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+
+	switch {
+	case !end && id == datastore.MaxStreamID:
+		return id, errors.New("invalid start ID for the interval")
+	case !end:
+		return id.Next(), nil
+	case id == datastore.StreamID{}:
+		return id, errors.New("invalid end ID for the interval")
+	case id.Seq > 0:
+		return datastore.StreamID{Ms: id.Ms, Seq: id.Seq - 1}, nil
+	}
+	return datastore.StreamID{Ms: id.Ms - 1, Seq: datastore.MaxStreamID.Seq}, nil
+}
+
+// writeStreamEntries writes entries as an array of [id, [field, value, ...]] pairs. Fields are null for
+// pending entries that were trimmed.
+func writeStreamEntries(c *client, entries []datastore.StreamEntry) {
+	c.writer.WriteArrayHeader(len(entries))
+	for _, entry := range entries {
+		c.writer.WriteArrayHeader(2)
+		c.writer.WriteBulkString(entry.ID.String())
+		if entry.Fields == nil {
+			c.writer.WriteNullArray()
+		} else {
+			c.writer.WriteStringArray(entry.Fields)
+		}
+	}
+}
+
+// streamReply holds the entries read from a stream by XREAD and XREADGROUP.
+type streamReply struct {
+	key     string
+	entries []datastore.StreamEntry
+}
+
+// writeStreamReplies writes the entries read from each stream, as a map from keys to entries in RESP3
+// and an array of [key, entries] pairs in RESP2.
+func writeStreamReplies(c *client, replies []streamReply) {
+	if c.writer.proto >= 3 {
+		c.writer.WriteMapHeader(len(replies))
+	} else {
+		c.writer.WriteArrayHeader(len(replies))
+	}
+	for _, reply := range replies {
+		if c.writer.proto < 3 {
+			c.writer.WriteArrayHeader(2)
+		}
+		c.writer.WriteBulkString(reply.key)
+		writeStreamEntries(c, reply.entries)
+	}
+}
+
+// readOptions are the options shared by XREAD and XREADGROUP.
+type readOptions struct {
+	count int
+	// block is set by BLOCK, timeout being zero to block forever
+	block   bool
+	timeout time.Duration
+	noAck   bool
+	keys    []string
+	ids     []string
+}
+
+// parseReadOptions parses [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...],
+// NOACK being only accepted by XREADGROUP.
+func parseReadOptions(args [][]byte, group bool) (readOptions, error) {
+	var options readOptions
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "count" && i+1 < len(args):
+			n, err := parseInteger(args[i+1])
+			if err != nil {
+				return options, err
+			}
+			options.count = int(max(n, 0))
+			i++
+		case option == "block" && i+1 < len(args):
+			timeout, err := parseBlockTimeout(args[i+1])
+			if err != nil {
+				return options, err
+			}
+			options.block, options.timeout = true, timeout
+			i++
+		case option == "noack" && group:
+			options.noAck = true
+		case option == "streams":
+			streams := args[i+1:]
+			if len(streams) == 0 || len(streams)%2 != 0 {
+				return options, errUnbalancedStreams
+			}
+			for j, arg := range streams {
+				if j < len(streams)/2 {
+					options.keys = append(options.keys, string(arg))
+				} else {
+					options.ids = append(options.ids, string(arg))
+				}
+			}
+			return options, nil
+		default:
+			return options, errSyntax
+		}
+	}
+	return options, errSyntax
+}
+
+// xreadCommand implements XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...], replying
+// with the entries added after id to each stream, "$" being the last entry. With BLOCK, it waits for an entry
+// to be added when there is none.
+func (s *Server) xreadCommand(c *client, args [][]byte) {
+	options, err := parseReadOptions(args[1:], false)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	after := make([]datastore.StreamID, len(options.keys))
+	for i, id := range options.ids {
+		if id == "$" {
+			after[i], err = s.datastore.XLastID(options.keys[i])
+		} else {
+			after[i], err = datastore.ParseStreamID(id, 0)
+		}
+		if err != nil {
+			writeDataStoreError(c, err)
+			return
+		}
+	}
+
+	try := func() bool {
+		var replies []streamReply
+		for i, key := range options.keys {
+			entries, err := s.datastore.XRead(key, after[i], options.count)
+			if err != nil {
+				writeDataStoreError(c, err)
+				return true
+			}
+			if len(entries) > 0 {
+				replies = append(replies, streamReply{key: key, entries: entries})
+			}
+		}
+		if len(replies) == 0 {
+			return false
+		}
+		writeStreamReplies(c, replies)
+		return true
+	}
+	if options.block {
+		if !s.block(c, options.keys, options.timeout, try) {
+			c.writer.WriteNullArray()
+		}
+	} else if !try() {
+		c.writer.WriteNullArray()
+	}
+}
+
+// xreadgroupCommand implements XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK]
+// STREAMS key [key ...] id [id ...]. The ID ">" delivers the entries never delivered to the group, which
+// BLOCK waits for when there is none. Other IDs reply with the entries pending for the consumer after them.
+func (s *Server) xreadgroupCommand(c *client, args [][]byte) {
+	if !strings.EqualFold(string(args[1]), "group") {
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	group, consumer := string(args[2]), string(args[3])
+	options, err := parseReadOptions(args[4:], true)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	history := make([]bool, len(options.keys))
+	after := make([]datastore.StreamID, len(options.keys))
+	for i, id := range options.ids {
+		if id == ">" {
+			continue
+		}
+		history[i] = true
+		if after[i], err = datastore.ParseStreamID(id, 0); err != nil {
+			writeDataStoreError(c, err)
+			return
+		}
+		// Pending entries are only read once
+		options.block = false
+	}
+
+	try := func() bool {
+		var replies []streamReply
+		for i, key := range options.keys {
+			var entries []datastore.StreamEntry
+			var err error
+			if history[i] {
+				entries, err = s.datastore.XReadGroupHistory(key, group, consumer, after[i], options.count)
+			} else {
+				entries, err = s.datastore.XReadGroup(key, group, consumer, options.count, options.noAck)
+			}
+			if err != nil {
+				writeDataStoreError(c, err)
+				return true
+			}
+			if len(entries) > 0 || history[i] {
+				replies = append(replies, streamReply{key: key, entries: entries})
+			}
+		}
+		if len(replies) == 0 {
+			return false
+		}
+		writeStreamReplies(c, replies)
+		return true
+	}
+	if options.block {
+		if !s.block(c, options.keys, options.timeout, try) {
+			c.writer.WriteNullArray()
+		}
+	} else if !try() {
+		c.writer.WriteNullArray()
+	}
+}
+
+// xgroupCommand implements XGROUP CREATE key group id|$ [MKSTREAM] and XGROUP DESTROY key group.
+func (s *Server) xgroupCommand(c *client, args [][]byte) {
+	switch subcommand := strings.ToLower(string(args[1])); {
+	case subcommand == "create" && (len(args) == 5 || len(args) == 6):
+		mkStream := len(args) == 6
+		if mkStream && !strings.EqualFold(string(args[5]), "mkstream") {
+			c.writer.WriteError("ERR " + errSyntax.Error())
+			return
+		}
+		var id datastore.StreamID
+		last := string(args[4]) == "$"
+		if !last {
+			var err error
+			if id, err = datastore.ParseStreamID(string(args[4]), 0); err != nil {
+				writeDataStoreError(c, err)
+				return
+			}
+		}
+		if err := s.datastore.XGroupCreate(string(args[2]), string(args[3]), id, last, mkStream); err != nil {
+			if err == datastore.ErrKeyNotFound {
+				c.writer.WriteError("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+				return
+			}
+			writeDataStoreError(c, err)
+			return
+		}
+		c.writer.WriteOK()
+	case subcommand == "destroy" && len(args) == 4:
+		destroyed, err := s.datastore.XGroupDestroy(string(args[2]), string(args[3]))
+		if err != nil {
+			writeDataStoreError(c, err)
+			return
+		}
+		if destroyed {
+			c.writer.WriteInteger(1)
+		} else {
+			c.writer.WriteInteger(0)
+		}
+	case subcommand == "create" || subcommand == "destroy":
+		c.writer.WriteError(wrongArgs("xgroup|" + subcommand))
+	default:
+		c.writer.WriteError(fmt.Sprintf("ERR unknown subcommand '%s'", printable(args[1])))
+	}
+}
+
+// xackCommand implements XACK key group id [id ...], replying with the number of entries acknowledged.
+func (s *Server) xackCommand(c *client, args [][]byte) {
+	ids, err := parseStreamIDs(args[3:])
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	n, err := s.datastore.XAck(string(args[1]), string(args[2]), ids)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(int64(n))
+}
+
+func parseStreamIDs(args [][]byte) ([]datastore.StreamID, error) {
+	ids := make([]datastore.StreamID, len(args))
+	for i, arg := range args {
+		var err error
+		if ids[i], err = datastore.ParseStreamID(string(arg), 0); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// xpendingCommand implements XPENDING key group [[IDLE min-idle-time] start end count [consumer]].
+// Without a range, it replies with the number of pending entries, the smallest and greatest pending IDs,
+// and the number of entries pending for each consumer. With a range, it replies with the ID, consumer,
+// idle time in milliseconds and delivery count of each pending entry.
+func (s *Server) xpendingCommand(c *client, args [][]byte) {
+	key, group := string(args[1]), string(args[2])
+	if len(args) == 3 {
+		summary, err := s.datastore.XPending(key, group)
+		if err != nil {
+			writeDataStoreError(c, err)
+			return
+		}
+		c.writer.WriteArrayHeader(4)
+		c.writer.WriteInteger(int64(summary.Count))
+		if summary.Count == 0 {
+			c.writer.WriteNull()
+			c.writer.WriteNull()
+			c.writer.WriteNullArray()
+			return
+		}
+		c.writer.WriteBulkString(summary.Lowest.String())
+		c.writer.WriteBulkString(summary.Highest.String())
+		consumers := make([]string, 0, len(summary.Consumers))
+		for consumer := range summary.Consumers {
+			consumers = append(consumers, consumer)
+		}
+		sort.Strings(consumers)
+		c.writer.WriteArrayHeader(len(consumers))
+		for _, consumer := range consumers {
+			c.writer.WriteStringArray([]string{consumer, strconv.Itoa(summary.Consumers[consumer])})
+		}
+		return
+	}
+
+	rest := args[3:]
+	var minIdle time.Duration
+	if strings.EqualFold(string(rest[0]), "idle") {
+		if len(rest) < 2 {
+			c.writer.WriteError("ERR " + errSyntax.Error())
+			return
+		}
+		ms, err := parseInteger(rest[1])
+		if err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+		minIdle = time.Duration(max(ms, 0)) * time.Millisecond
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	start, err := parseRangeID(rest[0], false)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	end, err := parseRangeID(rest[1], true)
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	count, err := parseInteger(rest[2])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	consumer := ""
+	if len(rest) == 4 {
+		consumer = string(rest[3])
+	}
+
+	entries, err := s.datastore.XPendingRange(key, group, start, end, int(max(count, 0)), consumer, minIdle)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteArrayHeader(len(entries))
+	for _, entry := range entries {
+		c.writer.WriteArrayHeader(4)
+		c.writer.WriteBulkString(entry.ID.String())
+		c.writer.WriteBulkString(entry.Consumer)
+		c.writer.WriteInteger(entry.Idle.Milliseconds())
+		c.writer.WriteInteger(int64(entry.Deliveries))
+	}
+}
+
+// xclaimCommand implements XCLAIM key group consumer min-idle-time id [id ...] [JUSTID], transferring to consumer
+// the given pending entries idle for at least min-idle-time milliseconds. It replies with the claimed entries,
+// or only their IDs with JUSTID, which leaves their delivery count unchanged.
+func (s *Server) xclaimCommand(c *client, args [][]byte) {
+	minIdle, err := parseInteger(args[4])
+	if err != nil {
+		c.writer.WriteError("ERR Invalid min-idle-time argument for XCLAIM")
+		return
+	}
+	idArgs := args[5:]
+	justID := strings.EqualFold(string(idArgs[len(idArgs)-1]), "justid")
+	if justID {
+		idArgs = idArgs[:len(idArgs)-1]
+	}
+	if len(idArgs) == 0 {
+		c.writer.WriteError(wrongArgs("xclaim"))
+		return
+	}
+	ids, err := parseStreamIDs(idArgs)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+
+	entries, err := s.datastore.XClaim(string(args[1]), string(args[2]), string(args[3]),
+		time.Duration(max(minIdle, 0))*time.Millisecond, ids, justID)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	if !justID {
+		writeStreamEntries(c, entries)
+		return
+	}
+	c.writer.WriteArrayHeader(len(entries))
+	for _, entry := range entries {
+		c.writer.WriteBulkString(entry.ID.String())
+	}
+}
@@ -0,0 +1,128 @@
+package network
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_StreamCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"XADD s 1-1 a 1\r\n",
+		"XADD s 1-* b 2\r\n",
+		"XADD s 1-1 c 3\r\n",
+		"XADD s MAXLEN 2 3-0 c 3\r\n",
+		"XLEN s\r\n",
+		"XRANGE s - +\r\n",
+		"XREVRANGE s + (1-2 COUNT 5\r\n",
+		"XREAD COUNT 1 STREAMS s 0\r\n",
+		"XREAD STREAMS s $\r\n",
+		"XTRIM s MINID 3\r\n",
+		"XADD missing NOMKSTREAM * a 1\r\n",
+		"SET str value\r\n",
+		"XADD str * a 1\r\n",
+		"GET s\r\n",
+		"XADD s 4-0 odd\r\n",
+	)
+	expected := []string{
+		"$3\r\n1-1\r\n",
+		"$3\r\n1-2\r\n",
+		"-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n",
+		"$3\r\n3-0\r\n",
+		":2\r\n",
+		"*2\r\n*2\r\n$3\r\n1-2\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n",
+		"*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nc\r\n$1\r\n3\r\n",
+		"*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-2\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		"*-1\r\n",
+		":1\r\n",
+		"$-1\r\n",
+		"+OK\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-ERR wrong number of arguments for 'xadd' command\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_StreamConsumerGroups(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"XGROUP CREATE s g $\r\n",
+		"XGROUP CREATE s g $ MKSTREAM\r\n",
+		"XGROUP CREATE s g $ MKSTREAM\r\n",
+		"XADD s 1-0 a 1\r\n",
+		"XADD s 2-0 b 2\r\n",
+		"XREADGROUP GROUP g alice COUNT 1 STREAMS s >\r\n",
+		"XREADGROUP GROUP g bob STREAMS s >\r\n",
+		"XREADGROUP GROUP g bob STREAMS s >\r\n",
+		"XREADGROUP GROUP g alice STREAMS s 0\r\n",
+		"XPENDING s g\r\n",
+		"XACK s g 1-0 5-0\r\n",
+		"XCLAIM s g alice 0 2-0 JUSTID\r\n",
+		"XPENDING s g - + 10 alice\r\n",
+		"XREADGROUP GROUP missing alice STREAMS s >\r\n",
+		"XGROUP DESTROY s g\r\n",
+	)
+	expected := []string{
+		"-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.\r\n",
+		"+OK\r\n",
+		"-BUSYGROUP Consumer Group name already exists\r\n",
+		"$3\r\n1-0\r\n",
+		"$3\r\n2-0\r\n",
+		"*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+		"*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		"*-1\r\n",
+		"*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+		"*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n",
+		":1\r\n",
+		"*1\r\n$3\r\n2-0\r\n",
+		"",
+		"-NOGROUP No such key or consumer group\r\n",
+		":1\r\n",
+	}
+	for i := range expected {
+		if i == 12 {
+			// The idle time varies, the delivery count is unchanged by JUSTID
+			if !strings.HasPrefix(replies[i], "*1\r\n*4\r\n$3\r\n2-0\r\n$5\r\nalice\r\n:") || !strings.HasSuffix(replies[i], ":1\r\n") {
+				t.Errorf("Expected alice to hold 2-0, got %q", replies[i])
+			}
+			continue
+		}
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_XReadBlock(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	if replies := exchange(t, server, "XREAD BLOCK 20 STREAMS s $\r\n"); replies[0] != "*-1\r\n" {
+		t.Errorf("Expected a null reply once the timeout elapsed, got %q", replies[0])
+	}
+
+	blocked := make(chan string)
+	go func() {
+		blocked <- exchange(t, server, "XREAD BLOCK 0 STREAMS other s $ $\r\n")[0]
+	}()
+	time.Sleep(20 * time.Millisecond)
+	exchange(t, server, "XADD s 1-0 a 1\r\n")
+
+	select {
+	case reply := <-blocked:
+		if expected := "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"; reply != expected {
+			t.Errorf("Expected %q, got %q", expected, reply)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected XADD to wake up the blocked XREAD")
+	}
+}
@@ -0,0 +1,265 @@
+package network
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+)
+
+// setCommand implements SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|KEEPTTL]. It replies with OK,
+// or null when NX or XX prevented the write, and with GET, with the value replaced or null instead.
+func (s *Server) setCommand(c *client, args [][]byte) {
+	var opts datastore.SetOptions
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "nx" && !opts.XX:
+			opts.NX = true
+		case option == "xx" && !opts.NX:
+			opts.XX = true
+		case option == "get":
+			opts.Get = true
+		case option == "keepttl" && opts.TTL == 0:
+			opts.KeepTTL = true
+		case (option == "ex" || option == "px") && opts.TTL == 0 && !opts.KeepTTL && i+1 < len(args):
+			ttl, err := parseTTL(option, args[i+1], "set")
+			if err != nil {
+				c.writer.WriteError("ERR " + err.Error())
+				return
+			}
+			opts.TTL = ttl
+			i++
+		default:
+			c.writer.WriteError("ERR " + errSyntax.Error())
+			return
+		}
+	}
+
+	old, written, err := s.datastore.SetWithOptions(string(args[1]), string(args[2]), opts)
+	switch {
+	case err != nil:
+		writeDataStoreError(c, err)
+	case opts.Get && old != nil:
+		c.writer.WriteValue(old)
+	case opts.Get || !written:
+		c.writer.WriteNull()
+	default:
+		c.writer.WriteOK()
+	}
+}
+
+// parseTTL parses the seconds of the EX option, or the milliseconds of the PX option, of command.
+func parseTTL(option string, arg []byte, command string) (time.Duration, error) {
+	n, err := parseInteger(arg)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid expire time in '%s' command", command)
+	}
+	if option == "px" {
+		return expireDuration(n, time.Millisecond, command)
+	}
+	return expireDuration(n, time.Second, command)
+}
+
+// setnxCommand implements SETNX key value, replying with 1 when the key was set and 0 when it already existed.
+func (s *Server) setnxCommand(c *client, args [][]byte) {
+	_, written, err := s.datastore.SetWithOptions(string(args[1]), string(args[2]), datastore.SetOptions{NX: true})
+	switch {
+	case err != nil:
+		writeDataStoreError(c, err)
+	case written:
+		c.writer.WriteInteger(1)
+	default:
+		c.writer.WriteInteger(0)
+	}
+}
+
+// mgetCommand implements MGET key [key ...], replying with the value of each key, or null when it does
+// not exist or holds another kind of value.
+func (s *Server) mgetCommand(c *client, args [][]byte) {
+	values := s.datastore.MGet(stringArgs(args[1:])...)
+	c.writer.WriteArrayHeader(len(values))
+	for _, value := range values {
+		if value == nil {
+			c.writer.WriteNull()
+			continue
+		}
+		c.writer.WriteValue(value)
+	}
+}
+
+// msetCommand implements MSET key value [key value ...], which sets every key at once, and MSETNX, which
+// only does when none of the keys exist and replies with whether it did.
+func (s *Server) msetCommand(c *client, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	if len(args)%2 == 0 {
+		c.writer.WriteError(wrongArgs(name))
+		return
+	}
+	pairs := make([]datastore.KeyValue, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		pairs = append(pairs, datastore.KeyValue{Key: string(args[i]), Value: string(args[i+1])})
+	}
+
+	if name == "msetnx" {
+		written, err := s.datastore.MSetNX(pairs...)
+		switch {
+		case err != nil:
+			writeDataStoreError(c, err)
+		case written:
+			c.writer.WriteInteger(1)
+		default:
+			c.writer.WriteInteger(0)
+		}
+		return
+	}
+	if err := s.datastore.MSet(pairs...); err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// getsetCommand implements GETSET key value, which sets the key and replies with the value replaced or null.
+func (s *Server) getsetCommand(c *client, args [][]byte) {
+	old, _, err := s.datastore.SetWithOptions(string(args[1]), string(args[2]), datastore.SetOptions{Get: true})
+	switch {
+	case err != nil:
+		writeDataStoreError(c, err)
+	case old == nil:
+		c.writer.WriteNull()
+	default:
+		c.writer.WriteValue(old)
+	}
+}
+
+// getdelCommand implements GETDEL key, which deletes the key and replies with its value or null.
+func (s *Server) getdelCommand(c *client, args [][]byte) {
+	value, err := s.datastore.GetDel(string(args[1]))
+	switch {
+	case err == datastore.ErrKeyNotFound:
+		c.writer.WriteNull()
+	case err != nil:
+		writeDataStoreError(c, err)
+	default:
+		c.writer.WriteValue(value)
+	}
+}
+
+// getverCommand implements GETVER key, replying with the value of the key and its version for CAS, or
+// with null and version 0 when the key does not exist.
+func (s *Server) getverCommand(c *client, args [][]byte) {
+	value, version, err := s.datastore.GetVersion(string(args[1]))
+	if err != nil && err != datastore.ErrKeyNotFound {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteArrayHeader(2)
+	if err != nil {
+		c.writer.WriteNull()
+	} else {
+		c.writer.WriteValue(value)
+	}
+	c.writer.WriteInteger(int64(version))
+}
+
+// casCommand implements CAS key expected-version value [EX seconds|PX milliseconds], which sets the key
+// only when it is at the version replied by GETVER, or does not exist when expected-version is 0. It
+// replies with the new version, or null when the key was written since.
+func (s *Server) casCommand(c *client, args [][]byte) {
+	version, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		c.writer.WriteError("ERR " + errNotInteger.Error())
+		return
+	}
+	var ttl time.Duration
+	switch option := strings.ToLower(string(args[len(args)-2])); {
+	case len(args) == 4:
+	case len(args) == 6 && (option == "ex" || option == "px"):
+		if ttl, err = parseTTL(option, args[5], "cas"); err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+	default:
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+
+	version, err = s.datastore.CompareAndSwap(string(args[1]), version, string(args[3]), ttl)
+	switch {
+	case err == datastore.ErrVersionMismatch:
+		c.writer.WriteNull()
+	case err != nil:
+		writeDataStoreError(c, err)
+	default:
+		c.writer.WriteInteger(int64(version))
+	}
+}
+
+func (s *Server) getCommand(c *client, args [][]byte) {
+	value, err := s.datastore.Get(string(args[1]))
+	if err == datastore.ErrWrongType {
+		writeDataStoreError(c, err)
+		return
+	}
+	if err != nil {
+		c.writer.WriteNull()
+		return
+	}
+	c.writer.WriteValue(value)
+}
+
+// updateCommand implements UPDATE key value, which replaces the value of an existing key.
+func (s *Server) updateCommand(c *client, args [][]byte) {
+	if err := s.datastore.Update(string(args[1]), string(args[2])); err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// incrCommand implements INCR, DECR, INCRBY and DECRBY key [increment], replying with the new value.
+func (s *Server) incrCommand(c *client, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	increment := int64(1)
+	if strings.HasSuffix(name, "by") {
+		var err error
+		if increment, err = parseInteger(args[2]); err != nil {
+			c.writer.WriteError("ERR " + err.Error())
+			return
+		}
+	}
+	if strings.HasPrefix(name, "decr") {
+		if increment == math.MinInt64 {
+			c.writer.WriteError("ERR decrement would overflow")
+			return
+		}
+		increment = -increment
+	}
+	value, err := s.datastore.IncrBy(string(args[1]), increment)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteInteger(value)
+}
+
+// incrbyfloatCommand implements INCRBYFLOAT key increment, replying with the new value as a bulk string.
+func (s *Server) incrbyfloatCommand(c *client, args [][]byte) {
+	increment, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		c.writer.WriteError("ERR " + errNotFloat.Error())
+		return
+	}
+	value, err := s.datastore.IncrByFloat(string(args[1]), increment)
+	if err != nil {
+		writeDataStoreError(c, err)
+		return
+	}
+	c.writer.WriteBulkString(strconv.FormatFloat(value, 'f', -1, 64))
+}
@@ -0,0 +1,177 @@
+package network
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_CounterCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"INCR counter\r\n",
+		"INCRBY counter 10\r\n",
+		"DECR counter\r\n",
+		"DECRBY counter 5\r\n",
+		"GET counter\r\n",
+		"INCRBY counter x\r\n",
+		"DECRBY counter -9223372036854775808\r\n",
+		"SET max 9223372036854775807\r\n",
+		"INCR max\r\n",
+		"SET text abc\r\n",
+		"INCR text\r\n",
+		"INCRBYFLOAT counter 0.5\r\n",
+		"INCRBYFLOAT counter nope\r\n",
+		"INCRBYFLOAT text 1\r\n",
+		"RPUSH list a\r\n",
+		"INCR list\r\n",
+	)
+	expected := []string{
+		":1\r\n",
+		":11\r\n",
+		":10\r\n",
+		":5\r\n",
+		"$1\r\n5\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"-ERR decrement would overflow\r\n",
+		"+OK\r\n",
+		"-ERR increment or decrement would overflow\r\n",
+		"+OK\r\n",
+		"-ERR value is not an integer or out of range\r\n",
+		"$3\r\n5.5\r\n",
+		"-ERR value is not a valid float\r\n",
+		"-ERR value is not a valid float\r\n",
+		":1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_ConditionalSetCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"SET key a XX\r\n",
+		"SET key a NX\r\n",
+		"SET key b NX\r\n",
+		"SET key b\r\n",
+		"SET key c GET\r\n",
+		"SET key d NX XX\r\n",
+		"SET key d EX 10 KEEPTTL\r\n",
+		"SET key d PX 0\r\n",
+		"SETNX key e\r\n",
+		"SETNX other e\r\n",
+		"GETSET key f\r\n",
+		"GETSET missing f\r\n",
+		"GETDEL key\r\n",
+		"GETDEL key\r\n",
+		"RPUSH list a\r\n",
+		"SET list x GET\r\n",
+		"GETDEL list\r\n",
+	)
+	expected := []string{
+		"$-1\r\n",
+		"+OK\r\n",
+		"$-1\r\n",
+		"+OK\r\n",
+		"$1\r\nb\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR syntax error\r\n",
+		"-ERR invalid expire time in 'set' command\r\n",
+		":0\r\n",
+		":1\r\n",
+		"$1\r\nc\r\n",
+		"$-1\r\n",
+		"$1\r\nf\r\n",
+		"$-1\r\n",
+		":1\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		"-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_CASCommand(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"GETVER lease\r\n",
+		"CAS lease 0 owner-1 EX 30\r\n",
+		"CAS lease 0 owner-2\r\n",
+		"CAS lease x owner-2\r\n",
+		"CAS lease 1 owner-2 KEEPTTL\r\n",
+		"GETVER lease\r\n",
+	)
+	if replies[0] != "*2\r\n$-1\r\n:0\r\n" {
+		t.Errorf("Expected a missing key at version 0, got %q", replies[0])
+	}
+	version := strings.TrimSuffix(strings.TrimPrefix(replies[1], ":"), "\r\n")
+	if replies[2] != "$-1\r\n" {
+		t.Errorf("Expected version 0 to fail on an existing key, got %q", replies[2])
+	}
+	if replies[3] != "-ERR value is not an integer or out of range\r\n" {
+		t.Errorf("Expected an invalid version to be rejected, got %q", replies[3])
+	}
+	if replies[4] != "-ERR syntax error\r\n" {
+		t.Errorf("Expected a syntax error, got %q", replies[4])
+	}
+	if expected := "*2\r\n$7\r\nowner-1\r\n:" + version + "\r\n"; replies[5] != expected {
+		t.Errorf("Expected %q, got %q", expected, replies[5])
+	}
+
+	replies = exchange(t, server,
+		"CAS lease "+version+" owner-2\r\n",
+		"CAS lease "+version+" owner-3\r\n",
+		"GET lease\r\n",
+		"TTL lease\r\n",
+	)
+	if replies[0] == "$-1\r\n" || replies[0][0] != ':' {
+		t.Errorf("Expected the new version, got %q", replies[0])
+	}
+	expected := []string{"$-1\r\n", "$7\r\nowner-2\r\n", ":-1\r\n"}
+	for i := range expected {
+		if replies[i+1] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i+1, expected[i], replies[i+1])
+		}
+	}
+}
+
+func TestServer_MultiKeyCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"MSET a 1 b 2\r\n",
+		"MSET a 1 b\r\n",
+		"MSETNX b 3 c 3\r\n",
+		"MSETNX c 3 d 4\r\n",
+		"RPUSH list x\r\n",
+		"MGET a b c d list missing\r\n",
+		"DEL a b list missing\r\n",
+		"MGET a b c\r\n",
+	)
+	expected := []string{
+		"+OK\r\n",
+		"-ERR wrong number of arguments for 'mset' command\r\n",
+		":0\r\n",
+		":1\r\n",
+		":1\r\n",
+		"*6\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n$1\r\n4\r\n$-1\r\n$-1\r\n",
+		":3\r\n",
+		"*3\r\n$-1\r\n$-1\r\n$1\r\n3\r\n",
+	}
+	for i, reply := range replies {
+		if reply != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], reply)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package network
+
+import (
+	"bytes"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+// multiCommand implements MULTI, after which the commands of the connection are queued until EXEC.
+func (s *Server) multiCommand(c *client, args [][]byte) {
+	if c.multi {
+		c.writer.WriteError("ERR MULTI calls can not be nested")
+		return
+	}
+	c.multi = true
+	c.writer.WriteOK()
+}
+
+// execCommand implements EXEC, which runs the queued commands while every other client waits, and
+// replies with an array of their replies. It replies with a null array instead when a watched key
+// was written since WATCH, and fails when a command was rejected while queued.
+func (s *Server) execCommand(c *client, args [][]byte) {
+	if !c.multi {
+		c.writer.WriteError("ERR EXEC without MULTI")
+		return
+	}
+	queued, failed, watch := c.queued, c.multiFailed, c.watch
+	c.watch = nil
+	c.endTransaction()
+	if failed {
+		if watch != nil {
+			watch.Release()
+		}
+		c.writer.WriteError("EXECABORT Transaction discarded because of previous errors.")
+		return
+	}
+
+	// Replies are buffered until the datastore is unlocked, so that a client reading them slowly
+	// does not hold up the other clients
+	var replies bytes.Buffer
+	out := c.writer
+	c.writer = newRESPWriter(&replies)
+	c.writer.proto = out.proto
+	err := s.datastore.Exec(watch, func(tx *datastore.DataStore) {
+		txServer := s.withDataStore(tx)
+		for _, args := range queued {
+			txServer.dispatch(c, args)
+		}
+	})
+	c.writer.Flush()
+	c.writer = out
+
+	if err != nil {
+		c.writer.WriteNullArray()
+		return
+	}
+	c.writer.WriteArrayHeader(len(queued))
+	c.writer.w.Write(replies.Bytes())
+}
+
+// discardCommand implements DISCARD, which drops the queued commands and the watched keys.
+func (s *Server) discardCommand(c *client, args [][]byte) {
+	if !c.multi {
+		c.writer.WriteError("ERR DISCARD without MULTI")
+		return
+	}
+	c.endTransaction()
+	c.writer.WriteOK()
+}
+
+// watchCommand implements WATCH key [key ...], after which EXEC fails if one of the keys is written.
+func (s *Server) watchCommand(c *client, args [][]byte) {
+	if c.multi {
+		c.writer.WriteError("ERR WATCH inside MULTI is not allowed")
+		return
+	}
+	if c.watch == nil {
+		c.watch = s.datastore.Watch(stringArgs(args[1:])...)
+	} else {
+		c.watch.Add(stringArgs(args[1:])...)
+	}
+	c.writer.WriteOK()
+}
+
+// unwatchCommand implements UNWATCH, which forgets the keys watched with WATCH.
+func (s *Server) unwatchCommand(c *client, args [][]byte) {
+	c.unwatch()
+	c.writer.WriteOK()
+}
+
+// withDataStore returns a copy of the server that runs commands against tx, the handle of a transaction.
+func (s *Server) withDataStore(tx *datastore.DataStore) *Server {
+	txServer := *s
+	txServer.datastore = tx
+	txServer.txn = true
+	return &txServer
+}
@@ -0,0 +1,107 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestServer_MultiExec(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"EXEC\r\n",
+		"DISCARD\r\n",
+		"MULTI\r\n",
+		"MULTI\r\n",
+		"SET a 1\r\n",
+		"INCR a\r\n",
+		"LPUSH a x\r\n",
+		"BLPOP empty 0\r\n",
+		"GET a\r\n",
+		"EXEC\r\n",
+		"MULTI\r\n",
+		"SET b 1\r\n",
+		"NOPE\r\n",
+		"SUBSCRIBE channel\r\n",
+		"EXEC\r\n",
+		"GET b\r\n",
+		"MULTI\r\n",
+		"SET c 1\r\n",
+		"DISCARD\r\n",
+		"GET c\r\n",
+	)
+	expected := []string{
+		"-ERR EXEC without MULTI\r\n",
+		"-ERR DISCARD without MULTI\r\n",
+		"+OK\r\n",
+		"-ERR MULTI calls can not be nested\r\n",
+		"+QUEUED\r\n",
+		"+QUEUED\r\n",
+		"+QUEUED\r\n",
+		"+QUEUED\r\n",
+		"+QUEUED\r\n",
+		"*5\r\n+OK\r\n:2\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n*-1\r\n$1\r\n2\r\n",
+		"+OK\r\n",
+		"+QUEUED\r\n",
+		"-ERR unknown command 'NOPE'\r\n",
+		"-ERR Command not allowed inside a transaction\r\n",
+		"-EXECABORT Transaction discarded because of previous errors.\r\n",
+		"$-1\r\n",
+		"+OK\r\n",
+		"+QUEUED\r\n",
+		"+OK\r\n",
+		"$-1\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_Watch(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+	watcher := newSubscriber(t, server)
+	other := newSubscriber(t, server)
+
+	// A write by another client between WATCH and EXEC aborts the transaction
+	watcher.send(t, "WATCH counter\r\n")
+	watcher.expect(t, "+OK\r\n")
+	other.send(t, "INCR counter\r\n")
+	other.expect(t, ":1\r\n")
+	watcher.send(t, "MULTI\r\n")
+	watcher.expect(t, "+OK\r\n")
+	watcher.send(t, "WATCH other\r\n")
+	watcher.expect(t, "-ERR WATCH inside MULTI is not allowed\r\n")
+	watcher.send(t, "INCRBY counter 10\r\n")
+	watcher.expect(t, "+QUEUED\r\n")
+	watcher.send(t, "EXEC\r\n")
+	watcher.expect(t, "*-1\r\n")
+
+	// EXEC releases the watched keys, and the transaction runs when they were not written
+	other.send(t, "INCR counter\r\n")
+	other.expect(t, ":2\r\n")
+	watcher.send(t, "WATCH counter\r\n")
+	watcher.expect(t, "+OK\r\n")
+	watcher.send(t, "MULTI\r\n")
+	watcher.expect(t, "+OK\r\n")
+	watcher.send(t, "INCRBY counter 10\r\n")
+	watcher.expect(t, "+QUEUED\r\n")
+	watcher.send(t, "EXEC\r\n")
+	watcher.expect(t, "*1\r\n:12\r\n")
+
+	// UNWATCH forgets the watched keys
+	watcher.send(t, "WATCH counter\r\n")
+	watcher.expect(t, "+OK\r\n")
+	other.send(t, "DEL counter\r\n")
+	other.expect(t, ":1\r\n")
+	watcher.send(t, "UNWATCH\r\n")
+	watcher.expect(t, "+OK\r\n")
+	watcher.send(t, "MULTI\r\n")
+	watcher.expect(t, "+OK\r\n")
+	watcher.send(t, "INCR counter\r\n")
+	watcher.expect(t, "+QUEUED\r\n")
+	watcher.send(t, "EXEC\r\n")
+	watcher.expect(t, "*1\r\n:1\r\n")
+}
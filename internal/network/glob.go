@@ -0,0 +1,82 @@
+package network
+
+// globMatch reports whether s matches the glob-style pattern the way Redis matches channels and keys:
+// * matches any sequence of bytes, ? any byte, [abc], [^abc] and [a-z] a byte of a set, and \ escapes
+// the next byte.
+func globMatch(pattern, s string) bool {
+	p, i := 0, 0
+	// starP and starI are the positions of the last * and of the byte it was tried to match up to
+	starP, starI := -1, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starI = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			default:
+				if n, ok := matchOne(pattern[p:], s[i]); ok {
+					p += n
+					i++
+					continue
+				}
+			}
+		}
+		// Let the last * match one more byte and try again
+		if starP < 0 {
+			return false
+		}
+		starI++
+		p, i = starP+1, starI
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchOne matches c against the element starting pattern, other than * and ?, and returns the
+// length of that element.
+func matchOne(pattern string, c byte) (int, bool) {
+	switch pattern[0] {
+	case '\\':
+		if len(pattern) > 1 {
+			return 2, pattern[1] == c
+		}
+		return 1, c == '\\'
+	case '[':
+		i := 1
+		negate := i < len(pattern) && pattern[i] == '^'
+		if negate {
+			i++
+		}
+		matched := false
+		for ; i < len(pattern) && pattern[i] != ']'; i++ {
+			switch {
+			case pattern[i] == '\\' && i+1 < len(pattern):
+				i++
+				matched = matched || pattern[i] == c
+			case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+				lo, hi := pattern[i], pattern[i+2]
+				if lo > hi {
+					lo, hi = hi, lo
+				}
+				matched = matched || (lo <= c && c <= hi)
+				i += 2
+			default:
+				matched = matched || pattern[i] == c
+			}
+		}
+		// Like in Redis, a set missing its closing bracket extends to the end of the pattern
+		if i < len(pattern) {
+			i++
+		}
+		return i, matched != negate
+	default:
+		return 1, pattern[0] == c
+	}
+}
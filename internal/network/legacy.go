@@ -0,0 +1,361 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// legacyCommands lists the commands of the legacy protocol, to tell malformed commands from unknown ones.
+var legacyCommands = map[string]bool{
+	"SET": true, "UPDATE": true, "GET": true, "DELETE": true, "EXPIRE": true, "PEXPIRE": true,
+	"TTL": true, "PTTL": true, "PERSIST": true, "ALL": true, "FLUSH": true,
+}
+
+// legacyWriteCommands lists the commands of the legacy protocol that replicas reject.
+var legacyWriteCommands = map[string]bool{
+	"SET": true, "UPDATE": true, "DELETE": true, "EXPIRE": true, "PEXPIRE": true, "PERSIST": true, "FLUSH": true,
+}
+
+// legacyRequest is a command of the legacy protocol. It is either a text line such as "SET key value",
+// or, for binary-safe keys and values, a RESP array of length-prefixed bulk strings.
+type legacyRequest struct {
+	// line is the text line of the command, empty for framed requests.
+	line string
+	args [][]byte
+}
+
+// framed reports whether the request was sent as a RESP array.
+func (r *legacyRequest) framed() bool { return r.line == "" }
+
+// name returns the upper case command name.
+func (r *legacyRequest) name() string { return strings.ToUpper(string(r.args[0])) }
+
+// String describes the request in error replies.
+func (r *legacyRequest) String() string {
+	if r.framed() {
+		return r.name()
+	}
+	return r.line
+}
+
+// readLegacyRequest reads the next request of the legacy protocol. Values of framed requests are read
+// straight from the connection buffer, so multi-megabyte values do not go through a line reader.
+func readLegacyRequest(reader *respReader) (*legacyRequest, error) {
+	prefix, err := reader.r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if prefix[0] == '*' {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			return nil, err
+		}
+		return &legacyRequest{args: args}, nil
+	}
+
+	line, err := reader.readLine()
+	if err != nil {
+		return nil, err
+	}
+	msg := strings.TrimSpace(string(line))
+	if msg == "" {
+		return &legacyRequest{}, nil
+	}
+
+	// Text commands carrying a value keep the rest of the line, spaces included, as last argument
+	parts := 2
+	switch strings.ToUpper(strings.SplitN(msg, " ", 2)[0]) {
+	case "SET", "UPDATE", "EXPIRE", "PEXPIRE":
+		parts = 3
+	}
+	request := &legacyRequest{line: msg}
+	for _, part := range strings.SplitN(msg, " ", parts) {
+		request.args = append(request.args, []byte(strings.TrimSpace(part)))
+	}
+	return request, nil
+}
+
+// handleLegacyConnection handles a connection speaking the legacy newline-delimited text protocol,
+// in which commands look like "SET key value" and replies like "VALUE key 5" or "NODATA".
+func (s *Server) handleLegacyConnection(conn net.Conn) {
+	reader := newRESPReader(conn)
+	reader.maxBulkLength = s.maxBulkLength
+	writer := bufio.NewWriter(conn)
+
+	for {
+		// Requests already received, pipelined by the client, run before their replies are written at once
+		if reader.r.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				log.Printf("Error writing reply: %v\n", err)
+				break
+			}
+			if !s.life.end(conn) {
+				break
+			}
+		}
+		err := s.awaitCommand(conn, reader, false)
+		var request *legacyRequest
+		if err == nil {
+			request, err = readLegacyRequest(reader)
+		}
+		if err != nil {
+			if isProtocolError(err) {
+				writer.WriteString(formatErrorString("request", err.Error()) + "\r\n")
+				writer.Flush()
+			} else if err != io.EOF && !errors.Is(err, net.ErrClosed) && !isTimeout(err) {
+				log.Printf("Error reading message: %v\n", err)
+			}
+			break
+		}
+		if len(request.args) == 0 {
+			continue
+		}
+
+		if !s.life.begin(conn) {
+			break
+		}
+		log.Printf("Received message: %s\n", request)
+		s.dispatchLegacy(writer, request)
+	}
+}
+
+// dispatchLegacy runs a request of the legacy protocol and writes its reply.
+func (s *Server) dispatchLegacy(writer *bufio.Writer, request *legacyRequest) {
+	write := legacyWriteCommands[request.name()]
+	if write && s.repl.isReplica() {
+		writer.WriteString(formatErrorString(request.String(), errReadOnly))
+		return
+	}
+	if write {
+		if err := s.logFailure(); err != nil {
+			writer.WriteString(formatErrorString(request.String(), logFailureReply(err)))
+			return
+		}
+	}
+	if !write || !s.logsEveryWrite() {
+		s.runLegacy(writer, request)
+		return
+	}
+
+	// Like runLogged, the reply is held back until the write is logged
+	var reply bytes.Buffer
+	held := bufio.NewWriter(&reply)
+	s.runLegacy(held, request)
+	held.Flush()
+	if err := s.logFailure(); err != nil {
+		writer.WriteString(formatErrorString(request.String(), logFailureReply(err)))
+		return
+	}
+	writer.Write(reply.Bytes())
+}
+
+// runLegacy runs a request of the legacy protocol, once it is allowed to.
+func (s *Server) runLegacy(writer *bufio.Writer, request *legacyRequest) {
+	args := request.args
+	switch name := request.name(); {
+	case name == "SET" && len(args) >= 3:
+		key, value := string(args[1]), string(args[2])
+		var ttl time.Duration
+		var err error
+		if request.framed() {
+			ttl, err = parseFramedSetOptions(args[3:])
+		} else {
+			value, ttl, err = parseSetOptions(value)
+		}
+		if err == nil {
+			if ttl > 0 {
+				err = s.datastore.SetWithTTL(key, value, ttl)
+			} else {
+				err = s.datastore.Set(key, value)
+			}
+		}
+		if err != nil {
+			writer.WriteString(formatErrorString(request.String(), err.Error()))
+		} else {
+			writer.WriteString("OK\r\n")
+		}
+
+	case name == "UPDATE" && len(args) == 3:
+		if err := s.datastore.Update(string(args[1]), string(args[2])); err != nil {
+			writer.WriteString(formatErrorString(request.String(), err.Error()))
+		} else {
+			writer.WriteString("OK\r\n")
+		}
+
+	case name == "GET" && len(args) == 2:
+		value, err := s.datastore.Get(string(args[1]))
+		if err != nil {
+			writer.WriteString("NODATA\r\n")
+		} else {
+			data := formatValue(value)
+			writer.WriteString(fmt.Sprintf("VALUE %s %d\r\n", args[1], len(data)))
+			writer.WriteString(data)
+			writer.WriteString("\r\n")
+		}
+
+	case name == "DELETE" && len(args) == 2:
+		if err := s.datastore.Delete(string(args[1])); err != nil {
+			writer.WriteString("NODATA\r\n")
+		} else {
+			writer.WriteString("OK\r\n")
+		}
+
+	case (name == "EXPIRE" || name == "PEXPIRE") && len(args) == 3:
+		unit := time.Second
+		if name == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		ttl, err := parseDuration(string(args[2]), unit, strings.ToLower(name))
+		if err != nil {
+			writer.WriteString(formatErrorString(request.String(), err.Error()))
+		} else if err := s.datastore.Expire(string(args[1]), ttl); err != nil {
+			writer.WriteString("NODATA\r\n")
+		} else {
+			writer.WriteString("OK\r\n")
+		}
+
+	case (name == "TTL" || name == "PTTL") && len(args) == 2:
+		unit := time.Second
+		if name == "PTTL" {
+			unit = time.Millisecond
+		}
+		ttl, err := s.datastore.TTL(string(args[1]))
+		writer.WriteString(fmt.Sprintf("TTL %d\r\n", formatTTL(ttl, err, unit)))
+
+	case name == "PERSIST" && len(args) == 2:
+		removed, err := s.datastore.Persist(string(args[1]))
+		if err != nil || !removed {
+			writer.WriteString("NODATA\r\n")
+		} else {
+			writer.WriteString("OK\r\n")
+		}
+
+	case name == "ALL" && len(args) == 1:
+		// Every entry is framed by the length of its key and value, so both may hold any byte
+		values := s.datastore.GetAll()
+		writer.WriteString("ALLVALUES\r\n")
+		for key, value := range values {
+			data := formatValue(value)
+			writer.WriteString(fmt.Sprintf("ENTRY %d %d\r\n", len(key), len(data)))
+			writer.WriteString(key)
+			writer.WriteString("\r\n")
+			writer.WriteString(data)
+			writer.WriteString("\r\n")
+		}
+		writer.WriteString("ENDOFALLVALUES\r\n")
+
+	case name == "FLUSH" && len(args) == 1:
+		err := s.datastore.FlushAll()
+		if err != nil {
+			writer.WriteString(formatErrorString(request.String(), err.Error()))
+		} else {
+			writer.WriteString("OK\r\n")
+		}
+
+	case legacyCommands[name]:
+		writer.WriteString(formatErrorString(request.String(), "invalid format"))
+
+	default:
+		writer.WriteString("UNKNOWN\r\n")
+	}
+}
+
+// formatValue returns the bytes sent for a value of the datastore, whatever its Go type.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatFloat(v)
+	case float32:
+		return formatFloat(float64(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parseSetOptions strips a trailing "EX seconds" or "PX milliseconds" option from a SET value
+// and returns the remaining value along with the requested time to live.
+func parseSetOptions(value string) (string, time.Duration, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return value, 0, nil
+	}
+
+	var unit time.Duration
+	switch strings.ToUpper(fields[len(fields)-2]) {
+	case "EX":
+		unit = time.Second
+	case "PX":
+		unit = time.Millisecond
+	default:
+		return value, 0, nil
+	}
+
+	ttl, err := parseDuration(fields[len(fields)-1], unit, "set")
+	if err != nil {
+		return "", 0, err
+	}
+	if ttl <= 0 {
+		return "", 0, errors.New("invalid expire time")
+	}
+	value = strings.TrimSpace(value[:strings.LastIndex(value, fields[len(fields)-2])])
+	return value, ttl, nil
+}
+
+// parseFramedSetOptions parses the "EX seconds" or "PX milliseconds" arguments that follow the value
+// of a framed SET request.
+func parseFramedSetOptions(options [][]byte) (time.Duration, error) {
+	if len(options) == 0 {
+		return 0, nil
+	}
+	if len(options) != 2 {
+		return 0, errSyntax
+	}
+
+	var unit time.Duration
+	switch strings.ToUpper(string(options[0])) {
+	case "EX":
+		unit = time.Second
+	case "PX":
+		unit = time.Millisecond
+	default:
+		return 0, errSyntax
+	}
+
+	ttl, err := parseDuration(string(options[1]), unit, "set")
+	if err != nil {
+		return 0, err
+	}
+	if ttl <= 0 {
+		return 0, errors.New("invalid expire time")
+	}
+	return ttl, nil
+}
+
+// parseDuration parses an integer amount of unit, as sent by EXPIRE and SET ... EX/PX of command.
+func parseDuration(amount string, unit time.Duration, command string) (time.Duration, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(amount), 10, 64)
+	if err != nil {
+		return 0, errors.New("value is not an integer or out of range")
+	}
+	return expireDuration(n, unit, command)
+}
+
+func formatErrorString(command string, err string) string {
+	return fmt.Sprintf("Error in %s : %s", command, err)
+}
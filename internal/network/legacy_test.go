@@ -0,0 +1,79 @@
+package network
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+// legacyExchange sends each request to a legacy connection handled by server and returns the replies,
+// read up to the given number of lines each.
+func legacyExchange(t *testing.T, server *Server, requests []string, lines []int) []string {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go server.handleConnection(serverConn)
+
+	reader := bufio.NewReader(clientConn)
+	replies := make([]string, 0, len(requests))
+	for i, request := range requests {
+		if _, err := clientConn.Write([]byte(request)); err != nil {
+			t.Fatalf("Expected no error writing %q, got %v", request, err)
+		}
+		reply := ""
+		for j := 0; j < lines[i]; j++ {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Expected a reply to %q, got %v", request, err)
+			}
+			reply += line
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+func TestLegacy_TextCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+	server.protocol = ProtocolLegacy
+
+	replies := legacyExchange(t, server, []string{
+		"SET key hello world EX 100\n",
+		"GET key\n",
+		"TTL key\n",
+		"DELETE key\n",
+		"GET key\n",
+		"NOPE\n",
+	}, []int{1, 2, 1, 1, 1, 1})
+	expected := []string{
+		"OK\r\n",
+		"VALUE key 11\r\nhello world\r\n",
+		"TTL 100\r\n",
+		"OK\r\n",
+		"NODATA\r\n",
+		"UNKNOWN\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestLegacy_FramedBinaryValues(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+	server.protocol = ProtocolLegacy
+
+	replies := legacyExchange(t, server, []string{
+		"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$6\r\na\r\nb\x00c\r\n",
+		"GET key\n",
+	}, []int{1, 3})
+	if replies[0] != "OK\r\n" {
+		t.Errorf("Expected OK, got %q", replies[0])
+	}
+	if replies[1] != "VALUE key 6\r\na\r\nb\x00c\r\n" {
+		t.Errorf("Expected the length-prefixed binary value, got %q", replies[1])
+	}
+}
@@ -0,0 +1,250 @@
+package network
+
+import (
+	"log"
+	"sync"
+)
+
+// defaultPubSubOutputLimit bounds, by default, the messages waiting to be written to a subscriber.
+const defaultPubSubOutputLimit = 32 * 1024 * 1024
+
+// pubsub routes published messages to the clients subscribed to their channel or to a matching pattern.
+type pubsub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*client]struct{}
+	patterns map[string]map[*client]struct{}
+	// outputLimit bounds the messages waiting to be written to a subscriber, in bytes. Subscribers
+	// reading too slowly are disconnected once they reach it, rather than blocking publishers.
+	outputLimit int
+}
+
+func newPubSub() *pubsub {
+	return &pubsub{
+		channels:    make(map[string]map[*client]struct{}),
+		patterns:    make(map[string]map[*client]struct{}),
+		outputLimit: defaultPubSubOutputLimit,
+	}
+}
+
+// subscribe adds c to the subscribers of channel, or of pattern when pattern is set, and returns
+// the number of subscriptions of c.
+func (ps *pubsub) subscribe(c *client, name string, pattern bool) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	subscribers, subscriptions := ps.channels, c.channels
+	if pattern {
+		subscribers, subscriptions = ps.patterns, c.patterns
+	}
+	if subscribers[name] == nil {
+		subscribers[name] = make(map[*client]struct{})
+	}
+	subscribers[name][c] = struct{}{}
+	subscriptions[name] = struct{}{}
+	return len(c.channels) + len(c.patterns)
+}
+
+// unsubscribe removes c from the subscribers of channel, or of pattern when pattern is set, and returns
+// the number of subscriptions of c left.
+func (ps *pubsub) unsubscribe(c *client, name string, pattern bool) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	subscribers, subscriptions := ps.channels, c.channels
+	if pattern {
+		subscribers, subscriptions = ps.patterns, c.patterns
+	}
+	if clients := subscribers[name]; clients != nil {
+		delete(clients, c)
+		if len(clients) == 0 {
+			delete(subscribers, name)
+		}
+	}
+	delete(subscriptions, name)
+	return len(c.channels) + len(c.patterns)
+}
+
+// unsubscribeAll removes every subscription of c, once its connection is closed.
+func (ps *pubsub) unsubscribeAll(c *client) {
+	for channel := range c.channels {
+		ps.unsubscribe(c, channel, false)
+	}
+	for pattern := range c.patterns {
+		ps.unsubscribe(c, pattern, true)
+	}
+}
+
+// publish sends message to the subscribers of channel and returns the number of clients that received it.
+// It never blocks: messages are queued for the subscribers and written by their push goroutine.
+func (ps *pubsub) publish(channel, message string) int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	receivers := 0
+	for c := range ps.channels[channel] {
+		c.push.enqueue(c, []string{"message", channel, message}, ps.outputLimit)
+		receivers++
+	}
+	for pattern, clients := range ps.patterns {
+		if !globMatch(pattern, channel) {
+			continue
+		}
+		for c := range clients {
+			c.push.enqueue(c, []string{"pmessage", pattern, channel, message}, ps.outputLimit)
+			receivers++
+		}
+	}
+	return receivers
+}
+
+// pushQueue holds the messages published to a client and not written yet.
+type pushQueue struct {
+	mu       sync.Mutex
+	messages [][]string
+	// size is the approximate number of bytes the messages take once encoded
+	size   int
+	notify chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+func newPushQueue() *pushQueue {
+	return &pushQueue{notify: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+// enqueue schedules message to be written to c, or disconnects c when too many messages are pending.
+func (q *pushQueue) enqueue(c *client, message []string, limit int) {
+	size := 0
+	for _, part := range message {
+		size += len(part) + 16
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	if q.size+size > limit {
+		log.Printf("Disconnecting subscriber %d: output buffer limit reached\n", c.id)
+		q.closed = true
+		c.conn.Close()
+		return
+	}
+	q.messages = append(q.messages, message)
+	q.size += size
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the pending messages and empties the queue.
+func (q *pushQueue) take() [][]string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	messages := q.messages
+	q.messages, q.size = nil, 0
+	return messages
+}
+
+// pending returns the approximate number of bytes of the messages not written yet.
+func (q *pushQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// close stops the push goroutine and drops the pending messages.
+func (q *pushQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	select {
+	case <-q.done:
+	default:
+		close(q.done)
+	}
+}
+
+// runPush writes the messages published to c until its connection is closed. Messages are only written
+// between replies, c.outMu being held while a command runs and its reply is written.
+func (s *Server) runPush(c *client) {
+	for {
+		select {
+		case <-c.push.done:
+			return
+		case <-c.push.notify:
+		}
+
+		messages := c.push.take()
+		c.outMu.Lock()
+		for _, message := range messages {
+			c.writer.WritePushHeader(len(message))
+			for _, part := range message {
+				c.writer.WriteBulkString(part)
+			}
+		}
+		err := c.writer.Flush()
+		c.outMu.Unlock()
+		if err != nil {
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// subscribeCommand implements SUBSCRIBE channel [channel ...] and PSUBSCRIBE pattern [pattern ...].
+func (s *Server) subscribeCommand(c *client, args [][]byte) {
+	pattern := len(args[0]) > 0 && (args[0][0] == 'p' || args[0][0] == 'P')
+	kind := "subscribe"
+	if pattern {
+		kind = "psubscribe"
+	}
+	if c.push == nil {
+		c.push = newPushQueue()
+		go s.runPush(c)
+	}
+	for _, name := range args[1:] {
+		count := s.pubsub.subscribe(c, string(name), pattern)
+		c.writer.WritePushHeader(3)
+		c.writer.WriteBulkString(kind)
+		c.writer.WriteBulk(name)
+		c.writer.WriteInteger(int64(count))
+	}
+}
+
+// unsubscribeCommand implements UNSUBSCRIBE [channel ...] and PUNSUBSCRIBE [pattern ...], which
+// unsubscribe from every channel, or pattern, when none is given.
+func (s *Server) unsubscribeCommand(c *client, args [][]byte) {
+	pattern := len(args[0]) > 0 && (args[0][0] == 'p' || args[0][0] == 'P')
+	kind, subscriptions := "unsubscribe", c.channels
+	if pattern {
+		kind, subscriptions = "punsubscribe", c.patterns
+	}
+
+	names := make([]string, 0, len(args)-1)
+	for _, name := range args[1:] {
+		names = append(names, string(name))
+	}
+	if len(names) == 0 {
+		for name := range subscriptions {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		c.writer.WritePushHeader(3)
+		c.writer.WriteBulkString(kind)
+		c.writer.WriteNull()
+		c.writer.WriteInteger(int64(len(c.channels) + len(c.patterns)))
+		return
+	}
+	for _, name := range names {
+		count := s.pubsub.unsubscribe(c, name, pattern)
+		c.writer.WritePushHeader(3)
+		c.writer.WriteBulkString(kind)
+		c.writer.WriteBulkString(name)
+		c.writer.WriteInteger(int64(count))
+	}
+}
+
+// publishCommand implements PUBLISH channel message, replying with the number of clients that received it.
+func (s *Server) publishCommand(c *client, args [][]byte) {
+	c.writer.WriteInteger(int64(s.pubsub.publish(string(args[1]), string(args[2]))))
+}
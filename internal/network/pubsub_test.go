@@ -0,0 +1,155 @@
+package network
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		expected   bool
+	}{
+		{"news.*", "news.tech", true},
+		{"news.*", "news", false},
+		{"*", "", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"*a*b", "xaxxaxb", true},
+		{"*a*b", "xaxxaxbx", false},
+	}
+	for _, test := range tests {
+		if matched := globMatch(test.pattern, test.s); matched != test.expected {
+			t.Errorf("Expected globMatch(%q, %q) to be %v", test.pattern, test.s, test.expected)
+		}
+	}
+}
+
+// subscriber is a connection to server on which replies and messages are read as they come.
+type subscriber struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newSubscriber(t *testing.T, server *Server) *subscriber {
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	go server.handleConnection(serverConn)
+	return &subscriber{conn: clientConn, reader: bufio.NewReader(clientConn)}
+}
+
+func (s *subscriber) send(t *testing.T, command string) {
+	t.Helper()
+	if _, err := s.conn.Write([]byte(command)); err != nil {
+		t.Fatalf("Expected no error writing %q, got %v", command, err)
+	}
+}
+
+func (s *subscriber) expect(t *testing.T, expected string) {
+	t.Helper()
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if reply := readReply(t, s.reader); reply != expected {
+		t.Errorf("Expected %q, got %q", expected, reply)
+	}
+}
+
+func TestPubSub_PublishSubscribe(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	sub := newSubscriber(t, server)
+	sub.send(t, "*3\r\n$9\r\nSUBSCRIBE\r\n$4\r\nnews\r\n$6\r\nsports\r\n")
+	sub.expect(t, "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+	sub.expect(t, "*3\r\n$9\r\nsubscribe\r\n$6\r\nsports\r\n:2\r\n")
+	sub.send(t, "*2\r\n$10\r\nPSUBSCRIBE\r\n$2\r\nn*\r\n")
+	sub.expect(t, "*3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:3\r\n")
+
+	replies := exchange(t, server,
+		"*3\r\n$7\r\nPUBLISH\r\n$4\r\nnews\r\n$5\r\nhello\r\n",
+		"*3\r\n$7\r\nPUBLISH\r\n$7\r\nweather\r\n$4\r\nrain\r\n",
+	)
+	if replies[0] != ":2\r\n" || replies[1] != ":0\r\n" {
+		t.Errorf("Expected the receiver counts 2 and 0, got %q", replies)
+	}
+	sub.expect(t, "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+	sub.expect(t, "*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+
+	// Only the pub/sub commands are allowed while subscribed
+	sub.send(t, "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n")
+	sub.expect(t, "-ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n")
+	sub.send(t, "*1\r\n$4\r\nPING\r\n")
+	sub.expect(t, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+
+	sub.send(t, "*1\r\n$11\r\nUNSUBSCRIBE\r\n")
+	for i := 0; i < 2; i++ {
+		reply := readReply(t, sub.reader)
+		if !strings.HasPrefix(reply, "*3\r\n$11\r\nunsubscribe\r\n") {
+			t.Errorf("Expected an unsubscribe confirmation, got %q", reply)
+		}
+	}
+	sub.send(t, "*2\r\n$12\r\nPUNSUBSCRIBE\r\n$2\r\nn*\r\n")
+	sub.expect(t, "*3\r\n$12\r\npunsubscribe\r\n$2\r\nn*\r\n:0\r\n")
+
+	// Back to regular commands
+	sub.send(t, "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n")
+	sub.expect(t, "$-1\r\n")
+	if replies := exchange(t, server, "*3\r\n$7\r\nPUBLISH\r\n$4\r\nnews\r\n$5\r\nhello\r\n"); replies[0] != ":0\r\n" {
+		t.Errorf("Expected no receiver after unsubscribing, got %q", replies[0])
+	}
+}
+
+func TestPubSub_RESP3Push(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	sub := newSubscriber(t, server)
+	sub.send(t, "*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n")
+	readReply(t, sub.reader)
+	sub.send(t, "*2\r\n$9\r\nSUBSCRIBE\r\n$4\r\nnews\r\n")
+	sub.expect(t, ">3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+
+	exchange(t, server, "*3\r\n$7\r\nPUBLISH\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+	sub.expect(t, ">3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+
+	// RESP3 connections keep running regular commands
+	sub.send(t, "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n")
+	sub.expect(t, "_\r\n")
+}
+
+func TestPubSub_SlowSubscriber(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+	server.pubsub.outputLimit = 1024
+
+	sub := newSubscriber(t, server)
+	sub.send(t, "*2\r\n$9\r\nSUBSCRIBE\r\n$4\r\nnews\r\n")
+	sub.expect(t, "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+
+	// The subscriber never reads: publishers must not block, and the subscriber gets disconnected
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			server.pubsub.publish("news", strings.Repeat("x", 100))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected publishing to a slow subscriber not to block")
+	}
+
+	waitFor(t, "the subscriber to be disconnected", func() bool {
+		return server.pubsub.publish("news", "ping") == 0
+	})
+}
@@ -0,0 +1,733 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/persistence"
+)
+
+// Replication follows the design of Redis. The primary streams every write to its replicas as RESP
+// commands, and keeps the latest part of that stream in a backlog. The position in the stream is the
+// replication offset. A replica connects with PSYNC, giving the replication ID and offset it reached:
+// it gets the missing part of the stream when the backlog still holds it, and a snapshot followed by
+// the stream otherwise. Replicas forward the stream of their primary as is, so that they can serve
+// replicas of their own with the same IDs and offsets.
+
+const (
+	defaultReplBacklogSize = 1024 * 1024
+	// replicaOutputLimit is the amount of stream buffered for a slow replica before it is disconnected.
+	replicaOutputLimit = 256 * 1024 * 1024
+	// replicationPingInterval is how often the primary sends PING in the stream, so that replicas can tell
+	// an idle primary from a broken link.
+	replicationPingInterval = 10 * time.Second
+	// replicaAckInterval is how often replicas report their offset with REPLCONF ACK.
+	replicaAckInterval = time.Second
+	// replicaRetryDelay is the time a replica waits before connecting again to its primary.
+	replicaRetryDelay  = time.Second
+	replicaDialTimeout = 5 * time.Second
+)
+
+// errReadOnly is the reply to write commands sent to a replica.
+const errReadOnly = "READONLY You can't write against a read only replica."
+
+// replicationBacklog is a ring buffer holding the latest bytes of the replication stream.
+type replicationBacklog struct {
+	buf []byte
+	// offset is the replication offset after the last byte written, histlen the number of bytes held.
+	offset  int64
+	histlen int
+}
+
+func newReplicationBacklog(size int) *replicationBacklog {
+	return &replicationBacklog{buf: make([]byte, size)}
+}
+
+func (b *replicationBacklog) write(p []byte) {
+	for len(p) > 0 {
+		n := copy(b.buf[int(b.offset%int64(len(b.buf))):], p)
+		p = p[n:]
+		b.offset += int64(n)
+		b.histlen = min(b.histlen+n, len(b.buf))
+	}
+}
+
+// readFrom returns a copy of the stream from offset on, and false when the backlog does not hold it anymore.
+func (b *replicationBacklog) readFrom(offset int64) ([]byte, bool) {
+	if offset > b.offset || offset < b.offset-int64(b.histlen) {
+		return nil, false
+	}
+	data := make([]byte, b.offset-offset)
+	start := int(offset % int64(len(b.buf)))
+	n := copy(data, b.buf[start:])
+	copy(data[n:], b.buf)
+	return data, true
+}
+
+// reset empties the backlog, which then starts at offset.
+func (b *replicationBacklog) reset(offset int64) {
+	b.offset = offset
+	b.histlen = 0
+}
+
+// replicaConn is a replica connected to this server. Its fields are guarded by replication.mu.
+type replicaConn struct {
+	c *client
+	// port is the port the replica listens on, as told by REPLCONF listening-port
+	port int
+	// online is set once the replica received its initial snapshot
+	online bool
+	// pending is the part of the stream not written to the replica yet
+	pending      [][]byte
+	pendingBytes int
+	notify       chan struct{}
+	closed       bool
+	ackOffset    int64
+	ackTime      time.Time
+}
+
+// enqueue schedules p to be written to the replica, or disconnects the replica when too much is pending.
+// Caller must hold replication.mu.
+func (r *replicaConn) enqueue(p []byte) {
+	if r.closed {
+		return
+	}
+	if r.pendingBytes+len(p) > replicaOutputLimit {
+		log.Printf("Disconnecting replica %s: output buffer limit reached\n", r.c.conn.RemoteAddr())
+		r.close()
+		return
+	}
+	r.pending = append(r.pending, p)
+	r.pendingBytes += len(p)
+	r.wake()
+}
+
+// wake signals the writer of the replica that pending changed.
+func (r *replicaConn) wake() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// close disconnects the replica. Caller must hold replication.mu.
+func (r *replicaConn) close() {
+	if !r.closed {
+		r.closed = true
+		r.c.conn.Close()
+		r.wake()
+	}
+}
+
+// primaryLink is the connection of this server, as a replica, to its primary.
+// Its fields, but host, port and done, are guarded by replication.mu.
+type primaryLink struct {
+	host string
+	port int
+	done chan struct{}
+
+	conn net.Conn
+	// connected is set while the stream is being received, syncing during the initial synchronization
+	connected bool
+	syncing   bool
+	// synced is set once a synchronization succeeded, after which reconnections try a partial one
+	synced bool
+	lastIO time.Time
+}
+
+// stop disconnects from the primary for good. Caller must hold replication.mu.
+func (l *primaryLink) stop() {
+	close(l.done)
+	if l.conn != nil {
+		l.conn.Close()
+	}
+}
+
+// replication holds the replication state of a server, as a primary and as a replica.
+type replication struct {
+	mu      sync.Mutex
+	replID  string
+	backlog *replicationBacklog
+	// replicas are the replicas connected to this server
+	replicas map[*replicaConn]struct{}
+	// link is the connection to the primary, nil when this server is a primary
+	link *primaryLink
+	// syncFull and syncPartial count the synchronizations served to replicas
+	syncFull    int64
+	syncPartial int64
+}
+
+func newReplication() *replication {
+	return &replication{
+		replID:   newReplID(),
+		backlog:  newReplicationBacklog(defaultReplBacklogSize),
+		replicas: make(map[*replicaConn]struct{}),
+	}
+}
+
+// newReplID returns a random replication ID.
+func newReplID() string {
+	id := make([]byte, 20)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// setBacklogSize replaces the backlog by an empty one of size bytes, keeping the replication offset.
+func (r *replication) setBacklogSize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	offset := r.backlog.offset
+	r.backlog = newReplicationBacklog(size)
+	r.backlog.reset(offset)
+}
+
+// isReplica reports whether the server replicates a primary.
+func (r *replication) isReplica() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.link != nil
+}
+
+// role returns "replica" when the server replicates a primary, "master" otherwise, as HELLO reports it.
+func (s *Server) role() string {
+	if s.repl.isReplica() {
+		return "replica"
+	}
+	return "master"
+}
+
+// propagate is the datastore propagator of a primary: it appends the writes to the stream.
+// Replicas only forward the stream of their primary, see forward.
+func (r *replication) propagate(args []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.link != nil {
+		return
+	}
+	r.appendStream(appendCommand(nil, args))
+}
+
+// forward appends a part of the stream received from the primary to the stream of this server.
+func (r *replication) forward(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appendStream(p)
+}
+
+// appendStream writes p to the backlog and the connected replicas. Caller must hold mu.
+func (r *replication) appendStream(p []byte) {
+	r.backlog.write(p)
+	for replica := range r.replicas {
+		replica.enqueue(p)
+	}
+}
+
+// ping appends a PING to the stream of a primary with replicas.
+func (r *replication) ping() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.link == nil && len(r.replicas) > 0 {
+		r.appendStream(appendCommand(nil, []string{"PING"}))
+	}
+}
+
+// disconnectReplicas disconnects every replica, which then synchronize again. Caller must hold mu.
+func (r *replication) disconnectReplicas() {
+	for replica := range r.replicas {
+		replica.close()
+	}
+}
+
+// resetHistory starts a new history, that of a primary after a full synchronization.
+func (r *replication) resetHistory(replID string, offset int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replID = replID
+	r.backlog.reset(offset)
+	r.disconnectReplicas()
+}
+
+// removeReplica forgets the replica of c, once its connection is closed.
+func (r *replication) removeReplica(c *client) {
+	if c.replica == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c.replica.close()
+	delete(r.replicas, c.replica)
+}
+
+// runReplica writes the stream to a replica until it disconnects.
+func (s *Server) runReplica(replica *replicaConn) {
+	writer := bufio.NewWriter(replica.c.conn)
+	for {
+		<-replica.notify
+
+		s.repl.mu.Lock()
+		pending, closed := replica.pending, replica.closed
+		replica.pending, replica.pendingBytes = nil, 0
+		s.repl.mu.Unlock()
+		if closed {
+			return
+		}
+
+		for _, p := range pending {
+			writer.Write(p)
+		}
+		if err := writer.Flush(); err != nil {
+			s.repl.mu.Lock()
+			replica.close()
+			s.repl.mu.Unlock()
+			return
+		}
+	}
+}
+
+// psyncCommand implements PSYNC replicationid offset, sent by replicas to start receiving the stream.
+// After the reply, the connection only carries the stream and the REPLCONF ACK of the replica.
+func (s *Server) psyncCommand(c *client, args [][]byte) {
+	if c.replica != nil {
+		c.writer.WriteError("ERR PSYNC already called on this connection")
+		return
+	}
+	offset, err := parseInteger(args[2])
+	if err != nil {
+		c.writer.WriteError("ERR " + err.Error())
+		return
+	}
+	replica := &replicaConn{c: c, port: c.replicaPort, notify: make(chan struct{}, 1)}
+	c.replica = replica
+
+	// Partial synchronization, from the backlog
+	s.repl.mu.Lock()
+	if string(args[1]) == s.repl.replID {
+		if missing, ok := s.repl.backlog.readFrom(offset); ok {
+			c.writer.WriteSimpleString("CONTINUE " + s.repl.replID)
+			if err := c.writer.Flush(); err != nil {
+				s.repl.mu.Unlock()
+				return
+			}
+			replica.online = true
+			s.repl.replicas[replica] = struct{}{}
+			s.repl.syncPartial++
+			if len(missing) > 0 {
+				replica.enqueue(missing)
+			}
+			s.repl.mu.Unlock()
+			go s.runReplica(replica)
+			return
+		}
+	}
+	s.repl.mu.Unlock()
+
+	// Full synchronization: a snapshot, then the stream from the offset at which the snapshot was taken
+	var snapshot bytes.Buffer
+	var replID string
+	err = persistence.WriteSnapshot(&snapshot, s.datastore, func() {
+		s.repl.mu.Lock()
+		defer s.repl.mu.Unlock()
+		replID, offset = s.repl.replID, s.repl.backlog.offset
+		s.repl.replicas[replica] = struct{}{}
+		s.repl.syncFull++
+	})
+	if err != nil {
+		log.Printf("Error taking snapshot for replica %s: %v\n", c.conn.RemoteAddr(), err)
+		c.writer.WriteError("ERR " + err.Error())
+		c.closing = true
+		return
+	}
+
+	c.writer.WriteSimpleString(fmt.Sprintf("FULLRESYNC %s %d", replID, offset))
+	// Like Redis, the snapshot is sent as a bulk string without the trailing CRLF
+	c.writer.writeLength('$', snapshot.Len())
+	c.writer.w.Write(snapshot.Bytes())
+	if err := c.writer.Flush(); err != nil {
+		return
+	}
+
+	s.repl.mu.Lock()
+	replica.online = true
+	s.repl.mu.Unlock()
+	go s.runReplica(replica)
+	// Write what was streamed while the snapshot was sent
+	replica.wake()
+}
+
+// replconfCommand implements REPLCONF, with which replicas describe themselves and acknowledge offsets.
+func (s *Server) replconfCommand(c *client, args [][]byte) {
+	if len(args)%2 == 0 {
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	for i := 1; i < len(args); i += 2 {
+		switch option := strings.ToLower(string(args[i])); option {
+		case "listening-port":
+			port, err := parseInteger(args[i+1])
+			if err != nil {
+				c.writer.WriteError("ERR " + err.Error())
+				return
+			}
+			c.replicaPort = int(port)
+		case "ack":
+			// Acknowledgements are not replied to
+			offset, err := parseInteger(args[i+1])
+			if err == nil && c.replica != nil {
+				s.repl.mu.Lock()
+				c.replica.ackOffset = offset
+				c.replica.ackTime = time.Now()
+				s.repl.mu.Unlock()
+			}
+			return
+		case "getack":
+			return
+		case "capa", "ip-address":
+		default:
+			c.writer.WriteError(fmt.Sprintf("ERR Unrecognized REPLCONF option: %s", printable(args[i])))
+			return
+		}
+	}
+	c.writer.WriteOK()
+}
+
+// replicaofCommand implements REPLICAOF host port, and REPLICAOF NO ONE which turns a replica into a primary.
+func (s *Server) replicaofCommand(c *client, args [][]byte) {
+	if c.replica != nil {
+		c.writer.WriteError("ERR Command is not valid when client is a replica.")
+		return
+	}
+	if strings.EqualFold(string(args[1]), "no") && strings.EqualFold(string(args[2]), "one") {
+		s.promote()
+		c.writer.WriteOK()
+		return
+	}
+
+	port, err := parseInteger(args[2])
+	if err != nil || port <= 0 || port > 65535 {
+		c.writer.WriteError("ERR Invalid master port")
+		return
+	}
+	if !s.follow(string(args[1]), int(port)) {
+		c.writer.WriteSimpleString("OK Already connected to specified master")
+		return
+	}
+	c.writer.WriteOK()
+}
+
+// follow makes the server a replica of host:port. It returns false when it already is.
+func (s *Server) follow(host string, port int) bool {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	if link := s.repl.link; link != nil {
+		if link.host == host && link.port == port {
+			return false
+		}
+		link.stop()
+	}
+	s.repl.disconnectReplicas()
+
+	link := &primaryLink{host: host, port: port, done: make(chan struct{})}
+	s.repl.link = link
+	log.Printf("Replicating %s:%d\n", host, port)
+	go s.runPrimaryLink(link)
+	return true
+}
+
+// promote stops replicating and makes the server a primary with a new history.
+func (s *Server) promote() {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	if s.repl.link == nil {
+		return
+	}
+	s.repl.link.stop()
+	s.repl.link = nil
+	s.repl.replID = newReplID()
+	s.repl.disconnectReplicas()
+	log.Println("Replication stopped, now a primary")
+}
+
+// runPrimaryLink synchronizes with the primary of link, reconnecting when the connection breaks,
+// until the link is stopped.
+func (s *Server) runPrimaryLink(link *primaryLink) {
+	for {
+		err := s.syncWithPrimary(link)
+		select {
+		case <-link.done:
+			return
+		default:
+		}
+		if err != nil {
+			log.Printf("Replication from %s:%d: %v\n", link.host, link.port, err)
+		}
+
+		select {
+		case <-link.done:
+			return
+		case <-time.After(replicaRetryDelay):
+		}
+	}
+}
+
+// syncWithPrimary connects to the primary, synchronizes and applies the stream until the connection breaks.
+func (s *Server) syncWithPrimary(link *primaryLink) error {
+	conn, err := s.dialPrimary(link.host, link.port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s.repl.mu.Lock()
+	select {
+	case <-link.done:
+		s.repl.mu.Unlock()
+		return nil
+	default:
+	}
+	link.conn = conn
+	link.syncing = true
+	synced, replID, offset := link.synced, s.repl.replID, s.repl.backlog.offset
+	s.repl.mu.Unlock()
+
+	defer func() {
+		s.repl.mu.Lock()
+		link.conn, link.connected, link.syncing = nil, false, false
+		s.repl.mu.Unlock()
+	}()
+
+	reader := newRESPReader(conn)
+	writer := bufio.NewWriter(conn)
+	request := func(args ...string) (string, error) {
+		writer.Write(appendCommand(nil, args))
+		if err := writer.Flush(); err != nil {
+			return "", err
+		}
+		line, err := reader.readLine()
+		if err != nil {
+			return "", err
+		}
+		if len(line) > 0 && line[0] == '-' {
+			return "", fmt.Errorf("%s replied %s", args[0], line[1:])
+		}
+		return string(line), nil
+	}
+
+	if s.primaryUser != "" || s.primaryPassword != "" {
+		user := s.primaryUser
+		if user == "" {
+			user = defaultUser
+		}
+		if _, err := request("AUTH", user, s.primaryPassword); err != nil {
+			return err
+		}
+	}
+	if _, err := request("PING"); err != nil {
+		return err
+	}
+	if _, err := request("REPLCONF", "listening-port", strconv.Itoa(s.port)); err != nil {
+		return err
+	}
+	// A partial synchronization is only possible with the history of this primary
+	if !synced {
+		replID, offset = "?", -1
+	}
+	reply, err := request("PSYNC", replID, strconv.FormatInt(offset, 10))
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(reply)
+	switch {
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid FULLRESYNC offset %q", fields[2])
+		}
+		if err := s.loadPrimarySnapshot(reader); err != nil {
+			return err
+		}
+		s.repl.resetHistory(fields[1], offset)
+		log.Printf("Full synchronization with %s:%d done\n", link.host, link.port)
+	case len(fields) >= 1 && fields[0] == "+CONTINUE":
+		log.Printf("Partial synchronization with %s:%d done\n", link.host, link.port)
+	default:
+		return fmt.Errorf("unexpected PSYNC reply %q", reply)
+	}
+
+	s.repl.mu.Lock()
+	link.synced, link.syncing, link.connected, link.lastIO = true, false, true, time.Now()
+	s.repl.mu.Unlock()
+
+	go s.acknowledgeOffsets(conn, writer)
+	return s.applyPrimaryStream(link, reader)
+}
+
+// loadPrimarySnapshot reads the snapshot sent by the primary and replaces the datastore with it.
+func (s *Server) loadPrimarySnapshot(reader *respReader) error {
+	line, err := reader.readLine()
+	if err != nil {
+		return err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return fmt.Errorf("expected snapshot, got %q", printable(line))
+	}
+	length, err := strconv.Atoi(string(line[1:]))
+	if err != nil || length < 0 {
+		return fmt.Errorf("invalid snapshot length %q", printable(line))
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader.r, data); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	entries, err := persistence.DecodeSnapshot(data)
+	if err != nil {
+		return err
+	}
+	s.datastore.Reset(entries...)
+	return nil
+}
+
+// applyPrimaryStream applies the commands streamed by the primary, and forwards them to the replicas
+// of this server, until the connection breaks.
+func (s *Server) applyPrimaryStream(link *primaryLink, reader *respReader) error {
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		command := make([]string, len(args))
+		for i, arg := range args {
+			command[i] = string(arg)
+		}
+		raw := appendCommand(nil, command)
+
+		switch strings.ToUpper(command[0]) {
+		case "PING":
+			s.repl.forward(raw)
+		default:
+			// The command is forwarded before the datastore is unlocked, so that a snapshot taken for
+			// a replica of this server never holds a write its stream offset does not include
+			err := s.datastore.ApplyThen(command, func() { s.repl.forward(raw) })
+			if err != nil {
+				log.Printf("Error applying replicated command %s: %v\n", command[0], err)
+			}
+		}
+
+		s.repl.mu.Lock()
+		link.lastIO = time.Now()
+		s.repl.mu.Unlock()
+	}
+}
+
+// acknowledgeOffsets sends REPLCONF ACK with the offset of the replica until the connection breaks.
+func (s *Server) acknowledgeOffsets(conn net.Conn, writer *bufio.Writer) {
+	ticker := time.NewTicker(replicaAckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.repl.mu.Lock()
+		offset := s.repl.backlog.offset
+		s.repl.mu.Unlock()
+
+		writer.Write(appendCommand(nil, []string{"REPLCONF", "ACK", strconv.FormatInt(offset, 10)}))
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// dialPrimary connects to a primary, with TLS when the server itself uses TLS.
+func (s *Server) dialPrimary(host string, port int) (net.Conn, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: replicaDialTimeout}
+	if s.ssl && s.certs != nil {
+		return tls.DialWithDialer(dialer, "tcp", address, s.certs.clientConfig(host))
+	}
+	return dialer.Dial("tcp", address)
+}
+
+// replicationInfo describes the replication state for INFO replication.
+func (s *Server) replicationInfo() string {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+
+	var info strings.Builder
+	info.WriteString("# Replication\r\n")
+	if link := s.repl.link; link != nil {
+		status, lastIO := "down", int64(-1)
+		if link.connected {
+			status, lastIO = "up", int64(time.Since(link.lastIO).Seconds())
+		}
+		fmt.Fprintf(&info, "role:slave\r\nmaster_host:%s\r\nmaster_port:%d\r\n", link.host, link.port)
+		fmt.Fprintf(&info, "master_link_status:%s\r\nmaster_last_io_seconds_ago:%d\r\n", status, lastIO)
+		fmt.Fprintf(&info, "master_sync_in_progress:%d\r\n", boolToInt(link.syncing))
+		fmt.Fprintf(&info, "slave_repl_offset:%d\r\nslave_read_only:1\r\n", s.repl.backlog.offset)
+	} else {
+		info.WriteString("role:master\r\n")
+	}
+
+	fmt.Fprintf(&info, "connected_slaves:%d\r\n", len(s.repl.replicas))
+	i := 0
+	for replica := range s.repl.replicas {
+		state, lag := "wait_bgsave", int64(-1)
+		if replica.online {
+			state = "online"
+		}
+		if !replica.ackTime.IsZero() {
+			lag = int64(time.Since(replica.ackTime).Seconds())
+		}
+		ip, _, _ := net.SplitHostPort(replica.c.conn.RemoteAddr().String())
+		fmt.Fprintf(&info, "slave%d:ip=%s,port=%d,state=%s,offset=%d,lag=%d\r\n", i, ip, replica.port, state, replica.ackOffset, lag)
+		i++
+	}
+
+	backlog := s.repl.backlog
+	fmt.Fprintf(&info, "master_replid:%s\r\nmaster_repl_offset:%d\r\n", s.repl.replID, backlog.offset)
+	fmt.Fprintf(&info, "repl_backlog_active:1\r\nrepl_backlog_size:%d\r\n", len(backlog.buf))
+	fmt.Fprintf(&info, "repl_backlog_first_byte_offset:%d\r\nrepl_backlog_histlen:%d\r\n", backlog.offset-int64(backlog.histlen), backlog.histlen)
+	return info.String()
+}
+
+// statsInfo describes the synchronizations served, for INFO stats.
+func (s *Server) statsInfo() string {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	return fmt.Sprintf("# Stats\r\nsync_full:%d\r\nsync_partial_ok:%d\r\n", s.repl.syncFull, s.repl.syncPartial)
+}
+
+// appendCommand appends args encoded as a RESP array of bulk strings to buf.
+func appendCommand(buf []byte, args []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
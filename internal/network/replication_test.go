@@ -0,0 +1,182 @@
+package network
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestReplicationBacklog(t *testing.T) {
+	b := newReplicationBacklog(8)
+	b.write([]byte("abcde"))
+
+	if data, ok := b.readFrom(2); !ok || string(data) != "cde" {
+		t.Errorf("Expected \"cde\" from offset 2, got %q, %v", data, ok)
+	}
+	if data, ok := b.readFrom(5); !ok || len(data) != 0 {
+		t.Errorf("Expected nothing missing at the current offset, got %q, %v", data, ok)
+	}
+	if _, ok := b.readFrom(6); ok {
+		t.Error("Expected an offset past the stream to be refused")
+	}
+
+	// Wrap around, dropping the first bytes
+	b.write([]byte("fghijk"))
+	if data, ok := b.readFrom(3); !ok || string(data) != "defghijk" {
+		t.Errorf("Expected \"defghijk\" from offset 3, got %q, %v", data, ok)
+	}
+	if _, ok := b.readFrom(2); ok {
+		t.Error("Expected an offset older than the backlog to be refused")
+	}
+
+	b.reset(100)
+	if _, ok := b.readFrom(99); ok || b.offset != 100 {
+		t.Error("Expected a reset backlog to hold nothing")
+	}
+}
+
+// serve accepts RESP connections for server on a random local port, which it returns.
+func serve(t *testing.T, server *Server) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error listening, got %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go server.handleConnection(conn)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// waitFor fails the test when condition does not hold within a few seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func hasValue(ds *datastore.DataStore, key, expected string) func() bool {
+	return func() bool {
+		value, err := ds.Get(key)
+		return err == nil && value == expected
+	}
+}
+
+func TestReplication_Sync(t *testing.T) {
+	primaryStore := datastore.NewDataStore()
+	primary := NewServer(primaryStore)
+	port := serve(t, primary)
+	primaryStore.Set("before", "snapshot")
+
+	replicaStore := datastore.NewDataStore()
+	replicaStore.Set("stale", "value")
+	replica := NewServer(replicaStore)
+	defer replica.promote()
+
+	replies := exchange(t, replica, string(appendCommand(nil, []string{"REPLICAOF", "127.0.0.1", strconv.Itoa(port)})))
+	if replies[0] != "+OK\r\n" {
+		t.Fatalf("Expected REPLICAOF to reply OK, got %q", replies[0])
+	}
+
+	// Full synchronization, replacing the content of the replica
+	waitFor(t, "the snapshot", hasValue(replicaStore, "before", "snapshot"))
+	if _, err := replicaStore.Get("stale"); err == nil {
+		t.Error("Expected the full synchronization to drop the keys of the replica")
+	}
+
+	// Streamed writes
+	primaryStore.Set("after", "stream")
+	primaryStore.ExpireAt("after", time.Now().Add(time.Hour))
+	waitFor(t, "the stream", hasValue(replicaStore, "after", "stream"))
+	waitFor(t, "the deadline", func() bool {
+		ttl, err := replicaStore.TTL("after")
+		return err == nil && ttl > 0
+	})
+
+	replies = exchange(t, replica,
+		"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n",
+		"*2\r\n$3\r\nGET\r\n$5\r\nafter\r\n",
+		"*2\r\n$4\r\nINFO\r\n$11\r\nreplication\r\n",
+	)
+	if replies[0] != "-"+errReadOnly+"\r\n" {
+		t.Errorf("Expected the replica to refuse writes, got %q", replies[0])
+	}
+	if replies[1] != "$6\r\nstream\r\n" {
+		t.Errorf("Expected the replica to serve reads, got %q", replies[1])
+	}
+	if !strings.Contains(replies[2], "role:slave\r\n") || !strings.Contains(replies[2], "master_link_status:up\r\n") {
+		t.Errorf("Expected INFO to describe a connected replica, got %q", replies[2])
+	}
+
+	info := exchange(t, primary, "*1\r\n$4\r\nINFO\r\n")[0]
+	if !strings.Contains(info, "role:master\r\n") || !strings.Contains(info, "connected_slaves:1\r\n") {
+		t.Errorf("Expected INFO to describe a primary with a replica, got %q", info)
+	}
+
+	// Partial synchronization after the link breaks
+	replica.repl.mu.Lock()
+	replica.repl.link.conn.Close()
+	replica.repl.mu.Unlock()
+	primaryStore.Set("during", "disconnection")
+	waitFor(t, "the partial synchronization", hasValue(replicaStore, "during", "disconnection"))
+
+	primary.repl.mu.Lock()
+	full, partial := primary.repl.syncFull, primary.repl.syncPartial
+	primary.repl.mu.Unlock()
+	if full != 1 || partial != 1 {
+		t.Errorf("Expected 1 full and 1 partial synchronization, got %d and %d", full, partial)
+	}
+
+	// Promotion
+	replies = exchange(t, replica,
+		"*3\r\n$9\r\nREPLICAOF\r\n$2\r\nNO\r\n$3\r\nONE\r\n",
+		"*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n",
+	)
+	if replies[0] != "+OK\r\n" || replies[1] != "+OK\r\n" {
+		t.Errorf("Expected a promoted replica to accept writes, got %q", replies)
+	}
+}
+
+func TestReplication_Chained(t *testing.T) {
+	primaryStore := datastore.NewDataStore()
+	primary := NewServer(primaryStore)
+	primaryPort := serve(t, primary)
+
+	middleStore := datastore.NewDataStore()
+	middle := NewServer(middleStore)
+	middlePort := serve(t, middle)
+	middle.follow("127.0.0.1", primaryPort)
+	defer middle.promote()
+
+	leafStore := datastore.NewDataStore()
+	leaf := NewServer(leafStore)
+	leaf.follow("127.0.0.1", middlePort)
+	defer leaf.promote()
+
+	primaryStore.Set("key", "value")
+	waitFor(t, "the chained stream", hasValue(leafStore, "key", "value"))
+
+	waitFor(t, "matching offsets", func() bool {
+		primary.repl.mu.Lock()
+		defer primary.repl.mu.Unlock()
+		leaf.repl.mu.Lock()
+		defer leaf.repl.mu.Unlock()
+		return primary.repl.backlog.offset == leaf.repl.backlog.offset && primary.repl.replID == leaf.repl.replID
+	})
+}
@@ -0,0 +1,396 @@
+package network
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxMultiBulkLength bounds the number of arguments of a single command.
+	maxMultiBulkLength = 1024 * 1024
+	// defaultMaxBulkLength bounds the size of a single argument, like Redis' proto-max-bulk-len.
+	defaultMaxBulkLength = 512 * 1024 * 1024
+	// bulkChunkSize is the amount of memory committed at once while reading a bulk string.
+	bulkChunkSize = 1024 * 1024
+	// maxInlineLength bounds the size of an inline command line.
+	maxInlineLength = 64 * 1024
+)
+
+// ProtocolError is returned by respReader when a client sends malformed data.
+// The connection cannot be resynchronized after a protocol error and must be closed.
+type ProtocolError struct {
+	Message string
+}
+
+func (e *ProtocolError) Error() string { return "Protocol error: " + e.Message }
+
+// respReader reads commands sent with the RESP protocol: multi-bulk arrays of bulk strings,
+// or inline commands made of space separated words for telnet-like clients.
+type respReader struct {
+	r *bufio.Reader
+	// maxBulkLength bounds the size of a single argument.
+	maxBulkLength int
+}
+
+func newRESPReader(r io.Reader) *respReader {
+	return &respReader{r: bufio.NewReader(r), maxBulkLength: defaultMaxBulkLength}
+}
+
+// ReadCommand reads the next command and returns its arguments. An empty command is returned for blank inline lines.
+func (r *respReader) ReadCommand() ([][]byte, error) {
+	prefix, err := r.r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if prefix[0] != '*' {
+		return r.readInline()
+	}
+
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(string(line[1:]))
+	if err != nil || count > maxMultiBulkLength {
+		return nil, &ProtocolError{Message: "invalid multibulk length"}
+	}
+	if count <= 0 {
+		return [][]byte{}, nil
+	}
+
+	args := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		arg, err := r.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readBulk reads a single "$<length>\r\n<bytes>\r\n" bulk string.
+func (r *respReader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, &ProtocolError{Message: fmt.Sprintf("expected '$', got '%s'", printable(line))}
+	}
+	length, err := strconv.Atoi(string(line[1:]))
+	if err != nil || length < 0 || length > r.maxBulkLength {
+		return nil, &ProtocolError{Message: "invalid bulk length"}
+	}
+
+	// The buffer grows as data arrives, so that a client announcing a huge
+	// bulk string cannot make the server allocate it upfront.
+	buf := make([]byte, 0, min(length, bulkChunkSize))
+	for len(buf) < length {
+		chunk := min(length-len(buf), bulkChunkSize)
+		buf = slices.Grow(buf, chunk)
+		n, err := io.ReadFull(r.r, buf[len(buf):len(buf)+chunk])
+		buf = buf[:len(buf)+n]
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+
+	var crlf [2]byte
+	if _, err := io.ReadFull(r.r, crlf[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if crlf[0] != '\r' || crlf[1] != '\n' {
+		return nil, &ProtocolError{Message: "bulk string is not terminated by CRLF"}
+	}
+	return buf, nil
+}
+
+// readInline reads a command written as a single line of space separated words.
+func (r *respReader) readInline() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(line))
+	args := make([][]byte, len(fields))
+	for i, field := range fields {
+		args[i] = []byte(field)
+	}
+	return args, nil
+}
+
+// readLine reads a line terminated by "\r\n" or "\n" and returns it without the terminator.
+func (r *respReader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// Lines longer than the reader buffer are only expected for inline commands
+		full := append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull && len(full) <= maxInlineLength {
+			line, err = r.r.ReadSlice('\n')
+			full = append(full, line...)
+		}
+		if err == bufio.ErrBufferFull {
+			return nil, &ProtocolError{Message: "too big inline request"}
+		}
+		line = full
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// unexpectedEOF turns an EOF in the middle of a command into io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// printable truncates data for use in error messages.
+func printable(data []byte) string {
+	if len(data) > 32 {
+		data = data[:32]
+	}
+	quoted := strconv.Quote(string(data))
+	return quoted[1 : len(quoted)-1]
+}
+
+// respWriter writes replies with the RESP protocol. RESP3 only types, such as maps, doubles and nulls,
+// are downgraded to their RESP2 equivalent when the client did not negotiate RESP3 with HELLO.
+type respWriter struct {
+	w     *bufio.Writer
+	proto int
+}
+
+func newRESPWriter(w io.Writer) *respWriter {
+	return &respWriter{w: bufio.NewWriter(w), proto: 2}
+}
+
+func (w *respWriter) Flush() error { return w.w.Flush() }
+
+// WriteSimpleString writes a status reply such as "+OK".
+func (w *respWriter) WriteSimpleString(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) WriteOK() { w.WriteSimpleString("OK") }
+
+// WriteError writes an error reply. The message should start with an error code such as "ERR" or "WRONGTYPE".
+func (w *respWriter) WriteError(message string) {
+	w.w.WriteByte('-')
+	// Error replies cannot span several lines
+	w.w.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(message))
+	w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) WriteInteger(n int64) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) WriteBulk(b []byte) {
+	w.writeLength('$', len(b))
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) WriteBulkString(s string) {
+	w.writeLength('$', len(s))
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// WriteNull writes the null reply, a null bulk string in RESP2.
+func (w *respWriter) WriteNull() {
+	if w.proto >= 3 {
+		w.w.WriteString("_\r\n")
+	} else {
+		w.w.WriteString("$-1\r\n")
+	}
+}
+
+// WriteNullArray writes the null reply, a null array in RESP2.
+func (w *respWriter) WriteNullArray() {
+	if w.proto >= 3 {
+		w.w.WriteString("_\r\n")
+	} else {
+		w.w.WriteString("*-1\r\n")
+	}
+}
+
+func (w *respWriter) WriteArrayHeader(n int) { w.writeLength('*', n) }
+
+// WriteMapHeader starts a map of n key-value pairs, a flat array of 2*n elements in RESP2.
+func (w *respWriter) WriteMapHeader(n int) {
+	if w.proto >= 3 {
+		w.writeLength('%', n)
+	} else {
+		w.writeLength('*', 2*n)
+	}
+}
+
+// WriteSetHeader starts a set of n elements, a plain array in RESP2.
+func (w *respWriter) WriteSetHeader(n int) {
+	if w.proto >= 3 {
+		w.writeLength('~', n)
+	} else {
+		w.writeLength('*', n)
+	}
+}
+
+// WritePushHeader starts an out-of-band message of n elements, such as a pub/sub message, a plain array in RESP2.
+func (w *respWriter) WritePushHeader(n int) {
+	if w.proto >= 3 {
+		w.writeLength('>', n)
+	} else {
+		w.writeLength('*', n)
+	}
+}
+
+// WriteDouble writes a floating point number, a bulk string in RESP2.
+func (w *respWriter) WriteDouble(f float64) {
+	formatted := formatFloat(f)
+	if w.proto >= 3 {
+		w.w.WriteByte(',')
+		w.w.WriteString(formatted)
+		w.w.WriteString("\r\n")
+	} else {
+		w.WriteBulkString(formatted)
+	}
+}
+
+// WriteBool writes a boolean, the integer 1 or 0 in RESP2.
+func (w *respWriter) WriteBool(b bool) {
+	switch {
+	case w.proto >= 3 && b:
+		w.w.WriteString("#t\r\n")
+	case w.proto >= 3:
+		w.w.WriteString("#f\r\n")
+	case b:
+		w.WriteInteger(1)
+	default:
+		w.WriteInteger(0)
+	}
+}
+
+// WriteStringArray writes an array of bulk strings.
+func (w *respWriter) WriteStringArray(values []string) {
+	w.WriteArrayHeader(len(values))
+	for _, value := range values {
+		w.WriteBulkString(value)
+	}
+}
+
+// WriteValue writes a value held by the datastore, picking the reply type from its Go type.
+func (w *respWriter) WriteValue(value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		w.WriteNull()
+	case string:
+		w.WriteBulkString(v)
+	case []byte:
+		w.WriteBulk(v)
+	case int:
+		w.WriteInteger(int64(v))
+	case int8:
+		w.WriteInteger(int64(v))
+	case int16:
+		w.WriteInteger(int64(v))
+	case int32:
+		w.WriteInteger(int64(v))
+	case int64:
+		w.WriteInteger(v)
+	case uint8:
+		w.WriteInteger(int64(v))
+	case uint16:
+		w.WriteInteger(int64(v))
+	case uint32:
+		w.WriteInteger(int64(v))
+	case uint:
+		w.writeUnsigned(uint64(v))
+	case uint64:
+		w.writeUnsigned(v)
+	case float32:
+		w.WriteDouble(float64(v))
+	case float64:
+		w.WriteDouble(v)
+	case bool:
+		w.WriteBool(v)
+	case error:
+		w.WriteError(v.Error())
+	case []string:
+		w.WriteStringArray(v)
+	case []interface{}:
+		w.WriteArrayHeader(len(v))
+		for _, element := range v {
+			w.WriteValue(element)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		w.WriteMapHeader(len(keys))
+		for _, key := range keys {
+			w.WriteBulkString(key)
+			w.WriteValue(v[key])
+		}
+	case fmt.Stringer:
+		w.WriteBulkString(v.String())
+	default:
+		w.WriteBulkString(fmt.Sprint(v))
+	}
+}
+
+// writeUnsigned writes n as an integer, or as a bulk string when it does not fit in a signed integer.
+func (w *respWriter) writeUnsigned(n uint64) {
+	if n > math.MaxInt64 {
+		w.WriteBulkString(strconv.FormatUint(n, 10))
+		return
+	}
+	w.WriteInteger(int64(n))
+}
+
+func (w *respWriter) writeLength(prefix byte, n int) {
+	w.w.WriteByte(prefix)
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+// formatFloat formats f the way Redis does: the shortest representation, and inf/-inf/nan for special values.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	default:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+}
+
+// isProtocolError reports whether err was caused by malformed client data.
+func isProtocolError(err error) bool {
+	var protocolErr *ProtocolError
+	return errors.As(err, &protocolErr)
+}
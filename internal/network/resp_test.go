@@ -0,0 +1,286 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestRESPReader_MultiBulk(t *testing.T) {
+	r := newRESPReader(strings.NewReader("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$12\r\nhello\r\nworld\r\n"))
+
+	args, err := r.ReadCommand()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []string{"SET", "key", "hello\r\nworld"}
+	if len(args) != len(expected) {
+		t.Fatalf("Expected %d arguments, got %d", len(expected), len(args))
+	}
+	for i, arg := range args {
+		if string(arg) != expected[i] {
+			t.Errorf("Expected argument %d to be %q, got %q", i, expected[i], arg)
+		}
+	}
+}
+
+func TestRESPReader_Inline(t *testing.T) {
+	r := newRESPReader(strings.NewReader("GET  key\r\n\nPING\n"))
+
+	args, _ := r.ReadCommand()
+	if len(args) != 2 || string(args[0]) != "GET" || string(args[1]) != "key" {
+		t.Errorf("Expected [GET key], got %q", args)
+	}
+	if args, _ = r.ReadCommand(); len(args) != 0 {
+		t.Errorf("Expected an empty command for a blank line, got %q", args)
+	}
+	if args, _ = r.ReadCommand(); len(args) != 1 || string(args[0]) != "PING" {
+		t.Errorf("Expected [PING], got %q", args)
+	}
+	if _, err := r.ReadCommand(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+func TestRESPReader_ProtocolErrors(t *testing.T) {
+	inputs := []string{
+		"*x\r\n",
+		"*1\r\n:1\r\n",
+		"*1\r\n$-5\r\n",
+		"*1\r\n$3\r\nabcd\r\n",
+	}
+	for _, input := range inputs {
+		if _, err := newRESPReader(strings.NewReader(input)).ReadCommand(); !isProtocolError(err) {
+			t.Errorf("Expected a protocol error for %q, got %v", input, err)
+		}
+	}
+
+	if _, err := newRESPReader(strings.NewReader("*2\r\n$3\r\nGET\r\n")).ReadCommand(); err != io.EOF {
+		t.Errorf("Expected EOF for a truncated command, got %v", err)
+	}
+}
+
+func TestRESPWriter_Types(t *testing.T) {
+	tests := []struct {
+		proto    int
+		value    interface{}
+		expected string
+	}{
+		{2, "value", "$5\r\nvalue\r\n"},
+		{2, []byte("bytes"), "$5\r\nbytes\r\n"},
+		{2, 42, ":42\r\n"},
+		{2, nil, "$-1\r\n"},
+		{3, nil, "_\r\n"},
+		{2, 1.5, "$3\r\n1.5\r\n"},
+		{3, 1.5, ",1.5\r\n"},
+		{3, true, "#t\r\n"},
+		{2, map[string]interface{}{"a": "1"}, "*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{3, map[string]interface{}{"a": "1"}, "%1\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{2, []interface{}{"a", 1}, "*2\r\n$1\r\na\r\n:1\r\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := newRESPWriter(&buf)
+		w.proto = tt.proto
+		w.WriteValue(tt.value)
+		w.Flush()
+		if buf.String() != tt.expected {
+			t.Errorf("Expected %v in RESP%d to be written as %q, got %q", tt.value, tt.proto, tt.expected, buf.String())
+		}
+	}
+}
+
+// exchange sends each command to a RESP connection handled by server and returns the raw replies.
+func exchange(t *testing.T, server *Server, commands ...string) []string {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go server.handleConnection(serverConn)
+
+	reader := bufio.NewReader(clientConn)
+	replies := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		if _, err := clientConn.Write([]byte(cmd)); err != nil {
+			t.Fatalf("Expected no error writing %q, got %v", cmd, err)
+		}
+		replies = append(replies, readReply(t, reader))
+	}
+	return replies
+}
+
+// readReply reads a single RESP reply, including nested aggregates.
+func readReply(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Expected a reply, got %v", err)
+	}
+	switch line[0] {
+	case '$':
+		if line == "$-1\r\n" {
+			return line
+		}
+		n := 0
+		for _, ch := range line[1 : len(line)-2] {
+			n = n*10 + int(ch-'0')
+		}
+		buf := make([]byte, n+2)
+		io.ReadFull(r, buf)
+		return line + string(buf)
+	case '*', '%', '~', '>':
+		n := 0
+		for _, ch := range line[1 : len(line)-2] {
+			n = n*10 + int(ch-'0')
+		}
+		if line[0] == '%' {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			line += readReply(t, r)
+		}
+	}
+	return line
+}
+
+func TestServer_RESPCommands(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"*1\r\n$4\r\nPING\r\n",
+		"*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n",
+		"*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n",
+		"*2\r\n$3\r\nGET\r\n$7\r\nmissing\r\n",
+		"*5\r\n$3\r\nSET\r\n$3\r\ntmp\r\n$1\r\nv\r\n$2\r\nEX\r\n$3\r\n100\r\n",
+		"*2\r\n$3\r\nTTL\r\n$3\r\ntmp\r\n",
+		"*3\r\n$3\r\nDEL\r\n$3\r\ntmp\r\n$7\r\nmissing\r\n",
+		"*1\r\n$7\r\nUNKNOWN\r\n",
+		"*1\r\n$3\r\nGET\r\n",
+		"EXISTS key\r\n",
+	)
+	expected := []string{
+		"+PONG\r\n",
+		"+OK\r\n",
+		"$5\r\nvalue\r\n",
+		"$-1\r\n",
+		"+OK\r\n",
+		":100\r\n",
+		":1\r\n",
+		"-ERR unknown command 'UNKNOWN'\r\n",
+		"-ERR wrong number of arguments for 'get' command\r\n",
+		":1\r\n",
+	}
+	for i := range expected {
+		if replies[i] != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], replies[i])
+		}
+	}
+}
+
+func TestServer_Hello(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"*2\r\n$5\r\nHELLO\r\n$1\r\n4\r\n",
+		"*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n",
+		"*2\r\n$3\r\nGET\r\n$7\r\nmissing\r\n",
+	)
+	if replies[0] != "-NOPROTO unsupported protocol version\r\n" {
+		t.Errorf("Expected NOPROTO for protocol 4, got %q", replies[0])
+	}
+	if !strings.HasPrefix(replies[1], "%7\r\n") || !strings.Contains(replies[1], "$5\r\nproto\r\n:3\r\n") {
+		t.Errorf("Expected a RESP3 map describing the server, got %q", replies[1])
+	}
+	if replies[2] != "_\r\n" {
+		t.Errorf("Expected the RESP3 null after HELLO 3, got %q", replies[2])
+	}
+}
+
+func TestRESPReader_LargeBinaryBulk(t *testing.T) {
+	value := bytes.Repeat([]byte{0, '\r', '\n', 0xff}, 2*1024*1024) // 8MB of binary data
+	var request bytes.Buffer
+	request.WriteString("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n")
+	request.WriteString("$" + strconv.Itoa(len(value)) + "\r\n")
+	request.Write(value)
+	request.WriteString("\r\n")
+
+	args, err := newRESPReader(&request).ReadCommand()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.Equal(args[2], value) {
+		t.Errorf("Expected the binary value to be read unchanged")
+	}
+}
+
+func TestRESPReader_MaxBulkLength(t *testing.T) {
+	r := newRESPReader(strings.NewReader("*1\r\n$1000\r\n"))
+	r.maxBulkLength = 10
+
+	if _, err := r.ReadCommand(); !isProtocolError(err) {
+		t.Errorf("Expected a protocol error for a bulk string over the limit, got %v", err)
+	}
+}
+
+func TestServer_BinaryValues(t *testing.T) {
+	ds := datastore.NewDataStore()
+	ds.Set("number", 45)
+	server := NewServer(ds)
+
+	replies := exchange(t, server,
+		"*3\r\n$3\r\nSET\r\n$5\r\nk\r\ney\r\n$4\r\n\x00\r\n\xff\r\n",
+		"*2\r\n$3\r\nGET\r\n$5\r\nk\r\ney\r\n",
+		"*2\r\n$3\r\nGET\r\n$6\r\nnumber\r\n",
+	)
+	if replies[1] != "$4\r\n\x00\r\n\xff\r\n" {
+		t.Errorf("Expected the binary value back, got %q", replies[1])
+	}
+	if replies[2] != ":45\r\n" {
+		t.Errorf("Expected an integer reply for an integer value, got %q", replies[2])
+	}
+}
+
+// countingConn counts the writes to a connection.
+type countingConn struct {
+	net.Conn
+	writes atomic.Int64
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(p)
+}
+
+func TestServer_Pipelining(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	conn := &countingConn{Conn: serverConn}
+	go server.handleConnection(conn)
+
+	// The commands are read at once, so their replies are written at once
+	clientConn.Write([]byte("SET a 1\r\nGET a\r\nMSET b 2 c 3\r\nMGET a b c\r\nDEL a b c\r\n"))
+	reader := bufio.NewReader(clientConn)
+	expected := []string{"+OK\r\n", "$1\r\n1\r\n", "+OK\r\n", "*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n", ":3\r\n"}
+	for i, want := range expected {
+		if reply := readReply(t, reader); reply != want {
+			t.Errorf("Expected reply %d to be %q, got %q", i, want, reply)
+		}
+	}
+	if writes := conn.writes.Load(); writes != 1 {
+		t.Errorf("Expected the replies of the pipeline to be written at once, got %d writes", writes)
+	}
+
+	// Replies pipelined before a blocking command are not held back while it waits
+	clientConn.Write([]byte("PING\r\nBLPOP queue 0\r\n"))
+	if reply := readReply(t, reader); reply != "+PONG\r\n" {
+		t.Errorf("Expected the reply to PING, got %q", reply)
+	}
+}
@@ -1,96 +1,357 @@
 package network
 
 import (
-	"bufio"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"os"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/AbdessamadEnabih/Vertex/pkg/persistence"
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
 	"github.com/AbdessamadEnabih/Vertex/pkg/config"
 	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	"github.com/AbdessamadEnabih/Vertex/pkg/persistence"
+)
+
+// Connection settings used when the configuration sets none
+const (
+	defaultMaxClients   = 10000
+	defaultTCPKeepAlive = 300 * time.Second
+)
+
+// Protocols spoken by the server, selected with the server.protocol configuration key
+const (
+	ProtocolRESP   = "resp"
+	ProtocolLegacy = "legacy"
 )
 
 type Server struct {
-	datastore *datastore.DataStore
+	datastore     *datastore.DataStore
+	protocol      string
+	maxBulkLength int
+	nextID        *atomic.Int64
+	// aof logs every write when append-only persistence is enabled, and queueLog every change of the
+	// queues, nil otherwise
+	aof      *persistence.AOF
+	queueLog *persistence.AOF
+	// snapshotter saves the datastore, nil when persistence is disabled
+	snapshotter *persistence.Snapshotter
+	repl        *replication
+	pubsub      *pubsub
+	// broker holds the work queues, loaded from the queue log on Start
+	broker *queue.Broker
+	// port and ssl are those the server listens with, which replicas also use to reach their primary
+	port int
+	ssl  bool
+	// certs are the TLS certificates of the server, nil when it serves no TLS connection
+	certs *certificates
+	// txn is set on the copies of the server running the commands of a transaction, see withDataStore
+	txn bool
+	// acl holds the users clients authenticate as
+	acl *acl
+	// primaryUser and primaryPassword authenticate the server to its primary, when it is a replica
+	primaryUser, primaryPassword string
+	// life tracks the listeners and connections, to stop the server gracefully
+	life *lifecycle
+	// clients holds the clients connected with the RESP protocol
+	clients *clientRegistry
+	// maxClients bounds the connections served at once, idleTimeout closes the connections sending no
+	// command for that long and readTimeout those taking longer to send a command, zero meaning no timeout
+	maxClients  int
+	idleTimeout time.Duration
+	readTimeout time.Duration
 }
 
 // NewServer creates a new server instance
 func NewServer(datastore *datastore.DataStore) *Server {
-	return &Server{datastore: datastore}
+	s := &Server{datastore: datastore, nextID: new(atomic.Int64), protocol: ProtocolRESP, maxBulkLength: defaultMaxBulkLength, repl: newReplication(), pubsub: newPubSub(), broker: queue.NewBroker(queue.Options{}), acl: newACL(), life: newLifecycle(), clients: newClientRegistry(), maxClients: defaultMaxClients}
+	datastore.AddPropagator(s.repl.propagate)
+	return s
 }
 
-// getServerConfiguration returns the server configuration from the config file
-func getServerConfiguration() (string, int, bool) {
+// serverConfiguration holds the settings of the server section of the config file
+type serverConfiguration struct {
+	address string
+	port    int
+	ssl     bool
+	// tlsPort, when set, is a port serving TLS connections in addition to port
+	tlsPort       int
+	tls           tlsConfiguration
+	protocol      string
+	maxBulkLength int
+	// replicaOf is the "<host> <port>" of the primary to replicate, empty for a primary
+	replicaOf       string
+	replBacklogSize int
+	// pubsubOutputLimit bounds the messages waiting to be written to a subscriber
+	pubsubOutputLimit int
+	primaryUser       string
+	primaryPassword   string
+	maxClients        int
+	idleTimeout       time.Duration
+	readTimeout       time.Duration
+	// tcpKeepAlive is the period of TCP keepalive probes, negative to disable them
+	tcpKeepAlive time.Duration
+}
+
+// getServerConfiguration returns the server configuration from the config file. Invalid TLS settings
+// are an error rather than replaced by defaults.
+func getServerConfiguration() (serverConfiguration, error) {
+	conf := serverConfiguration{
+		address:         "0.0.0.0",
+		port:            6380,
+		protocol:        ProtocolRESP,
+		maxBulkLength:   defaultMaxBulkLength,
+		replBacklogSize: defaultReplBacklogSize,
+
+		pubsubOutputLimit: defaultPubSubOutputLimit,
+		maxClients:        defaultMaxClients,
+		tcpKeepAlive:      defaultTCPKeepAlive,
+	}
 	serverConfig, err := config.GetConfigByField("Server")
 	if err != nil {
 		log.Printf("Error while loading Server configuration: %s", err)
-		return "0.0.0.0", 6380, false
+		return conf, nil
 	}
-	return reflect.ValueOf(serverConfig).FieldByName("Adress").String(), int(reflect.ValueOf(serverConfig).FieldByName("Port").Int()), reflect.ValueOf(serverConfig).FieldByName("SSL").Bool()
-}
 
-// generateTLSConfig generates a TLS configuration for the server
-func generateTLSConfig() *tls.Config {
-	cert, err := tls.LoadX509KeyPair("certs/server.crt", "certs/server.key")
-	if err != nil {
-		log.Fatalf("Error loading certificate: %v", err)
+	v := reflect.ValueOf(serverConfig)
+	conf.address = v.FieldByName("Adress").String()
+	conf.port = int(v.FieldByName("Port").Int())
+	conf.ssl = v.FieldByName("SSL").Bool()
+	conf.tlsPort = int(v.FieldByName("TLSPort").Int())
+	if conf.tls, err = parseTLSConfiguration(v); err != nil {
+		return conf, err
+	}
+	if protocol := strings.ToLower(v.FieldByName("Protocol").String()); protocol != "" {
+		conf.protocol = protocol
+	}
+	if maxBulkLength := v.FieldByName("MaxBulkLength").String(); maxBulkLength != "" {
+		size, err := config.ParseSize(maxBulkLength)
+		if err != nil || size <= 0 {
+			log.Printf("Invalid max_bulk_length %q, using the default", maxBulkLength)
+		} else {
+			conf.maxBulkLength = int(size)
+		}
+	}
+	conf.replicaOf = strings.TrimSpace(v.FieldByName("ReplicaOf").String())
+	if backlogSize := v.FieldByName("ReplBacklogSize").String(); backlogSize != "" {
+		size, err := config.ParseSize(backlogSize)
+		if err != nil || size <= 0 {
+			log.Printf("Invalid repl_backlog_size %q, using the default", backlogSize)
+		} else {
+			conf.replBacklogSize = int(size)
+		}
+	}
+	if outputLimit := v.FieldByName("PubSubOutputBufferLimit").String(); outputLimit != "" {
+		size, err := config.ParseSize(outputLimit)
+		if err != nil || size <= 0 {
+			log.Printf("Invalid pubsub_output_buffer_limit %q, using the default", outputLimit)
+		} else {
+			conf.pubsubOutputLimit = int(size)
+		}
+	}
+	conf.primaryUser = v.FieldByName("PrimaryUser").String()
+	conf.primaryPassword = v.FieldByName("PrimaryPassword").String()
+	if maxClients := int(v.FieldByName("MaxClients").Int()); maxClients > 0 {
+		conf.maxClients = maxClients
+	}
+	for _, timeout := range []struct {
+		key, field string
+		value      *time.Duration
+	}{
+		{"idle_timeout", "IdleTimeout", &conf.idleTimeout},
+		{"read_timeout", "ReadTimeout", &conf.readTimeout},
+		{"tcp_keepalive", "TCPKeepAlive", &conf.tcpKeepAlive},
+	} {
+		setting := v.FieldByName(timeout.field).String()
+		if setting == "" {
+			continue
+		}
+		if d, err := config.ParseDuration(setting); err != nil {
+			log.Printf("Invalid %s %q, using the default", timeout.key, setting)
+		} else {
+			*timeout.value = d
+		}
+	}
+	if conf.tcpKeepAlive == 0 {
+		conf.tcpKeepAlive = -1
 	}
+	return conf, nil
+}
 
-	caCert, err := os.ReadFile("certs/ca.crt")
+// getACLConfiguration returns the users of the acl section of the config file.
+func getACLConfiguration() (*acl, error) {
+	aclConfig, err := config.GetConfigByField("ACL")
 	if err != nil {
-		log.Fatalf("Error loading CA certificate: %v", err)
+		log.Printf("Error while loading ACL configuration: %s", err)
+		return newACL(), nil
 	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
-
-	return &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ClientCAs:    caCertPool,
-		ClientAuth:   tls.RequireAndVerifyClientCert,
+	users, _ := reflect.ValueOf(aclConfig).FieldByName("Users").Interface().([]config.ACLUser)
+	loaded, err := loadACL(users)
+	if err != nil {
+		return nil, fmt.Errorf("invalid acl configuration: %w", err)
 	}
+	return loaded, nil
 }
 
-func (s *Server) Start() error {
-	address, port, ssl := getServerConfiguration()
-	var ln net.Listener
-	var err error
+// Start serves clients until ctx is done, Shutdown is called or a client sends SHUTDOWN, then stops
+// gracefully and saves a final snapshot.
+func (s *Server) Start(ctx context.Context) error {
+	s.life.mu.Lock()
+	s.life.started = true
+	s.life.mu.Unlock()
+	defer close(s.life.stopped)
 
-	if ssl {
+	conf, err := getServerConfiguration()
+	if err != nil {
+		return err
+	}
+	address, port, protocol := conf.address, conf.port, conf.protocol
+	if protocol != ProtocolRESP && protocol != ProtocolLegacy {
+		return fmt.Errorf("unknown protocol %q, expected %q or %q", protocol, ProtocolRESP, ProtocolLegacy)
+	}
+	s.protocol = protocol
+	s.maxBulkLength = conf.maxBulkLength
+	s.port, s.ssl = port, conf.ssl
+	s.repl.setBacklogSize(conf.replBacklogSize)
+	s.pubsub.outputLimit = conf.pubsubOutputLimit
+	s.primaryUser, s.primaryPassword = conf.primaryUser, conf.primaryPassword
+	s.maxClients, s.idleTimeout, s.readTimeout = conf.maxClients, conf.idleTimeout, conf.readTimeout
+	users, err := getACLConfiguration()
+	if err != nil {
+		return err
+	}
+	s.acl = users
+	if protocol == ProtocolLegacy && users.restricted() {
+		return fmt.Errorf("acl users require the %q protocol, the %q protocol has no authentication", ProtocolRESP, ProtocolLegacy)
+	}
+	var primaryHost string
+	var primaryPort int
+	if conf.replicaOf != "" {
+		if _, err := fmt.Sscanf(conf.replicaOf, "%s %d", &primaryHost, &primaryPort); err != nil {
+			return fmt.Errorf("invalid replicaof %q, expected \"<host> <port>\"", conf.replicaOf)
+		}
+	}
+	if conf.tlsPort != 0 && conf.tlsPort == port {
+		return fmt.Errorf("tls_port %d is already the port of the server", conf.tlsPort)
+	}
+	if conf.ssl || conf.tlsPort != 0 {
+		certs, err := loadCertificates(conf.tls)
+		if err != nil {
+			return err
+		}
+		s.certs = certs
+		stopWatching := make(chan struct{})
+		defer close(stopWatching)
+		go certs.watch(stopWatching)
+	}
+
+	lc := net.ListenConfig{KeepAlive: conf.tcpKeepAlive}
+	if conf.ssl {
 		log.Println("Starting TCP server with SSL")
-		tlsConfig := generateTLSConfig()
-		ln, err = tls.Listen("tcp", fmt.Sprintf("%s:%d", address, port), tlsConfig)
 	} else {
 		log.Println("Starting TCP server")
-		ln, err = net.Listen("tcp", fmt.Sprintf("%s:%d", address, port))
 	}
-
+	ln, err := lc.Listen(ctx, "tcp", fmt.Sprintf("%s:%d", address, port))
 	if err != nil {
 		return fmt.Errorf("failed to start listener: %w", err)
 	}
+	if conf.ssl {
+		ln = tls.NewListener(ln, s.certs.serverConfig())
+	}
 	defer ln.Close()
+	log.Printf("TCP server listening on %s:%d using the %s protocol\n", address, port, protocol)
 
-	log.Printf("TCP server listening on %s:%d\n", address, port)
+	var tlsLn net.Listener
+	if conf.tlsPort != 0 {
+		tlsLn, err = lc.Listen(ctx, "tcp", fmt.Sprintf("%s:%d", address, conf.tlsPort))
+		if err != nil {
+			return fmt.Errorf("failed to start TLS listener: %w", err)
+		}
+		tlsLn = tls.NewListener(tlsLn, s.certs.serverConfig())
+		defer tlsLn.Close()
+		log.Printf("TCP server listening with SSL on %s:%d\n", address, conf.tlsPort)
+	}
 
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+	aof, err := persistence.StartAppendOnly(s.datastore)
+	if err != nil {
+		return fmt.Errorf("failed to open append only file: %w", err)
+	}
+	if aof != nil {
+		s.aof = aof
+		defer aof.Close()
+	}
 
+	broker, err := persistence.LoadQueues()
+	if err != nil {
+		return fmt.Errorf("failed to load queues: %w", err)
+	}
+	s.broker = broker
+	queueLog, err := persistence.StartQueueLog(broker)
+	if err != nil {
+		return fmt.Errorf("failed to open queue log: %w", err)
+	}
+	if queueLog != nil {
+		s.queueLog = queueLog
+		defer queueLog.Close()
+	}
+
+	stopExpiration := s.datastore.StartExpirationCycle()
+	defer stopExpiration()
+
+	snapshotter, err := persistence.StartSnapshotter(s.datastore)
+	if err != nil {
+		return fmt.Errorf("failed to start snapshots: %w", err)
+	}
+	if snapshotter != nil {
+		s.snapshotter = snapshotter
+		defer snapshotter.Close()
+	}
+
+	if primaryHost != "" {
+		s.follow(primaryHost, primaryPort)
+	}
 	go func() {
-		for range ticker.C {
-			persistence.Save(s.datastore)
+		ticker := time.NewTicker(replicationPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.life.stopping:
+				return
+			case <-ticker.C:
+				s.repl.ping()
+			}
 		}
 	}()
 
+	// Connections are served once the persistence is set up
+	go s.serve(ln)
+	if tlsLn != nil {
+		go s.serve(tlsLn)
+	}
+	select {
+	case <-ctx.Done():
+		s.life.request(shutdownDefault)
+	case <-s.life.stopping:
+	}
+	return s.stop()
+}
+
+// serve accepts the connections of ln and handles each of them in its own goroutine, until ln is closed.
+func (s *Server) serve(ln net.Listener) {
+	if !s.life.listen(ln) {
+		return
+	}
 	for {
 		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
 			log.Printf("Error accepting connection: %v\n", err)
 			continue
@@ -100,89 +361,119 @@ func (s *Server) Start() error {
 	}
 }
 
-// handleConnection handles the connection from the client
+// handleConnection handles the connection from the client, using the configured protocol. Connections
+// beyond maxclients are rejected with an error.
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
-
-	reader := bufio.NewReader(conn)
-	writer := bufio.NewWriter(conn)
-
-	for {
-		msg, err := reader.ReadString('\n')
-		if err != nil {
-			if err != io.EOF {
-				log.Printf("Error reading message: %v\n", err)
-			}
-			break
-		}
-
-		log.Printf("Received message: %s\n", msg)
-		msg = strings.TrimSpace(msg)
-
-		switch {
-		case strings.HasPrefix(msg, "SET "):
-			key, value, err := parseKeyValue(msg)
-			if err == nil {
-				err = s.datastore.Set(key, value)
-				if err != nil {
-					writer.WriteString(formatErrorString(msg, err.Error()))
-				} else {
-					writer.WriteString("OK\r\n")
-				}
+	if err := s.life.add(conn, s.maxClients); err != nil {
+		if errors.Is(err, errMaxClients) {
+			if s.protocol == ProtocolLegacy {
+				conn.Write([]byte(formatErrorString("connection", err.Error()) + "\r\n"))
 			} else {
-				writer.WriteString(formatErrorString(msg, err.Error()))
+				conn.Write([]byte("-ERR " + err.Error() + "\r\n"))
 			}
+		}
+		return
+	}
+	defer s.life.remove(conn)
 
-		case strings.HasPrefix(msg, "GET "):
-			key := strings.TrimSpace(msg[4:]) // Remove "GET " prefix
-			value, err := s.datastore.Get(key)
-			if err != nil {
-				writer.WriteString("NODATA\r\n")
-			} else {
-				writer.WriteString(fmt.Sprintf("VALUE %s\r\n%s\r\n", key, value))
-			}
+	if s.protocol == ProtocolLegacy {
+		s.handleLegacyConnection(conn)
+		return
+	}
+	s.handleRESPConnection(conn)
+}
 
-		case strings.HasPrefix(msg, "DELETE "):
-			key := strings.TrimSpace(msg[8:]) // Remove "DELETE " prefix
-			err := s.datastore.Delete(key)
-			if err != nil {
-				writer.WriteString("NODATA\r\n")
-			} else {
-				writer.WriteString("OK\r\n")
-			}
+// handleRESPConnection reads RESP commands from the connection and replies to them until the client
+// disconnects, sends QUIT or breaks the protocol.
+func (s *Server) handleRESPConnection(conn net.Conn) {
+	c := newClient(s.nextID.Add(1), conn)
+	c.user = s.acl.initialUser()
+	c.info.user = c.user
+	c.reader.maxBulkLength = s.maxBulkLength
+	s.clients.add(c)
+	defer s.clients.remove(c)
+	defer s.repl.removeReplica(c)
+	defer c.unwatch()
+	defer func() {
+		s.pubsub.unsubscribeAll(c)
+		if c.push != nil {
+			c.push.close()
+		}
+	}()
 
-		case msg == "ALL":
-			values := s.datastore.GetAll()
-			writer.WriteString("ALLVALUES\r\n")
-			for key, value := range values {
-				writer.WriteString(fmt.Sprintf("%s=%s\r\n", key, value))
+	for !c.closing {
+		// Commands already received, pipelined by the client, run before their replies are written at once
+		if c.reader.r.Buffered() == 0 {
+			if err := c.flush(); err != nil {
+				log.Printf("Error writing reply: %v\n", err)
+				return
 			}
-			writer.WriteString("ENDOFALLVALUES\r\n")
-
-		case msg == "FLUSH":
-			err := s.datastore.FlushAll()
-			if err != nil {
-				writer.WriteString(formatErrorString(msg, err.Error()))
-			} else {
-				writer.WriteString("OK\r\n")
+			if !s.life.end(conn) {
+				return
 			}
-
-		default:
-			writer.WriteString("UNKNOWN\r\n")
+		}
+		// Subscribers and replicas wait for messages rather than commands, they have no idle timeout
+		err := s.awaitCommand(conn, c.reader, c.subscribed() || c.replica != nil)
+		var args [][]byte
+		if err == nil {
+			args, err = c.reader.ReadCommand()
+		}
+		if err != nil {
+			if isProtocolError(err) {
+				c.outMu.Lock()
+				c.writer.WriteError("ERR " + err.Error())
+				c.writer.Flush()
+				c.outMu.Unlock()
+			} else if err != io.EOF && !errors.Is(err, net.ErrClosed) && !isTimeout(err) {
+				log.Printf("Error reading command: %v\n", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if !s.life.begin(conn) {
+			return
 		}
 
-		writer.Flush()
+		c.outMu.Lock()
+		c.startCommand(args[0])
+		s.dispatch(c, args)
+		c.endCommand()
+		c.outMu.Unlock()
+	}
+	if err := c.flush(); err != nil {
+		log.Printf("Error writing reply: %v\n", err)
 	}
 }
 
-func parseKeyValue(msg string) (string, string, error) {
-	parts := strings.SplitN(msg, " ", 3)
-	if len(parts) != 3 {
-		return "", "", errors.New("invalid format")
+// awaitCommand waits for the next command of conn, for at most the idle timeout unless exempt is set,
+// then leaves the read timeout for the command to be received entirely.
+func (s *Server) awaitCommand(conn net.Conn, reader *respReader, exempt bool) error {
+	if s.idleTimeout == 0 && s.readTimeout == 0 {
+		return nil
+	}
+	var deadline time.Time
+	if s.idleTimeout > 0 && !exempt {
+		deadline = time.Now().Add(s.idleTimeout)
+	}
+	if reader.r.Buffered() == 0 {
+		conn.SetReadDeadline(deadline)
+		if _, err := reader.r.Peek(1); err != nil {
+			return err
+		}
+	}
+
+	deadline = time.Time{}
+	if s.readTimeout > 0 {
+		deadline = time.Now().Add(s.readTimeout)
 	}
-	return parts[1], parts[2], nil
+	return conn.SetReadDeadline(deadline)
 }
 
-func formatErrorString(command string, err string) string {
-	return fmt.Sprintf("Error in %s : %s", command, err)
+// isTimeout reports whether err is a read or write deadline being exceeded.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
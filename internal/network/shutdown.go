@@ -0,0 +1,263 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/persistence"
+)
+
+// shutdownTimeout bounds the time Start waits for the commands running when the server stops, after
+// which their connections are closed.
+const shutdownTimeout = 10 * time.Second
+
+var (
+	errStopping   = errors.New("server is shutting down")
+	errMaxClients = errors.New("max number of clients reached")
+)
+
+// saveMode is how the final snapshot is taken when the server stops.
+type saveMode int
+
+const (
+	// shutdownDefault saves a snapshot unless persistence is disabled
+	shutdownDefault saveMode = iota
+	shutdownSave
+	shutdownNoSave
+)
+
+// lifecycle tracks the listeners and connections of a server, so that it can stop gracefully: the
+// listeners are closed, idle connections are closed right away, and busy ones once their command replied.
+type lifecycle struct {
+	mu        sync.Mutex
+	started   bool
+	listeners []net.Listener
+	// conns maps the open connections to whether they are running a command
+	conns map[net.Conn]bool
+	wg    sync.WaitGroup
+	// stopping is closed once the server is asked to stop, stopped once Start returned
+	stopping chan struct{}
+	stopped  chan struct{}
+	// save is the final snapshot asked for by the first stop request
+	save saveMode
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{
+		conns:    make(map[net.Conn]bool),
+		stopping: make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// request asks the server to stop, the first request deciding of the final snapshot.
+func (l *lifecycle) request(save saveMode) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.stopping:
+	default:
+		l.save = save
+		close(l.stopping)
+	}
+}
+
+// isStopping reports whether the server was asked to stop. Caller must hold mu.
+func (l *lifecycle) isStopping() bool {
+	select {
+	case <-l.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// listen tracks ln, and returns false when the server is stopping and ln must not be served.
+func (l *lifecycle) listen(ln net.Listener) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isStopping() {
+		return false
+	}
+	l.listeners = append(l.listeners, ln)
+	return true
+}
+
+// add tracks conn. It fails when the server is stopping, or when limit connections, zero meaning no
+// limit, are open already, and conn must then be closed.
+func (l *lifecycle) add(conn net.Conn, limit int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isStopping() {
+		return errStopping
+	}
+	if limit > 0 && len(l.conns) >= limit {
+		return errMaxClients
+	}
+	l.conns[conn] = false
+	l.wg.Add(1)
+	return nil
+}
+
+// remove forgets conn, once it is closed.
+func (l *lifecycle) remove(conn net.Conn) {
+	l.mu.Lock()
+	delete(l.conns, conn)
+	l.mu.Unlock()
+	l.wg.Done()
+}
+
+// begin marks conn as running commands, and returns false when the server is stopping and the command
+// must not run. The commands pipelined after a command that ran still run, until their replies are written.
+func (l *lifecycle) begin(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isStopping() && !l.conns[conn] {
+		return false
+	}
+	l.conns[conn] = true
+	return true
+}
+
+// end marks conn as idle once its replies are written, and returns false when the server is stopping and
+// conn must be closed.
+func (l *lifecycle) end(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conns[conn] = false
+	return !l.isStopping()
+}
+
+// drain closes the listeners and the idle connections, then waits for the busy ones to finish their
+// command. The connections still open once ctx is done are closed.
+func (l *lifecycle) drain(ctx context.Context) error {
+	l.request(shutdownDefault)
+	l.mu.Lock()
+	for _, ln := range l.listeners {
+		ln.Close()
+	}
+	for conn, busy := range l.conns {
+		if !busy {
+			conn.Close()
+		}
+	}
+	l.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		l.closeAll()
+		<-drained
+		return ctx.Err()
+	}
+}
+
+// closeAll closes every connection, busy or not.
+func (l *lifecycle) closeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for conn := range l.conns {
+		conn.Close()
+	}
+}
+
+// Shutdown stops the server started with Start: it stops accepting connections, closes the idle ones,
+// waits for the commands running on the others and saves a final snapshot, unless persistence is
+// disabled. The connections still running a command when ctx is done are closed, and ctx.Err() is
+// returned once Start returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.life.request(shutdownDefault)
+	s.life.mu.Lock()
+	started := s.life.started
+	s.life.mu.Unlock()
+	if !started {
+		return nil
+	}
+
+	select {
+	case <-s.life.stopped:
+		return nil
+	case <-ctx.Done():
+		s.life.closeAll()
+		<-s.life.stopped
+		return ctx.Err()
+	}
+}
+
+// stop shuts the server down once Start was asked to return, and takes the final snapshot.
+func (s *Server) stop() error {
+	log.Println("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.life.drain(ctx); err != nil {
+		log.Printf("Closed the connections still running a command: %v\n", err)
+	}
+	s.stopReplication()
+
+	s.life.mu.Lock()
+	save := s.life.save
+	s.life.mu.Unlock()
+	if s.snapshotter == nil || save == shutdownNoSave {
+		return nil
+	}
+	// Wait for a background save, the final one must see every write
+	s.snapshotter.Close()
+	if err := s.snapshotter.Save(); err != nil {
+		return fmt.Errorf("failed to save the final snapshot: %w", err)
+	}
+	log.Println("Final snapshot saved")
+	return nil
+}
+
+// stopReplication disconnects from the primary and from the replicas.
+func (s *Server) stopReplication() {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	if s.repl.link != nil {
+		s.repl.link.stop()
+		s.repl.link = nil
+	}
+	s.repl.disconnectReplicas()
+}
+
+// shutdownCommand implements SHUTDOWN [SAVE|NOSAVE], stopping the server once the commands running on
+// other connections replied. Without option, a snapshot is saved unless persistence is disabled.
+func (s *Server) shutdownCommand(c *client, args [][]byte) {
+	save := shutdownDefault
+	if len(args) > 2 {
+		c.writer.WriteError("ERR " + errSyntax.Error())
+		return
+	}
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "save":
+			save = shutdownSave
+		case "nosave":
+			save = shutdownNoSave
+		default:
+			c.writer.WriteError("ERR " + errSyntax.Error())
+			return
+		}
+	}
+	if save == shutdownSave && s.snapshotter == nil {
+		c.writer.WriteError("ERR " + persistence.ErrPersistenceDisabled.Error())
+		return
+	}
+
+	log.Println("SHUTDOWN requested")
+	s.life.request(save)
+	// Like Redis, the connection is closed without a reply
+	c.closing = true
+}
@@ -0,0 +1,121 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+// waitBusy waits until a connection of server runs a command.
+func waitBusy(t *testing.T, server *Server) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		server.life.mu.Lock()
+		for _, busy := range server.life.conns {
+			if busy {
+				server.life.mu.Unlock()
+				return
+			}
+		}
+		server.life.mu.Unlock()
+	}
+	t.Fatal("Expected a connection to run a command")
+}
+
+// expectClosed checks that the server closed the connection of sub.
+func expectClosed(t *testing.T, sub *subscriber) {
+	t.Helper()
+	sub.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := sub.reader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestServer_ShutdownDrainsConnections(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	blocked := newSubscriber(t, server)
+	blocked.send(t, "BLPOP queue 0\r\n")
+	waitBusy(t, server)
+	idle := newSubscriber(t, server)
+	idle.send(t, "PING\r\n")
+	idle.expect(t, "+PONG\r\n")
+
+	drained := make(chan error, 1)
+	go func() { drained <- server.life.drain(context.Background()) }()
+	expectClosed(t, idle)
+	// The blocked command replies before its connection is closed
+	blocked.expect(t, "*-1\r\n")
+	expectClosed(t, blocked)
+	if err := <-drained; err != nil {
+		t.Fatalf("Expected the connections to be drained, got %v", err)
+	}
+
+	late := newSubscriber(t, server)
+	expectClosed(t, late)
+}
+
+func TestServer_ShutdownClosesBusyConnections(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	// The reply is never read, so the command never completes
+	stuck := newSubscriber(t, server)
+	stuck.send(t, "PING\r\n")
+	waitBusy(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := server.life.drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the busy connection to be closed once the context is done, got %v", err)
+	}
+}
+
+func TestServer_ShutdownCommand(t *testing.T) {
+	server := NewServer(datastore.NewDataStore())
+
+	replies := exchange(t, server,
+		"SHUTDOWN NOW\r\n",
+		"SHUTDOWN SAVE\r\n",
+	)
+	expected := []string{
+		"-ERR syntax error\r\n",
+		"-ERR persistence is disabled\r\n",
+	}
+	for i, reply := range replies {
+		if reply != expected[i] {
+			t.Errorf("Expected reply %d to be %q, got %q", i, expected[i], reply)
+		}
+	}
+	select {
+	case <-server.life.stopping:
+		t.Fatal("Expected a rejected SHUTDOWN not to stop the server")
+	default:
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go server.handleConnection(serverConn)
+	clientConn.Write([]byte("SHUTDOWN NOSAVE\r\n"))
+	if _, err := bufio.NewReader(clientConn).ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to be closed without a reply, got %v", err)
+	}
+	select {
+	case <-server.life.stopping:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected SHUTDOWN to stop the server")
+	}
+	if server.life.save != shutdownNoSave {
+		t.Errorf("Expected SHUTDOWN NOSAVE to skip the final snapshot, got %v", server.life.save)
+	}
+
+	// Without Start, Shutdown has nothing to wait for
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("Expected Shutdown to succeed, got %v", err)
+	}
+}
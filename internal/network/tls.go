@@ -0,0 +1,228 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Default paths of the certificate of the server, its key and the CA certificates, relative to the
+// working directory
+const (
+	defaultTLSCertFile = "certs/server.crt"
+	defaultTLSKeyFile  = "certs/server.key"
+	defaultTLSCAFile   = "certs/ca.crt"
+)
+
+// tlsReloadInterval is how often the certificate files are checked for changes.
+const tlsReloadInterval = 5 * time.Second
+
+// tlsConfiguration holds the TLS settings of the server section of the config file.
+type tlsConfiguration struct {
+	certFile, keyFile, caFile string
+	clientAuth                tls.ClientAuthType
+	minVersion                uint16
+	// cipherSuites are the TLS 1.2 cipher suites allowed, nil for the defaults of Go
+	cipherSuites []uint16
+}
+
+// parseTLSConfiguration reads the TLS settings from v, the server section of the config file.
+func parseTLSConfiguration(v reflect.Value) (tlsConfiguration, error) {
+	conf := tlsConfiguration{
+		certFile:   v.FieldByName("TLSCertFile").String(),
+		keyFile:    v.FieldByName("TLSKeyFile").String(),
+		caFile:     v.FieldByName("TLSCAFile").String(),
+		clientAuth: tls.RequireAndVerifyClientCert,
+		minVersion: tls.VersionTLS12,
+	}
+	if conf.certFile == "" {
+		conf.certFile = defaultTLSCertFile
+	}
+	if conf.keyFile == "" {
+		conf.keyFile = defaultTLSKeyFile
+	}
+	if conf.caFile == "" {
+		conf.caFile = defaultTLSCAFile
+	}
+
+	switch mode := strings.ToLower(v.FieldByName("TLSClientAuth").String()); mode {
+	case "", "require":
+	case "optional":
+		conf.clientAuth = tls.VerifyClientCertIfGiven
+	case "none":
+		conf.clientAuth = tls.NoClientCert
+	default:
+		return conf, fmt.Errorf("invalid tls_client_auth %q, expected none, optional or require", mode)
+	}
+
+	switch version := v.FieldByName("TLSMinVersion").String(); version {
+	case "", "1.2":
+	case "1.0":
+		conf.minVersion = tls.VersionTLS10
+	case "1.1":
+		conf.minVersion = tls.VersionTLS11
+	case "1.3":
+		conf.minVersion = tls.VersionTLS13
+	default:
+		return conf, fmt.Errorf("invalid tls_min_version %q, expected 1.0, 1.1, 1.2 or 1.3", version)
+	}
+
+	ciphers, _ := v.FieldByName("TLSCiphers").Interface().([]string)
+	for _, name := range ciphers {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return conf, fmt.Errorf("unknown or insecure tls cipher %q", name)
+		}
+		conf.cipherSuites = append(conf.cipherSuites, id)
+	}
+	return conf, nil
+}
+
+// cipherSuiteID returns the ID of the secure cipher suite named name, such as TLS_AES_128_GCM_SHA256.
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if strings.EqualFold(suite.Name, name) {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// certificates holds the certificate of the server and the CA certificates it trusts, which are reloaded
+// when their files change or the server receives SIGHUP, so that they can be renewed without a restart.
+type certificates struct {
+	conf    tlsConfiguration
+	current atomic.Pointer[loadedCertificates]
+	// modTimes are the times the files were modified when they were last read, whether they could be
+	// loaded or not, so that broken files are only read again once they change. Only the goroutine
+	// watching the files uses them after loading.
+	modTimes [3]time.Time
+}
+
+// loadedCertificates are the certificates read from the files.
+type loadedCertificates struct {
+	cert   tls.Certificate
+	caPool *x509.CertPool
+}
+
+// loadCertificates reads the certificates named by conf.
+func loadCertificates(conf tlsConfiguration) (*certificates, error) {
+	c := &certificates{conf: conf}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// files returns the paths of the certificate files.
+func (c *certificates) files() [3]string {
+	return [3]string{c.conf.certFile, c.conf.keyFile, c.conf.caFile}
+}
+
+// reload reads the certificate files again. The previous certificates are kept when they cannot be read.
+// The CA file is optional when client certificates are not verified.
+func (c *certificates) reload() error {
+	for i, path := range c.files() {
+		c.modTimes[i] = time.Time{}
+		if info, err := os.Stat(path); err == nil {
+			c.modTimes[i] = info.ModTime()
+		}
+	}
+
+	var loaded loadedCertificates
+	cert, err := tls.LoadX509KeyPair(c.conf.certFile, c.conf.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading certificate: %w", err)
+	}
+	loaded.cert = cert
+	caCert, err := os.ReadFile(c.conf.caFile)
+	switch {
+	case err == nil:
+		loaded.caPool = x509.NewCertPool()
+		if !loaded.caPool.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("error loading CA certificate: no certificate found in %s", c.conf.caFile)
+		}
+	case c.conf.clientAuth != tls.NoClientCert:
+		return fmt.Errorf("error loading CA certificate: %w", err)
+	}
+	c.current.Store(&loaded)
+	return nil
+}
+
+// changed reports whether a certificate file was modified since it was last read.
+func (c *certificates) changed() bool {
+	for i, path := range c.files() {
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Equal(c.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the certificates on SIGHUP and when their files change, until done is closed.
+func (c *certificates) watch(done <-chan struct{}) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(tlsReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-hangup:
+		case <-ticker.C:
+			if !c.changed() {
+				continue
+			}
+		}
+		if err := c.reload(); err != nil {
+			log.Printf("Keeping the previous TLS certificates: %v\n", err)
+		} else {
+			log.Println("TLS certificates reloaded")
+		}
+	}
+}
+
+// serverConfig returns the TLS configuration of the listeners, which always uses the latest certificates.
+func (c *certificates) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   c.conf.minVersion,
+		CipherSuites: c.conf.cipherSuites,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			loaded := c.current.Load()
+			return &tls.Config{
+				Certificates: []tls.Certificate{loaded.cert},
+				ClientCAs:    loaded.caPool,
+				ClientAuth:   c.conf.clientAuth,
+				MinVersion:   c.conf.minVersion,
+				CipherSuites: c.conf.cipherSuites,
+			}, nil
+		},
+	}
+}
+
+// clientConfig returns the TLS configuration with which a replica connects to its primary on host,
+// presenting the certificate of the server and trusting the CA certificates, or those of the system
+// when there is no CA file.
+func (c *certificates) clientConfig(host string) *tls.Config {
+	loaded := c.current.Load()
+	return &tls.Config{
+		RootCAs:      loaded.caPool,
+		ServerName:   host,
+		MinVersion:   c.conf.minVersion,
+		CipherSuites: c.conf.cipherSuites,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &c.current.Load().cert, nil
+		},
+	}
+}
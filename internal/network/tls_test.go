@@ -0,0 +1,232 @@
+package network
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/config"
+)
+
+// testPKI is a CA along with the certificates it signed, written as PEM files to a temporary directory.
+type testPKI struct {
+	t      *testing.T
+	dir    string
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	p := &testPKI{t: t, dir: t.TempDir()}
+	p.caCert, p.caKey = p.sign(1, nil, nil, true)
+	p.writePEM("ca.crt", "CERTIFICATE", p.caCert.Raw)
+	return p
+}
+
+// sign creates a certificate with serial, signed by parent, or self-signed when parent is nil.
+func (p *testPKI) sign(serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, ca bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	p.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// issue writes a certificate signed by the CA, and its key, under name.crt and name.key.
+func (p *testPKI) issue(name string, serial int64) tls.Certificate {
+	p.t.Helper()
+	cert, key := p.sign(serial, p.caCert, p.caKey, false)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.writePEM(name+".crt", "CERTIFICATE", cert.Raw)
+	p.writePEM(name+".key", "EC PRIVATE KEY", keyDER)
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+}
+
+func (p *testPKI) writePEM(name, blockType string, der []byte) {
+	p.t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(p.dir, name), data, 0o600); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func (p *testPKI) conf(clientAuth tls.ClientAuthType) tlsConfiguration {
+	return tlsConfiguration{
+		certFile:   filepath.Join(p.dir, "server.crt"),
+		keyFile:    filepath.Join(p.dir, "server.key"),
+		caFile:     filepath.Join(p.dir, "ca.crt"),
+		clientAuth: clientAuth,
+		minVersion: tls.VersionTLS12,
+	}
+}
+
+// handshake connects a client with clientConfig to a listener with certs, and returns the serial
+// number of the certificate presented by the server.
+func handshake(t *testing.T, certs *certificates, clientConfig *tls.Config) (int64, error) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	server := tls.Server(serverConn, certs.serverConfig())
+	go func() {
+		// Keep the connection open until the client closes it once the handshake succeeded
+		if server.Handshake() == nil {
+			io.Copy(io.Discard, server)
+		}
+		serverConn.Close()
+	}()
+	client := tls.Client(clientConn, clientConfig)
+	if err := client.Handshake(); err != nil {
+		return 0, err
+	}
+	// With TLS 1.3, a rejected client certificate is only reported on the first read
+	client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := client.Read(make([]byte, 1)); err != nil && !isTimeout(err) {
+		return 0, err
+	}
+	return client.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestCertificates_ClientAuth(t *testing.T) {
+	pki := newTestPKI(t)
+	pki.issue("server", 2)
+	clientCert := pki.issue("client", 3)
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.caCert)
+
+	certs, err := loadCertificates(pki.conf(tls.RequireAndVerifyClientCert))
+	if err != nil {
+		t.Fatalf("Expected the certificates to load, got %v", err)
+	}
+	if _, err := handshake(t, certs, &tls.Config{RootCAs: roots, ServerName: "localhost"}); err == nil {
+		t.Error("Expected a client without certificate to be rejected")
+	}
+	withCert := &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{clientCert}}
+	if _, err := handshake(t, certs, withCert); err != nil {
+		t.Errorf("Expected a client certificate signed by the CA to be accepted, got %v", err)
+	}
+
+	os.Remove(filepath.Join(pki.dir, "ca.crt"))
+	if _, err := loadCertificates(pki.conf(tls.RequireAndVerifyClientCert)); err == nil {
+		t.Error("Expected the CA file to be required to verify clients")
+	}
+	certs, err = loadCertificates(pki.conf(tls.NoClientCert))
+	if err != nil {
+		t.Fatalf("Expected the CA file to be optional without client authentication, got %v", err)
+	}
+	if _, err := handshake(t, certs, &tls.Config{RootCAs: roots, ServerName: "localhost"}); err != nil {
+		t.Errorf("Expected a client without certificate to be accepted, got %v", err)
+	}
+}
+
+func TestCertificates_Reload(t *testing.T) {
+	pki := newTestPKI(t)
+	pki.issue("server", 2)
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.caCert)
+	clientConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+
+	certs, err := loadCertificates(pki.conf(tls.NoClientCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs.changed() {
+		t.Error("Expected the certificates not to be changed right after loading them")
+	}
+
+	// A renewed certificate is served to new connections once reloaded
+	pki.issue("server", 4)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(filepath.Join(pki.dir, "server.crt"), later, later)
+	if !certs.changed() {
+		t.Error("Expected the renewed certificate to be detected")
+	}
+	if err := certs.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if serial, err := handshake(t, certs, clientConfig); err != nil || serial != 4 {
+		t.Errorf("Expected the renewed certificate, got serial %d, %v", serial, err)
+	}
+
+	// A broken certificate is not loaded, nor read again until it changes
+	os.WriteFile(filepath.Join(pki.dir, "server.crt"), []byte("broken"), 0o600)
+	later = later.Add(time.Second)
+	os.Chtimes(filepath.Join(pki.dir, "server.crt"), later, later)
+	if err := certs.reload(); err == nil {
+		t.Error("Expected a broken certificate to fail to load")
+	}
+	if serial, err := handshake(t, certs, clientConfig); err != nil || serial != 4 {
+		t.Errorf("Expected the previous certificate to be kept, got serial %d, %v", serial, err)
+	}
+	if certs.changed() {
+		t.Error("Expected the broken certificate not to be retried before it changes")
+	}
+	later = later.Add(time.Second)
+	os.Chtimes(filepath.Join(pki.dir, "server.crt"), later, later)
+	if !certs.changed() {
+		t.Error("Expected the certificate to be retried once it changed")
+	}
+}
+
+func TestParseTLSConfiguration(t *testing.T) {
+	var c config.Config
+	conf, err := parseTLSConfiguration(reflect.ValueOf(c.Server))
+	if err != nil || conf.certFile != defaultTLSCertFile || conf.clientAuth != tls.RequireAndVerifyClientCert || conf.minVersion != tls.VersionTLS12 {
+		t.Errorf("Expected the defaults, got %+v, %v", conf, err)
+	}
+
+	c.Server.TLSClientAuth = "optional"
+	c.Server.TLSMinVersion = "1.3"
+	c.Server.TLSCiphers = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	conf, err = parseTLSConfiguration(reflect.ValueOf(c.Server))
+	if err != nil || conf.clientAuth != tls.VerifyClientCertIfGiven || conf.minVersion != tls.VersionTLS13 ||
+		!reflect.DeepEqual(conf.cipherSuites, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}) {
+		t.Errorf("Expected the settings to be applied, got %+v, %v", conf, err)
+	}
+
+	for _, invalid := range []func(){
+		func() { c.Server.TLSClientAuth = "sometimes" },
+		func() { c.Server.TLSClientAuth, c.Server.TLSMinVersion = "", "2.0" },
+		func() { c.Server.TLSMinVersion, c.Server.TLSCiphers = "", []string{"TLS_RSA_WITH_RC4_128_SHA"} },
+	} {
+		invalid()
+		if _, err := parseTLSConfiguration(reflect.ValueOf(c.Server)); err == nil {
+			t.Errorf("Expected %+v to be rejected", c.Server)
+		}
+	}
+}
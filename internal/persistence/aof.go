@@ -0,0 +1,514 @@
+package persistence
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	logger "github.com/AbdessamadEnabih/Vertex/pkg/logger"
+)
+
+// FsyncPolicy tells how often the append-only file is flushed to disk.
+type FsyncPolicy string
+
+const (
+	// FsyncAlways flushes every write before it is acknowledged.
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncEverySec flushes once per second, losing at most one second of writes on a crash.
+	FsyncEverySec FsyncPolicy = "everysec"
+	// FsyncNo leaves flushing to the operating system.
+	FsyncNo FsyncPolicy = "no"
+)
+
+const (
+	aofFileName = "appendonly.aof"
+	// aofSyncInterval is how often buffered writes reach the file, and the file the disk with FsyncEverySec.
+	aofSyncInterval = time.Second
+	// defaultRewritePercentage triggers a rewrite once the file grew by this percentage since the last one.
+	defaultRewritePercentage = 100
+	// defaultRewriteMinSize is the size under which the file is never rewritten automatically.
+	defaultRewriteMinSize = 64 * 1024 * 1024
+	// maxCommandArgs and maxArgLength bound the commands read from the file, as the RESP reader of the
+	// server bounds the ones received from clients.
+	maxCommandArgs = 1024 * 1024
+	maxArgLength   = 512 * 1024 * 1024
+)
+
+var (
+	// ErrRewriteInProgress is returned when a rewrite is requested while another one is running.
+	ErrRewriteInProgress = errors.New("background append only file rewriting already in progress")
+	// ErrCorruptAOF is returned when the append-only file holds malformed data before its last command.
+	ErrCorruptAOF = errors.New("append only file is corrupt")
+	// ErrLocked is returned when the append-only file is opened while another process, such as a running
+	// server, writes it: the two processes would rewrite the file under each other and lose writes.
+	ErrLocked = errors.New("append only file is used by another process")
+)
+
+// AOF is an append-only file logging every write of a datastore, or every change of a queue broker,
+// so that it can be replayed on Load.
+type AOF struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	policy FsyncPolicy
+	// lock is held on path.lock while the file is open, see OpenAOF
+	lock *os.File
+	// buf holds the commands not written to the file yet.
+	buf []byte
+	// size is the size of the file, and baseSize its size after the last rewrite.
+	size     int64
+	baseSize int64
+	// rewritePercentage and rewriteMinSize control automatic rewrites. A zero percentage disables them.
+	rewritePercentage int
+	rewriteMinSize    int64
+	// err is the error of the last flush, nil once a flush succeeded.
+	err error
+	// rewriting is set while a rewrite runs, rewriteBuf then collects the commands
+	// missing from the snapshot the rewrite started from.
+	rewriting  bool
+	rewriteBuf []byte
+	// writeState writes the commands recreating the logged state to rewrite the file, nil until attached.
+	// barrier is called once the state to write is fixed, writes propagated after it returns are missing.
+	writeState func(w io.Writer, barrier func()) error
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// OpenAOF opens, or creates, the append-only file at path for appending. It fails with ErrLocked when
+// another process has it open.
+func OpenAOF(path string, policy FsyncPolicy) (*AOF, error) {
+	switch policy {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+	default:
+		return nil, fmt.Errorf("unknown fsync policy %q", policy)
+	}
+
+	// A single process writes the file, which is locked until Close
+	lock, err := lockFile(path + ".lock")
+	if err != nil {
+		logError("persistence.OpenAOF: Error locking append only file", path, err)
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		lock.Close()
+		logError("persistence.OpenAOF: Error opening append only file", path, err)
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		lock.Close()
+		return nil, err
+	}
+
+	return &AOF{
+		path:              path,
+		file:              file,
+		lock:              lock,
+		policy:            policy,
+		size:              info.Size(),
+		baseSize:          info.Size(),
+		rewritePercentage: defaultRewritePercentage,
+		rewriteMinSize:    defaultRewriteMinSize,
+		done:              make(chan struct{}),
+	}, nil
+}
+
+// Attach registers the AOF as a propagator of ds, so that every write of ds is logged,
+// and starts the background goroutine flushing the log and rewriting it when it grows too much.
+func (a *AOF) Attach(ds *datastore.DataStore) {
+	a.attach(func(w io.Writer, barrier func()) error {
+		return writeDataStoreCommands(ds, w, barrier)
+	})
+	ds.AddPropagator(a.Append)
+	a.start()
+}
+
+func (a *AOF) attach(writeState func(w io.Writer, barrier func()) error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.writeState = writeState
+}
+
+// start starts the background goroutine, once the AOF is attached.
+func (a *AOF) start() {
+	a.wg.Add(1)
+	go a.run()
+}
+
+// Append logs a command. It is called by the datastore, or the broker, with its lock held.
+func (a *AOF) Append(args []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.buf = appendCommand(a.buf, args)
+	if a.rewriting {
+		a.rewriteBuf = appendCommand(a.rewriteBuf, args)
+	}
+	if a.policy == FsyncAlways {
+		// The error is kept for Err, so that the write is not acknowledged
+		a.flushLocked(true)
+	}
+}
+
+// Err returns the error of the last attempt to write the log to the file, or to flush it to disk, nil
+// once an attempt succeeded. Writes should be refused meanwhile, as they may not be logged.
+func (a *AOF) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Policy returns the fsync policy of the log.
+func (a *AOF) Policy() FsyncPolicy {
+	return a.policy
+}
+
+// Sync writes buffered commands to the file and flushes the file to disk.
+func (a *AOF) Sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flushLocked(true)
+}
+
+// Size returns the size of the file, including buffered commands.
+func (a *AOF) Size() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.size + int64(len(a.buf))
+}
+
+// Rewriting reports whether a rewrite is running.
+func (a *AOF) Rewriting() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rewriting
+}
+
+// Close stops the background goroutine, flushes buffered commands and closes the file.
+func (a *AOF) Close() error {
+	select {
+	case <-a.done:
+		return nil
+	default:
+		close(a.done)
+	}
+	a.wg.Wait()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.flushLocked(true)
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	a.lock.Close()
+	return err
+}
+
+// flushLocked writes the buffered commands to the file, and flushes the file to disk when sync is set.
+// The error is also recorded for Err. Caller must hold mu.
+func (a *AOF) flushLocked(sync bool) error {
+	a.err = a.writeLocked(sync)
+	return a.err
+}
+
+func (a *AOF) writeLocked(sync bool) error {
+	if len(a.buf) > 0 {
+		n, err := a.file.Write(a.buf)
+		if err != nil {
+			logError("persistence.AOF: Error writing append only file", a.path, err)
+			// Drop the partial command, it is written again on the next flush
+			if n > 0 {
+				if err := a.file.Truncate(a.size); err != nil {
+					logError("persistence.AOF: Error truncating partial write", a.path, err)
+				}
+			}
+			return err
+		}
+		a.size += int64(n)
+		a.buf = a.buf[:0]
+	}
+	if sync {
+		if err := a.file.Sync(); err != nil {
+			logError("persistence.AOF: Error syncing append only file", a.path, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// run flushes the log every aofSyncInterval and starts automatic rewrites.
+func (a *AOF) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(aofSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+
+		a.mu.Lock()
+		// After a failure, the log is flushed to disk again before writes are accepted
+		a.flushLocked(a.policy == FsyncEverySec || a.err != nil)
+		rewrite := a.needsRewriteLocked()
+		a.mu.Unlock()
+
+		if rewrite {
+			a.wg.Add(1)
+			go func() {
+				defer a.wg.Done()
+				if err := a.Rewrite(); err != nil && err != ErrRewriteInProgress {
+					logError("persistence.AOF: Error rewriting append only file", a.path, err)
+				}
+			}()
+		}
+	}
+}
+
+// needsRewriteLocked reports whether the file grew enough since the last rewrite to be compacted.
+// Caller must hold mu.
+func (a *AOF) needsRewriteLocked() bool {
+	if a.rewriting || a.rewritePercentage <= 0 || a.writeState == nil || a.size < a.rewriteMinSize {
+		return false
+	}
+	base := a.baseSize
+	if base == 0 {
+		base = 1
+	}
+	return (a.size-base)*100/base >= int64(a.rewritePercentage)
+}
+
+// Rewrite compacts the log: it writes the commands recreating a snapshot of the logged state to a temporary
+// file, appends the writes that happened in the meantime, and atomically replaces the log with it.
+// Datastore writers are not blocked while the snapshot is written, see datastore.IterateSnapshot.
+func (a *AOF) Rewrite() error {
+	a.mu.Lock()
+	if a.rewriting {
+		a.mu.Unlock()
+		return ErrRewriteInProgress
+	}
+	if a.writeState == nil {
+		a.mu.Unlock()
+		return errors.New("append only file is not attached")
+	}
+	a.rewriting = true
+	writeState := a.writeState
+	a.mu.Unlock()
+
+	tmpPath := a.path + ".rewrite"
+	err := a.rewrite(writeState, tmpPath)
+
+	a.mu.Lock()
+	a.rewriting = false
+	a.rewriteBuf = nil
+	a.mu.Unlock()
+
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	logger.Log("persistence.AOF: Append only file rewritten at path "+a.path, "INFO")
+	return nil
+}
+
+func (a *AOF) rewrite(writeState func(w io.Writer, barrier func()) error, tmpPath string) error {
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	// Commands propagated after the barrier are missing from the snapshot and collected in rewriteBuf
+	err = writeState(writer, func() {
+		a.mu.Lock()
+		a.rewriteBuf = a.rewriteBuf[:0]
+		a.mu.Unlock()
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Writes keep being logged to the current file until the new one replaces it
+	if _, err := file.Write(a.rewriteBuf); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, a.path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(a.path))
+
+	newFile, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	a.file.Close()
+	a.file = newFile
+	// Buffered commands are part of rewriteBuf, hence already in the new file
+	a.buf = a.buf[:0]
+	a.size = info.Size()
+	a.baseSize = info.Size()
+	return nil
+}
+
+// writeDataStoreCommands writes the commands recreating a point-in-time view of ds, see datastore.IterateSnapshot.
+func writeDataStoreCommands(ds *datastore.DataStore, w io.Writer, barrier func()) error {
+	iterator := ds.IterateSnapshot(barrier)
+	defer iterator.Close()
+
+	var encoded []byte
+	batch := make([]datastore.Entry, snapshotBatchSize)
+	for n := iterator.Next(batch); n > 0; n = iterator.Next(batch) {
+		for _, entry := range batch[:n] {
+			for _, args := range datastore.EntryCommands(entry) {
+				encoded = appendCommand(encoded[:0], args)
+				if _, err := w.Write(encoded); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ReplayAOF applies the commands logged in the append-only file at path to ds. A command cut short at the
+// end of the file, as left by a crash during a write, is discarded and the file truncated after the last
+// complete command. Malformed data anywhere else makes ReplayAOF fail with ErrCorruptAOF.
+func ReplayAOF(path string, ds *datastore.DataStore) error {
+	return replayLog("persistence.ReplayAOF", path, ds.Apply)
+}
+
+// replayLog replays the append-only file at path with apply, as described by ReplayAOF.
+// caller prefixes the logged errors.
+func replayLog(caller string, path string, apply func(args []string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		logError(caller+": Error opening append only file", path, err)
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	offset := int64(0)
+	for {
+		args, n, err := readCommand(reader)
+		if err == io.EOF && n == 0 {
+			return nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			logger.Log(fmt.Sprintf("%s: Truncated command at offset %d, truncating append only file at path %s", caller, offset, path), "ERROR")
+			return os.Truncate(path, offset)
+		}
+		if err != nil {
+			logError(fmt.Sprintf("%s: Error reading command at offset %d", caller, offset), path, err)
+			return fmt.Errorf("%w: %v at offset %d", ErrCorruptAOF, err, offset)
+		}
+		if err := apply(args); err != nil {
+			logError(fmt.Sprintf("%s: Error applying command at offset %d", caller, offset), path, err)
+			return fmt.Errorf("%w: %v at offset %d", ErrCorruptAOF, err, offset)
+		}
+		offset += int64(n)
+	}
+}
+
+// appendCommand appends args encoded as a RESP array of bulk strings to buf.
+func appendCommand(buf []byte, args []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// readCommand reads a command written by appendCommand and returns it along with the number of bytes read.
+// It returns io.EOF, or io.ErrUnexpectedEOF, when the data ends before the command is complete.
+func readCommand(reader *bufio.Reader) ([]string, int, error) {
+	n := 0
+	readLength := func(prefix byte, max int) (int, error) {
+		line, err := reader.ReadString('\n')
+		n += len(line)
+		if err != nil {
+			return 0, err
+		}
+		if len(line) < 3 || line[0] != prefix || line[len(line)-2] != '\r' {
+			return 0, fmt.Errorf("expected '%c', got %q", prefix, line)
+		}
+		length, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil || length < 0 || length > max {
+			return 0, fmt.Errorf("invalid length %q", line)
+		}
+		return length, nil
+	}
+
+	count, err := readLength('*', maxCommandArgs)
+	if err != nil {
+		return nil, n, err
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		length, err := readLength('$', maxArgLength)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, n, err
+		}
+		buf := make([]byte, length+2)
+		read, err := io.ReadFull(reader, buf)
+		n += read
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, n, err
+		}
+		if buf[length] != '\r' || buf[length+1] != '\n' {
+			return nil, n, errors.New("bulk string is not terminated by CRLF")
+		}
+		args = append(args, string(buf[:length]))
+	}
+	return args, n, nil
+}
+
+// syncDir flushes a directory to disk, so that a file renamed into it survives a crash.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	d.Sync()
+}
@@ -0,0 +1,222 @@
+package persistence_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/persistence"
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func openTestAOF(t *testing.T, policy persistence.FsyncPolicy) (string, *persistence.AOF, *datastore.DataStore) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, err := persistence.OpenAOF(path, policy)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ds := datastore.NewDataStore()
+	aof.Attach(ds)
+	t.Cleanup(func() { aof.Close() })
+	return path, aof, ds
+}
+
+func TestAOF_ReplayRestoresWrites(t *testing.T) {
+	path, aof, ds := openTestAOF(t, persistence.FsyncAlways)
+
+	ds.Set("a", "1")
+	ds.Set("b", "value with\r\nnewlines")
+	ds.SetWithTTL("c", "3", time.Hour)
+	ds.Update("a", "11")
+	ds.Delete("b")
+	if err := aof.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	replayed := datastore.NewDataStore()
+	if err := persistence.ReplayAOF(path, replayed); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := replayed.Get("a"); value != "11" {
+		t.Errorf("Expected 11, got %v", value)
+	}
+	if _, err := replayed.Get("b"); err == nil {
+		t.Errorf("Expected deleted key to stay deleted")
+	}
+	if ttl, _ := replayed.TTL("c"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected the deadline to be restored, got %v", ttl)
+	}
+}
+
+func TestAOF_EverySecBuffersUntilSync(t *testing.T) {
+	path, aof, ds := openTestAOF(t, persistence.FsyncEverySec)
+
+	ds.Set("a", "1")
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("Expected writes to be buffered, got a file of %d bytes", info.Size())
+	}
+	if err := aof.Sync(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if info, _ := os.Stat(path); info.Size() == 0 {
+		t.Errorf("Expected writes to reach the file after Sync")
+	}
+}
+
+func TestOpenAOF_UnknownPolicy(t *testing.T) {
+	if _, err := persistence.OpenAOF(filepath.Join(t.TempDir(), "appendonly.aof"), "sometimes"); err == nil {
+		t.Errorf("Expected an error for an unknown fsync policy")
+	}
+}
+
+func TestOpenAOF_Locked(t *testing.T) {
+	path, aof, _ := openTestAOF(t, persistence.FsyncAlways)
+
+	// Another writer, such as the CLI next to a running server, is refused
+	if _, err := persistence.OpenAOF(path, persistence.FsyncAlways); !errors.Is(err, persistence.ErrLocked) {
+		t.Fatalf("Expected ErrLocked while the file is open, got %v", err)
+	}
+	aof.Close()
+	reopened, err := persistence.OpenAOF(path, persistence.FsyncAlways)
+	if err != nil {
+		t.Fatalf("Expected the file to be opened once closed, got %v", err)
+	}
+	reopened.Close()
+}
+
+func TestReplayAOF_TruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	complete := "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n"
+	os.WriteFile(path, []byte(complete+"*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$5\r\nval"), 0644)
+
+	ds := datastore.NewDataStore()
+	if err := persistence.ReplayAOF(path, ds); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := ds.Get("a"); value != "1" {
+		t.Errorf("Expected 1, got %v", value)
+	}
+	if _, err := ds.Get("b"); err == nil {
+		t.Errorf("Expected the truncated command to be discarded")
+	}
+	if data, _ := os.ReadFile(path); string(data) != complete {
+		t.Errorf("Expected the file to be truncated after the last complete command, got %q", data)
+	}
+}
+
+func TestReplayAOF_Corrupt(t *testing.T) {
+	for name, data := range map[string]string{
+		"garbage":       "garbage\r\n*1\r\n$8\r\nFLUSHALL\r\n",
+		"huge count":    "*9223372036854775807\r\n$3\r\nSET\r\n",
+		"huge length":   "*1\r\n$9223372036854775807\r\nFLUSHALL\r\n",
+		"too many args": "*2000000\r\n$3\r\nSET\r\n",
+		"too long arg":  "*1\r\n$1073741824\r\nFLUSHALL\r\n",
+	} {
+		path := filepath.Join(t.TempDir(), "appendonly.aof")
+		os.WriteFile(path, []byte(data), 0644)
+
+		err := persistence.ReplayAOF(path, datastore.NewDataStore())
+		if !errors.Is(err, persistence.ErrCorruptAOF) {
+			t.Errorf("Expected ErrCorruptAOF for %s, got %v", name, err)
+		}
+	}
+}
+
+func TestAOF_RewriteCompactsLog(t *testing.T) {
+	path, aof, ds := openTestAOF(t, persistence.FsyncAlways)
+
+	ds.Set("counter", "0")
+	for i := 0; i < 100; i++ {
+		ds.Update("counter", "value")
+	}
+	ds.SetWithTTL("session", "s", time.Hour)
+	before := aof.Size()
+
+	if err := aof.Rewrite(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if after := aof.Size(); after >= before {
+		t.Errorf("Expected the rewrite to shrink the file from %d bytes, got %d", before, after)
+	}
+
+	// Writes after the rewrite go to the new file
+	ds.Set("after", "rewrite")
+	aof.Close()
+
+	replayed := datastore.NewDataStore()
+	if err := persistence.ReplayAOF(path, replayed); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for key, expected := range map[string]string{"counter": "value", "session": "s", "after": "rewrite"} {
+		if value, _ := replayed.Get(key); value != expected {
+			t.Errorf("Expected %s for %s, got %v", expected, key, value)
+		}
+	}
+	if ttl, _ := replayed.TTL("session"); ttl <= 0 {
+		t.Errorf("Expected the deadline to survive the rewrite, got %v", ttl)
+	}
+}
+
+func TestAOF_ReplayPreservesTypes(t *testing.T) {
+	path, aof, ds := openTestAOF(t, persistence.FsyncAlways)
+
+	logged := map[string]interface{}{
+		"string":  "value",
+		"bytes":   []byte{0, 1, 0xff},
+		"bool":    true,
+		"int":     42,
+		"int8":    int8(-8),
+		"uint64":  uint64(1 << 63),
+		"float32": float32(1.5),
+		"float64": 3.14,
+	}
+	rewritten := map[string]interface{}{"rewritten-int": int64(-1 << 60), "rewritten-float": 0.1}
+	for key, value := range rewritten {
+		ds.Set(key, value)
+	}
+	// Values are typed both in the base written by a rewrite and in the writes logged after it
+	if err := aof.Rewrite(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for key, value := range logged {
+		ds.Set(key, value)
+	}
+	ds.Update("int", 43)
+	logged["int"] = 43
+	aof.Close()
+
+	replayed := datastore.NewDataStore()
+	if err := persistence.ReplayAOF(path, replayed); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, values := range []map[string]interface{}{logged, rewritten} {
+		for key, expected := range values {
+			if value, _ := replayed.Get(key); !reflect.DeepEqual(value, expected) {
+				t.Errorf("Expected %s to be %#v (%T), got %#v (%T)", key, expected, expected, value, value)
+			}
+		}
+	}
+}
+
+func TestAOF_AlwaysRecordsWriteErrors(t *testing.T) {
+	// Every write to /dev/full fails
+	aof, err := persistence.OpenAOF("/dev/full", persistence.FsyncAlways)
+	if err != nil {
+		t.Skipf("Expected /dev/full to be available, got %v", err)
+	}
+	ds := datastore.NewDataStore()
+	aof.Attach(ds)
+	defer aof.Close()
+
+	if err := aof.Err(); err != nil {
+		t.Fatalf("Expected no error before the first write, got %v", err)
+	}
+	ds.Set("a", "1")
+	if aof.Err() == nil {
+		t.Errorf("Expected the failed write to be recorded")
+	}
+}
@@ -0,0 +1,500 @@
+package persistence
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+// The payload of a version 2 snapshot is a sequence of records, each starting with an opcode:
+//
+//	opEntry | key | deadline | value
+//	opEOF
+//
+// Strings are a uvarint length followed by their bytes, deadlines a varint of Unix milliseconds
+// (0 for no deadline), and values a type tag followed by the encoding of that type.
+const (
+	opEntry byte = 0x01
+	opEOF   byte = 0xff
+)
+
+// Type tags of the values. They are stored in snapshot files and must never be renumbered.
+const (
+	tagNil     byte = 0
+	tagString  byte = 1
+	tagBytes   byte = 2
+	tagBool    byte = 3
+	tagInt     byte = 4
+	tagInt8    byte = 5
+	tagInt16   byte = 6
+	tagInt32   byte = 7
+	tagInt64   byte = 8
+	tagUint    byte = 9
+	tagUint8   byte = 10
+	tagUint16  byte = 11
+	tagUint32  byte = 12
+	tagUint64  byte = 13
+	tagFloat32 byte = 14
+	tagFloat64 byte = 15
+	tagStrings byte = 16
+	tagList    byte = 17
+	tagMap     byte = 18
+	tagStream  byte = 19
+	tagListKey byte = 20 // *datastore.List, tagList being the generic []interface{}
+	tagHash    byte = 21
+	tagSet     byte = 22
+	tagZSet    byte = 23
+)
+
+// maxValueDepth bounds the nesting of lists and maps read from a snapshot.
+const maxValueDepth = 64
+
+// ErrUnsupportedType is returned when a value of the datastore has a type the snapshot format cannot hold.
+var ErrUnsupportedType = errors.New("value type cannot be persisted")
+
+// snapshotBatchSize is the number of entries read at once from a snapshot iterator.
+const snapshotBatchSize = 256
+
+// encodeDataStore writes a point-in-time view of ds with encoder and closes it.
+func encodeDataStore(ds *datastore.DataStore, barrier func(), encoder *snapshotEncoder) error {
+	iterator := ds.IterateSnapshot(barrier)
+	defer iterator.Close()
+
+	batch := make([]datastore.Entry, snapshotBatchSize)
+	for n := iterator.Next(batch); n > 0; n = iterator.Next(batch) {
+		for _, entry := range batch[:n] {
+			if err := encoder.writeEntry(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return encoder.close()
+}
+
+// snapshotEncoder writes the records of a snapshot payload.
+type snapshotEncoder struct {
+	w       *bufio.Writer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func newSnapshotEncoder(w io.Writer) *snapshotEncoder {
+	return &snapshotEncoder{w: bufio.NewWriter(w)}
+}
+
+// writeEntry writes a key along with its value and deadline.
+func (e *snapshotEncoder) writeEntry(entry datastore.Entry) error {
+	e.w.WriteByte(opEntry)
+	e.writeString(entry.Key)
+	if entry.ExpireAt.IsZero() {
+		e.writeVarint(0)
+	} else {
+		e.writeVarint(entry.ExpireAt.UnixMilli())
+	}
+	if err := e.writeValue(entry.Value); err != nil {
+		return fmt.Errorf("key %q: %w", entry.Key, err)
+	}
+	return nil
+}
+
+// close ends the payload and flushes it. It returns the first write error, if any.
+func (e *snapshotEncoder) close() error {
+	e.w.WriteByte(opEOF)
+	return e.w.Flush()
+}
+
+func (e *snapshotEncoder) writeUvarint(n uint64) {
+	e.w.Write(binary.AppendUvarint(e.scratch[:0], n))
+}
+
+func (e *snapshotEncoder) writeVarint(n int64) {
+	e.w.Write(binary.AppendVarint(e.scratch[:0], n))
+}
+
+func (e *snapshotEncoder) writeString(s string) {
+	e.writeUvarint(uint64(len(s)))
+	e.w.WriteString(s)
+}
+
+func (e *snapshotEncoder) writeValue(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		e.w.WriteByte(tagNil)
+	case string:
+		e.w.WriteByte(tagString)
+		e.writeString(v)
+	case []byte:
+		e.w.WriteByte(tagBytes)
+		e.writeString(string(v))
+	case bool:
+		e.w.WriteByte(tagBool)
+		if v {
+			e.w.WriteByte(1)
+		} else {
+			e.w.WriteByte(0)
+		}
+	case int:
+		e.w.WriteByte(tagInt)
+		e.writeVarint(int64(v))
+	case int8:
+		e.w.WriteByte(tagInt8)
+		e.writeVarint(int64(v))
+	case int16:
+		e.w.WriteByte(tagInt16)
+		e.writeVarint(int64(v))
+	case int32:
+		e.w.WriteByte(tagInt32)
+		e.writeVarint(int64(v))
+	case int64:
+		e.w.WriteByte(tagInt64)
+		e.writeVarint(v)
+	case uint:
+		e.w.WriteByte(tagUint)
+		e.writeUvarint(uint64(v))
+	case uint8:
+		e.w.WriteByte(tagUint8)
+		e.writeUvarint(uint64(v))
+	case uint16:
+		e.w.WriteByte(tagUint16)
+		e.writeUvarint(uint64(v))
+	case uint32:
+		e.w.WriteByte(tagUint32)
+		e.writeUvarint(uint64(v))
+	case uint64:
+		e.w.WriteByte(tagUint64)
+		e.writeUvarint(v)
+	case float32:
+		e.w.WriteByte(tagFloat32)
+		e.w.Write(binary.BigEndian.AppendUint32(e.scratch[:0], math.Float32bits(v)))
+	case float64:
+		e.w.WriteByte(tagFloat64)
+		e.w.Write(binary.BigEndian.AppendUint64(e.scratch[:0], math.Float64bits(v)))
+	case []string:
+		e.w.WriteByte(tagStrings)
+		e.writeUvarint(uint64(len(v)))
+		for _, element := range v {
+			e.writeString(element)
+		}
+	case []interface{}:
+		e.w.WriteByte(tagList)
+		e.writeUvarint(uint64(len(v)))
+		for _, element := range v {
+			if err := e.writeValue(element); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		e.w.WriteByte(tagMap)
+		e.writeUvarint(uint64(len(v)))
+		for key, element := range v {
+			e.writeString(key)
+			if err := e.writeValue(element); err != nil {
+				return err
+			}
+		}
+	case *datastore.Stream:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.w.WriteByte(tagStream)
+		e.writeString(string(data))
+	case *datastore.List:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.w.WriteByte(tagListKey)
+		e.writeString(string(data))
+	case *datastore.Hash:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.w.WriteByte(tagHash)
+		e.writeString(string(data))
+	case *datastore.Set:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.w.WriteByte(tagSet)
+		e.writeString(string(data))
+	case *datastore.SortedSet:
+		data, err := v.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.w.WriteByte(tagZSet)
+		e.writeString(string(data))
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, value)
+	}
+	return nil
+}
+
+// snapshotDecoder reads the records of a snapshot payload.
+type snapshotDecoder struct {
+	data []byte
+	pos  int
+}
+
+var errTruncatedPayload = errors.New("unexpected end of payload")
+
+// readEntry reads the next entry. It returns false once the end of the payload is reached.
+func (d *snapshotDecoder) readEntry() (datastore.Entry, bool, error) {
+	var entry datastore.Entry
+	op, err := d.readByte()
+	if err != nil {
+		return entry, false, err
+	}
+	switch op {
+	case opEOF:
+		if d.pos != len(d.data) {
+			return entry, false, errors.New("data after the end of payload")
+		}
+		return entry, false, nil
+	case opEntry:
+	default:
+		return entry, false, fmt.Errorf("unknown opcode 0x%02x", op)
+	}
+
+	if entry.Key, err = d.readString(); err != nil {
+		return entry, false, err
+	}
+	ms, err := d.readVarint()
+	if err != nil {
+		return entry, false, err
+	}
+	if ms != 0 {
+		entry.ExpireAt = time.UnixMilli(ms)
+	}
+	if entry.Value, err = d.readValue(0); err != nil {
+		return entry, false, fmt.Errorf("key %q: %w", entry.Key, err)
+	}
+	return entry, true, nil
+}
+
+func (d *snapshotDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errTruncatedPayload
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *snapshotDecoder) readUvarint() (uint64, error) {
+	n, size := binary.Uvarint(d.data[d.pos:])
+	if size <= 0 {
+		return 0, errTruncatedPayload
+	}
+	d.pos += size
+	return n, nil
+}
+
+func (d *snapshotDecoder) readVarint() (int64, error) {
+	n, size := binary.Varint(d.data[d.pos:])
+	if size <= 0 {
+		return 0, errTruncatedPayload
+	}
+	d.pos += size
+	return n, nil
+}
+
+func (d *snapshotDecoder) readFixed(size int) ([]byte, error) {
+	if len(d.data)-d.pos < size {
+		return nil, errTruncatedPayload
+	}
+	b := d.data[d.pos : d.pos+size]
+	d.pos += size
+	return b, nil
+}
+
+func (d *snapshotDecoder) readString() (string, error) {
+	n, err := d.readUvarint()
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(len(d.data)-d.pos) {
+		return "", errTruncatedPayload
+	}
+	b, err := d.readFixed(int(n))
+	return string(b), err
+}
+
+// readLength reads the number of elements of a list or map, each taking at least one byte.
+func (d *snapshotDecoder) readLength() (int, error) {
+	n, err := d.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)-d.pos) {
+		return 0, errTruncatedPayload
+	}
+	return int(n), nil
+}
+
+func (d *snapshotDecoder) readValue(depth int) (interface{}, error) {
+	if depth > maxValueDepth {
+		return nil, errors.New("value nested too deeply")
+	}
+	tag, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case tagNil:
+		return nil, nil
+	case tagString:
+		return d.readString()
+	case tagBytes:
+		s, err := d.readString()
+		return []byte(s), err
+	case tagBool:
+		b, err := d.readByte()
+		return b != 0, err
+	case tagInt, tagInt8, tagInt16, tagInt32, tagInt64:
+		n, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagInt:
+			return int(n), nil
+		case tagInt8:
+			return int8(n), nil
+		case tagInt16:
+			return int16(n), nil
+		case tagInt32:
+			return int32(n), nil
+		}
+		return n, nil
+	case tagUint, tagUint8, tagUint16, tagUint32, tagUint64:
+		n, err := d.readUvarint()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case tagUint:
+			return uint(n), nil
+		case tagUint8:
+			return uint8(n), nil
+		case tagUint16:
+			return uint16(n), nil
+		case tagUint32:
+			return uint32(n), nil
+		}
+		return n, nil
+	case tagFloat32:
+		b, err := d.readFixed(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case tagFloat64:
+		b, err := d.readFixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case tagStrings:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, n)
+		for i := range values {
+			if values[i], err = d.readString(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case tagList:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = d.readValue(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case tagMap:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			key, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			if values[key], err = d.readValue(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case tagStream:
+		data, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		stream := new(datastore.Stream)
+		if err := stream.UnmarshalBinary([]byte(data)); err != nil {
+			return nil, err
+		}
+		return stream, nil
+	case tagListKey:
+		data, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		list := new(datastore.List)
+		if err := list.UnmarshalBinary([]byte(data)); err != nil {
+			return nil, err
+		}
+		return list, nil
+	case tagHash:
+		data, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		hash := new(datastore.Hash)
+		if err := hash.UnmarshalBinary([]byte(data)); err != nil {
+			return nil, err
+		}
+		return hash, nil
+	case tagSet:
+		data, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		set := new(datastore.Set)
+		if err := set.UnmarshalBinary([]byte(data)); err != nil {
+			return nil, err
+		}
+		return set, nil
+	case tagZSet:
+		data, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		zset := new(datastore.SortedSet)
+		if err := zset.UnmarshalBinary([]byte(data)); err != nil {
+			return nil, err
+		}
+		return zset, nil
+	default:
+		return nil, fmt.Errorf("unknown value type 0x%02x", tag)
+	}
+}
@@ -0,0 +1,110 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// A snapshot file is made of a header, the encoded datastore and a trailer:
+//
+//	magic (8 bytes) | format version (uint16, big endian) | payload | CRC-32C of everything before (uint32, big endian)
+const (
+	snapshotMagic = "VERTEXDB"
+	// snapshotVersion 1 holds gzip compressed JSON, version 2 the typed encoding of encoding.go, compressed with gzip.
+	snapshotVersion = 2
+
+	snapshotHeaderSize  = len(snapshotMagic) + 2
+	snapshotTrailerSize = 4
+)
+
+// gzipMagic starts the snapshots written before the header was introduced, which hold a bare gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrCorruptSnapshot is returned when a snapshot file exists but cannot be trusted.
+	ErrCorruptSnapshot = errors.New("snapshot file is corrupt")
+	// ErrUnsupportedVersion is returned for snapshots written by a newer version of the format.
+	ErrUnsupportedVersion = errors.New("unsupported snapshot format version")
+)
+
+// writeSnapshot frames the payload produced by writePayload with the snapshot header and trailer.
+func writeSnapshot(w io.Writer, writePayload func(w io.Writer) error) error {
+	checksum := crc32.New(crcTable)
+	framed := io.MultiWriter(w, checksum)
+
+	header := binary.BigEndian.AppendUint16([]byte(snapshotMagic), snapshotVersion)
+	if _, err := framed.Write(header); err != nil {
+		return err
+	}
+	if err := writePayload(framed); err != nil {
+		return err
+	}
+	_, err := w.Write(binary.BigEndian.AppendUint32(nil, checksum.Sum32()))
+	return err
+}
+
+// decodeSnapshot checks the header and trailer of a snapshot file and returns its payload and format version.
+// Snapshots predating the header are returned as is, with version 0.
+func decodeSnapshot(data []byte) ([]byte, uint16, error) {
+	if bytes.HasPrefix(data, gzipMagic) {
+		return data, 0, nil
+	}
+	if len(data) < snapshotHeaderSize+snapshotTrailerSize || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, 0, fmt.Errorf("%w: missing header", ErrCorruptSnapshot)
+	}
+
+	body, trailer := data[:len(data)-snapshotTrailerSize], data[len(data)-snapshotTrailerSize:]
+	if sum := crc32.Checksum(body, crcTable); sum != binary.BigEndian.Uint32(trailer) {
+		return nil, 0, fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+	version := binary.BigEndian.Uint16(data[len(snapshotMagic):snapshotHeaderSize])
+	if version > snapshotVersion {
+		return nil, version, fmt.Errorf("%w %d", ErrUnsupportedVersion, version)
+	}
+	return body[snapshotHeaderSize:], version, nil
+}
+
+// writeFileAtomic writes a temporary file next to path with write, flushes it to disk and renames it
+// over path, so that a crash leaves either the previous file or the new one, never a partial one.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	buffered := bufio.NewWriter(tmp)
+	if err := write(buffered); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
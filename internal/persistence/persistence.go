@@ -1,130 +1,312 @@
 package persistence
 
 import (
-    "bytes"
-    "compress/gzip"
-    "encoding/json"
-    "io"
-    "os"
-    "path/filepath"
-    "reflect"
-
-    "github.com/AbdessamadEnabih/Vertex/pkg/config"
-    "github.com/AbdessamadEnabih/Vertex/pkg/datastore"
-    logger "github.com/AbdessamadEnabih/Vertex/pkg/logger"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/config"
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	logger "github.com/AbdessamadEnabih/Vertex/pkg/logger"
 )
 
 func get_datastore_path() string {
-    persistence_config, err := config.GetConfigByField("Persistence")
-    if err != nil {
-        logError("persistence.get_datastore_path: Error getting persistence config", "", err)
-    }
+	persistence_config, err := config.GetConfigByField("Persistence")
+	if err != nil {
+		logError("persistence.get_datastore_path: Error getting persistence config", "", err)
+	}
+
+	dir, _ := os.Getwd()
+
+	return filepath.Join(filepath.Join(dir, reflect.ValueOf(persistence_config).FieldByName("Path").String()), "datastore.data")
+}
+
+func get_aof_path() string {
+	return filepath.Join(filepath.Dir(get_datastore_path()), aofFileName)
+}
+
+// snapshotConfiguration holds the snapshot settings of the persistence section of the config file
+type snapshotConfiguration struct {
+	enabled bool
+	rules   []SaveRule
+}
+
+func getSnapshotConfiguration() (snapshotConfiguration, error) {
+	conf := snapshotConfiguration{enabled: true}
+	persistence_config, err := config.GetConfigByField("Persistence")
+	if err != nil {
+		return conf, err
+	}
+
+	v := reflect.ValueOf(persistence_config)
+	conf.enabled = v.FieldByName("Enabled").Bool()
+	for _, rule := range v.FieldByName("Save").Interface().([]string) {
+		saveRule, err := ParseSaveRule(rule)
+		if err != nil {
+			return conf, err
+		}
+		conf.rules = append(conf.rules, saveRule)
+	}
+	if interval := v.FieldByName("SnapshotInterval").Int(); len(conf.rules) == 0 && interval > 0 {
+		conf.rules = []SaveRule{{Interval: time.Duration(interval) * time.Second, Changes: 1}}
+	}
+	return conf, nil
+}
+
+// appendOnlyConfiguration holds the append-only settings of the persistence section of the config file
+type appendOnlyConfiguration struct {
+	enabled           bool
+	fsync             FsyncPolicy
+	rewritePercentage int
+	rewriteMinSize    int64
+}
+
+func getAppendOnlyConfiguration() (appendOnlyConfiguration, error) {
+	conf := appendOnlyConfiguration{fsync: FsyncEverySec, rewritePercentage: defaultRewritePercentage, rewriteMinSize: defaultRewriteMinSize}
+	persistence_config, err := config.GetConfigByField("Persistence")
+	if err != nil {
+		return conf, err
+	}
+
+	v := reflect.ValueOf(persistence_config)
+	conf.enabled = v.FieldByName("Enabled").Bool() && v.FieldByName("AppendOnly").Bool()
+	if fsync := v.FieldByName("AppendFsync").String(); fsync != "" {
+		conf.fsync = FsyncPolicy(strings.ToLower(fsync))
+	}
+	if percentage := int(v.FieldByName("AutoAOFRewritePercentage").Int()); percentage != 0 {
+		conf.rewritePercentage = percentage
+	}
+	if minSize := v.FieldByName("AutoAOFRewriteMinSize").String(); minSize != "" {
+		if conf.rewriteMinSize, err = config.ParseSize(minSize); err != nil {
+			return conf, err
+		}
+	}
+	return conf, nil
+}
+
+// StartAppendOnly opens the append-only file and logs every subsequent write of datastore in it.
+// It returns nil when append_only, or persistence, is disabled. When the file is empty, it is first rewritten from
+// the current content of datastore, which was loaded from the snapshot.
+func StartAppendOnly(datastore *datastore.DataStore) (*AOF, error) {
+	conf, err := getAppendOnlyConfiguration()
+	if err != nil {
+		logError("persistence.StartAppendOnly: Error getting append only config", "", err)
+		return nil, err
+	}
+	if !conf.enabled {
+		return nil, nil
+	}
+
+	aofpath := get_aof_path()
+	aof, err := OpenAOF(aofpath, conf.fsync)
+	if err != nil {
+		return nil, err
+	}
+	aof.rewritePercentage = conf.rewritePercentage
+	aof.rewriteMinSize = conf.rewriteMinSize
+	aof.Attach(datastore)
+
+	if aof.Size() == 0 {
+		if err := aof.Rewrite(); err != nil {
+			logError("persistence.StartAppendOnly: Error writing the base of the append only file", aofpath, err)
+			aof.Close()
+			return nil, err
+		}
+	}
+	return aof, nil
+}
 
-    dir, _ := os.Getwd()
+// StartSnapshotter returns a Snapshotter saving datastore according to the configured save rules,
+// with the rules already being checked. It returns nil when persistence is disabled.
+func StartSnapshotter(datastore *datastore.DataStore) (*Snapshotter, error) {
+	conf, err := getSnapshotConfiguration()
+	if err != nil {
+		logError("persistence.StartSnapshotter: Error getting persistence config", "", err)
+		return nil, err
+	}
+	if !conf.enabled {
+		return nil, nil
+	}
 
-    return filepath.Join(filepath.Join(dir, reflect.ValueOf(persistence_config).FieldByName("Path").String()), "datastore.data")
+	snapshotter := NewSnapshotter(datastore, get_datastore_path(), conf.rules)
+	snapshotter.Start()
+	return snapshotter, nil
 }
 
+// Save writes a snapshot of datastore, unless persistence is disabled.
 func Save(datastore *datastore.DataStore) error {
-    datastorepath := get_datastore_path()
+	if conf, err := getSnapshotConfiguration(); err == nil && !conf.enabled {
+		return nil
+	}
+	datastorepath := get_datastore_path()
 
-    if err := WriteInDataStoreFile(datastore, datastorepath); err != nil {
-        logError("persistence.Save: Error saving datastore", datastorepath, err)
-        return err
-    }
-    return nil
+	dirty := datastore.Dirty()
+	if err := WriteInDataStoreFile(datastore, datastorepath); err != nil {
+		logError("persistence.Save: Error saving datastore", datastorepath, err)
+		return err
+	}
+	datastore.ClearDirty(dirty)
+	return nil
 }
 
+// WriteInDataStoreFile writes a snapshot of datastore to filepath. The file is replaced atomically,
+// a crash in the middle of the write leaves the previous snapshot untouched. The datastore is streamed
+// from a point-in-time view, writers are not blocked while it is written.
 func WriteInDataStoreFile(datastore *datastore.DataStore, filepath string) error {
-    file, err := os.OpenFile(filepath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
-    if err != nil {
-        logError("persistence.WriteInDataStoreFile: Error opening file for writing", filepath, err)
-        return err
-    }
-    defer file.Close()
-
-    jsonData, err := json.Marshal(datastore)
-    if err != nil {
-        logError("persistence.WriteInDataStoreFile: Error marshaling datastore to JSON", filepath, err)
-        return err
-    }
-
-    var compressedBuffer bytes.Buffer
-    gzipWriter := gzip.NewWriter(&compressedBuffer)
-    _, err = gzipWriter.Write(jsonData)
-    if err != nil {
-        logError("persistence.WriteInDataStoreFile: Error compressing data", filepath, err)
-        return err
-    }
-    gzipWriter.Close()
-    data := compressedBuffer.Bytes()
-
-    _, err = file.Write(data)
-    if err != nil {
-        logError("persistence.WriteInDataStoreFile: Error writing compressed data to file", filepath, err)
-        return err
-    }
-
-    return nil
+	err := writeFileAtomic(filepath, func(w io.Writer) error {
+		return WriteSnapshot(w, datastore, nil)
+	})
+	if err != nil {
+		logError("persistence.WriteInDataStoreFile: Error writing snapshot file", filepath, err)
+		return err
+	}
+
+	return nil
 }
 
+// ReadDataStoreFromFile reads a snapshot written by WriteInDataStoreFile. It returns an error wrapping
+// os.ErrNotExist when the file is missing, and ErrCorruptSnapshot when it cannot be trusted.
 func ReadDataStoreFromFile(filepath string) (*datastore.DataStore, error) {
-    compressedData, err := os.ReadFile(filepath)
-    if err != nil {
-        logError("persistence.ReadDataStoreFromFile: Error reading file", filepath, err)
-        return nil, err
-    }
-
-    compressedBuffer := bytes.NewBuffer(compressedData)
-    gzipReader, err := gzip.NewReader(compressedBuffer)
-    if err != nil {
-        logError("persistence.ReadDataStoreFromFile: Error creating gzip reader", filepath, err)
-        return nil, err
-    }
-    defer gzipReader.Close()
-
-    var decompressedBuffer bytes.Buffer
-    _, err = io.Copy(&decompressedBuffer, gzipReader)
-    if err != nil {
-        logError("persistence.ReadDataStoreFromFile: Error decompressing data", filepath, err)
-        return nil, err
-    }
-
-    var savedDataStore datastore.DataStore
-    err = json.Unmarshal(decompressedBuffer.Bytes(), &savedDataStore)
-    if err != nil {
-        logError("persistence.ReadDataStoreFromFile: Error unmarshaling JSON data", filepath, err)
-        return nil, err
-    }
-
-    return &savedDataStore, nil
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		logError("persistence.ReadDataStoreFromFile: Error reading file", filepath, err)
+		return nil, err
+	}
+
+	entries, err := DecodeSnapshot(data)
+	if err != nil {
+		logError("persistence.ReadDataStoreFromFile: Error decoding snapshot", filepath, err)
+		return nil, err
+	}
+
+	// The loaded datastore is unbounded until its limits are configured
+	savedDataStore := datastore.NewDataStore()
+	savedDataStore.SetLimits(datastore.Limits{})
+	savedDataStore.Restore(entries...)
+	return savedDataStore, nil
+}
+
+// WriteSnapshot writes a snapshot of datastore to w, in the format of the snapshot files.
+// barrier is called as described by datastore.IterateSnapshot.
+func WriteSnapshot(w io.Writer, datastore *datastore.DataStore, barrier func()) error {
+	return writeSnapshot(w, func(w io.Writer) error {
+		gzipWriter := gzip.NewWriter(w)
+		if err := encodeDataStore(datastore, barrier, newSnapshotEncoder(gzipWriter)); err != nil {
+			return err
+		}
+		return gzipWriter.Close()
+	})
 }
 
+// DecodeSnapshot returns the entries of a snapshot written by WriteSnapshot or WriteInDataStoreFile.
+// It returns ErrCorruptSnapshot when the data cannot be trusted.
+func DecodeSnapshot(data []byte) ([]datastore.Entry, error) {
+	compressedData, version, err := decodeSnapshot(data)
+	if err != nil {
+		return nil, err
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(compressedData))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	defer gzipReader.Close()
+
+	var decompressedBuffer bytes.Buffer
+	if _, err := io.Copy(&decompressedBuffer, gzipReader); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+
+	// Snapshots written before the typed encoding hold JSON
+	if version < 2 {
+		var savedDataStore datastore.DataStore
+		if err := json.Unmarshal(decompressedBuffer.Bytes(), &savedDataStore); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+		if savedDataStore.InternalDataStore == nil {
+			return nil, nil
+		}
+		return savedDataStore.Snapshot(nil), nil
+	}
+
+	var entries []datastore.Entry
+	decoder := &snapshotDecoder{data: decompressedBuffer.Bytes()}
+	for {
+		entry, ok, err := decoder.readEntry()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+		if !ok {
+			return entries, nil
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Load returns the persisted datastore, or an empty one when nothing was persisted yet or persistence is disabled.
+// It fails, rather than starting empty, when the persisted data is corrupt or unreadable.
 func Load() (*datastore.DataStore, error) {
-    datastorepath := get_datastore_path()
-
-    _, err := os.Stat(datastorepath)
-    if os.IsNotExist(err) {
-        logError("persistence.Load: DataStore not found", datastorepath, err)
-        return datastore.NewDataStore(), nil
-    }
-    if err == nil {
-        savedDataStore, err := ReadDataStoreFromFile(datastorepath)
-        if err != nil {
-            logError("persistence.Load: Error reading datastore file", datastorepath, err)
-            return datastore.NewDataStore(), err
-        }
-        return savedDataStore, nil
-    } else {
-        logError("persistence.Load: Error checking file existence", datastorepath, err)
-        return datastore.NewDataStore(), err
-    }
+	if conf, err := getSnapshotConfiguration(); err == nil && !conf.enabled {
+		return datastore.NewDataStore(), nil
+	}
+
+	loaded, err := load()
+	if err != nil {
+		return nil, err
+	}
+	// Loading replays writes, the loaded datastore is nonetheless in sync with the disk
+	loaded.ClearDirty(loaded.Dirty())
+	return loaded, nil
+}
+
+func load() (*datastore.DataStore, error) {
+	// The append-only file holds every write, it takes precedence over the snapshot
+	if conf, err := getAppendOnlyConfiguration(); err == nil && conf.enabled {
+		aofpath := get_aof_path()
+		if _, err := os.Stat(aofpath); err == nil {
+			return loadAppendOnly(aofpath)
+		}
+	}
+
+	datastorepath := get_datastore_path()
+
+	savedDataStore, err := ReadDataStoreFromFile(datastorepath)
+	if errors.Is(err, os.ErrNotExist) {
+		logError("persistence.Load: DataStore not found", datastorepath, err)
+		return datastore.NewDataStore(), nil
+	}
+	if err != nil {
+		logError("persistence.Load: Error reading datastore file", datastorepath, err)
+		return nil, err
+	}
+	return savedDataStore, nil
+}
+
+// loadAppendOnly rebuilds a datastore by replaying the append-only file at aofpath.
+func loadAppendOnly(aofpath string) (*datastore.DataStore, error) {
+	// Like a loaded snapshot, the replayed datastore is unbounded until its limits are configured, so
+	// that no write of the log is evicted or refused while it is replayed
+	loaded := datastore.NewDataStore()
+	loaded.SetLimits(datastore.Limits{})
+	if err := ReplayAOF(aofpath, loaded); err != nil {
+		logError("persistence.Load: Error replaying append only file", aofpath, err)
+		return nil, err
+	}
+	return loaded, nil
 }
 
 func logError(message, filepath string, err error) {
-    if filepath != "" {
-        logger.Log(message+" at path "+filepath+": "+err.Error(), "ERROR")
-    } else {
-        logger.Log(message+": "+err.Error(), "ERROR")
-    }
+	if filepath != "" {
+		logger.Log(message+" at path "+filepath+": "+err.Error(), "ERROR")
+	} else {
+		logger.Log(message+": "+err.Error(), "ERROR")
+	}
 }
@@ -1,9 +1,17 @@
 package persistence_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/AbdessamadEnabih/Vertex/internal/persistence"
 	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
@@ -61,3 +69,396 @@ func TestReadDataStoreFromFile(t *testing.T) {
 		t.Fatalf("Expected %v, got %v", val, value)
 	}
 }
+
+func TestReadDataStoreFromFile_KeepsDeadlines(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ds := datastore.NewDataStore()
+	ds.SetWithTTL("volatile", "value", time.Minute)
+	ds.Set("persistent", "value")
+
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	if err := persistence.WriteInDataStoreFile(ds, datastorePath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if ttl, _ := loadedDS.TTL("volatile"); ttl <= 59*time.Second || ttl > time.Minute {
+		t.Fatalf("Expected a TTL close to one minute, got %v", ttl)
+	}
+	if ttl, _ := loadedDS.TTL("persistent"); ttl != datastore.NoTTL {
+		t.Fatalf("Expected no TTL, got %v", ttl)
+	}
+}
+
+func TestWriteInDataStoreFile_ReplacesAtomically(t *testing.T) {
+	setup()
+	defer teardown()
+
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	for _, value := range []string{"first", "second"} {
+		ds := datastore.NewDataStore()
+		ds.Set("key", value)
+		if err := persistence.WriteInDataStoreFile(ds, datastorePath); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	entries, _ := os.ReadDir("testdata")
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary file left behind, got %v", entries)
+	}
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := loadedDS.Get("key"); value != "second" {
+		t.Errorf("Expected second, got %v", value)
+	}
+}
+
+func TestReadDataStoreFromFile_Missing(t *testing.T) {
+	_, err := persistence.ReadDataStoreFromFile(filepath.Join(t.TempDir(), "datastore.data"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestReadDataStoreFromFile_Corrupt(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ds := datastore.NewDataStore()
+	ds.Set("key", "value")
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	if err := persistence.WriteInDataStoreFile(ds, datastorePath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data, _ := os.ReadFile(datastorePath)
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+	corruptions := map[string][]byte{
+		"flipped byte": flipped,
+		"truncated":    data[:len(data)-3],
+		"no header":    []byte("not a snapshot"),
+	}
+	for name, corrupt := range corruptions {
+		os.WriteFile(datastorePath, corrupt, 0644)
+		if _, err := persistence.ReadDataStoreFromFile(datastorePath); !errors.Is(err, persistence.ErrCorruptSnapshot) {
+			t.Errorf("%s: Expected ErrCorruptSnapshot, got %v", name, err)
+		}
+	}
+}
+
+func TestReadDataStoreFromFile_UnsupportedVersion(t *testing.T) {
+	setup()
+	defer teardown()
+
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	data := append([]byte("VERTEXDB"), 0xff, 0xff)
+	data = binary.BigEndian.AppendUint32(data, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	os.WriteFile(datastorePath, data, 0644)
+
+	if _, err := persistence.ReadDataStoreFromFile(datastorePath); !errors.Is(err, persistence.ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestReadDataStoreFromFile_LegacyFormat(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Snapshots written before the header was introduced are a bare gzip stream
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	gzipWriter.Write([]byte(`{"InternalDataStore":{"Data":{"key":"value"}}}`))
+	gzipWriter.Close()
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	os.WriteFile(datastorePath, buf.Bytes(), 0644)
+
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := loadedDS.Get("key"); value != "value" {
+		t.Errorf("Expected value, got %v", value)
+	}
+}
+
+func TestReadDataStoreFromFile_PreservesTypes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	values := map[string]interface{}{
+		"string":  "value",
+		"empty":   "",
+		"bytes":   []byte{0, 1, 0xff},
+		"bool":    true,
+		"int":     42,
+		"int8":    int8(-8),
+		"int64":   int64(-1 << 60),
+		"uint":    uint(7),
+		"uint64":  uint64(1 << 63),
+		"float32": float32(1.5),
+		"float64": 3.14,
+		"strings": []string{"a", "b"},
+		"list":    []interface{}{1, "two", []byte("three"), nil},
+		"map":     map[string]interface{}{"nested": map[string]interface{}{"n": int64(1)}},
+	}
+	ds := datastore.NewDataStore()
+	for key, value := range values {
+		if err := ds.Set(key, value); err != nil {
+			t.Fatalf("Expected no error setting %s, got %v", key, err)
+		}
+	}
+	ds.Expire("int", time.Minute)
+
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	if err := persistence.WriteInDataStoreFile(ds, datastorePath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for key, expected := range values {
+		value, err := loadedDS.Get(key)
+		if err != nil {
+			t.Errorf("Expected %s to be restored, got %v", key, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, expected) {
+			t.Errorf("Expected %s to be %#v (%T), got %#v (%T)", key, expected, expected, value, value)
+		}
+	}
+	if ttl, _ := loadedDS.TTL("int"); ttl <= 59*time.Second || ttl > time.Minute {
+		t.Errorf("Expected a TTL close to one minute, got %v", ttl)
+	}
+}
+
+func TestReadDataStoreFromFile_PreservesStreams(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ds := datastore.NewDataStore()
+	ds.XAdd("stream", datastore.XAddArgs{ID: datastore.StreamID{Ms: 1}, Fields: []string{"a", "1"}})
+	ds.XAdd("stream", datastore.XAddArgs{ID: datastore.StreamID{Ms: 2}, Fields: []string{"b", "2"}})
+	ds.XGroupCreate("stream", "group", datastore.StreamID{}, false, false)
+	ds.XReadGroup("stream", "group", "consumer", 1, false)
+
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	if err := persistence.WriteInDataStoreFile(ds, datastorePath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if n, _ := loadedDS.XLen("stream"); n != 2 {
+		t.Errorf("Expected the 2 entries to be restored, got %d", n)
+	}
+	// Consumers resume where they stopped
+	if entries, _ := loadedDS.XReadGroup("stream", "group", "consumer", 0, false); len(entries) != 1 || entries[0].ID.Ms != 2 {
+		t.Errorf("Expected the entry not delivered yet, got %v", entries)
+	}
+	if n, _ := loadedDS.XAck("stream", "group", []datastore.StreamID{{Ms: 1}}); n != 1 {
+		t.Errorf("Expected the pending entry to be restored")
+	}
+}
+
+func TestReadDataStoreFromFile_PreservesLists(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ds := datastore.NewDataStore()
+	ds.RPush("list", "a", "b", "c")
+	ds.LPop("list", 1)
+
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	if err := persistence.WriteInDataStoreFile(ds, datastorePath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if values, _ := loadedDS.LRange("list", 0, -1); !reflect.DeepEqual(values, []string{"b", "c"}) {
+		t.Errorf("Expected the elements to be restored, got %v", values)
+	}
+}
+
+func TestReadDataStoreFromFile_PreservesHashes(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ds := datastore.NewDataStore()
+	ds.HSet("session", "user", "alice", "visits", "3")
+
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	if err := persistence.WriteInDataStoreFile(ds, datastorePath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if fields, _ := loadedDS.HGetAll("session"); !reflect.DeepEqual(fields, map[string]string{"user": "alice", "visits": "3"}) {
+		t.Errorf("Expected the fields to be restored, got %v", fields)
+	}
+	if value, _ := loadedDS.HIncrBy("session", "visits", 1); value != 4 {
+		t.Errorf("Expected the restored field to be incremented, got %d", value)
+	}
+}
+
+func TestReadDataStoreFromFile_PreservesSetsAndSortedSets(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ds := datastore.NewDataStore()
+	ds.SAdd("tags", "go", "redis")
+	ds.ZAdd("scores", datastore.ZAddFlags{}, datastore.ZMember{Member: "alice", Score: 2.5}, datastore.ZMember{Member: "bob", Score: 1})
+
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	if err := persistence.WriteInDataStoreFile(ds, datastorePath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if members, _ := loadedDS.SMembers("tags"); !reflect.DeepEqual(members, []string{"go", "redis"}) {
+		t.Errorf("Expected the set members to be restored, got %v", members)
+	}
+	expected := []datastore.ZMember{{Member: "bob", Score: 1}, {Member: "alice", Score: 2.5}}
+	if members, _ := loadedDS.ZRange("scores", 0, -1, false); !reflect.DeepEqual(members, expected) {
+		t.Errorf("Expected the sorted set members to be restored, got %v", members)
+	}
+	if rank, _, _ := loadedDS.ZRank("scores", "alice", false); rank != 1 {
+		t.Errorf("Expected the restored sorted set to be ranked, got %d", rank)
+	}
+}
+
+func TestWriteInDataStoreFile_UnsupportedType(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ds := datastore.NewDataStore()
+	ds.Set("channel", make(chan int))
+
+	err := persistence.WriteInDataStoreFile(ds, filepath.Join("testdata", "datastore.data"))
+	if !errors.Is(err, persistence.ErrUnsupportedType) {
+		t.Errorf("Expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestReadDataStoreFromFile_JSONVersion(t *testing.T) {
+	setup()
+	defer teardown()
+
+	// Version 1 snapshots hold gzip compressed JSON
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	gzipWriter.Write([]byte(`{"InternalDataStore":{"Data":{"key":"value"}}}`))
+	gzipWriter.Close()
+	data := append([]byte("VERTEXDB"), 0, 1)
+	data = append(data, buf.Bytes()...)
+	data = binary.BigEndian.AppendUint32(data, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	os.WriteFile(datastorePath, data, 0644)
+
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := loadedDS.Get("key"); value != "value" {
+		t.Errorf("Expected value, got %v", value)
+	}
+}
+
+func TestWriteInDataStoreFile_ConcurrentWriters(t *testing.T) {
+	setup()
+	defer teardown()
+
+	ds := datastore.NewDataStore()
+	for i := 0; i < 1000; i++ {
+		ds.Set(fmt.Sprint(i), "value")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1000; i < 2000; i++ {
+			ds.Set(fmt.Sprint(i), "value")
+			ds.Delete(fmt.Sprint(i - 1000))
+		}
+	}()
+	datastorePath := filepath.Join("testdata", "datastore.data")
+	if err := persistence.WriteInDataStoreFile(ds, datastorePath); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	<-done
+
+	loadedDS, err := persistence.ReadDataStoreFromFile(datastorePath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The writer replaces i by i+1000: a point-in-time view always holds one of them
+	for i := 0; i < 1000; i++ {
+		_, errOld := loadedDS.Get(fmt.Sprint(i))
+		_, errNew := loadedDS.Get(fmt.Sprint(i + 1000))
+		if errOld != nil && errNew != nil {
+			t.Fatalf("Expected key %d or %d in the snapshot", i, i+1000)
+		}
+	}
+}
+
+// useConfig points the configuration at a file holding yaml for the rest of the test.
+func useConfig(t *testing.T, yaml string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	t.Setenv("VERTEX_CONFIG_PATH", path)
+}
+
+func TestLoad_AppendOnlyKeepsSavedWrites(t *testing.T) {
+	setup()
+	defer teardown()
+	useConfig(t, "persistence:\n  enabled: true\n  append_only: true\n  appendfsync: always\n  path: testdata\n")
+
+	// Like the CLI: load, log the writes, then save a snapshot on exit
+	ds, err := persistence.Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	aof, err := persistence.StartAppendOnly(ds)
+	if err != nil || aof == nil {
+		t.Fatalf("Expected the append only file to be opened, got %v, %v", aof, err)
+	}
+	ds.Set("key", "value")
+	if err := persistence.Save(ds); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	aof.Close()
+
+	// The append-only file, which is loaded rather than the snapshot, holds the write too
+	loaded, err := persistence.Load()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := loaded.Get("key"); value != "value" {
+		t.Errorf("Expected the write to survive a restart, got %v", value)
+	}
+}
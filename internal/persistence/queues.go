@@ -0,0 +1,106 @@
+package persistence
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+	"github.com/AbdessamadEnabih/Vertex/pkg/config"
+)
+
+// queueLogFileName is the log of the queue broker. Unlike the datastore, queues have no snapshot:
+// they are only persisted through this log, which is compacted like the append-only file.
+const queueLogFileName = "queues.aof"
+
+func getQueueLogPath() string {
+	return filepath.Join(filepath.Dir(get_datastore_path()), queueLogFileName)
+}
+
+// getQueueOptions returns the default queue options from the broker section of the config file.
+func getQueueOptions() (queue.Options, error) {
+	var options queue.Options
+	brokerConfig, err := config.GetConfigByField("Broker")
+	if err != nil {
+		return options, err
+	}
+
+	v := reflect.ValueOf(brokerConfig)
+	if options.VisibilityTimeout, err = config.ParseDuration(v.FieldByName("VisibilityTimeout").String()); err != nil {
+		return options, err
+	}
+	options.MaxDeliveries = int(v.FieldByName("MaxDeliveries").Int())
+	if options.VisibilityTimeout < 0 || options.MaxDeliveries < 0 {
+		return options, queue.ErrInvalidOptions
+	}
+	return options, nil
+}
+
+// LoadQueues returns the persisted queue broker, or an empty one when nothing was persisted yet or persistence
+// is disabled. It fails, rather than starting empty, when the log is corrupt or unreadable.
+func LoadQueues() (*queue.Broker, error) {
+	options, err := getQueueOptions()
+	if err != nil {
+		logError("persistence.LoadQueues: Error getting broker config", "", err)
+		return nil, err
+	}
+	broker := queue.NewBroker(options)
+	if conf, err := getSnapshotConfiguration(); err == nil && !conf.enabled {
+		return broker, nil
+	}
+
+	path := getQueueLogPath()
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return broker, nil
+	}
+	if err := ReplayQueueLog(path, broker); err != nil {
+		logError("persistence.LoadQueues: Error replaying queue log", path, err)
+		return nil, err
+	}
+	return broker, nil
+}
+
+// ReplayQueueLog applies the changes logged in the queue log at path to broker, like ReplayAOF.
+func ReplayQueueLog(path string, broker *queue.Broker) error {
+	return replayLog("persistence.ReplayQueueLog", path, broker.Apply)
+}
+
+// StartQueueLog opens the queue log and logs every subsequent change of broker in it, flushing it
+// according to appendfsync. It returns nil when persistence is disabled.
+func StartQueueLog(broker *queue.Broker) (*AOF, error) {
+	if conf, err := getSnapshotConfiguration(); err == nil && !conf.enabled {
+		return nil, nil
+	}
+	conf, err := getAppendOnlyConfiguration()
+	if err != nil {
+		logError("persistence.StartQueueLog: Error getting append only config", "", err)
+		return nil, err
+	}
+
+	log, err := OpenAOF(getQueueLogPath(), conf.fsync)
+	if err != nil {
+		return nil, err
+	}
+	log.rewritePercentage = conf.rewritePercentage
+	log.rewriteMinSize = conf.rewriteMinSize
+	log.AttachBroker(broker)
+	return log, nil
+}
+
+// AttachBroker is Attach for a queue broker: every change of broker is logged.
+func (a *AOF) AttachBroker(broker *queue.Broker) {
+	a.attach(func(w io.Writer, barrier func()) error {
+		var encoded []byte
+		for _, args := range broker.Snapshot(barrier) {
+			encoded = appendCommand(encoded[:0], args)
+			if _, err := w.Write(encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	broker.AddPropagator(a.Append)
+	a.start()
+}
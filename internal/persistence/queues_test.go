@@ -0,0 +1,56 @@
+package persistence_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+	"github.com/AbdessamadEnabih/Vertex/internal/persistence"
+)
+
+func TestAOF_QueueLogReplayAndRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queues.aof")
+	log, err := persistence.OpenAOF(path, persistence.FsyncAlways)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	broker := queue.NewBroker(queue.Options{})
+	log.AttachBroker(broker)
+	defer log.Close()
+
+	broker.Configure("jobs", queue.Options{MaxDeliveries: 3})
+	for i := 0; i < 50; i++ {
+		broker.Enqueue("jobs", "done", 0)
+		msg, _ := broker.Reserve("jobs", 0)
+		broker.Ack("jobs", msg.Receipt())
+	}
+	broker.Enqueue("jobs", "reserved", 0)
+	reserved, _ := broker.Reserve("jobs", time.Hour)
+	before := log.Size()
+
+	if err := log.Rewrite(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if after := log.Size(); after >= before {
+		t.Errorf("Expected the rewrite to shrink the log from %d bytes, got %d", before, after)
+	}
+
+	// Changes after the rewrite go to the new log
+	broker.Enqueue("jobs", "after", 0)
+	log.Close()
+
+	replayed := queue.NewBroker(queue.Options{})
+	if err := persistence.ReplayQueueLog(path, replayed); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stats := replayed.Stats("jobs"); stats != (queue.Stats{Ready: 1, Reserved: 1}) {
+		t.Errorf("Expected 1 ready and 1 reserved message, got %+v", stats)
+	}
+	if err := replayed.Ack("jobs", reserved.Receipt()); err != nil {
+		t.Errorf("Expected the reservation to survive the rewrite, got %v", err)
+	}
+	if options := replayed.Options("jobs"); options.MaxDeliveries != 3 {
+		t.Errorf("Expected the options to survive the rewrite, got %+v", options)
+	}
+}
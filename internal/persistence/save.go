@@ -0,0 +1,184 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	logger "github.com/AbdessamadEnabih/Vertex/pkg/logger"
+)
+
+const (
+	// saveCheckInterval is how often the save rules are checked.
+	saveCheckInterval = time.Second
+	// saveRetryDelay is the time to wait after a failed save before the rules may trigger another one.
+	saveRetryDelay = 5 * time.Second
+)
+
+var (
+	// ErrSaveInProgress is returned when a save is requested while a background save is running.
+	ErrSaveInProgress = errors.New("background save already in progress")
+	// ErrPersistenceDisabled is returned by the save commands when persistence is disabled.
+	ErrPersistenceDisabled = errors.New("persistence is disabled")
+)
+
+// SaveRule triggers a snapshot once Interval elapsed and at least Changes writes happened since the last one.
+type SaveRule struct {
+	Interval time.Duration
+	Changes  int64
+}
+
+// ParseSaveRule parses a rule written as "<seconds> <changes>", such as "60 1000".
+func ParseSaveRule(rule string) (SaveRule, error) {
+	fields := strings.Fields(rule)
+	if len(fields) != 2 {
+		return SaveRule{}, fmt.Errorf("invalid save rule %q, expected \"<seconds> <changes>\"", rule)
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || seconds < 0 {
+		return SaveRule{}, fmt.Errorf("invalid save rule %q: invalid seconds", rule)
+	}
+	changes, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || changes < 0 {
+		return SaveRule{}, fmt.Errorf("invalid save rule %q: invalid changes", rule)
+	}
+	return SaveRule{Interval: time.Duration(seconds) * time.Second, Changes: changes}, nil
+}
+
+// Snapshotter saves a datastore to a snapshot file, on demand or when one of its rules is met.
+type Snapshotter struct {
+	datastore *datastore.DataStore
+	path      string
+	rules     []SaveRule
+
+	mu     sync.Mutex
+	saving bool
+	// lastSave is the time of the last successful save, lastAttempt and lastErr those of the last save.
+	lastSave    time.Time
+	lastAttempt time.Time
+	lastErr     error
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewSnapshotter returns a Snapshotter saving ds to path. The datastore is considered saved at creation.
+func NewSnapshotter(ds *datastore.DataStore, path string, rules []SaveRule) *Snapshotter {
+	now := time.Now()
+	return &Snapshotter{
+		datastore:   ds,
+		path:        path,
+		rules:       rules,
+		lastSave:    now,
+		lastAttempt: now,
+		done:        make(chan struct{}),
+	}
+}
+
+// Start checks the save rules every saveCheckInterval and starts a background save when one is met.
+func (s *Snapshotter) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(saveCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				if s.shouldSave(time.Now()) {
+					s.BackgroundSave()
+				}
+			}
+		}
+	}()
+}
+
+// Close stops checking the rules and waits for a running background save.
+func (s *Snapshotter) Close() {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.wg.Wait()
+}
+
+// shouldSave reports whether a rule is met at now.
+func (s *Snapshotter) shouldSave(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saving || (s.lastErr != nil && now.Sub(s.lastAttempt) < saveRetryDelay) {
+		return false
+	}
+	dirty := s.datastore.Dirty()
+	for _, rule := range s.rules {
+		if dirty >= rule.Changes && dirty > 0 && now.Sub(s.lastSave) >= rule.Interval {
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes a snapshot and waits for it to complete.
+func (s *Snapshotter) Save() error {
+	if err := s.begin(); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// BackgroundSave starts writing a snapshot and returns without waiting for it.
+func (s *Snapshotter) BackgroundSave() error {
+	if err := s.begin(); err != nil {
+		return err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.save()
+	}()
+	return nil
+}
+
+// LastSave returns the time of the last successful save.
+func (s *Snapshotter) LastSave() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSave
+}
+
+// begin marks a save as running, or fails when one already is.
+func (s *Snapshotter) begin() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saving {
+		return ErrSaveInProgress
+	}
+	s.saving = true
+	return nil
+}
+
+func (s *Snapshotter) save() error {
+	// Writes happening while the snapshot is taken stay dirty, at worst they are saved twice
+	dirty := s.datastore.Dirty()
+	err := WriteInDataStoreFile(s.datastore, s.path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saving = false
+	s.lastAttempt = time.Now()
+	s.lastErr = err
+	if err != nil {
+		logError("persistence.Snapshotter: Error saving datastore", s.path, err)
+		return err
+	}
+	s.lastSave = s.lastAttempt
+	s.datastore.ClearDirty(dirty)
+	logger.Log("persistence.Snapshotter: DataStore saved at path "+s.path, "INFO")
+	return nil
+}
@@ -0,0 +1,82 @@
+package persistence_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/persistence"
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+)
+
+func TestParseSaveRule(t *testing.T) {
+	rule, err := persistence.ParseSaveRule("60 1000")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rule.Interval != time.Minute || rule.Changes != 1000 {
+		t.Errorf("Expected 1m0s after 1000 changes, got %v after %d changes", rule.Interval, rule.Changes)
+	}
+
+	for _, invalid := range []string{"", "60", "60 1000 1", "a 1", "60 -1"} {
+		if _, err := persistence.ParseSaveRule(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestSnapshotter_SaveClearsDirty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "datastore.data")
+	ds := datastore.NewDataStore()
+	ds.Set("a", "1")
+	ds.Set("b", "2")
+
+	snapshotter := persistence.NewSnapshotter(ds, path, nil)
+	before := snapshotter.LastSave()
+	time.Sleep(time.Millisecond)
+	if err := snapshotter.Save(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if dirty := ds.Dirty(); dirty != 0 {
+		t.Errorf("Expected no dirty writes after a save, got %d", dirty)
+	}
+	if !snapshotter.LastSave().After(before) {
+		t.Errorf("Expected LastSave to advance")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the snapshot to be written, got %v", err)
+	}
+}
+
+func TestSnapshotter_RulesTriggerSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "datastore.data")
+	ds := datastore.NewDataStore()
+	snapshotter := persistence.NewSnapshotter(ds, path, []persistence.SaveRule{{Interval: 0, Changes: 2}})
+	snapshotter.Start()
+	defer snapshotter.Close()
+
+	// A single change does not meet the rule
+	ds.Set("a", "1")
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected no snapshot before the rule is met, got %v", err)
+	}
+
+	ds.Set("b", "2")
+	deadline := time.Now().Add(3 * time.Second)
+	for ds.Dirty() != 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if ds.Dirty() != 0 {
+		t.Fatalf("Expected the rule to trigger a save")
+	}
+	loaded, err := persistence.ReadDataStoreFromFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(loaded.GetAll()) != 2 {
+		t.Errorf("Expected 2 keys, got %v", loaded.GetAll())
+	}
+}
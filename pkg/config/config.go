@@ -23,46 +23,115 @@ type Config struct {
 		MaxKeyAge         string `yaml:"max_key_age"`
 		MaxSize           string `yaml:"max_size"`
 		MaxAllowedEntries int    `yaml:"max_allowed_entries"`
-	} `yaml:"state"`
+		EvictionPolicy    string `yaml:"eviction_policy"`
+	} `yaml:"store"`
 	Server struct {
 		Adress string `yaml:"adress"`
 		Port   int    `yaml:"port"`
 		SSL    bool   `yaml:"ssl"`
+		// TLSPort, when set, serves TLS connections on that port in addition to port, which serves plain
+		// connections unless ssl is set
+		TLSPort int `yaml:"tls_port"`
+		// TLSCertFile, TLSKeyFile and TLSCAFile are the certificate of the server, its key and the CA certificates
+		// that client and primary certificates are verified with, reloaded on SIGHUP and when they change
+		TLSCertFile string `yaml:"tls_cert_file"`
+		TLSKeyFile  string `yaml:"tls_key_file"`
+		TLSCAFile   string `yaml:"tls_ca_file"`
+		// TLSClientAuth is "none", "optional" or "require" (default), whether clients must present a certificate
+		TLSClientAuth string `yaml:"tls_client_auth"`
+		// TLSMinVersion is the oldest TLS version accepted, "1.2" by default
+		TLSMinVersion string `yaml:"tls_min_version"`
+		// TLSCiphers restricts the TLS 1.2 cipher suites, such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+		TLSCiphers []string `yaml:"tls_ciphers"`
+		// Protocol is "resp" (default) or "legacy" for the newline-delimited text protocol
+		Protocol string `yaml:"protocol"`
+		// MaxBulkLength bounds the size of a single key or value sent by clients, such as "512MB"
+		MaxBulkLength string `yaml:"max_bulk_length"`
+		// ReplicaOf is the "<host> <port>" of the primary this server replicates, empty for a primary
+		ReplicaOf string `yaml:"replicaof"`
+		// ReplBacklogSize is the amount of replication stream kept for partial resynchronizations, such as "1MB"
+		ReplBacklogSize string `yaml:"repl_backlog_size"`
+		// PubSubOutputBufferLimit is the amount of messages pending for a subscriber before it is disconnected, such as "32MB"
+		PubSubOutputBufferLimit string `yaml:"pubsub_output_buffer_limit"`
+		// PrimaryUser and PrimaryPassword authenticate a replica to its primary when the primary has ACL users
+		PrimaryUser     string `yaml:"primary_user"`
+		PrimaryPassword string `yaml:"primary_password"`
+		// MaxClients bounds the connections served at once, 10000 by default
+		MaxClients int `yaml:"maxclients"`
+		// IdleTimeout closes the connections sending no command for that long, such as "5m", and ReadTimeout
+		// those taking longer to send a whole command, both disabled when empty or "0"
+		IdleTimeout string `yaml:"idle_timeout"`
+		ReadTimeout string `yaml:"read_timeout"`
+		// TCPKeepAlive is the period of TCP keepalive probes, "300s" by default and disabled with "0"
+		TCPKeepAlive string `yaml:"tcp_keepalive"`
 	} `yaml:"server"`
+	ACL struct {
+		// Users are the users clients authenticate as with AUTH. Without users, clients need no password
+		// and may run every command.
+		Users []ACLUser `yaml:"users"`
+	} `yaml:"acl"`
 	Persistence struct {
 		Path             string `yaml:"path"`
 		SnapshotInterval int    `yaml:"snapshot_interval"`
-		Enabled          bool   `yaml:"enabled"`
-		AppendOnly       bool   `yaml:"append_only"`
+		// Save lists "<seconds> <changes>" rules: a snapshot is taken once that many seconds
+		// and changes passed since the last one. When empty, snapshot_interval is used.
+		Save       []string `yaml:"save"`
+		Enabled    bool     `yaml:"enabled"`
+		AppendOnly bool     `yaml:"append_only"`
+		// AppendFsync is "always", "everysec" (default) or "no"
+		AppendFsync string `yaml:"appendfsync"`
+		// AutoAOFRewritePercentage and AutoAOFRewriteMinSize trigger a rewrite of the append-only file
+		// once it grew by that percentage since the last rewrite and is bigger than that size
+		AutoAOFRewritePercentage int    `yaml:"auto_aof_rewrite_percentage"`
+		AutoAOFRewriteMinSize    string `yaml:"auto_aof_rewrite_min_size"`
 	} `yaml:"persistence"`
+	Broker struct {
+		// VisibilityTimeout is how long a reserved message stays hidden before it is delivered again, such as "30s"
+		VisibilityTimeout string `yaml:"visibility_timeout"`
+		// MaxDeliveries moves a message to the dead-letter queue after that many deliveries, 0 for no limit
+		MaxDeliveries int `yaml:"max_deliveries"`
+	} `yaml:"broker"`
+}
+
+// ACLUser is a user of the acl section of the config file.
+type ACLUser struct {
+	Name string `yaml:"name"`
+	// Passwords are the SHA-256 hashes of the passwords of the user, in hexadecimal
+	Passwords []string `yaml:"passwords"`
+	// NoPass lets the user authenticate with any password
+	NoPass bool `yaml:"nopass"`
+	// Categories are the command categories the user may run: read, write, admin, pubsub or all
+	Categories []string `yaml:"categories"`
+	// Keys are the glob-style patterns of the keys the user may access, such as "session:*"
+	Keys []string `yaml:"keys"`
 }
 
 func getConfigPath() string {
-    // Use the config path if explicitly set
-    if configPath := os.Getenv("VERTEX_CONFIG_PATH"); configPath != "" {
-        return configPath
-    }
+	// Use the config path if explicitly set
+	if configPath := os.Getenv("VERTEX_CONFIG_PATH"); configPath != "" {
+		return configPath
+	}
 
-    // Default environment to "development" if not set
-    vertexEnv := os.Getenv("VERTEX_ENV")
-    if vertexEnv == "" {
-        vertexEnv = "development"
-    }
+	// Default environment to "development" if not set
+	vertexEnv := os.Getenv("VERTEX_ENV")
+	if vertexEnv == "" {
+		vertexEnv = "development"
+	}
 
-    switch vertexEnv {
-    case "production":
-        return "/etc/vertex/config.yaml"
-    case "development":
-        _, filename, _, ok := runtime.Caller(0)
-        if !ok {
-            panic("unable to determine caller information")
-        }
-        // Assuming this file is in [project_root]/pkg/config, move up two directories.
-        projectRoot := filepath.Join(filepath.Dir(filename), "..", "..")
-        return filepath.Join(projectRoot, "configs", "config.yaml")
-    default:
-        return "configs/config.yaml"
-    }
+	switch vertexEnv {
+	case "production":
+		return "/etc/vertex/config.yaml"
+	case "development":
+		_, filename, _, ok := runtime.Caller(0)
+		if !ok {
+			panic("unable to determine caller information")
+		}
+		// Assuming this file is in [project_root]/pkg/config, move up two directories.
+		projectRoot := filepath.Join(filepath.Dir(filename), "..", "..")
+		return filepath.Join(projectRoot, "configs", "config.yaml")
+	default:
+		return "configs/config.yaml"
+	}
 }
 
 func LoadConfig() *Config {
@@ -1,11 +1,22 @@
 package datastore
 
-import "github.com/AbdessamadEnabih/Vertex/internal/datastore"
+import (
+	"reflect"
+	"time"
+
+	"github.com/AbdessamadEnabih/Vertex/internal/datastore"
+	"github.com/AbdessamadEnabih/Vertex/pkg/config"
+)
+
+// NoTTL is returned by TTL for keys that exist but have no associated expire.
+const NoTTL = datastore.NoTTL
 
 type DataStore struct {
 	InternalDataStore *datastore.DataStore
 }
 
+// NewDataStore returns an empty datastore without limits, which never evicts keys until SetLimits or
+// ApplyConfig bounds it.
 func NewDataStore() *DataStore {
 	return &DataStore{
 		InternalDataStore: datastore.NewDataStore(),
@@ -16,6 +27,10 @@ func (s *DataStore) Set(key string, value interface{}) error {
 	return s.InternalDataStore.Set(key, value)
 }
 
+func (s *DataStore) SetWithTTL(key string, value interface{}, ttl time.Duration) error {
+	return s.InternalDataStore.SetWithTTL(key, value, ttl)
+}
+
 func (s *DataStore) Get(key string) (interface{}, error) {
 	return s.InternalDataStore.Get(key)
 }
@@ -28,10 +43,488 @@ func (s *DataStore) GetAll() map[string]interface{} {
 	return s.InternalDataStore.GetAll()
 }
 
+// Scan returns about count keys, starting at cursor, along with the cursor of the next call, zero once
+// every key was returned. Start with cursor zero; every key present during the whole scan is returned once.
+func (s *DataStore) Scan(cursor uint64, count int) (uint64, []string) {
+	return s.InternalDataStore.Scan(cursor, count)
+}
+
+func (s *DataStore) Keys() []string {
+	return s.InternalDataStore.Keys()
+}
+
+func (s *DataStore) DBSize() int {
+	return s.InternalDataStore.DBSize()
+}
+
+func (s *DataStore) Exists(keys ...string) int {
+	return s.InternalDataStore.Exists(keys...)
+}
+
+func (s *DataStore) Type(key string) string {
+	return s.InternalDataStore.Type(key)
+}
+
 func (s *DataStore) Update(key string, value interface{}) error {
 	return s.InternalDataStore.Update(key, value)
 }
 
+func (s *DataStore) IncrBy(key string, increment int64) (int64, error) {
+	return s.InternalDataStore.IncrBy(key, increment)
+}
+
+func (s *DataStore) IncrByFloat(key string, increment float64) (float64, error) {
+	return s.InternalDataStore.IncrByFloat(key, increment)
+}
+
+// SetOptions are the conditions and expiry of SetWithOptions, like the options of SET.
+type SetOptions = datastore.SetOptions
+
+// SetWithOptions stores value under key whether the key exists or not, unless opts say otherwise, and
+// returns the value replaced, if any, and whether value was stored.
+func (s *DataStore) SetWithOptions(key string, value interface{}, opts SetOptions) (interface{}, bool, error) {
+	return s.InternalDataStore.SetWithOptions(key, value, opts)
+}
+
+func (s *DataStore) GetDel(key string) (interface{}, error) {
+	return s.InternalDataStore.GetDel(key)
+}
+
+// KeyValue is a key along with the value MSet and MSetNX store under it.
+type KeyValue = datastore.KeyValue
+
+func (s *DataStore) MGet(keys ...string) []interface{} {
+	return s.InternalDataStore.MGet(keys...)
+}
+
+// MSet stores every pair, or none of them when one is invalid or the datastore is out of memory.
+func (s *DataStore) MSet(pairs ...KeyValue) error {
+	return s.InternalDataStore.MSet(pairs...)
+}
+
+// MSetNX stores every pair when none of the keys exist, and reports whether it did.
+func (s *DataStore) MSetNX(pairs ...KeyValue) (bool, error) {
+	return s.InternalDataStore.MSetNX(pairs...)
+}
+
+func (s *DataStore) Del(keys ...string) int {
+	return s.InternalDataStore.Del(keys...)
+}
+
+func (s *DataStore) GetVersion(key string) (interface{}, uint64, error) {
+	return s.InternalDataStore.GetVersion(key)
+}
+
+// CompareAndSwap stores value under key only when the key is at version, as returned by GetVersion, or
+// does not exist when version is zero, and returns the new version.
+func (s *DataStore) CompareAndSwap(key string, version uint64, value interface{}, ttl time.Duration) (uint64, error) {
+	return s.InternalDataStore.CompareAndSwap(key, version, value, ttl)
+}
+
+// Txn runs fn while every other caller of the datastore waits, so that fn applies several reads and
+// writes atomically through tx. When fn returns an error, its writes are undone. fn must only use the
+// datastore through tx, and not once it returns.
+func (s *DataStore) Txn(fn func(tx *DataStore) error) error {
+	return s.InternalDataStore.Txn(nil, func(tx *datastore.DataStore) error {
+		return fn(&DataStore{InternalDataStore: tx})
+	})
+}
+
+// Watch starts watching keys for Exec, and must be released once done, by Exec or Watch.Release.
+func (s *DataStore) Watch(keys ...string) *Watch {
+	return s.InternalDataStore.Watch(keys...)
+}
+
+// Exec runs fn like Txn, except that the writes of fn are never undone, like EXEC. When w is not nil,
+// fn only runs if none of the keys watched by w was written since, otherwise Exec returns an error.
+func (s *DataStore) Exec(w *Watch, fn func(tx *DataStore)) error {
+	return s.InternalDataStore.Exec(w, func(tx *datastore.DataStore) {
+		fn(&DataStore{InternalDataStore: tx})
+	})
+}
+
 func (s *DataStore) FlushAll() error {
 	return s.InternalDataStore.FlushAll()
 }
+
+func (s *DataStore) Expire(key string, ttl time.Duration) error {
+	return s.InternalDataStore.Expire(key, ttl)
+}
+
+func (s *DataStore) ExpireAt(key string, deadline time.Time) error {
+	return s.InternalDataStore.ExpireAt(key, deadline)
+}
+
+func (s *DataStore) TTL(key string) (time.Duration, error) {
+	return s.InternalDataStore.TTL(key)
+}
+
+func (s *DataStore) Persist(key string) (bool, error) {
+	return s.InternalDataStore.Persist(key)
+}
+
+func (s *DataStore) StartExpirationCycle() (stop func()) {
+	return s.InternalDataStore.StartExpirationCycle()
+}
+
+func (s *DataStore) SetLimits(limits datastore.Limits) error {
+	return s.InternalDataStore.SetLimits(limits)
+}
+
+func (s *DataStore) Limits() datastore.Limits {
+	return s.InternalDataStore.Limits()
+}
+
+func (s *DataStore) UsedMemory() int64 {
+	return s.InternalDataStore.UsedMemory()
+}
+
+// ApplyConfig bounds the datastore with the limits and eviction policy of the store configuration.
+// Settings missing from the configuration keep their default value.
+func (s *DataStore) ApplyConfig() error {
+	storeConfig, err := config.GetConfigByField("Store")
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(storeConfig)
+	limits := datastore.DefaultLimits()
+
+	if maxSize := v.FieldByName("MaxSize").String(); maxSize != "" {
+		if limits.MaxMemory, err = config.ParseSize(maxSize); err != nil {
+			return err
+		}
+	}
+	if maxEntries := int(v.FieldByName("MaxAllowedEntries").Int()); maxEntries > 0 {
+		limits.MaxEntries = maxEntries
+	}
+	if limits.MaxKeyAge, err = config.ParseDuration(v.FieldByName("MaxKeyAge").String()); err != nil {
+		return err
+	}
+	if policy := v.FieldByName("EvictionPolicy").String(); policy != "" {
+		if limits.Policy, err = datastore.ParseEvictionPolicy(policy); err != nil {
+			return err
+		}
+	}
+
+	return s.SetLimits(limits)
+}
+
+// Propagator receives every write applied to the datastore as a command that replays it with Apply.
+type Propagator = datastore.Propagator
+
+// Limits bounds the memory and number of keys of the datastore.
+type Limits = datastore.Limits
+
+// Entry is a key of the datastore along with its value and deadline.
+type Entry = datastore.Entry
+
+// Watch tracks writes to keys, so that Exec only runs when none of them was written since.
+type Watch = datastore.Watch
+
+func (s *DataStore) AddPropagator(p Propagator) {
+	s.InternalDataStore.AddPropagator(p)
+}
+
+func (s *DataStore) Snapshot(barrier func()) []Entry {
+	return s.InternalDataStore.Snapshot(barrier)
+}
+
+// SnapshotIterator walks a point-in-time view of the datastore without blocking writers.
+type SnapshotIterator = datastore.SnapshotIterator
+
+func (s *DataStore) IterateSnapshot(barrier func()) *SnapshotIterator {
+	return s.InternalDataStore.IterateSnapshot(barrier)
+}
+
+func (s *DataStore) Apply(args []string) error {
+	return s.InternalDataStore.Apply(args)
+}
+
+func (s *DataStore) ApplyThen(args []string, then func()) error {
+	return s.InternalDataStore.ApplyThen(args, then)
+}
+
+func (s *DataStore) Restore(entries ...Entry) {
+	s.InternalDataStore.Restore(entries...)
+}
+
+func (s *DataStore) Dirty() int64 {
+	return s.InternalDataStore.Dirty()
+}
+
+func (s *DataStore) ClearDirty(n int64) {
+	s.InternalDataStore.ClearDirty(n)
+}
+
+func (s *DataStore) Reset(entries ...Entry) {
+	s.InternalDataStore.Reset(entries...)
+}
+
+// EntryCommands returns the commands that recreate entry with Apply.
+func EntryCommands(entry Entry) [][]string {
+	return datastore.EntryCommands(entry)
+}
+
+// Stream is an append-only log of entries read by consumer groups.
+type Stream = datastore.Stream
+
+// StreamID identifies an entry of a stream.
+type StreamID = datastore.StreamID
+
+// StreamEntry is an entry of a stream.
+type StreamEntry = datastore.StreamEntry
+
+// XAddArgs are the arguments of XAdd.
+type XAddArgs = datastore.XAddArgs
+
+// StreamTrim describes how a stream is trimmed.
+type StreamTrim = datastore.StreamTrim
+
+func (s *DataStore) XAdd(key string, args XAddArgs) (StreamID, error) {
+	return s.InternalDataStore.XAdd(key, args)
+}
+
+func (s *DataStore) XTrim(key string, trim StreamTrim) (int, error) {
+	return s.InternalDataStore.XTrim(key, trim)
+}
+
+func (s *DataStore) XLen(key string) (int, error) {
+	return s.InternalDataStore.XLen(key)
+}
+
+func (s *DataStore) XRange(key string, start, end StreamID, count int, reverse bool) ([]StreamEntry, error) {
+	return s.InternalDataStore.XRange(key, start, end, count, reverse)
+}
+
+func (s *DataStore) XRead(key string, after StreamID, count int) ([]StreamEntry, error) {
+	return s.InternalDataStore.XRead(key, after, count)
+}
+
+func (s *DataStore) XLastID(key string) (StreamID, error) {
+	return s.InternalDataStore.XLastID(key)
+}
+
+func (s *DataStore) XGroupCreate(key, group string, id StreamID, last bool, mkStream bool) error {
+	return s.InternalDataStore.XGroupCreate(key, group, id, last, mkStream)
+}
+
+func (s *DataStore) XGroupDestroy(key, group string) (bool, error) {
+	return s.InternalDataStore.XGroupDestroy(key, group)
+}
+
+func (s *DataStore) XReadGroup(key, group, consumer string, count int, noAck bool) ([]StreamEntry, error) {
+	return s.InternalDataStore.XReadGroup(key, group, consumer, count, noAck)
+}
+
+func (s *DataStore) XReadGroupHistory(key, group, consumer string, after StreamID, count int) ([]StreamEntry, error) {
+	return s.InternalDataStore.XReadGroupHistory(key, group, consumer, after, count)
+}
+
+func (s *DataStore) XAck(key, group string, ids []StreamID) (int, error) {
+	return s.InternalDataStore.XAck(key, group, ids)
+}
+
+func (s *DataStore) XPending(key, group string) (datastore.PendingSummary, error) {
+	return s.InternalDataStore.XPending(key, group)
+}
+
+func (s *DataStore) XPendingRange(key, group string, start, end StreamID, count int, consumer string, minIdle time.Duration) ([]datastore.PendingEntry, error) {
+	return s.InternalDataStore.XPendingRange(key, group, start, end, count, consumer, minIdle)
+}
+
+func (s *DataStore) XClaim(key, group, consumer string, minIdle time.Duration, ids []StreamID, justID bool) ([]StreamEntry, error) {
+	return s.InternalDataStore.XClaim(key, group, consumer, minIdle, ids, justID)
+}
+
+func (s *DataStore) WaitForKeys(keys ...string) (written <-chan struct{}, cancel func()) {
+	return s.InternalDataStore.WaitForKeys(keys...)
+}
+
+// List is a sequence of strings that grows and shrinks at both ends.
+type List = datastore.List
+
+// ListSide is an end of a list.
+type ListSide = datastore.ListSide
+
+const (
+	ListLeft  = datastore.ListLeft
+	ListRight = datastore.ListRight
+)
+
+// NewList returns a list holding values.
+func NewList(values ...string) *List {
+	return datastore.NewList(values...)
+}
+
+func (s *DataStore) LPush(key string, values ...string) (int, error) {
+	return s.InternalDataStore.LPush(key, values...)
+}
+
+func (s *DataStore) RPush(key string, values ...string) (int, error) {
+	return s.InternalDataStore.RPush(key, values...)
+}
+
+func (s *DataStore) LPop(key string, count int) ([]string, error) {
+	return s.InternalDataStore.LPop(key, count)
+}
+
+func (s *DataStore) RPop(key string, count int) ([]string, error) {
+	return s.InternalDataStore.RPop(key, count)
+}
+
+func (s *DataStore) LLen(key string) (int, error) {
+	return s.InternalDataStore.LLen(key)
+}
+
+func (s *DataStore) LRange(key string, start, stop int) ([]string, error) {
+	return s.InternalDataStore.LRange(key, start, stop)
+}
+
+func (s *DataStore) LIndex(key string, index int) (string, bool, error) {
+	return s.InternalDataStore.LIndex(key, index)
+}
+
+func (s *DataStore) LSet(key string, index int, value string) error {
+	return s.InternalDataStore.LSet(key, index, value)
+}
+
+func (s *DataStore) LTrim(key string, start, stop int) error {
+	return s.InternalDataStore.LTrim(key, start, stop)
+}
+
+func (s *DataStore) LMove(src, dst string, from, to ListSide) (string, bool, error) {
+	return s.InternalDataStore.LMove(src, dst, from, to)
+}
+
+// Hash maps fields to string values under a single key.
+type Hash = datastore.Hash
+
+// NewHash returns a hash holding fieldValues, a list of field-value pairs.
+func NewHash(fieldValues ...string) *Hash {
+	return datastore.NewHash(fieldValues...)
+}
+
+func (s *DataStore) HSet(key string, fieldValues ...string) (int, error) {
+	return s.InternalDataStore.HSet(key, fieldValues...)
+}
+
+func (s *DataStore) HGet(key, field string) (string, bool, error) {
+	return s.InternalDataStore.HGet(key, field)
+}
+
+func (s *DataStore) HMGet(key string, fields ...string) ([]interface{}, error) {
+	return s.InternalDataStore.HMGet(key, fields...)
+}
+
+func (s *DataStore) HGetAll(key string) (map[string]string, error) {
+	return s.InternalDataStore.HGetAll(key)
+}
+
+func (s *DataStore) HDel(key string, fields ...string) (int, error) {
+	return s.InternalDataStore.HDel(key, fields...)
+}
+
+func (s *DataStore) HIncrBy(key, field string, increment int64) (int64, error) {
+	return s.InternalDataStore.HIncrBy(key, field, increment)
+}
+
+func (s *DataStore) HExists(key, field string) (bool, error) {
+	return s.InternalDataStore.HExists(key, field)
+}
+
+func (s *DataStore) HLen(key string) (int, error) {
+	return s.InternalDataStore.HLen(key)
+}
+
+func (s *DataStore) HScan(key string, cursor uint64, count int) (uint64, []string, error) {
+	return s.InternalDataStore.HScan(key, cursor, count)
+}
+
+// Set is an unordered collection of unique strings.
+type Set = datastore.Set
+
+// NewSet returns a set holding members.
+func NewSet(members ...string) *Set {
+	return datastore.NewSet(members...)
+}
+
+func (s *DataStore) SAdd(key string, members ...string) (int, error) {
+	return s.InternalDataStore.SAdd(key, members...)
+}
+
+func (s *DataStore) SRem(key string, members ...string) (int, error) {
+	return s.InternalDataStore.SRem(key, members...)
+}
+
+func (s *DataStore) SMembers(key string) ([]string, error) {
+	return s.InternalDataStore.SMembers(key)
+}
+
+func (s *DataStore) SIsMember(key, member string) (bool, error) {
+	return s.InternalDataStore.SIsMember(key, member)
+}
+
+func (s *DataStore) SCard(key string) (int, error) {
+	return s.InternalDataStore.SCard(key)
+}
+
+func (s *DataStore) SInter(keys ...string) ([]string, error) {
+	return s.InternalDataStore.SInter(keys...)
+}
+
+func (s *DataStore) SUnion(keys ...string) ([]string, error) {
+	return s.InternalDataStore.SUnion(keys...)
+}
+
+func (s *DataStore) SDiff(keys ...string) ([]string, error) {
+	return s.InternalDataStore.SDiff(keys...)
+}
+
+// SortedSet is a set of unique strings ordered by score.
+type SortedSet = datastore.SortedSet
+
+// ZMember is a member of a sorted set along with its score.
+type ZMember = datastore.ZMember
+
+// ZAddFlags are the options of ZAdd.
+type ZAddFlags = datastore.ZAddFlags
+
+// ScoreBound is the minimum or maximum of a score range.
+type ScoreBound = datastore.ScoreBound
+
+// NewSortedSet returns a sorted set holding members.
+func NewSortedSet(members ...ZMember) *SortedSet {
+	return datastore.NewSortedSet(members...)
+}
+
+func (s *DataStore) ZAdd(key string, flags ZAddFlags, members ...ZMember) (int, error) {
+	return s.InternalDataStore.ZAdd(key, flags, members...)
+}
+
+func (s *DataStore) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	return s.InternalDataStore.ZIncrBy(key, increment, member)
+}
+
+func (s *DataStore) ZRem(key string, members ...string) (int, error) {
+	return s.InternalDataStore.ZRem(key, members...)
+}
+
+func (s *DataStore) ZScore(key, member string) (float64, bool, error) {
+	return s.InternalDataStore.ZScore(key, member)
+}
+
+func (s *DataStore) ZCard(key string) (int, error) {
+	return s.InternalDataStore.ZCard(key)
+}
+
+func (s *DataStore) ZRank(key, member string, reverse bool) (int, bool, error) {
+	return s.InternalDataStore.ZRank(key, member, reverse)
+}
+
+func (s *DataStore) ZRange(key string, start, stop int, reverse bool) ([]ZMember, error) {
+	return s.InternalDataStore.ZRange(key, start, stop, reverse)
+}
+
+func (s *DataStore) ZRangeByScore(key string, min, max ScoreBound, reverse bool, offset, count int) ([]ZMember, error) {
+	return s.InternalDataStore.ZRangeByScore(key, min, max, reverse, offset, count)
+}
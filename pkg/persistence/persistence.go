@@ -1,32 +1,114 @@
 package persistence
 
 import (
-    "errors"
+	"errors"
+	"io"
 
-    "github.com/AbdessamadEnabih/Vertex/internal/persistence"
-    "github.com/AbdessamadEnabih/Vertex/pkg/datastore"
-    logger "github.com/AbdessamadEnabih/Vertex/pkg/logger"
+	"github.com/AbdessamadEnabih/Vertex/internal/broker/queue"
+	"github.com/AbdessamadEnabih/Vertex/internal/persistence"
+	"github.com/AbdessamadEnabih/Vertex/pkg/datastore"
+	logger "github.com/AbdessamadEnabih/Vertex/pkg/logger"
 )
 
 func Save(datastore *datastore.DataStore) error {
-    if err := persistence.Save(datastore); err != nil {
-        logger.Log("persistence.Save: Error saving datastore: "+err.Error(), "Error")
-        return err
-    }
-    return nil
+	if err := persistence.Save(datastore); err != nil {
+		logger.Log("persistence.Save: Error saving datastore: "+err.Error(), "Error")
+		return err
+	}
+	return nil
 }
 
 func Load() (*datastore.DataStore, error) {
-    DataStore, err := persistence.Load()
-    if err != nil {
-        logger.Log("persistence.Load: Error loading datastore: "+err.Error(), "Error")
-        return nil, err
-    }
-
-    if DataStore == nil {
-        logger.Log("persistence.Load: Error: DataStore is nil", "Error")
-        return nil, errors.New("datastore is nil")
-    }
-
-    return DataStore, nil
+	DataStore, err := persistence.Load()
+	if err != nil {
+		logger.Log("persistence.Load: Error loading datastore: "+err.Error(), "Error")
+		return nil, err
+	}
+
+	if DataStore == nil {
+		logger.Log("persistence.Load: Error: DataStore is nil", "Error")
+		return nil, errors.New("datastore is nil")
+	}
+
+	return DataStore, nil
+}
+
+// AOF is the append-only file logging every write of a datastore.
+type AOF = persistence.AOF
+
+// FsyncPolicy tells how often the append-only file is flushed to disk, see appendfsync.
+type FsyncPolicy = persistence.FsyncPolicy
+
+const (
+	FsyncAlways   = persistence.FsyncAlways
+	FsyncEverySec = persistence.FsyncEverySec
+	FsyncNo       = persistence.FsyncNo
+)
+
+// StartAppendOnly opens the append-only file and logs every write of datastore in it.
+// It returns nil when append_only is disabled in the configuration.
+func StartAppendOnly(datastore *datastore.DataStore) (*AOF, error) {
+	aof, err := persistence.StartAppendOnly(datastore)
+	if err != nil {
+		logger.Log("persistence.StartAppendOnly: Error opening append only file: "+err.Error(), "Error")
+		return nil, err
+	}
+	return aof, nil
+}
+
+// ErrRewriteInProgress is returned when a rewrite of the append-only file is already running.
+var ErrRewriteInProgress = persistence.ErrRewriteInProgress
+
+// ErrLocked is returned when the append-only file or the queue log is written by another process.
+var ErrLocked = persistence.ErrLocked
+
+// Snapshotter saves a datastore on demand or according to the configured save rules.
+type Snapshotter = persistence.Snapshotter
+
+// Errors returned by the save commands.
+var (
+	ErrSaveInProgress      = persistence.ErrSaveInProgress
+	ErrPersistenceDisabled = persistence.ErrPersistenceDisabled
+)
+
+// StartSnapshotter saves datastore according to the configured save rules.
+// It returns nil when persistence is disabled in the configuration.
+func StartSnapshotter(datastore *datastore.DataStore) (*Snapshotter, error) {
+	snapshotter, err := persistence.StartSnapshotter(datastore)
+	if err != nil {
+		logger.Log("persistence.StartSnapshotter: Error reading save rules: "+err.Error(), "Error")
+		return nil, err
+	}
+	return snapshotter, nil
+}
+
+// WriteSnapshot writes a snapshot of datastore to w, calling barrier once the point-in-time view is taken.
+func WriteSnapshot(w io.Writer, datastore *datastore.DataStore, barrier func()) error {
+	return persistence.WriteSnapshot(w, datastore, barrier)
+}
+
+// DecodeSnapshot returns the entries of a snapshot written by WriteSnapshot.
+func DecodeSnapshot(data []byte) ([]datastore.Entry, error) {
+	return persistence.DecodeSnapshot(data)
+}
+
+// LoadQueues returns the persisted queue broker, or an empty one when nothing was persisted yet.
+func LoadQueues() (*queue.Broker, error) {
+	broker, err := persistence.LoadQueues()
+	if err != nil {
+		logger.Log("persistence.LoadQueues: Error loading queues: "+err.Error(), "Error")
+		return nil, err
+	}
+	return broker, nil
+}
+
+// StartQueueLog logs every change of broker, so that queues survive a restart.
+// It returns nil when persistence is disabled in the configuration.
+func StartQueueLog(broker *queue.Broker) (*AOF, error) {
+	log, err := persistence.StartQueueLog(broker)
+	if err != nil {
+		logger.Log("persistence.StartQueueLog: Error opening queue log: "+err.Error(), "Error")
+		return nil, err
+	}
+	return log, nil
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os/signal"
+	"syscall"
 
 	"github.com/AbdessamadEnabih/Vertex/internal/network"
 	"github.com/AbdessamadEnabih/Vertex/pkg/persistence"
@@ -17,10 +20,20 @@ func main() {
 		return
 	}
 
+	// Running without the configured limits could exhaust the memory, a typo must not go unnoticed
+	if err := GlobalDataStore.ApplyConfig(); err != nil {
+		log.Fatalf("Invalid store configuration: %s", err)
+	}
+
+	// SIGTERM and SIGINT stop the server gracefully, a second one kills it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	server := network.NewServer(GlobalDataStore)
-	if err := server.Start(); err != nil {
+	if err := server.Start(ctx); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
-
-	defer persistence.Save(GlobalDataStore)
 }